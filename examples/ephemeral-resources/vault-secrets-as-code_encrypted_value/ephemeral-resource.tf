@@ -0,0 +1,16 @@
+ephemeral "random_password" "db" {
+  length = 32
+}
+
+ephemeral "vault-secrets-as-code_encrypted_value" "db_password" {
+  plaintext = ephemeral.random_password.db.result
+}
+
+resource "vault-secrets-as-code_secret" "db" {
+  path              = "app/db"
+  values_are_base64 = false
+  encrypted_secrets_wo = {
+    password = ephemeral.vault-secrets-as-code_encrypted_value.db_password.ciphertext
+  }
+  encrypted_secrets_wo_version = 1
+}
@@ -16,6 +16,9 @@ provider "vault-secrets-as-code" {
   kv_path      = "secret/"
 
   managed_by = "terraform-vault-secrets-as-code"
+
+  // the dev server only listens on http
+  allow_http = true
 }
 
 resource "vault-secrets-as-code_secret" "mysupersecret" {
@@ -1,12 +1,13 @@
 package main
 
 import (
-	"context"
 	"flag"
 	"log"
 
 	"github.com/7fELF/terraform-provider-vault-secrets-as-code/provider"
 	"github.com/hashicorp/terraform-plugin-framework/providerserver"
+	"github.com/hashicorp/terraform-plugin-go/tfprotov6"
+	"github.com/hashicorp/terraform-plugin-go/tfprotov6/tf6server"
 )
 
 //go:generate go run github.com/hashicorp/terraform-plugin-docs/cmd/tfplugindocs
@@ -19,13 +20,24 @@ func main() {
 	flag.BoolVar(&debug, "debug", false, "set to true to run the provider with support for debuggers like delve")
 	flag.Parse()
 
-	opts := providerserver.ServeOpts{
-		Address: "registry.terraform.io/7fELF/vault-secrets-as-code",
-		Debug:   debug,
+	var opts []tf6server.ServeOpt
+	if debug {
+		opts = append(opts, tf6server.WithManagedDebug())
 	}
 
-	err := providerserver.Serve(context.Background(), provider.New(version), opts)
+	// Served through the protocol server rather than providerserver.Serve so
+	// that every diagnostic is sanitized on its way out.
+	p := provider.New(version)()
+	server := providerserver.NewProtocol6(p)
+	err := tf6server.Serve(
+		"registry.terraform.io/7fELF/vault-secrets-as-code",
+		func() tfprotov6.ProviderServer { return provider.Sanitized(server()) },
+		opts...,
+	)
 	if err != nil {
 		log.Fatal(err.Error())
 	}
+
+	// Serve returns once Terraform is done with the provider.
+	provider.LogStats(p)
 }
@@ -0,0 +1,90 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/vault/api"
+)
+
+// adopt stamps our ownership marker on the existing secret at k when it has
+// none, so that it can be written over. The custom metadata of the secret is
+// merged into metadata. It returns whether the secret was adopted, and the
+// keys value overwrites or removes.
+func (r *SecretResource) adopt(ctx context.Context, k string, metadata, value map[string]any) (bool, []string, error) {
+	kv := r.kv.client.KVv2(r.kv.path)
+
+	meta, err := kv.GetMetadata(ctx, k)
+	if errors.Is(err, api.ErrSecretNotFound) {
+		return false, nil, nil
+	} else if err != nil {
+		return false, nil, err
+	}
+
+	// A secret owned by anyone, us included, is left to the ownership check.
+	if _, ok := r.kv.ownershipMarker(meta.CustomMetadata); ok {
+		return false, nil, nil
+	}
+
+	for key, v := range r.kv.carriedMetadata(meta.CustomMetadata) {
+		if _, ok := metadata[key]; !ok {
+			metadata[key] = v
+		}
+	}
+
+	var overwritten []string
+	current, err := kv.Get(ctx, k)
+	if err != nil && !errors.Is(err, api.ErrSecretNotFound) {
+		return false, nil, err
+	} else if err == nil {
+		for key, v := range current.Data {
+			if nv, ok := value[key]; !ok || !jsonEqual(nv, v) {
+				overwritten = append(overwritten, key)
+			}
+		}
+		slices.Sort(overwritten)
+	}
+
+	if err := r.kv.OverwriteManagedbyMeta(ctx, k, metadata); err != nil {
+		return false, nil, err
+	}
+	return true, overwritten, nil
+}
+
+// takeOver moves the secret at k to our ownership marker when it is owned by
+// from, keeping its custom metadata. It returns whether it was taken over,
+// any other owner is left to the ownership check.
+func (r *SecretResource) takeOver(ctx context.Context, k, from string, metadata map[string]any) (bool, error) {
+	meta, err := r.kv.client.KVv2(r.kv.path).GetMetadata(ctx, k)
+	if errors.Is(err, api.ErrSecretNotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	managedBy, ok := r.kv.ownershipMarker(meta.CustomMetadata)
+	if !ok || managedBy != from {
+		return false, nil
+	}
+
+	for key, v := range r.kv.carriedMetadata(meta.CustomMetadata) {
+		if _, ok := metadata[key]; !ok {
+			metadata[key] = v
+		}
+	}
+	if err := r.kv.OverwriteManagedbyMeta(ctx, k, metadata); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// warnTakenOver records that the secret at k was taken over from from.
+func (r *SecretResource) warnTakenOver(k, from string, diags *diag.Diagnostics) {
+	diags.AddWarning(
+		"secret taken over",
+		fmt.Sprintf("%s was managed by %s = %q, it is now managed by %q. Remove force_takeover_from once every secret has moved", r.kv.fullPath(k), r.kv.ownershipKey, from, r.kv.managedBy),
+	)
+}
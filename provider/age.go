@@ -0,0 +1,61 @@
+package provider
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+// ageIdentityEnv holds age identities, in the format of an identity file,
+// when age_identity_file is not set.
+const ageIdentityEnv = "VSAC_AGE_IDENTITY"
+
+// loadAgeIdentities returns the identities of the file at path, or of the
+// VSAC_AGE_IDENTITY environment variable when path is empty. None is not an
+// error, resources using age_encrypted_secrets then fail.
+func loadAgeIdentities(path string) ([]age.Identity, error) {
+	text := os.Getenv(ageIdentityEnv)
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		text = string(b)
+	}
+	if strings.TrimSpace(text) == "" {
+		return nil, nil
+	}
+	return age.ParseIdentities(strings.NewReader(text))
+}
+
+// ageDecrypt decrypts ciphertext, an armored age file or the base64 encoding
+// of one, with the first of identities it is encrypted to.
+func ageDecrypt(identities []age.Identity, ciphertext string) ([]byte, error) {
+	if len(identities) == 0 {
+		return nil, fmt.Errorf("no age identity is configured, set age_identity_file or %s", ageIdentityEnv)
+	}
+
+	var src io.Reader
+	s := strings.TrimSpace(ciphertext)
+	if strings.HasPrefix(s, armor.Header) {
+		src = armor.NewReader(strings.NewReader(s))
+	} else {
+		b, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(s), ""))
+		if err != nil {
+			return nil, errors.New("not an age encrypted file: expected an armored file (age --armor) or the base64 encoding of one")
+		}
+		src = strings.NewReader(string(b))
+	}
+
+	r, err := age.Decrypt(src, identities...)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
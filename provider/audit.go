@@ -0,0 +1,53 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/vault/api"
+)
+
+// auditSequence numbers the audit entries of the process, to tell apart
+// entries written within the same nanosecond.
+var auditSequence atomic.Uint64
+
+// audit records operation on target, a path including its mount, as a new
+// entry under audit_log_path. Only key names are recorded, never values.
+// Entries are created with check-and-set 0, an existing entry is never
+// overwritten. The write bypasses the ownership check so that every
+// workspace can share the log, and a failure only warns: the operation it
+// describes already happened.
+func (v vaultKV) audit(ctx context.Context, operation, target string, keys []string, version int, diags *diag.Diagnostics) {
+	if v.auditLogPath == "" {
+		return
+	}
+
+	now := time.Now().UTC()
+	keys = slices.Sorted(slices.Values(keys))
+	if keys == nil {
+		keys = []string{}
+	}
+
+	k := fmt.Sprintf("%s/%s/%s-%d", v.auditLogPath, now.Format(time.DateOnly), now.Format("150405.000000000"), auditSequence.Add(1))
+	err := v.checkWritable()
+	if err == nil {
+		_, err = v.client.KVv2(v.path).Put(ctx, k, map[string]any{
+			"operation":  operation,
+			"path":       target,
+			"keys":       keys,
+			"version":    version,
+			"timestamp":  now.Format(time.RFC3339),
+			"managed_by": v.managedBy,
+		}, api.WithCheckAndSet(0))
+	}
+	if err != nil {
+		diags.AddWarning(
+			"failed to write audit entry",
+			fmt.Sprintf("the %s of %s succeeded but it could not be recorded in %s: %s", operation, target, v.fullPath(k), errorDetail(err)),
+		)
+	}
+}
@@ -0,0 +1,313 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/datasource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	vault "github.com/hashicorp/vault/api"
+)
+
+// requiredCapabilities returns the capabilities needed on the KV paths of k,
+// by path.
+func (v vaultKV) requiredCapabilities(k string) map[string][]string {
+	mount := strings.TrimSuffix(v.path, "/")
+	if v.readOnly {
+		return map[string][]string{
+			mount + "/data/" + k:     {"read"},
+			mount + "/metadata/" + k: {"read"},
+		}
+	}
+
+	if v.forbidMetadataDelete {
+		return map[string][]string{
+			mount + "/data/" + k:     {"read", "update"},
+			mount + "/metadata/" + k: {"read", "update"},
+			mount + "/delete/" + k:   {"update"},
+		}
+	}
+
+	return map[string][]string{
+		mount + "/data/" + k:     {"read", "update"},
+		mount + "/metadata/" + k: {"read", "update", "delete"},
+	}
+}
+
+// requiredCapabilities returns the capabilities needed on the transit key, by
+// path.
+func (v vaultTransit) requiredCapabilities() map[string][]string {
+	required := map[string][]string{
+		v.path + "encrypt/" + v.key: {"update"},
+		v.path + "decrypt/" + v.key: {"update"},
+		v.path + "rewrap/" + v.key:  {"update"},
+	}
+	for _, key := range v.fallbackKeys {
+		required[v.path+"decrypt/"+key] = []string{"update"}
+	}
+	for _, r := range v.routes {
+		required[r.path+"encrypt/"+r.key] = []string{"update"}
+		required[r.path+"decrypt/"+r.key] = []string{"update"}
+		required[r.path+"rewrap/"+r.key] = []string{"update"}
+	}
+	if v.signingKey != "" {
+		required[v.path+"sign/"+v.signingKey] = []string{"update"}
+		required[v.path+"verify/"+v.signingKey] = []string{"update"}
+	}
+	return required
+}
+
+// capabilitiesSelf returns the capabilities of the client token on paths, by
+// path.
+func capabilitiesSelf(ctx context.Context, client *vault.Client, paths []string) (map[string][]string, error) {
+	s, err := client.Logical().WriteWithContext(ctx, "sys/capabilities-self", map[string]any{"paths": paths})
+	if err != nil {
+		return nil, err
+	}
+	if s == nil {
+		return nil, errors.New("empty response from sys/capabilities-self")
+	}
+
+	granted := make(map[string][]string, len(paths))
+	for _, p := range paths {
+		caps := make([]string, 0)
+		raw, _ := s.Data[p].([]any)
+		for _, c := range raw {
+			if c, ok := c.(string); ok {
+				caps = append(caps, c)
+			}
+		}
+		granted[p] = caps
+	}
+	return granted, nil
+}
+
+// grants reports whether the capabilities granted on a path allow c.
+func grants(granted []string, c string) bool {
+	if slices.Contains(granted, "root") {
+		return true
+	}
+	return slices.Contains(granted, c) && !slices.Contains(granted, "deny")
+}
+
+// missingCapabilities returns the capabilities of required the client token
+// lacks, by path.
+func missingCapabilities(ctx context.Context, client *vault.Client, required map[string][]string) (map[string][]string, error) {
+	paths := make([]string, 0, len(required))
+	for p := range required {
+		paths = append(paths, p)
+	}
+
+	granted, err := capabilitiesSelf(ctx, client, paths)
+	if err != nil {
+		return nil, err
+	}
+
+	missing := make(map[string][]string)
+	for p, caps := range required {
+		for _, c := range caps {
+			if !grants(granted[p], c) {
+				missing[p] = append(missing[p], c)
+			}
+		}
+	}
+
+	return missing, nil
+}
+
+// preflightCapabilities warns about the capabilities the tokens lack to manage
+// the secret at k, before anything is written. Failing to query the
+// capabilities is only logged, the operations themselves will report it.
+func (d ProviderData) preflightCapabilities(ctx context.Context, k string, diags *diag.Diagnostics) {
+	checks := []struct {
+		client   *vault.Client
+		required map[string][]string
+	}{
+		{d.kv.client, d.kv.requiredCapabilities(k)},
+		{d.transit.client, d.transit.requiredCapabilities()},
+	}
+
+	missing := make(map[string][]string)
+	for _, c := range checks {
+		m, err := missingCapabilities(ctx, c.client, c.required)
+		if err != nil {
+			tflog.Debug(ctx, "skipping capabilities preflight check", map[string]any{
+				"path":  k,
+				"error": errorDetail(err),
+			})
+			return
+		}
+		for p, caps := range m {
+			missing[p] = append(missing[p], caps...)
+		}
+	}
+
+	if len(missing) == 0 {
+		return
+	}
+
+	lines := make([]string, 0, len(missing))
+	for p, caps := range missing {
+		lines = append(lines, fmt.Sprintf("%s: %s", p, strings.Join(caps, ", ")))
+	}
+	sort.Strings(lines)
+
+	diags.AddWarning(
+		"missing Vault capabilities",
+		fmt.Sprintf("the token is missing capabilities needed to manage secret %q, the apply is likely to fail with permission denied:\n%s", k, strings.Join(lines, "\n")),
+	)
+}
+
+// Ensure provider defined types fully satisfy framework interfaces.
+var _ datasource.DataSource = &CapabilitiesDataSource{}
+
+func NewCapabilitiesDataSource() datasource.DataSource {
+	return &CapabilitiesDataSource{}
+}
+
+// CapabilitiesDataSource reports the capabilities of the token of a client on
+// Vault paths, e.g. for preconditions.
+type CapabilitiesDataSource struct {
+	ProviderData
+}
+
+// CapabilitiesModel describes the data source data model.
+type CapabilitiesModel struct {
+	Paths        []string     `tfsdk:"paths"`
+	Client       types.String `tfsdk:"client"`
+	Capabilities types.Map    `tfsdk:"capabilities"`
+	Unknown      types.Bool   `tfsdk:"unknown"`
+	CanRead      types.Bool   `tfsdk:"can_read"`
+	CanUpdate    types.Bool   `tfsdk:"can_update"`
+	CanDelete    types.Bool   `tfsdk:"can_delete"`
+}
+
+func (d *CapabilitiesDataSource) Metadata(ctx context.Context, req datasource.MetadataRequest, resp *datasource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_capabilities"
+}
+
+func (d *CapabilitiesDataSource) Schema(ctx context.Context, req datasource.SchemaRequest, resp *datasource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		MarkdownDescription: "Capabilities of the token of the KV or transit client on Vault paths, from `sys/capabilities-self`, e.g. to fail fast in a precondition unless the token can update a path. A token denied `sys/capabilities-self` is not an error, `unknown` is true.",
+		Attributes: map[string]schema.Attribute{
+			"paths": schema.ListAttribute{
+				ElementType: types.StringType,
+				Required:    true,
+				Description: "Vault API paths to look up, including the mount, e.g. \"secret/data/app\"",
+			},
+			"client": schema.StringAttribute{
+				Optional:    true,
+				Description: "Client whose token is looked up, \"kv\" or \"transit\", defaults to \"kv\"",
+				Validators:  []validator.String{oneOfValidator{values: []string{"kv", "transit"}}},
+			},
+			"capabilities": schema.MapAttribute{
+				ElementType: types.ListType{ElemType: types.StringType},
+				Computed:    true,
+				Description: "Capabilities of the token, by path, null when `unknown`",
+			},
+			"unknown": schema.BoolAttribute{
+				Computed:    true,
+				Description: "Whether the token could not look its capabilities up, e.g. as its policies do not grant `sys/capabilities-self`",
+			},
+			"can_read": schema.BoolAttribute{
+				Computed:    true,
+				Description: "Whether the token can read every path, false when `unknown`",
+			},
+			"can_update": schema.BoolAttribute{
+				Computed:    true,
+				Description: "Whether the token can update every path, false when `unknown`",
+			},
+			"can_delete": schema.BoolAttribute{
+				Computed:    true,
+				Description: "Whether the token can delete every path, false when `unknown`",
+			},
+		},
+	}
+}
+
+func (d *CapabilitiesDataSource) Configure(ctx context.Context, req datasource.ConfigureRequest, resp *datasource.ConfigureResponse) {
+	// Prevent panic if the provider has not been configured.
+	if req.ProviderData == nil {
+		return
+	}
+
+	providerData, ok := req.ProviderData.(ProviderData)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Data Source Configure Type",
+			fmt.Sprintf("Expected ProviderData, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+		)
+		return
+	}
+
+	d.ProviderData = providerData
+}
+
+func (d *CapabilitiesDataSource) Read(ctx context.Context, req datasource.ReadRequest, resp *datasource.ReadResponse) {
+	var data CapabilitiesModel
+	resp.Diagnostics.Append(req.Config.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	// No path would grant everything.
+	if len(data.Paths) == 0 {
+		resp.Diagnostics.AddAttributeError(path.Root("paths"), "no path", "paths must hold at least one path")
+		return
+	}
+
+	client := d.kv.client
+	if data.Client.ValueString() == "transit" {
+		client = d.transit.client
+	}
+
+	capsType := types.ListType{ElemType: types.StringType}
+	data.Capabilities = types.MapNull(capsType)
+	data.Unknown = types.BoolValue(false)
+	data.CanRead = types.BoolValue(false)
+	data.CanUpdate = types.BoolValue(false)
+	data.CanDelete = types.BoolValue(false)
+
+	granted, err := capabilitiesSelf(ctx, client, data.Paths)
+	switch class := classifyError(err); {
+	case err == nil:
+	case class == errorClassDenied, class == errorClassNotFound:
+		tflog.Debug(ctx, "cannot look the token capabilities up", map[string]any{"error": errorDetail(err)})
+		data.Unknown = types.BoolValue(true)
+		resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+		return
+	default:
+		resp.Diagnostics.AddError("failed to look the token capabilities up", errorDetail(err))
+		return
+	}
+
+	capabilities, diags := types.MapValueFrom(ctx, capsType, granted)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	data.Capabilities = capabilities
+
+	can := func(c string) bool {
+		for _, p := range data.Paths {
+			if !grants(granted[p], c) {
+				return false
+			}
+		}
+		return true
+	}
+	data.CanRead = types.BoolValue(can("read"))
+	data.CanUpdate = types.BoolValue(can("update"))
+	data.CanDelete = types.BoolValue(can("delete"))
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
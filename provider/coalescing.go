@@ -0,0 +1,181 @@
+package provider
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	"github.com/hashicorp/vault/api"
+)
+
+const (
+	// coalescingWindow is how long a decryption waits for others to share
+	// its transit call.
+	coalescingWindow = 20 * time.Millisecond
+	// defaultCoalescingMaxItems is the default transit_batch_size.
+	defaultCoalescingMaxItems = 128
+)
+
+// decryptCoalescer merges the decryptions requested by concurrent resource
+// operations into transit batch_input calls, one per key. Enabled with
+// transit_request_coalescing.
+type decryptCoalescer struct {
+	// transit sends the calls, it must not coalesce itself.
+	transit vaultTransit
+	// maxItems caps the number of ciphertexts sent in one call.
+	maxItems int
+
+	mu      sync.Mutex
+	pending map[string]*decryptBatch
+}
+
+type decryptBatch struct {
+	key   string
+	items []decryptItem
+}
+
+type decryptItem struct {
+	ciphertext string
+	keyContext string
+	result     chan decryptResult
+}
+
+type decryptResult struct {
+	plaintext sensitive
+	err       error
+}
+
+func newDecryptCoalescer(transit vaultTransit, maxItems int) *decryptCoalescer {
+	return &decryptCoalescer{
+		transit:  transit,
+		maxItems: maxItems,
+		pending:  make(map[string]*decryptBatch),
+	}
+}
+
+// decrypt queues ciphertext in the pending batch of key and waits for its
+// result.
+func (c *decryptCoalescer) decrypt(ctx context.Context, key, ciphertext, keyContext string) (sensitive, error) {
+	item := decryptItem{
+		ciphertext: ciphertext,
+		keyContext: keyContext,
+		// Buffered so flushing never blocks on a caller that gave up.
+		result: make(chan decryptResult, 1),
+	}
+
+	c.mu.Lock()
+	batch, ok := c.pending[key]
+	if !ok {
+		batch = &decryptBatch{key: key}
+		c.pending[key] = batch
+		time.AfterFunc(coalescingWindow, func() { c.flush(ctx, batch) })
+	}
+	batch.items = append(batch.items, item)
+	if len(batch.items) >= c.maxItems {
+		// Full batches leave pending right away, the next decryption
+		// opens a new one.
+		delete(c.pending, key)
+		go c.send(ctx, batch)
+	}
+	c.mu.Unlock()
+
+	select {
+	case res := <-item.result:
+		return res.plaintext, res.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+// flush sends batch unless it was already sent.
+func (c *decryptCoalescer) flush(ctx context.Context, batch *decryptBatch) {
+	c.mu.Lock()
+	if c.pending[batch.key] != batch {
+		c.mu.Unlock()
+		return
+	}
+	delete(c.pending, batch.key)
+	c.mu.Unlock()
+
+	c.send(ctx, batch)
+}
+
+// send decrypts the items of batch, which must not be pending anymore. The
+// call runs with the context of the caller that opened the batch, without its
+// cancellation, so one caller giving up does not fail the others.
+func (c *decryptCoalescer) send(ctx context.Context, batch *decryptBatch) {
+	ctx = context.WithoutCancel(ctx)
+	if len(batch.items) == 1 {
+		item := batch.items[0]
+		plaintext, err := c.transit.decryptWith(ctx, batch.key, item.ciphertext, item.keyContext)
+		item.result <- decryptResult{plaintext: plaintext, err: err}
+		return
+	}
+
+	tflog.Debug(ctx, "coalesced transit decryptions", map[string]any{"key": batch.key, "items": len(batch.items)})
+
+	results, err := c.decryptBatch(ctx, batch)
+	if err != nil {
+		// Vault fails the whole call when every item fails, decrypt them
+		// one by one so each caller gets its own error.
+		for _, item := range batch.items {
+			plaintext, err := c.transit.decryptWith(ctx, batch.key, item.ciphertext, item.keyContext)
+			item.result <- decryptResult{plaintext: plaintext, err: err}
+		}
+		return
+	}
+
+	for i, item := range batch.items {
+		item.result <- results[i]
+	}
+}
+
+// decryptBatch decrypts the items of batch in a single call, per item
+// errors are reported like the error of a single decryption.
+func (c *decryptCoalescer) decryptBatch(ctx context.Context, batch *decryptBatch) ([]decryptResult, error) {
+	input := make([]map[string]any, 0, len(batch.items))
+	for _, item := range batch.items {
+		in := map[string]any{"ciphertext": item.ciphertext}
+		if item.keyContext != "" {
+			in["context"] = base64.StdEncoding.EncodeToString([]byte(item.keyContext))
+		}
+		input = append(input, in)
+	}
+
+	s, err := c.transit.client.Logical().WriteWithContext(ctx, c.transit.path+"decrypt/"+batch.key, map[string]any{"batch_input": input})
+	if err != nil {
+		return nil, err
+	}
+
+	raw, _ := s.Data["batch_results"].([]any)
+	if len(raw) != len(batch.items) {
+		return nil, fmt.Errorf("transit returned %d batch results for %d ciphertexts", len(raw), len(batch.items))
+	}
+
+	results := make([]decryptResult, len(raw))
+	for i, r := range raw {
+		r, _ := r.(map[string]any)
+		if msg, _ := r["error"].(string); msg != "" {
+			results[i].err = &api.ResponseError{
+				HTTPMethod: http.MethodPut,
+				URL:        c.transit.path + "decrypt/" + batch.key,
+				StatusCode: http.StatusBadRequest,
+				Errors:     []string{msg},
+			}
+			continue
+		}
+
+		plaintext, ok := r["plaintext"].(string)
+		if !ok {
+			results[i].err = fmt.Errorf("the value of the decrypted secret is not a string")
+			continue
+		}
+		results[i].plaintext = sensitive(plaintext)
+	}
+
+	return results, nil
+}
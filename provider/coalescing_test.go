@@ -0,0 +1,88 @@
+package provider
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// TestDecryptCoalescerBatchSize decrypts more ciphertexts at once than the
+// batch size: they are split into calls of at most that many, and every
+// caller gets its own plaintext.
+func TestDecryptCoalescerBatchSize(t *testing.T) {
+	const batchSize, decryptions = 5, 23
+	ctx := context.Background()
+	s := newTestVaultServer(t)
+
+	var mu sync.Mutex
+	var batches []int
+	s.inspect = func(p string, body map[string]any) {
+		if p != "transit/decrypt/vsac" {
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if input, ok := body["batch_input"].([]any); ok {
+			batches = append(batches, len(input))
+		} else {
+			batches = append(batches, 1)
+		}
+	}
+
+	client, err := newClient(ctx, s.vaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	transit := vaultTransit{
+		client:                client,
+		path:                  "transit/",
+		key:                   "vsac",
+		decryptedWith:         &sync.Map{},
+		minDecryptionVersions: &sync.Map{},
+	}
+	transit.coalescer = newDecryptCoalescer(transit, batchSize)
+
+	ciphertexts := make([]string, decryptions)
+	for i := range ciphertexts {
+		if ciphertexts[i], err = transit.Encrypt(ctx, fmt.Sprintf("secret-%d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i, ciphertext := range ciphertexts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			plaintext, err := transit.Decrypt(ctx, ciphertext)
+			if err != nil {
+				t.Errorf("decryption %d: %s", i, err)
+				return
+			}
+			// Transit plaintexts are base64.
+			if want := base64.StdEncoding.EncodeToString(fmt.Appendf(nil, "secret-%d", i)); plaintext.reveal() != want {
+				t.Errorf("decryption %d returned %q, expected %q", i, plaintext.reveal(), want)
+			}
+		}()
+	}
+	wg.Wait()
+
+	total, full := 0, 0
+	for _, n := range batches {
+		if n > batchSize {
+			t.Errorf("a call carried %d ciphertexts, more than the batch size %d", n, batchSize)
+		}
+		if n == batchSize {
+			full++
+		}
+		total += n
+	}
+	if total != decryptions {
+		t.Fatalf("%d ciphertexts sent in %v, expected %d", total, batches, decryptions)
+	}
+	if full == 0 {
+		t.Fatalf("no call carried a full batch: %v", batches)
+	}
+}
@@ -0,0 +1,151 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/datasource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/vault/api"
+)
+
+// Ensure provider defined types fully satisfy framework interfaces.
+var _ datasource.DataSource = &DriftDataSource{}
+
+func NewDriftDataSource() datasource.DataSource {
+	return &DriftDataSource{}
+}
+
+// DriftDataSource compares ciphertexts against the live secret, it only
+// reads and decrypts.
+type DriftDataSource struct {
+	ProviderData
+}
+
+// DriftModel describes the data source data model.
+type DriftModel struct {
+	Path             string            `tfsdk:"path"`
+	EncryptedSecrets map[string]string `tfsdk:"encrypted_secrets"`
+	InSync           types.Bool        `tfsdk:"in_sync"`
+	ChangedKeys      []string          `tfsdk:"changed_keys"`
+	MissingKeys      []string          `tfsdk:"missing_keys"`
+	ExtraKeys        []string          `tfsdk:"extra_keys"`
+}
+
+func (d *DriftDataSource) Metadata(ctx context.Context, req datasource.MetadataRequest, resp *datasource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_drift"
+}
+
+func (d *DriftDataSource) Schema(ctx context.Context, req datasource.SchemaRequest, resp *datasource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		MarkdownDescription: "Compares the values of a secret with ciphertexts, e.g. to check on a schedule that Vault still holds what the configuration says. " +
+			"Only reading the secret and decrypting with the transit key are needed, and only key names are reported. A missing secret is not an error, all its keys are missing.",
+		Attributes: map[string]schema.Attribute{
+			"path": schema.StringAttribute{
+				Required:    true,
+				Description: "Path of the secret, relative to `path_prefix`",
+			},
+			"encrypted_secrets": schema.MapAttribute{
+				Required:    true,
+				ElementType: types.StringType,
+				Description: "Expected values of the secret, encrypted with the transit key, as in the `secret` resource",
+			},
+			"in_sync": schema.BoolAttribute{
+				Computed:    true,
+				Description: "Whether the secret holds exactly the expected keys and values",
+			},
+			"changed_keys": schema.ListAttribute{
+				Computed:    true,
+				ElementType: types.StringType,
+				Description: "Keys whose live value differs from the expected one, sorted",
+			},
+			"missing_keys": schema.ListAttribute{
+				Computed:    true,
+				ElementType: types.StringType,
+				Description: "Expected keys the secret does not have, sorted",
+			},
+			"extra_keys": schema.ListAttribute{
+				Computed:    true,
+				ElementType: types.StringType,
+				Description: "Keys of the secret that are not expected, sorted",
+			},
+		},
+	}
+}
+
+func (d *DriftDataSource) Configure(ctx context.Context, req datasource.ConfigureRequest, resp *datasource.ConfigureResponse) {
+	// Prevent panic if the provider has not been configured.
+	if req.ProviderData == nil {
+		return
+	}
+
+	providerData, ok := req.ProviderData.(ProviderData)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Data Source Configure Type",
+			fmt.Sprintf("Expected ProviderData, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+		)
+		return
+	}
+
+	d.ProviderData = providerData
+}
+
+func (d *DriftDataSource) Read(ctx context.Context, req datasource.ReadRequest, resp *datasource.ReadResponse) {
+	var data DriftModel
+	resp.Diagnostics.Append(req.Config.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	secretPath := d.kv.secretPath(data.Path)
+	d.kv.checkPathAllowed(secretPath, path.Root("path"), &resp.Diagnostics)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	var live map[string]any
+	secret, err := d.kv.client.KVv2(d.kv.path).Get(ctx, secretPath)
+	if err == nil {
+		live = secret.Data
+	} else if !errors.Is(err, api.ErrSecretNotFound) {
+		resp.Diagnostics.AddError("failed to get secret", errorDetail(err))
+		return
+	}
+
+	data.ChangedKeys, data.MissingKeys, data.ExtraKeys = []string{}, []string{}, []string{}
+	for k, ciphertext := range data.EncryptedSecrets {
+		value, ok := live[k]
+		if !ok {
+			data.MissingKeys = append(data.MissingKeys, k)
+			continue
+		}
+
+		// Values are compared as written by the secret resource, never
+		// reported.
+		plaintext, err := d.transit.Decrypt(ctx, ciphertext)
+		if err != nil {
+			resp.Diagnostics.AddAttributeError(path.Root("encrypted_secrets").AtMapKey(k), "failed to decrypt secret", errorDetail(err))
+			return
+		}
+		if s, ok := value.(string); !ok || s != plaintext.reveal() {
+			data.ChangedKeys = append(data.ChangedKeys, k)
+		}
+	}
+	for k := range live {
+		if _, ok := data.EncryptedSecrets[k]; !ok {
+			data.ExtraKeys = append(data.ExtraKeys, k)
+		}
+	}
+	slices.Sort(data.ChangedKeys)
+	slices.Sort(data.MissingKeys)
+	slices.Sort(data.ExtraKeys)
+
+	data.InSync = types.BoolValue(len(data.ChangedKeys) == 0 && len(data.MissingKeys) == 0 && len(data.ExtraKeys) == 0)
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
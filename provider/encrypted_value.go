@@ -0,0 +1,102 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-framework/ephemeral"
+	"github.com/hashicorp/terraform-plugin-framework/ephemeral/schema"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+// Ensure provider defined types fully satisfy framework interfaces.
+var (
+	_ ephemeral.EphemeralResource              = &EncryptedValueEphemeralResource{}
+	_ ephemeral.EphemeralResourceWithConfigure = &EncryptedValueEphemeralResource{}
+)
+
+func NewEncryptedValueEphemeralResource() ephemeral.EphemeralResource {
+	return &EncryptedValueEphemeralResource{}
+}
+
+// EncryptedValueEphemeralResource encrypts an apply-time value with transit,
+// so the plaintext never enters the state.
+type EncryptedValueEphemeralResource struct {
+	ProviderData
+}
+
+// EncryptedValueModel describes the ephemeral resource data model.
+type EncryptedValueModel struct {
+	Plaintext  string       `tfsdk:"plaintext"`
+	Context    types.String `tfsdk:"context"`
+	Ciphertext types.String `tfsdk:"ciphertext"`
+	KeyVersion types.Int64  `tfsdk:"key_version"`
+}
+
+func (r *EncryptedValueEphemeralResource) Metadata(ctx context.Context, req ephemeral.MetadataRequest, resp *ephemeral.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_encrypted_value"
+}
+
+func (r *EncryptedValueEphemeralResource) Schema(ctx context.Context, req ephemeral.SchemaRequest, resp *ephemeral.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		MarkdownDescription: "Encrypts a value with the transit key of the provider, e.g. a credential generated by another resource at apply time. " +
+			"Terraform only accepts ephemeral values in write-only attributes: feed `ciphertext` into the `encrypted_secrets_wo` of a secret, along with an `encrypted_secrets_wo_version` to change when the value does. " +
+			"Transit ciphertexts differ on every encryption, which write-only attributes do not mind since they are kept in neither the plan nor the state.",
+		Attributes: map[string]schema.Attribute{
+			"plaintext": schema.StringAttribute{
+				Required:    true,
+				Sensitive:   true,
+				Description: "Value to encrypt",
+			},
+			"context": schema.StringAttribute{
+				Optional:    true,
+				Description: "Key derivation context, required by derived and convergent transit keys",
+			},
+			"ciphertext": schema.StringAttribute{
+				Computed:    true,
+				Description: "Ciphertext of `plaintext`, for the `encrypted_secrets_wo` of a secret. Leave `context` unset to use it there",
+			},
+			"key_version": schema.Int64Attribute{
+				Computed:    true,
+				Description: "Version of the transit key `ciphertext` was encrypted with",
+			},
+		},
+	}
+}
+
+func (r *EncryptedValueEphemeralResource) Configure(ctx context.Context, req ephemeral.ConfigureRequest, resp *ephemeral.ConfigureResponse) {
+	// Prevent panic if the provider has not been configured.
+	if req.ProviderData == nil {
+		return
+	}
+
+	providerData, ok := req.ProviderData.(ProviderData)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Ephemeral Resource Configure Type",
+			fmt.Sprintf("Expected ProviderData, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+		)
+		return
+	}
+
+	r.ProviderData = providerData
+}
+
+func (r *EncryptedValueEphemeralResource) Open(ctx context.Context, req ephemeral.OpenRequest, resp *ephemeral.OpenResponse) {
+	var data EncryptedValueModel
+	resp.Diagnostics.Append(req.Config.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ciphertext, err := r.transit.EncryptDerived(ctx, data.Plaintext, data.Context.ValueString())
+	if err != nil {
+		resp.Diagnostics.AddError("failed to encrypt value", errorDetail(err))
+		return
+	}
+
+	data.Ciphertext = types.StringValue(ciphertext)
+	data.KeyVersion = ciphertextKeyVersion(ciphertext)
+
+	resp.Diagnostics.Append(resp.Result.Set(ctx, &data)...)
+}
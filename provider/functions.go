@@ -0,0 +1,48 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// transitPathEnv, transitKeyEnv and signingKeyEnv set the transit keys of the
+// functions when Terraform calls them in a process the provider is not
+// configured in.
+const (
+	transitPathEnv = "VSAC_TRANSIT_PATH"
+	transitKeyEnv  = "VSAC_TRANSIT_KEY"
+	signingKeyEnv  = "VSAC_SIGNING_KEY"
+)
+
+// transitFromEnv returns the transit mount of VSAC_TRANSIT_PATH, with the keys
+// of VSAC_TRANSIT_KEY and VSAC_SIGNING_KEY, if any, and a client from the
+// VAULT_* environment variables.
+func transitFromEnv() (*vaultTransit, error) {
+	mount, endpoint := os.Getenv(transitPathEnv), os.Getenv("VAULT_ADDR")
+	if mount == "" || endpoint == "" {
+		return nil, fmt.Errorf("the provider is not configured in the process Terraform calls the function in: set %s, VAULT_ADDR and VAULT_TOKEN", transitPathEnv)
+	}
+
+	client, err := newClient(context.Background(), VaultConfigModel{Endpoint: endpoint})
+	if err != nil {
+		return nil, err
+	}
+	return &vaultTransit{
+		client:     client,
+		path:       strings.Trim(mount, "/") + "/",
+		key:        os.Getenv(transitKeyEnv),
+		signingKey: os.Getenv(signingKeyEnv),
+	}, nil
+}
+
+// functionTransit returns the transit mount the functions call: the one of
+// Configure, or the one of the environment when Terraform did not configure
+// the provider in this process.
+func (p *Provider) functionTransit() (*vaultTransit, error) {
+	if transit := p.transit.Load(); transit != nil {
+		return transit, nil
+	}
+	return p.envTransit()
+}
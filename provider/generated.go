@@ -0,0 +1,172 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringdefault"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+// generatedHMACsKey is the private state key holding the transit HMAC of
+// every generated value, the values themselves never enter the state.
+const generatedHMACsKey = "generated_secrets_hmacs"
+
+var generatedSecretsAttribute = schema.MapNestedAttribute{
+	Optional:    true,
+	Description: "Values generated by Vault at creation, from either transit random bytes or a password policy, keyed by secret key. A value is only regenerated when its specification (e.g. `rotate_trigger`) changes",
+	NestedObject: schema.NestedAttributeObject{
+		Attributes: map[string]schema.Attribute{
+			"length": schema.Int64Attribute{
+				Optional:    true,
+				Description: "Number of random bytes to generate, conflicts with `password_policy`",
+				Validators:  []validator.Int64{int64AtLeastValidator{min: 1}},
+			},
+			"password_policy": schema.StringAttribute{
+				Optional:    true,
+				Description: "Name of the password policy, on the KV Vault server, generating the value. Conflicts with `length`",
+			},
+			"format": schema.StringAttribute{
+				Optional:    true,
+				Computed:    true,
+				Default:     stringdefault.StaticString("base64"),
+				Description: "Encoding of the generated random bytes, `base64` or `hex`",
+				Validators:  []validator.String{oneOfValidator{values: []string{"base64", "hex"}}},
+			},
+			"rotate_trigger": schema.StringAttribute{
+				Optional:    true,
+				Description: "Arbitrary value, changing it regenerates the value",
+			},
+		},
+	},
+}
+
+// GeneratedSecretModel describes how a generated value is produced.
+type GeneratedSecretModel struct {
+	Length         types.Int64  `tfsdk:"length"`
+	PasswordPolicy types.String `tfsdk:"password_policy"`
+	Format         types.String `tfsdk:"format"`
+	RotateTrigger  types.String `tfsdk:"rotate_trigger"`
+}
+
+func (m GeneratedSecretModel) equal(o GeneratedSecretModel) bool {
+	return m.Length.Equal(o.Length) &&
+		m.PasswordPolicy.Equal(o.PasswordPolicy) &&
+		m.Format.Equal(o.Format) &&
+		m.RotateTrigger.Equal(o.RotateTrigger)
+}
+
+// validateGeneratedSecrets ensures every generated secret of the config sets
+// exactly one of length and password_policy.
+func validateGeneratedSecrets(generated types.Map) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	for k, e := range generated.Elements() {
+		obj, ok := e.(types.Object)
+		if !ok || obj.IsNull() || obj.IsUnknown() {
+			continue
+		}
+
+		length, policy := obj.Attributes()["length"], obj.Attributes()["password_policy"]
+		if length.IsUnknown() || policy.IsUnknown() {
+			continue
+		}
+		if length.IsNull() == policy.IsNull() {
+			diags.AddAttributeError(
+				path.Root("generated_secrets").AtMapKey(k),
+				"invalid generated secret",
+				"exactly one of length and password_policy must be set",
+			)
+		}
+	}
+
+	return diags
+}
+
+// privateState is implemented by the private state of every resource
+// request and response.
+type privateState interface {
+	GetKey(ctx context.Context, key string) ([]byte, diag.Diagnostics)
+	SetKey(ctx context.Context, key string, value []byte) diag.Diagnostics
+}
+
+func getGeneratedHMACs(ctx context.Context, private privateState) (map[string]string, diag.Diagnostics) {
+	hmacs := make(map[string]string)
+
+	b, diags := private.GetKey(ctx, generatedHMACsKey)
+	if diags.HasError() || b == nil {
+		return hmacs, diags
+	}
+
+	if err := json.Unmarshal(b, &hmacs); err != nil {
+		diags.AddError("failed to decode generated secrets private state", err.Error())
+	}
+
+	return hmacs, diags
+}
+
+func setGeneratedHMACs(ctx context.Context, private privateState, hmacs map[string]string) diag.Diagnostics {
+	if len(hmacs) == 0 {
+		return private.SetKey(ctx, generatedHMACsKey, nil)
+	}
+
+	b, err := json.Marshal(hmacs)
+	if err != nil {
+		var diags diag.Diagnostics
+		diags.AddError("failed to encode generated secrets private state", err.Error())
+		return diags
+	}
+
+	return private.SetKey(ctx, generatedHMACsKey, b)
+}
+
+// generateSecrets returns the values of the generated secrets in specs along
+// with their HMACs. Values whose specification did not change since prior are
+// taken from current instead of being regenerated.
+func (r *SecretResource) generateSecrets(
+	ctx context.Context,
+	specs, prior map[string]GeneratedSecretModel,
+	current map[string]any,
+	priorHMACs map[string]string,
+) (map[string]any, map[string]string, error) {
+	values := make(map[string]any)
+	hmacs := make(map[string]string)
+
+	for k, spec := range specs {
+		if p, ok := prior[k]; ok && p.equal(spec) {
+			value, ok := current[k].(string)
+			hmac, hasHMAC := priorHMACs[k]
+			if ok && hasHMAC {
+				values[k] = value
+				hmacs[k] = hmac
+				continue
+			}
+		}
+
+		var value string
+		var err error
+		if !spec.PasswordPolicy.IsNull() {
+			// Password policies live on the KV Vault server.
+			value, err = r.kv.GeneratePassword(ctx, spec.PasswordPolicy.ValueString())
+		} else {
+			value, err = r.transit.RandomBytes(ctx, spec.Length.ValueInt64(), spec.Format.ValueString())
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+		hmac, err := r.transit.HMAC(ctx, value)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		values[k] = value
+		hmacs[k] = hmac
+	}
+
+	return values, hmacs, nil
+}
@@ -0,0 +1,83 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-framework/function"
+)
+
+// hmacAlgorithms are the algorithms transit computes HMACs with.
+var hmacAlgorithms = []string{"sha2-224", "sha2-256", "sha2-384", "sha2-512", "sha3-224", "sha3-256", "sha3-384", "sha3-512"}
+
+// Ensure provider defined types fully satisfy framework interfaces.
+var _ function.Function = &HMACFunction{}
+
+// HMACFunction computes the transit HMAC of a value, e.g. for change detection
+// keys that do not reveal the value.
+type HMACFunction struct {
+	provider *Provider
+}
+
+func (f *HMACFunction) Metadata(ctx context.Context, req function.MetadataRequest, resp *function.MetadataResponse) {
+	resp.Name = "hmac"
+}
+
+func (f *HMACFunction) Definition(ctx context.Context, req function.DefinitionRequest, resp *function.DefinitionResponse) {
+	resp.Definition = function.Definition{
+		Summary:             "Transit HMAC of a value",
+		MarkdownDescription: fmt.Sprintf("HMAC of a value computed by Vault with the transit key of the provider, e.g. `vault:v1:...`, one call to `transit/hmac` each. The result is sensitive when the value is. Terraform may call functions before configuring the provider: the transit key is then the one of the `%s` and `%s` environment variables, with the Vault address and token of `VAULT_ADDR` and `VAULT_TOKEN`.", transitPathEnv, transitKeyEnv),
+		Parameters: []function.Parameter{
+			function.StringParameter{
+				Name:                "value",
+				MarkdownDescription: "Value to compute the HMAC of",
+			},
+		},
+		VariadicParameter: function.StringParameter{
+			Name:                "algorithm",
+			MarkdownDescription: fmt.Sprintf("Hash algorithm, one of %s, defaults to \"sha2-256\"", strings.Join(hmacAlgorithms, ", ")),
+		},
+		Return: function.StringReturn{},
+	}
+}
+
+func (f *HMACFunction) Run(ctx context.Context, req function.RunRequest, resp *function.RunResponse) {
+	var value string
+	var algorithms []string
+	resp.Error = function.ConcatFuncErrors(req.Arguments.Get(ctx, &value, &algorithms))
+	if resp.Error != nil {
+		return
+	}
+
+	algorithm := "sha2-256"
+	switch {
+	case len(algorithms) > 1:
+		resp.Error = function.NewArgumentFuncError(2, "at most one algorithm can be given")
+		return
+	case len(algorithms) == 1:
+		algorithm = algorithms[0]
+	}
+	if !slices.Contains(hmacAlgorithms, algorithm) {
+		resp.Error = function.NewArgumentFuncError(1, fmt.Sprintf("unsupported algorithm %q, expected one of %s", algorithm, strings.Join(hmacAlgorithms, ", ")))
+		return
+	}
+
+	transit, err := f.provider.functionTransit()
+	if err != nil {
+		resp.Error = function.NewFuncError(errorDetail(err))
+		return
+	}
+	if transit.key == "" {
+		resp.Error = function.NewFuncError(fmt.Sprintf("no transit key, set %s", transitKeyEnv))
+		return
+	}
+
+	hmac, err := transit.HMACWithAlgorithm(ctx, value, algorithm)
+	if err != nil {
+		resp.Error = function.NewFuncError("failed to compute the HMAC: " + errorDetail(err))
+		return
+	}
+	resp.Error = function.ConcatFuncErrors(resp.Result.Set(ctx, hmac))
+}
@@ -0,0 +1,664 @@
+package provider
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// inMemoryVault is a deterministic in-process stand-in for the subset of the
+// Vault API the provider uses, enabled with test_mode = "inmemory" so modules
+// can be tested without a Vault server. Transit "encryption" XORs the
+// plaintext with a pad derived from the key context, it is only reversible,
+// not secret.
+type inMemoryVault struct {
+	transitPath string
+	kvMount     string
+
+	mu      sync.Mutex
+	secrets map[string]*inMemorySecret
+	config  map[string]any
+	// keyVersions are the latest versions of the transit keys rotated at
+	// least once, the others are at version 1.
+	keyVersions map[string]int
+	// counter seeds the random bytes and passwords, so runs are
+	// reproducible.
+	counter uint64
+	// fail, when set, makes the requests it matches fail with a server
+	// error, for the tests to inject faults.
+	fail func(method, p string) bool
+}
+
+type inMemorySecret struct {
+	versions       []inMemoryVersion
+	customMetadata map[string]any
+	maxVersions    json.Number
+	casRequired    bool
+	// deleteVersionAfter is kept as written, Vault would normalize it.
+	deleteVersionAfter string
+	created            time.Time
+	updated            time.Time
+}
+
+type inMemoryVersion struct {
+	number    int
+	data      map[string]any
+	created   time.Time
+	deleted   time.Time
+	destroyed bool
+}
+
+// deletionTime formats the soft deletion time of v the way Vault does.
+func (v inMemoryVersion) deletionTime() string {
+	if v.deleted.IsZero() {
+		return ""
+	}
+	return v.deleted.Format(time.RFC3339Nano)
+}
+
+// newInMemoryVault returns an empty inMemoryVault serving transit at
+// transitPath and KVv2 at kvMount.
+func newInMemoryVault(transitPath, kvMount string) *inMemoryVault {
+	return &inMemoryVault{
+		transitPath: strings.Trim(transitPath, "/") + "/",
+		kvMount:     strings.Trim(kvMount, "/"),
+		secrets:     make(map[string]*inMemorySecret),
+		config:      map[string]any{"max_versions": json.Number("0"), "cas_required": false, "delete_version_after": "0s"},
+		keyVersions: make(map[string]int),
+	}
+}
+
+// newInMemoryClient returns a Vault client backed by a new inMemoryVault
+// serving transit at transitPath and KVv2 at kvMount. Its calls are counted
+// in stats, when set.
+func newInMemoryClient(transitPath, kvMount string, stats *operationStats) (*api.Client, error) {
+	backend := newInMemoryVault(transitPath, kvMount)
+
+	cfg := api.DefaultConfig()
+	cfg.Address = "http://inmemory.invalid"
+	cfg.MaxRetries = 0
+	cfg.HttpClient.Transport = backend
+	if stats != nil {
+		cfg.HttpClient.Transport = &statsTransport{base: backend, stats: stats}
+	}
+
+	client, err := api.NewClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	client.SetToken("inmemory")
+
+	return client, nil
+}
+
+// RoundTrip serves req without touching the network.
+func (b *inMemoryVault) RoundTrip(req *http.Request) (*http.Response, error) {
+	rec := httptest.NewRecorder()
+	b.ServeHTTP(rec, req)
+
+	resp := rec.Result()
+	resp.Request = req
+	return resp, nil
+}
+
+func (b *inMemoryVault) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var body map[string]any
+	if req.Body != nil {
+		dec := json.NewDecoder(req.Body)
+		dec.UseNumber()
+		if err := dec.Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+			inMemoryError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	p := strings.TrimPrefix(req.URL.Path, "/v1/")
+	list := req.URL.Query().Get("list") == "true"
+	if b.fail != nil && b.fail(req.Method, p) {
+		inMemoryError(w, http.StatusInternalServerError, "injected fault on "+p)
+		return
+	}
+
+	switch {
+	case p == "sys/seal-status":
+		inMemoryReply(w, map[string]any{"type": "shamir", "initialized": true, "sealed": false, "t": 1, "n": 1, "progress": 0})
+	case p == "sys/capabilities-self":
+		b.capabilities(w, body)
+	case strings.HasPrefix(p, "sys/policies/password/"):
+		b.password(w, strings.TrimPrefix(p, "sys/policies/password/"))
+	case strings.HasPrefix(p, b.transitPath):
+		b.transit(w, req.Method, strings.TrimPrefix(p, b.transitPath), body)
+	case p == b.kvMount+"/config":
+		b.kvConfig(w, req.Method, body)
+	case strings.HasPrefix(p, b.kvMount+"/data/"):
+		b.kvData(w, req.Method, strings.TrimPrefix(p, b.kvMount+"/data/"), req.URL.Query().Get("version"), body)
+	case strings.HasPrefix(p, b.kvMount+"/subkeys/"):
+		b.kvSubkeys(w, strings.TrimPrefix(p, b.kvMount+"/subkeys/"), req.URL.Query().Get("depth"))
+	case list && (p == b.kvMount+"/metadata" || strings.HasPrefix(p, b.kvMount+"/metadata/")):
+		b.kvList(w, strings.TrimPrefix(strings.TrimPrefix(p, b.kvMount+"/metadata"), "/"))
+	case strings.HasPrefix(p, b.kvMount+"/delete/"):
+		b.kvDelete(w, strings.TrimPrefix(p, b.kvMount+"/delete/"), body)
+	case strings.HasPrefix(p, b.kvMount+"/destroy/"):
+		b.kvDestroy(w, strings.TrimPrefix(p, b.kvMount+"/destroy/"), body)
+	case strings.HasPrefix(p, b.kvMount+"/metadata/"):
+		b.kvMetadata(w, req.Method, strings.TrimPrefix(p, b.kvMount+"/metadata/"), body)
+	default:
+		inMemoryError(w, http.StatusNotFound, "no handler for route "+p)
+	}
+}
+
+func inMemoryReply(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func inMemoryData(w http.ResponseWriter, data map[string]any) {
+	inMemoryReply(w, map[string]any{"data": data})
+}
+
+func inMemoryError(w http.ResponseWriter, status int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]any{"errors": []string{msg}})
+}
+
+// random returns n deterministic pseudo-random bytes.
+func (b *inMemoryVault) random(n int) []byte {
+	out := make([]byte, 0, n+sha256.Size)
+	for len(out) < n {
+		b.counter++
+		sum := sha256.Sum256([]byte(strconv.FormatUint(b.counter, 10)))
+		out = append(out, sum[:]...)
+	}
+	return out[:n]
+}
+
+func (b *inMemoryVault) capabilities(w http.ResponseWriter, body map[string]any) {
+	paths, _ := body["paths"].([]any)
+	data := make(map[string]any)
+	for _, p := range paths {
+		if p, ok := p.(string); ok {
+			data[p] = []string{"root"}
+		}
+	}
+	inMemoryData(w, data)
+}
+
+// password serves every password policy, generating hex passwords.
+func (b *inMemoryVault) password(w http.ResponseWriter, p string) {
+	if strings.HasSuffix(p, "/generate") {
+		inMemoryData(w, map[string]any{"password": hex.EncodeToString(b.random(16))})
+		return
+	}
+	inMemoryData(w, map[string]any{"policy": ""})
+}
+
+// inMemoryXOR applies the pad derived from keyContext to in.
+func inMemoryXOR(in []byte, keyContext string) []byte {
+	pad := sha256.Sum256([]byte("inmemory:" + keyContext))
+	out := make([]byte, len(in))
+	for i := range in {
+		out[i] = in[i] ^ pad[i%len(pad)]
+	}
+	return out
+}
+
+func inMemoryHMAC(input []byte) string {
+	mac := hmac.New(sha256.New, []byte("inmemory"))
+	mac.Write(input)
+	return "vault:v1:" + base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// inMemorySignature is the "signature" of input by version of a key of the
+// fake transit engine, an HMAC with another key for each version.
+func inMemorySignature(input []byte, version int) string {
+	secret := "inmemory-signing"
+	if version > 1 {
+		secret += ":" + strconv.Itoa(version)
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(input)
+	return fmt.Sprintf("vault:v%d:%s", version, base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+}
+
+// keyVersion returns the latest version of a transit key.
+func (b *inMemoryVault) keyVersion(key string) int {
+	return max(b.keyVersions[key], 1)
+}
+
+// inMemoryDecrypt reverses the encryption of the fake transit engine.
+func inMemoryDecrypt(ciphertext, keyContext string) (string, error) {
+	encoded, ok := strings.CutPrefix(ciphertext, "vault:v1:")
+	if !ok {
+		return "", errors.New("invalid ciphertext")
+	}
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", fmt.Errorf("invalid ciphertext: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(inMemoryXOR(raw, keyContext)), nil
+}
+
+func (b *inMemoryVault) transit(w http.ResponseWriter, method, p string, body map[string]any) {
+	op, key, _ := strings.Cut(p, "/")
+
+	str := func(k string) string {
+		v, _ := body[k].(string)
+		return v
+	}
+	decode := func(k string) ([]byte, bool) {
+		v, err := base64.StdEncoding.DecodeString(str(k))
+		if err != nil {
+			inMemoryError(w, http.StatusBadRequest, fmt.Sprintf("failed to decode %s: %s", k, err))
+			return nil, false
+		}
+		return v, true
+	}
+
+	keyContext := ""
+	if str("context") != "" {
+		c, ok := decode("context")
+		if !ok {
+			return
+		}
+		keyContext = string(c)
+	}
+
+	switch op {
+	case "encrypt":
+		plaintext, ok := decode("plaintext")
+		if !ok {
+			return
+		}
+		inMemoryData(w, map[string]any{
+			"ciphertext":  "vault:v1:" + base64.StdEncoding.EncodeToString(inMemoryXOR(plaintext, keyContext)),
+			"key_version": 1,
+		})
+	case "decrypt":
+		if batch, ok := body["batch_input"].([]any); ok {
+			results := make([]any, 0, len(batch))
+			for _, item := range batch {
+				item, _ := item.(map[string]any)
+				ciphertext, _ := item["ciphertext"].(string)
+				encodedContext, _ := item["context"].(string)
+				itemContext, _ := base64.StdEncoding.DecodeString(encodedContext)
+				plaintext, err := inMemoryDecrypt(ciphertext, string(itemContext))
+				if err != nil {
+					results = append(results, map[string]any{"error": err.Error()})
+				} else {
+					results = append(results, map[string]any{"plaintext": plaintext})
+				}
+			}
+			inMemoryData(w, map[string]any{"batch_results": results})
+			return
+		}
+
+		plaintext, err := inMemoryDecrypt(str("ciphertext"), keyContext)
+		if err != nil {
+			inMemoryError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		inMemoryData(w, map[string]any{"plaintext": plaintext})
+	case "rewrap":
+		// There is a single key version, the ciphertext is already bound to
+		// it.
+		if _, err := inMemoryDecrypt(str("ciphertext"), keyContext); err != nil {
+			inMemoryError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		inMemoryData(w, map[string]any{"ciphertext": str("ciphertext"), "key_version": 1})
+	case "random":
+		n, err := strconv.Atoi(strings.TrimPrefix(p, "random/"))
+		if err != nil || n <= 0 {
+			inMemoryError(w, http.StatusBadRequest, "invalid number of bytes")
+			return
+		}
+		raw := b.random(n)
+		encoded := base64.StdEncoding.EncodeToString(raw)
+		if str("format") == "hex" {
+			encoded = hex.EncodeToString(raw)
+		}
+		inMemoryData(w, map[string]any{"random_bytes": encoded})
+	case "hmac":
+		input, ok := decode("input")
+		if !ok {
+			return
+		}
+		inMemoryData(w, map[string]any{"hmac": inMemoryHMAC(input)})
+	case "verify":
+		input, ok := decode("input")
+		if !ok {
+			return
+		}
+		if signature := str("signature"); signature != "" {
+			var version int
+			if _, err := fmt.Sscanf(signature, "vault:v%d:", &version); err != nil || version < 1 || version > b.keyVersion(key) {
+				inMemoryError(w, http.StatusBadRequest, "invalid signature version")
+				return
+			}
+			inMemoryData(w, map[string]any{"valid": hmac.Equal([]byte(inMemorySignature(input, version)), []byte(signature))})
+			return
+		}
+		inMemoryData(w, map[string]any{"valid": hmac.Equal([]byte(inMemoryHMAC(input)), []byte(str("hmac")))})
+	case "sign":
+		input, ok := decode("input")
+		if !ok {
+			return
+		}
+		inMemoryData(w, map[string]any{"signature": inMemorySignature(input, b.keyVersion(key))})
+	case "keys":
+		// Only the versions of the keys are tracked, for rotations.
+		key, rotate := strings.CutSuffix(key, "/rotate")
+		if rotate == (method == http.MethodGet) {
+			inMemoryError(w, http.StatusMethodNotAllowed, "unsupported operation on transit keys")
+			return
+		}
+		if rotate {
+			b.keyVersions[key] = b.keyVersion(key) + 1
+		}
+		inMemoryData(w, map[string]any{
+			"name":                   key,
+			"type":                   "aes256-gcm96",
+			"latest_version":         b.keyVersion(key),
+			"min_decryption_version": 1,
+			"min_encryption_version": 0,
+		})
+	default:
+		inMemoryError(w, http.StatusNotFound, "unsupported transit operation "+op)
+	}
+}
+
+func (b *inMemoryVault) kvConfig(w http.ResponseWriter, method string, body map[string]any) {
+	if method == http.MethodGet {
+		inMemoryData(w, b.config)
+		return
+	}
+
+	for _, k := range []string{"max_versions", "cas_required", "delete_version_after"} {
+		if v, ok := body[k]; ok {
+			b.config[k] = v
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *inMemorySecret) versionMetadata(v inMemoryVersion) map[string]any {
+	return map[string]any{
+		"created_time":    v.created.Format(time.RFC3339Nano),
+		"custom_metadata": s.customMetadata,
+		"deletion_time":   v.deletionTime(),
+		"destroyed":       v.destroyed,
+		"version":         v.number,
+	}
+}
+
+func (b *inMemoryVault) kvData(w http.ResponseWriter, method, p, version string, body map[string]any) {
+	s := b.secrets[p]
+
+	switch method {
+	case http.MethodGet:
+		if s == nil || len(s.versions) == 0 {
+			inMemoryError(w, http.StatusNotFound, "")
+			return
+		}
+		v := s.versions[len(s.versions)-1]
+		if version != "" && version != "0" {
+			i := slices.IndexFunc(s.versions, func(v inMemoryVersion) bool { return strconv.Itoa(v.number) == version })
+			if i < 0 {
+				inMemoryError(w, http.StatusNotFound, "")
+				return
+			}
+			v = s.versions[i]
+		}
+		data := v.data
+		if !v.deleted.IsZero() {
+			data = nil
+		}
+		inMemoryData(w, map[string]any{
+			"data":     data,
+			"metadata": s.versionMetadata(v),
+		})
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+		data, _ := body["data"].(map[string]any)
+		if method == http.MethodPatch {
+			if s == nil || len(s.versions) == 0 {
+				inMemoryError(w, http.StatusNotFound, "")
+				return
+			}
+			merged := make(map[string]any)
+			for k, v := range s.versions[len(s.versions)-1].data {
+				merged[k] = v
+			}
+			for k, v := range data {
+				if v == nil {
+					delete(merged, k)
+				} else {
+					merged[k] = v
+				}
+			}
+			data = merged
+		}
+
+		if s == nil {
+			s = &inMemorySecret{created: time.Now().UTC()}
+			b.secrets[p] = s
+		}
+
+		current := 0
+		if len(s.versions) > 0 {
+			current = s.versions[len(s.versions)-1].number
+		}
+		options, _ := body["options"].(map[string]any)
+		if cas, ok := options["cas"].(json.Number); ok || s.casRequired {
+			if cas.String() != strconv.Itoa(current) {
+				inMemoryError(w, http.StatusBadRequest, "check-and-set parameter did not match the current version")
+				return
+			}
+		}
+
+		s.updated = time.Now().UTC()
+		version := inMemoryVersion{number: current + 1, data: data, created: s.updated}
+		s.versions = append(s.versions, version)
+
+		maxVersions, _ := s.maxVersions.Int64()
+		if maxVersions == 0 {
+			mountMaxVersions, _ := b.config["max_versions"].(json.Number)
+			maxVersions, _ = mountMaxVersions.Int64()
+		}
+		if maxVersions == 0 {
+			maxVersions = 10
+		}
+		if int64(len(s.versions)) > maxVersions {
+			s.versions = s.versions[int64(len(s.versions))-maxVersions:]
+		}
+
+		inMemoryData(w, s.versionMetadata(version))
+	default:
+		inMemoryError(w, http.StatusMethodNotAllowed, "")
+	}
+}
+
+// kvSubkeys serves the key structure of the latest version of p, its values
+// replaced by null below depth levels (all of them when 0).
+func (b *inMemoryVault) kvSubkeys(w http.ResponseWriter, p, depth string) {
+	s := b.secrets[p]
+	if s == nil || len(s.versions) == 0 || !s.versions[len(s.versions)-1].deleted.IsZero() || s.versions[len(s.versions)-1].destroyed {
+		inMemoryError(w, http.StatusNotFound, "")
+		return
+	}
+	levels, _ := strconv.Atoi(depth)
+
+	v := s.versions[len(s.versions)-1]
+	inMemoryData(w, map[string]any{
+		"subkeys":  subkeysOf(v.data, levels),
+		"metadata": s.versionMetadata(v),
+	})
+}
+
+func (b *inMemoryVault) kvMetadata(w http.ResponseWriter, method, p string, body map[string]any) {
+	s := b.secrets[p]
+
+	switch method {
+	case http.MethodGet:
+		if s == nil {
+			inMemoryError(w, http.StatusNotFound, "")
+			return
+		}
+
+		versions := make(map[string]any)
+		current, oldest := 0, 0
+		for _, v := range s.versions {
+			versions[strconv.Itoa(v.number)] = map[string]any{
+				"created_time":  v.created.Format(time.RFC3339Nano),
+				"deletion_time": v.deletionTime(),
+				"destroyed":     v.destroyed,
+			}
+			current = v.number
+			if oldest == 0 {
+				oldest = v.number
+			}
+		}
+		maxVersions := s.maxVersions
+		if maxVersions == "" {
+			maxVersions = "0"
+		}
+		deleteVersionAfter := s.deleteVersionAfter
+		if deleteVersionAfter == "" {
+			deleteVersionAfter = "0s"
+		}
+		inMemoryData(w, map[string]any{
+			"cas_required":         s.casRequired,
+			"created_time":         s.created.Format(time.RFC3339Nano),
+			"current_version":      current,
+			"custom_metadata":      s.customMetadata,
+			"delete_version_after": deleteVersionAfter,
+			"max_versions":         maxVersions,
+			"oldest_version":       oldest,
+			"updated_time":         s.updated.Format(time.RFC3339Nano),
+			"versions":             versions,
+		})
+	case http.MethodPost, http.MethodPut:
+		if s == nil {
+			s = &inMemorySecret{created: time.Now().UTC(), updated: time.Now().UTC()}
+			b.secrets[p] = s
+		}
+		s.customMetadata, _ = body["custom_metadata"].(map[string]any)
+		s.maxVersions, _ = body["max_versions"].(json.Number)
+		s.casRequired, _ = body["cas_required"].(bool)
+		s.deleteVersionAfter, _ = body["delete_version_after"].(string)
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodPatch:
+		// JSON merge patch: absent fields are kept, null custom metadata
+		// values delete their key.
+		if s == nil {
+			inMemoryError(w, http.StatusNotFound, "")
+			return
+		}
+		if v, ok := body["max_versions"].(json.Number); ok {
+			s.maxVersions = v
+		}
+		if v, ok := body["cas_required"].(bool); ok {
+			s.casRequired = v
+		}
+		if v, ok := body["delete_version_after"].(string); ok {
+			s.deleteVersionAfter = v
+		}
+		if patch, ok := body["custom_metadata"].(map[string]any); ok {
+			customMetadata := make(map[string]any)
+			for k, v := range s.customMetadata {
+				customMetadata[k] = v
+			}
+			for k, v := range patch {
+				if v == nil {
+					delete(customMetadata, k)
+				} else {
+					customMetadata[k] = v
+				}
+			}
+			s.customMetadata = customMetadata
+		}
+		s.updated = time.Now().UTC()
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		delete(b.secrets, p)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		inMemoryError(w, http.StatusMethodNotAllowed, "")
+	}
+}
+
+// kvDestroy destroys the data of the given versions.
+func (b *inMemoryVault) kvDestroy(w http.ResponseWriter, p string, body map[string]any) {
+	s := b.secrets[p]
+	versions, _ := body["versions"].([]any)
+	if s != nil {
+		for i := range s.versions {
+			if slices.Contains(versions, any(json.Number(strconv.Itoa(s.versions[i].number)))) {
+				s.versions[i].data = nil
+				s.versions[i].destroyed = true
+			}
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// kvDelete soft-deletes the given versions, their data is hidden but kept.
+func (b *inMemoryVault) kvDelete(w http.ResponseWriter, p string, body map[string]any) {
+	s := b.secrets[p]
+	versions, _ := body["versions"].([]any)
+	if s != nil {
+		for i := range s.versions {
+			for _, version := range versions {
+				if fmt.Sprint(version) == strconv.Itoa(s.versions[i].number) && s.versions[i].deleted.IsZero() {
+					s.versions[i].deleted = time.Now().UTC()
+				}
+			}
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// kvList lists the secrets and folders right under the folder prefix.
+func (b *inMemoryVault) kvList(w http.ResponseWriter, prefix string) {
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	var keys []string
+	for p := range b.secrets {
+		rest, ok := strings.CutPrefix(p, prefix)
+		if !ok || rest == "" {
+			continue
+		}
+		if folder, _, ok := strings.Cut(rest, "/"); ok {
+			rest = folder + "/"
+		}
+		if !slices.Contains(keys, rest) {
+			keys = append(keys, rest)
+		}
+	}
+
+	if len(keys) == 0 {
+		inMemoryError(w, http.StatusNotFound, "")
+		return
+	}
+	slices.Sort(keys)
+	inMemoryData(w, map[string]any{"keys": keys})
+}
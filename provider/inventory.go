@@ -0,0 +1,226 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/datasource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/vault/api"
+)
+
+// Ensure provider defined types fully satisfy framework interfaces.
+var _ datasource.DataSource = &InventoryDataSource{}
+
+const defaultInventoryMaxSecrets = 1000
+
+func NewInventoryDataSource() datasource.DataSource {
+	return &InventoryDataSource{}
+}
+
+// InventoryDataSource describes every secret carrying our ownership marker,
+// for reporting. It reads metadata and key names, never values.
+type InventoryDataSource struct {
+	ProviderData
+}
+
+// InventoryModel describes the data source data model.
+type InventoryModel struct {
+	Prefix         types.String           `tfsdk:"prefix"`
+	MaxDepth       types.Int64            `tfsdk:"max_depth"`
+	Concurrency    types.Int64            `tfsdk:"concurrency"`
+	MaxSecrets     types.Int64            `tfsdk:"max_secrets"`
+	IncludeSubkeys types.Bool             `tfsdk:"include_subkeys"`
+	Truncated      types.Bool             `tfsdk:"truncated"`
+	Secrets        []InventorySecretModel `tfsdk:"secrets"`
+}
+
+// InventorySecretModel describes a secret of the inventory.
+type InventorySecretModel struct {
+	Path           string            `tfsdk:"path"`
+	Keys           []string          `tfsdk:"keys"`
+	CurrentVersion int64             `tfsdk:"current_version"`
+	UpdatedTime    string            `tfsdk:"updated_time"`
+	CustomMetadata map[string]string `tfsdk:"custom_metadata"`
+	Subkeys        types.String      `tfsdk:"subkeys"`
+}
+
+func (d *InventoryDataSource) Metadata(ctx context.Context, req datasource.MetadataRequest, resp *datasource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_inventory"
+}
+
+func (d *InventoryDataSource) Schema(ctx context.Context, req datasource.SchemaRequest, resp *datasource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		MarkdownDescription: "Inventory of the secrets of the KVv2 mount whose ownership marker matches `managed_by`, with their key names and metadata but never their values, e.g. to write a report with `jsonencode` and `local_file` and diff it between runs. " +
+			"Everything is sorted so an unchanged mount gives the same output. Key names are read with the `subkeys` endpoint, so values never leave Vault; before Vault 1.10, or without the `read` capability on `<kv_path>/subkeys/*`, the secrets are read instead.",
+		Attributes: map[string]schema.Attribute{
+			"prefix":      listPrefixAttribute,
+			"max_depth":   listMaxDepthAttribute,
+			"concurrency": listConcurrencyAttribute,
+			"max_secrets": schema.Int64Attribute{
+				Optional:    true,
+				Description: fmt.Sprintf("Largest number of secrets described, defaults to %d. The first ones by path are kept and `truncated` is set", defaultInventoryMaxSecrets),
+				Validators:  []validator.Int64{int64AtLeastValidator{min: 1}},
+			},
+			"include_subkeys": schema.BoolAttribute{
+				Optional:    true,
+				Description: "Also describe the structure of every secret in `subkeys`, defaults to false",
+			},
+			"truncated": schema.BoolAttribute{
+				Computed:    true,
+				Description: "Whether secrets were left out because of `max_secrets`",
+			},
+			"secrets": schema.ListNestedAttribute{
+				Computed:    true,
+				Description: "The secrets, sorted by path",
+				NestedObject: schema.NestedAttributeObject{
+					Attributes: map[string]schema.Attribute{
+						"path": schema.StringAttribute{
+							Computed:    true,
+							Description: "Path of the secret, relative to `path_prefix`",
+						},
+						"keys": schema.ListAttribute{
+							Computed:    true,
+							ElementType: types.StringType,
+							Description: "Keys of the latest version, sorted. Empty when it is deleted or destroyed",
+						},
+						"current_version": schema.Int64Attribute{
+							Computed: true,
+						},
+						"updated_time": schema.StringAttribute{
+							Computed:    true,
+							Description: "Time of the latest write, in RFC 3339 format",
+						},
+						"custom_metadata": schema.MapAttribute{
+							Computed:    true,
+							ElementType: types.StringType,
+							Description: "Custom metadata of the secret, e.g. its ownership marker and owner tags",
+						},
+						"subkeys": schema.StringAttribute{
+							Computed:    true,
+							Description: "JSON structure of the latest version, with every value replaced by null and object keys sorted, when `include_subkeys` is set",
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func (d *InventoryDataSource) Configure(ctx context.Context, req datasource.ConfigureRequest, resp *datasource.ConfigureResponse) {
+	// Prevent panic if the provider has not been configured.
+	if req.ProviderData == nil {
+		return
+	}
+
+	providerData, ok := req.ProviderData.(ProviderData)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Data Source Configure Type",
+			fmt.Sprintf("Expected ProviderData, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+		)
+		return
+	}
+
+	d.ProviderData = providerData
+}
+
+func (d *InventoryDataSource) Read(ctx context.Context, req datasource.ReadRequest, resp *datasource.ReadResponse) {
+	var data InventoryModel
+	resp.Diagnostics.Append(req.Config.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	owned, err := d.kv.listOwned(ctx, data.Prefix, data.MaxDepth, data.Concurrency)
+	if err != nil {
+		resp.Diagnostics.AddError("failed to list secrets", errorDetail(err))
+		return
+	}
+
+	maxSecrets := defaultInventoryMaxSecrets
+	if !data.MaxSecrets.IsNull() {
+		maxSecrets = int(data.MaxSecrets.ValueInt64())
+	}
+	data.Truncated = types.BoolValue(len(owned) > maxSecrets)
+	if len(owned) > maxSecrets {
+		resp.Diagnostics.AddWarning(
+			"inventory truncated",
+			fmt.Sprintf("%d secrets are managed, only the first %d are described. Raise max_secrets or narrow prefix", len(owned), maxSecrets),
+		)
+		owned = owned[:maxSecrets]
+	}
+
+	concurrency := int64(defaultListConcurrency)
+	if !data.Concurrency.IsNull() {
+		concurrency = data.Concurrency.ValueInt64()
+	}
+
+	data.Secrets = make([]InventorySecretModel, len(owned))
+	errs := make([]error, len(owned))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	for i, s := range owned {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			secret := InventorySecretModel{
+				Path:           s.path,
+				CurrentVersion: int64(s.metadata.CurrentVersion),
+				UpdatedTime:    s.metadata.UpdatedTime.Format(time.RFC3339),
+				CustomMetadata: make(map[string]string, len(s.metadata.CustomMetadata)),
+				Subkeys:        types.StringNull(),
+			}
+			for k, v := range s.metadata.CustomMetadata {
+				secret.CustomMetadata[k] = fmt.Sprint(v)
+			}
+
+			depth := 1
+			if data.IncludeSubkeys.ValueBool() {
+				depth = 0
+			}
+			subkeys, err := d.kv.GetSubkeys(ctx, d.kv.secretPath(s.path), depth)
+			if errors.Is(err, api.ErrSecretNotFound) {
+				subkeys, err = nil, nil
+			}
+			if err != nil {
+				errs[i] = fmt.Errorf("%s: %w", d.kv.fullPath(d.kv.secretPath(s.path)), err)
+				return
+			}
+			secret.Keys = slices.Sorted(maps.Keys(subkeys))
+			if secret.Keys == nil {
+				secret.Keys = []string{}
+			}
+			if data.IncludeSubkeys.ValueBool() && subkeys != nil {
+				// Maps are marshalled with sorted keys.
+				b, err := json.Marshal(subkeys)
+				if err != nil {
+					errs[i] = err
+					return
+				}
+				secret.Subkeys = types.StringValue(string(b))
+			}
+			data.Secrets[i] = secret
+		}()
+	}
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		resp.Diagnostics.AddError("failed to read secret keys", errorDetail(err))
+		return
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
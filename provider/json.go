@@ -0,0 +1,73 @@
+package provider
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// decodeJSONPlaintext decodes a base64 transit plaintext holding a JSON
+// document. Numbers are kept as json.Number, like the Vault client does, so
+// they round-trip unchanged.
+func decodeJSONPlaintext(plaintext string) (any, error) {
+	b, err := base64.StdEncoding.DecodeString(plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+
+	var value any
+	if err := dec.Decode(&value); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, fmt.Errorf("unexpected data after the JSON document")
+	}
+
+	return value, nil
+}
+
+// jsonEqual reports whether a and b have the same canonical JSON encoding,
+// encoding/json sorts object keys.
+func jsonEqual(a, b any) bool {
+	ab, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	bb, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(ab, bb)
+}
+
+// normalizeJSONString returns the canonical encoding of s, sorted keys and no
+// insignificant whitespace, when s is a JSON object or array. Anything else is
+// returned untouched, including scalars: a password may well parse as a JSON
+// number.
+func normalizeJSONString(s string) string {
+	trimmed := strings.TrimSpace(s)
+	if !strings.HasPrefix(trimmed, "{") && !strings.HasPrefix(trimmed, "[") {
+		return s
+	}
+
+	dec := json.NewDecoder(strings.NewReader(trimmed))
+	dec.UseNumber()
+
+	var value any
+	if err := dec.Decode(&value); err != nil || dec.More() {
+		return s
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(value); err != nil {
+		return s
+	}
+	return strings.TrimSuffix(buf.String(), "\n")
+}
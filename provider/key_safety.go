@@ -0,0 +1,86 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	"github.com/hashicorp/vault/api"
+)
+
+// riskyKeySettings are the transit key settings that put every ciphertext
+// in git at risk, with why.
+var riskyKeySettings = []struct {
+	name string
+	risk string
+}{
+	{"deletion_allowed", "the key can be deleted, and every ciphertext with it for good"},
+	{"exportable", "the key can be exported, and every ciphertext decrypted outside Vault"},
+	{"allow_plaintext_backup", "a backup of the key carries it in plaintext"},
+}
+
+// checkKeySafety reports the risky settings of the transit key, and a missing
+// mount or key, as errors when strict. A key config the token cannot read is
+// not checked, which only fails in strict mode; settings missing from a
+// partial config are skipped.
+func (v vaultTransit) checkKeySafety(ctx context.Context, strict bool) diag.Diagnostics {
+	var diags diag.Diagnostics
+	attr := path.Root("transit_key")
+
+	p := v.path + "keys/" + v.key
+	resp, err := v.client.Logical().ReadRawWithContext(ctx, p)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	var s *api.Secret
+	if err == nil {
+		s, err = api.ParseSecret(resp.Body)
+	}
+	if err == nil && s == nil {
+		err = fmt.Errorf("%w: transit key %q not found", errTransitKeyMissing, v.key)
+	}
+	if err != nil {
+		err = v.explainTransitError(p, "read", v.key, err)
+	}
+
+	// Resources that never call transit keep working, a missing mount or
+	// key only fails in strict mode.
+	if errors.Is(err, errTransitMountMissing) || errors.Is(err, errTransitKeyMissing) {
+		detail := errorDetail(err)
+		if errors.Is(err, errTransitKeyMissing) {
+			detail += ". A missing key is created by its first encryption when the token is allowed to"
+		}
+		if strict {
+			diags.AddAttributeError(attr, "transit key unavailable", detail)
+		} else {
+			diags.AddAttributeWarning(attr, "transit key unavailable", detail)
+		}
+		return diags
+	}
+	if err != nil {
+		if strict {
+			diags.AddAttributeError(path.Root("require_safe_transit_key"), "failed to check the transit key", fmt.Sprintf("the config of transit key %q could not be read to check it is safe: %s", v.key, errorDetail(err)))
+			return diags
+		}
+		tflog.Debug(ctx, "skipped the transit key safety check, its config cannot be read", map[string]any{"key": v.key, "error": errorDetail(err)})
+		return diags
+	}
+
+	for _, setting := range riskyKeySettings {
+		enabled, ok := s.Data[setting.name].(bool)
+		if !ok || !enabled {
+			continue
+		}
+		summary := "risky transit key setting"
+		detail := fmt.Sprintf("transit key %q has %s set: %s. Turn it off on the key", v.key, setting.name, setting.risk)
+		if strict {
+			diags.AddAttributeError(attr, summary, detail+", or unset require_safe_transit_key")
+		} else {
+			diags.AddAttributeWarning(attr, summary, detail)
+		}
+	}
+	return diags
+}
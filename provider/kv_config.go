@@ -0,0 +1,192 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/booldefault"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/int64default"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringdefault"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+// Ensure provider defined types fully satisfy framework interfaces.
+var _ resource.Resource = &KVConfigResource{}
+
+func NewKVConfigResource() resource.Resource {
+	return &KVConfigResource{}
+}
+
+// KVConfigResource manages the configuration of the KVv2 mount.
+type KVConfigResource struct {
+	ProviderData
+}
+
+// KVConfigModel describes the resource data model.
+type KVConfigModel struct {
+	MaxVersions        types.Int64  `tfsdk:"max_versions"`
+	CASRequired        types.Bool   `tfsdk:"cas_required"`
+	DeleteVersionAfter types.String `tfsdk:"delete_version_after"`
+}
+
+func (r *KVConfigResource) Metadata(ctx context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_kv_config"
+}
+
+func (r *KVConfigResource) Schema(ctx context.Context, req resource.SchemaRequest, resp *resource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		MarkdownDescription: "Mount-wide configuration of the KVv2 engine at `kv_path`. Destroying it resets the Vault defaults.",
+		Attributes: map[string]schema.Attribute{
+			"max_versions": schema.Int64Attribute{
+				Optional:    true,
+				Computed:    true,
+				Default:     int64default.StaticInt64(0),
+				Description: "Number of versions kept per secret, 0 means the Vault default (10)",
+			},
+			"cas_required": schema.BoolAttribute{
+				Optional:    true,
+				Computed:    true,
+				Default:     booldefault.StaticBool(false),
+				Description: "Require the cas parameter on every write",
+			},
+			"delete_version_after": schema.StringAttribute{
+				Optional:    true,
+				Computed:    true,
+				Default:     stringdefault.StaticString("0s"),
+				Description: "Duration after which versions are deleted, 0s disables it",
+				Validators:  []validator.String{durationValidator{}},
+			},
+		},
+	}
+}
+
+func (r *KVConfigResource) Configure(ctx context.Context, req resource.ConfigureRequest, resp *resource.ConfigureResponse) {
+	// Prevent panic if the provider has not been configured.
+	if req.ProviderData == nil {
+		return
+	}
+
+	providerData, ok := req.ProviderData.(ProviderData)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Resource Configure Type",
+			fmt.Sprintf("Expected ProviderData, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+		)
+		return
+	}
+
+	r.ProviderData = providerData
+}
+
+func (r *KVConfigResource) configPath() string {
+	return strings.TrimSuffix(r.kv.path, "/") + "/config"
+}
+
+func (r *KVConfigResource) write(ctx context.Context, data KVConfigModel) error {
+	if err := r.kv.checkWritable(); err != nil {
+		return err
+	}
+
+	_, err := r.kv.client.Logical().WriteWithContext(ctx, r.configPath(), map[string]any{
+		"max_versions":         data.MaxVersions.ValueInt64(),
+		"cas_required":         data.CASRequired.ValueBool(),
+		"delete_version_after": data.DeleteVersionAfter.ValueString(),
+	})
+	return err
+}
+
+func (r *KVConfigResource) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
+	var data KVConfigModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if err := r.write(ctx, data); err != nil {
+		resp.Diagnostics.AddError("failed to write KV config", errorDetail(err))
+		return
+	}
+	r.kv.audit(ctx, "create", r.configPath(), nil, 0, &resp.Diagnostics)
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *KVConfigResource) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
+	var data KVConfigModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	s, err := r.kv.client.Logical().ReadWithContext(ctx, r.configPath())
+	if err != nil {
+		resp.Diagnostics.AddError("failed to read KV config", errorDetail(err))
+		return
+	}
+	if s == nil {
+		resp.Diagnostics.AddError("failed to read KV config", fmt.Sprintf("no configuration found at %q", r.configPath()))
+		return
+	}
+
+	if n, ok := s.Data["max_versions"].(json.Number); ok {
+		maxVersions, err := n.Int64()
+		if err != nil {
+			resp.Diagnostics.AddError("failed to read KV config", errorDetail(err))
+			return
+		}
+		data.MaxVersions = types.Int64Value(maxVersions)
+	}
+
+	if casRequired, ok := s.Data["cas_required"].(bool); ok {
+		data.CASRequired = types.BoolValue(casRequired)
+	}
+
+	// Vault normalizes durations (768h becomes 768h0m0s), only report drift
+	// when the actual duration changed.
+	if deleteVersionAfter, ok := s.Data["delete_version_after"].(string); ok {
+		current, err := time.ParseDuration(data.DeleteVersionAfter.ValueString())
+		live, liveErr := time.ParseDuration(deleteVersionAfter)
+		if err != nil || liveErr != nil || current != live {
+			data.DeleteVersionAfter = types.StringValue(deleteVersionAfter)
+		}
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *KVConfigResource) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
+	var plan KVConfigModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if err := r.write(ctx, plan); err != nil {
+		resp.Diagnostics.AddError("failed to write KV config", errorDetail(err))
+		return
+	}
+	r.kv.audit(ctx, "update", r.configPath(), nil, 0, &resp.Diagnostics)
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &plan)...)
+}
+
+// Delete resets the Vault defaults, the config endpoint cannot be deleted.
+func (r *KVConfigResource) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
+	defaults := KVConfigModel{
+		MaxVersions:        types.Int64Value(0),
+		CASRequired:        types.BoolValue(false),
+		DeleteVersionAfter: types.StringValue("0s"),
+	}
+
+	if err := r.write(ctx, defaults); err != nil {
+		resp.Diagnostics.AddError("failed to reset KV config", errorDetail(err))
+		return
+	}
+	r.kv.audit(ctx, "delete", r.configPath(), nil, 0, &resp.Diagnostics)
+}
@@ -0,0 +1,173 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/datasource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+// Ensure provider defined types fully satisfy framework interfaces.
+var _ datasource.DataSource = &ManagedSecretsDataSource{}
+
+const (
+	defaultListMaxDepth    = 16
+	defaultListConcurrency = 8
+)
+
+var (
+	listPrefixAttribute = schema.StringAttribute{
+		Optional:    true,
+		Description: "Only list the secrets under this folder, relative to `path_prefix`",
+	}
+	listMaxDepthAttribute = schema.Int64Attribute{
+		Optional:    true,
+		Description: fmt.Sprintf("Number of folders to descend below `prefix`, defaults to %d", defaultListMaxDepth),
+		Validators:  []validator.Int64{int64AtLeastValidator{min: 0}},
+	}
+	listConcurrencyAttribute = schema.Int64Attribute{
+		Optional:    true,
+		Description: fmt.Sprintf("Number of metadata reads running at once, defaults to %d", defaultListConcurrency),
+		Validators:  []validator.Int64{int64AtLeastValidator{min: 1}},
+	}
+)
+
+// listOwned is ListOwned taking the listing attributes of a data source.
+func (v vaultKV) listOwned(ctx context.Context, prefix types.String, maxDepth, concurrency types.Int64) ([]ownedSecret, error) {
+	depth := int64(defaultListMaxDepth)
+	if !maxDepth.IsNull() {
+		depth = maxDepth.ValueInt64()
+	}
+	workers := int64(defaultListConcurrency)
+	if !concurrency.IsNull() {
+		workers = concurrency.ValueInt64()
+	}
+
+	folder := prefix.ValueString()
+	if folder != "" && !strings.HasSuffix(folder, "/") {
+		folder += "/"
+	}
+
+	owned, err := v.ListOwned(ctx, v.secretPath(folder), int(depth), int(workers))
+	if err != nil {
+		return nil, err
+	}
+
+	// Report paths the way resources declare them, relative to path_prefix,
+	// leaving out the ones outside of allowed_path_prefixes.
+	allowed := owned[:0]
+	for _, s := range owned {
+		if !v.pathAllowed(s.path) && !v.warnOnDisallowedPaths {
+			continue
+		}
+		s.path = strings.TrimPrefix(s.path, v.pathPrefix)
+		allowed = append(allowed, s)
+	}
+	return allowed, nil
+}
+
+func NewManagedSecretsDataSource() datasource.DataSource {
+	return &ManagedSecretsDataSource{}
+}
+
+// ManagedSecretsDataSource lists the secrets carrying our ownership marker.
+type ManagedSecretsDataSource struct {
+	ProviderData
+}
+
+// ManagedSecretsModel describes the data source data model.
+type ManagedSecretsModel struct {
+	Prefix      types.String         `tfsdk:"prefix"`
+	MaxDepth    types.Int64          `tfsdk:"max_depth"`
+	Concurrency types.Int64          `tfsdk:"concurrency"`
+	Secrets     []ManagedSecretModel `tfsdk:"secrets"`
+}
+
+// ManagedSecretModel describes a listed secret.
+type ManagedSecretModel struct {
+	Path           string `tfsdk:"path"`
+	CurrentVersion int64  `tfsdk:"current_version"`
+	UpdatedTime    string `tfsdk:"updated_time"`
+}
+
+func (d *ManagedSecretsDataSource) Metadata(ctx context.Context, req datasource.MetadataRequest, resp *datasource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_managed_secrets"
+}
+
+func (d *ManagedSecretsDataSource) Schema(ctx context.Context, req datasource.SchemaRequest, resp *datasource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		MarkdownDescription: "Secrets of the KVv2 mount whose ownership marker matches `managed_by`, e.g. to compare them against the state.",
+		Attributes: map[string]schema.Attribute{
+			"prefix":      listPrefixAttribute,
+			"max_depth":   listMaxDepthAttribute,
+			"concurrency": listConcurrencyAttribute,
+			"secrets": schema.ListNestedAttribute{
+				Computed:    true,
+				Description: "The secrets, sorted by path",
+				NestedObject: schema.NestedAttributeObject{
+					Attributes: map[string]schema.Attribute{
+						"path": schema.StringAttribute{
+							Computed:    true,
+							Description: "Path of the secret, relative to `path_prefix`",
+						},
+						"current_version": schema.Int64Attribute{
+							Computed: true,
+						},
+						"updated_time": schema.StringAttribute{
+							Computed:    true,
+							Description: "Time of the latest write, in RFC 3339 format",
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func (d *ManagedSecretsDataSource) Configure(ctx context.Context, req datasource.ConfigureRequest, resp *datasource.ConfigureResponse) {
+	// Prevent panic if the provider has not been configured.
+	if req.ProviderData == nil {
+		return
+	}
+
+	providerData, ok := req.ProviderData.(ProviderData)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Data Source Configure Type",
+			fmt.Sprintf("Expected ProviderData, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+		)
+		return
+	}
+
+	d.ProviderData = providerData
+}
+
+func (d *ManagedSecretsDataSource) Read(ctx context.Context, req datasource.ReadRequest, resp *datasource.ReadResponse) {
+	var data ManagedSecretsModel
+	resp.Diagnostics.Append(req.Config.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	owned, err := d.kv.listOwned(ctx, data.Prefix, data.MaxDepth, data.Concurrency)
+	if err != nil {
+		resp.Diagnostics.AddError("failed to list secrets", errorDetail(err))
+		return
+	}
+
+	data.Secrets = make([]ManagedSecretModel, 0, len(owned))
+	for _, s := range owned {
+		data.Secrets = append(data.Secrets, ManagedSecretModel{
+			Path:           s.path,
+			CurrentVersion: int64(s.metadata.CurrentVersion),
+			UpdatedTime:    s.metadata.UpdatedTime.Format(time.RFC3339),
+		})
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
@@ -0,0 +1,176 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/tfsdk"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/vault/api"
+)
+
+// mirroredHMACKey is the private state key holding the HMAC of the data
+// written to the additional paths, to detect their drift without keeping it.
+const mirroredHMACKey = "mirrored_hmac"
+
+// checkAdditionalPaths checks the additional paths planned alongside path
+// like path itself, and that none of them repeats another.
+func (r *SecretResource) checkAdditionalPaths(ctx context.Context, plan tfsdk.Plan, p string, diags *diag.Diagnostics) {
+	var list types.List
+	diags.Append(plan.GetAttribute(ctx, path.Root("additional_paths"), &list)...)
+	if diags.HasError() || list.IsNull() || list.IsUnknown() {
+		return
+	}
+
+	var paths []types.String
+	diags.Append(list.ElementsAs(ctx, &paths, false)...)
+	if diags.HasError() {
+		return
+	}
+
+	seen := map[string]bool{r.kv.secretPath(p): true}
+	for i, additional := range paths {
+		if additional.IsUnknown() {
+			continue
+		}
+
+		attr := path.Root("additional_paths").AtListIndex(i)
+		k := r.kv.secretPath(additional.ValueString())
+		r.kv.checkPathAllowed(k, attr, diags)
+		if err := r.kv.checkSecretPath(k); err != nil {
+			diags.AddAttributeError(attr, "invalid secret path", fmt.Sprintf("additional_paths[%d] = %q: %s", i, additional.ValueString(), err))
+		}
+		if seen[k] {
+			diags.AddAttributeError(attr, "duplicate secret path", fmt.Sprintf("%s is already written by this resource", r.kv.fullPath(k)))
+		}
+		seen[k] = true
+	}
+}
+
+// writeMirrors writes value to every additional path of data and returns the
+// paths written. A path that fails is reported on its own, the others are
+// still written. Each write is audited as operation changing keys.
+func (r *SecretResource) writeMirrors(ctx context.Context, private privateState, operation string, data SecretModel, keys []string, value, metadata map[string]any, always bool, diags *diag.Diagnostics) []string {
+	if len(data.AdditionalPaths) == 0 {
+		return data.AdditionalPaths
+	}
+
+	input, err := canonicalContent(value)
+	if err == nil {
+		var hmac string
+		hmac, err = r.transit.HMAC(ctx, input)
+		diags.Append(setPrivateValue(ctx, private, mirroredHMACKey, hmac)...)
+	}
+	if err != nil {
+		diags.AddAttributeError(path.Root("additional_paths"), "failed to write additional paths", errorDetail(err))
+		return nil
+	}
+
+	written := make([]string, 0, len(data.AdditionalPaths))
+	for i, p := range data.AdditionalPaths {
+		k := r.kv.secretPath(p)
+
+		version, err := r.writeMirror(ctx, k, data, value, metadata, always, diags)
+		if err != nil {
+			diags.AddAttributeError(
+				path.Root("additional_paths").AtListIndex(i),
+				"failed to write additional path",
+				fmt.Sprintf("%s: %s. It is written again on the next apply", r.kv.fullPath(k), errorDetail(err)),
+			)
+			continue
+		}
+		r.kv.audit(ctx, operation, r.kv.fullPath(k), keys, version, diags)
+		written = append(written, p)
+	}
+	return written
+}
+
+// writeMirror writes value to the additional path k, taking it over first
+// when force_takeover_from is set, and returns its version.
+func (r *SecretResource) writeMirror(ctx context.Context, k string, data SecretModel, value, metadata map[string]any, always bool, diags *diag.Diagnostics) (int, error) {
+	if from := data.ForceTakeoverFrom.ValueString(); from != "" {
+		takenOver, err := r.takeOver(ctx, k, from, maps.Clone(metadata))
+		if err != nil {
+			return 0, err
+		}
+		if takenOver {
+			r.warnTakenOver(k, from, diags)
+		}
+	}
+
+	if always {
+		return r.kv.Put(ctx, k, value, metadata)
+	}
+	return r.kv.PutIfChanged(ctx, k, value, metadata)
+}
+
+// deleteMirrors deletes the additional paths of state, written under prefix,
+// that plan no longer lists there, and returns the ones that could not be
+// deleted.
+func (r *SecretResource) deleteMirrors(ctx context.Context, prefix string, state, plan SecretModel, diags *diag.Diagnostics) []string {
+	var kept []string
+	for _, p := range state.AdditionalPaths {
+		k := prefix + p
+		if k == r.kv.secretPath(p) && slices.Contains(plan.AdditionalPaths, p) {
+			continue
+		}
+
+		err := r.kv.Destroy(ctx, k, state.ShredOnDestroy.ValueBool())
+		if err == nil {
+			r.kv.audit(ctx, "delete", r.kv.fullPath(k), state.managedKeys(), 0, diags)
+		} else if !errors.Is(err, api.ErrSecretNotFound) && !r.kv.mountMissing(ctx, err) {
+			diags.AddError(
+				"failed to delete additional path",
+				fmt.Sprintf("%s: %s. It is deleted again on the next apply", r.kv.fullPath(k), errorDetail(err)),
+			)
+			kept = append(kept, p)
+		}
+	}
+	return kept
+}
+
+// verifyMirrors drops from data the additional paths, written under prefix,
+// that are missing, no longer ours or no longer hold what was written, so the
+// next apply writes them again.
+func (r *SecretResource) verifyMirrors(ctx context.Context, private privateState, prefix string, data *SecretModel) error {
+	if len(data.AdditionalPaths) == 0 {
+		return nil
+	}
+
+	var hmac string
+	if diags := getPrivateValue(ctx, private, mirroredHMACKey, &hmac); diags.HasError() {
+		return errors.New("failed to read the HMAC of the additional paths")
+	}
+
+	verified := make([]string, 0, len(data.AdditionalPaths))
+	for _, p := range data.AdditionalPaths {
+		mirror, err := r.kv.client.KVv2(r.kv.path).Get(ctx, prefix+p)
+		if errors.Is(err, api.ErrSecretNotFound) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if hmac == "" || r.kv.checkOwnership(prefix+p, mirror.CustomMetadata) != nil {
+			continue
+		}
+
+		input, err := canonicalContent(mirror.Data)
+		if err != nil {
+			return err
+		}
+		valid, err := r.transit.VerifyHMAC(ctx, input, hmac)
+		if err != nil {
+			return err
+		}
+		if valid {
+			verified = append(verified, p)
+		}
+	}
+	data.AdditionalPaths = verified
+	return nil
+}
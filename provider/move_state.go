@@ -0,0 +1,170 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/vault/api"
+)
+
+var _ resource.ResourceWithMoveState = &SecretResource{}
+
+// vaultProviderAddress is the address of the official Vault provider, whose
+// KV resources can be moved to secrets.
+const vaultProviderAddress = "registry.terraform.io/hashicorp/vault"
+
+// movedVaultSecret holds the attributes of vault_kv_secret_v2 and
+// vault_generic_secret the move needs.
+type movedVaultSecret struct {
+	Mount    string `json:"mount"`
+	Name     string `json:"name"`
+	Path     string `json:"path"`
+	DataJSON string `json:"data_json"`
+}
+
+func (r *SecretResource) MoveState(ctx context.Context) []resource.StateMover {
+	return []resource.StateMover{
+		{StateMover: r.moveVaultSecret},
+	}
+}
+
+// moveVaultSecret moves a vault_kv_secret_v2 or vault_generic_secret of the
+// KVv2 mount to a secret: its values are encrypted with transit, as they are
+// rather than as base64, and the secret is marked as managed by this
+// configuration, like an import.
+func (r *SecretResource) moveVaultSecret(ctx context.Context, req resource.MoveStateRequest, resp *resource.MoveStateResponse) {
+	if req.SourceProviderAddress != vaultProviderAddress ||
+		(req.SourceTypeName != "vault_kv_secret_v2" && req.SourceTypeName != "vault_generic_secret") {
+		return
+	}
+
+	if req.SourceRawState == nil {
+		resp.Diagnostics.AddError("failed to move secret", "the source state is empty")
+		return
+	}
+
+	var source movedVaultSecret
+	if err := json.Unmarshal(req.SourceRawState.JSON, &source); err != nil {
+		resp.Diagnostics.AddError("failed to move secret", fmt.Sprintf("failed to decode the %s state: %s", req.SourceTypeName, err))
+		return
+	}
+
+	secretPath, err := r.movedSecretPath(req.SourceTypeName, source)
+	if err != nil {
+		resp.Diagnostics.AddError("failed to move secret", err.Error())
+		return
+	}
+	r.kv.checkPathAllowed(secretPath, path.Root("path"), &resp.Diagnostics)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	var values map[string]any
+	if err := json.Unmarshal([]byte(source.DataJSON), &values); err != nil {
+		resp.Diagnostics.AddError("failed to move secret", fmt.Sprintf("data_json of %s is not a JSON object: %s", r.kv.fullPath(secretPath), err))
+		return
+	}
+
+	var notStrings []string
+	for k, v := range values {
+		if _, ok := v.(string); !ok {
+			notStrings = append(notStrings, k)
+		}
+	}
+	if len(notStrings) > 0 {
+		slices.Sort(notStrings)
+		resp.Diagnostics.AddError(
+			"values must be strings",
+			fmt.Sprintf("encrypted_secrets only holds strings, these keys of %s do not: %s. Rewrite them as strings before moving the secret", r.kv.fullPath(secretPath), strings.Join(notStrings, ", ")),
+		)
+		return
+	}
+
+	data := SecretModel{
+		Path:                   strings.TrimPrefix(secretPath, r.kv.pathPrefix),
+		EncryptedSecrets:       make(map[string]*string),
+		Protected:              types.BoolValue(false),
+		AlwaysWrite:            types.BoolValue(false),
+		UpdateStrategy:         types.StringValue("replace"),
+		PreserveUnmanagedKeys:  types.BoolValue(false),
+		ExpectNoExternalWrites: types.BoolValue(false),
+		ShredOnDestroy:         types.BoolValue(false),
+		OnExternalChange:       types.StringValue("reconcile"),
+		ValuesAreBase64:        types.BoolValue(false),
+		ExposePlaintext:        types.BoolValue(false),
+		AdoptExisting:          types.BoolValue(false),
+		Timeouts:               nullTimeouts(),
+	}
+	for k, v := range values {
+		encrypted, err := r.transit.Encrypt(ctx, v.(string))
+		if err != nil {
+			resp.Diagnostics.AddError("failed to encrypt secret", errorDetail(err))
+			return
+		}
+		data.EncryptedSecrets[k] = &encrypted
+	}
+	data.ExternalKeys = data.externalKeys(values)
+	data.UIURL = types.StringValue(r.kv.uiURL(secretPath))
+	data.RewrappedCiphertexts = types.MapNull(types.StringType)
+	data.Plaintext = types.MapNull(types.StringType)
+
+	meta, err := r.kv.client.KVv2(r.kv.path).GetMetadata(ctx, secretPath)
+	if errors.Is(err, api.ErrSecretNotFound) {
+		resp.Diagnostics.AddError("secret not found", fmt.Sprintf("no secret found at %s", r.kv.fullPath(secretPath)))
+		return
+	} else if err != nil {
+		resp.Diagnostics.AddError("failed to read secret metadata", errorDetail(err))
+		return
+	}
+
+	// Keep an existing deletion lock, like an import.
+	metadata := make(map[string]any)
+	if meta.CustomMetadata[deletionProtectedKey] == "true" {
+		metadata[deletionProtectedKey] = "true"
+		data.Protected = types.BoolValue(true)
+	}
+
+	if err := r.kv.OverwriteManagedbyMeta(ctx, secretPath, metadata); err != nil {
+		resp.Diagnostics.AddError("failed to mark secret as managed by Terraform", errorDetail(err))
+		return
+	}
+
+	resp.Diagnostics.Append(setPathPrefix(ctx, resp.TargetPrivate, r.kv.pathPrefix)...)
+	resp.Diagnostics.Append(setWrittenVersion(ctx, resp.TargetPrivate, meta.CurrentVersion)...)
+	resp.Diagnostics.Append(setPrivateValue(ctx, resp.TargetPrivate, managedByKey, r.kv.managedBy)...)
+	resp.Diagnostics.Append(resp.TargetState.Set(ctx, &data)...)
+}
+
+// movedSecretPath returns the path of the moved secret in the KVv2 mount,
+// which must be the one of the provider.
+func (r *SecretResource) movedSecretPath(typeName string, source movedVaultSecret) (string, error) {
+	mount := strings.Trim(r.kv.path, "/")
+
+	var secretPath string
+	switch typeName {
+	case "vault_kv_secret_v2":
+		if strings.Trim(source.Mount, "/") != mount {
+			return "", fmt.Errorf("the secret is in mount %q, the provider manages %q", source.Mount, mount)
+		}
+		secretPath = strings.Trim(source.Name, "/")
+	case "vault_generic_secret":
+		// KVv2 secrets are written through the data/ endpoint.
+		rest, ok := strings.CutPrefix(strings.Trim(source.Path, "/"), mount+"/data/")
+		if !ok {
+			return "", fmt.Errorf("%q is not a KVv2 secret of mount %q", source.Path, mount)
+		}
+		secretPath = rest
+	}
+
+	if !strings.HasPrefix(secretPath, r.kv.pathPrefix) {
+		return "", fmt.Errorf("%s is outside of path_prefix %q", r.kv.fullPath(secretPath), r.kv.pathPrefix)
+	}
+	return secretPath, nil
+}
@@ -0,0 +1,99 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/datasource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+// Ensure provider defined types fully satisfy framework interfaces.
+var _ datasource.DataSource = &OrphansDataSource{}
+
+func NewOrphansDataSource() datasource.DataSource {
+	return &OrphansDataSource{}
+}
+
+// OrphansDataSource lists the secrets carrying our ownership marker that are
+// no longer declared.
+type OrphansDataSource struct {
+	ProviderData
+}
+
+// OrphansModel describes the data source data model.
+type OrphansModel struct {
+	DeclaredPaths []string     `tfsdk:"declared_paths"`
+	Prefix        types.String `tfsdk:"prefix"`
+	MaxDepth      types.Int64  `tfsdk:"max_depth"`
+	Concurrency   types.Int64  `tfsdk:"concurrency"`
+	Orphans       []string     `tfsdk:"orphans"`
+}
+
+func (d *OrphansDataSource) Metadata(ctx context.Context, req datasource.MetadataRequest, resp *datasource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_orphans"
+}
+
+func (d *OrphansDataSource) Schema(ctx context.Context, req datasource.SchemaRequest, resp *datasource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		MarkdownDescription: "Secrets of the KVv2 mount whose ownership marker matches `managed_by` but which are missing from `declared_paths`, e.g. to fail a precondition or drive a cleanup.",
+		Attributes: map[string]schema.Attribute{
+			"declared_paths": schema.SetAttribute{
+				Required:    true,
+				ElementType: types.StringType,
+				Description: "Paths of the secrets declared in the configuration, as set in their `path`",
+			},
+			"prefix":      listPrefixAttribute,
+			"max_depth":   listMaxDepthAttribute,
+			"concurrency": listConcurrencyAttribute,
+			"orphans": schema.SetAttribute{
+				Computed:    true,
+				ElementType: types.StringType,
+				Description: "Paths of the owned secrets missing from `declared_paths`",
+			},
+		},
+	}
+}
+
+func (d *OrphansDataSource) Configure(ctx context.Context, req datasource.ConfigureRequest, resp *datasource.ConfigureResponse) {
+	// Prevent panic if the provider has not been configured.
+	if req.ProviderData == nil {
+		return
+	}
+
+	providerData, ok := req.ProviderData.(ProviderData)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Data Source Configure Type",
+			fmt.Sprintf("Expected ProviderData, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+		)
+		return
+	}
+
+	d.ProviderData = providerData
+}
+
+func (d *OrphansDataSource) Read(ctx context.Context, req datasource.ReadRequest, resp *datasource.ReadResponse) {
+	var data OrphansModel
+	resp.Diagnostics.Append(req.Config.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	owned, err := d.kv.listOwned(ctx, data.Prefix, data.MaxDepth, data.Concurrency)
+	if err != nil {
+		resp.Diagnostics.AddError("failed to list secrets", errorDetail(err))
+		return
+	}
+
+	data.Orphans = make([]string, 0)
+	for _, s := range owned {
+		if !slices.Contains(data.DeclaredPaths, s.path) {
+			data.Orphans = append(data.Orphans, s.path)
+		}
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
@@ -0,0 +1,118 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/datasource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/vault/api"
+)
+
+// Ensure provider defined types fully satisfy framework interfaces.
+var _ datasource.DataSource = &OwnershipDataSource{}
+
+func NewOwnershipDataSource() datasource.DataSource {
+	return &OwnershipDataSource{}
+}
+
+// OwnershipDataSource reports the ownership marker of a secret, from its
+// metadata only.
+type OwnershipDataSource struct {
+	ProviderData
+}
+
+// OwnershipModel describes the data source data model.
+type OwnershipModel struct {
+	Path        string       `tfsdk:"path"`
+	Exists      types.Bool   `tfsdk:"exists"`
+	Managed     types.Bool   `tfsdk:"managed"`
+	ManagedBy   types.String `tfsdk:"managed_by"`
+	ManagedByUs types.Bool   `tfsdk:"managed_by_us"`
+}
+
+func (d *OwnershipDataSource) Metadata(ctx context.Context, req datasource.MetadataRequest, resp *datasource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_ownership"
+}
+
+func (d *OwnershipDataSource) Schema(ctx context.Context, req datasource.SchemaRequest, resp *datasource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		MarkdownDescription: "Ownership marker of a secret, e.g. to check a secret is free before importing it. A missing secret is not an error, `exists` is false.",
+		Attributes: map[string]schema.Attribute{
+			"path": schema.StringAttribute{
+				Required:    true,
+				Description: "Path of the secret, relative to `path_prefix`",
+			},
+			"exists": schema.BoolAttribute{
+				Computed:    true,
+				Description: "Whether the secret has metadata",
+			},
+			"managed": schema.BoolAttribute{
+				Computed:    true,
+				Description: "Whether the secret carries an ownership marker, from any configuration",
+			},
+			"managed_by": schema.StringAttribute{
+				Computed:    true,
+				Description: "Value of the ownership marker, null when there is none",
+			},
+			"managed_by_us": schema.BoolAttribute{
+				Computed:    true,
+				Description: "Whether the ownership marker is the `managed_by` of this provider",
+			},
+		},
+	}
+}
+
+func (d *OwnershipDataSource) Configure(ctx context.Context, req datasource.ConfigureRequest, resp *datasource.ConfigureResponse) {
+	// Prevent panic if the provider has not been configured.
+	if req.ProviderData == nil {
+		return
+	}
+
+	providerData, ok := req.ProviderData.(ProviderData)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Data Source Configure Type",
+			fmt.Sprintf("Expected ProviderData, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+		)
+		return
+	}
+
+	d.ProviderData = providerData
+}
+
+func (d *OwnershipDataSource) Read(ctx context.Context, req datasource.ReadRequest, resp *datasource.ReadResponse) {
+	var data OwnershipModel
+	resp.Diagnostics.Append(req.Config.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	secretPath := d.kv.secretPath(data.Path)
+	d.kv.checkPathAllowed(secretPath, path.Root("path"), &resp.Diagnostics)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	data.Exists = types.BoolValue(true)
+	data.Managed = types.BoolValue(false)
+	data.ManagedBy = types.StringNull()
+	data.ManagedByUs = types.BoolValue(false)
+
+	meta, err := d.kv.client.KVv2(d.kv.path).GetMetadata(ctx, secretPath)
+	if errors.Is(err, api.ErrSecretNotFound) {
+		data.Exists = types.BoolValue(false)
+	} else if err != nil {
+		resp.Diagnostics.AddError("failed to read secret metadata", errorDetail(err))
+		return
+	} else if managedBy, ok := d.kv.ownershipMarker(meta.CustomMetadata); ok {
+		data.Managed = types.BoolValue(true)
+		data.ManagedBy = types.StringValue(fmt.Sprint(managedBy))
+		data.ManagedByUs = types.BoolValue(managedBy == d.kv.managedBy)
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
@@ -2,18 +2,50 @@ package provider
 
 import (
 	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"filippo.io/age"
+	"github.com/hashicorp/terraform-plugin-framework/action"
 	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/ephemeral"
+	"github.com/hashicorp/terraform-plugin-framework/function"
+	"github.com/hashicorp/terraform-plugin-framework/path"
 	"github.com/hashicorp/terraform-plugin-framework/provider"
 	"github.com/hashicorp/terraform-plugin-framework/provider/schema"
 	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
 	"github.com/hashicorp/terraform-plugin-framework/types"
 	"github.com/hashicorp/terraform-plugin-framework/types/basetypes"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	vault "github.com/hashicorp/vault/api"
+)
+
+// Ensure the provider serves ephemeral resources, functions and actions.
+var (
+	_ provider.ProviderWithEphemeralResources = &Provider{}
+	_ provider.ProviderWithFunctions          = &Provider{}
+	_ provider.ProviderWithActions            = &Provider{}
 )
 
 // Provider defines the providervimplemengation.
 type Provider struct {
 	version string
+	// stats counts the Vault calls of the run, from Configure on.
+	stats *operationStats
+	// transit is the transit key of Configure, for the functions. Terraform
+	// may call them in a process it never configures the provider in, they
+	// then use envTransit.
+	transit    atomic.Pointer[vaultTransit]
+	envTransit func() (*vaultTransit, error)
 }
 
 // ProviderModel describes the provider data model.
@@ -25,6 +57,41 @@ type ProviderModel struct {
 	TransitKey  types.String `tfsdk:"transit_key"`
 	KVPath      types.String `tfsdk:"kv_path"`
 	ManagedBy   types.String `tfsdk:"managed_by"`
+
+	ManagedByPrefix types.String `tfsdk:"managed_by_prefix"`
+
+	OwnershipMetadataKey     types.String `tfsdk:"ownership_metadata_key"`
+	ReadOnly                 types.Bool   `tfsdk:"read_only"`
+	ForbidMetadataDelete     types.Bool   `tfsdk:"forbid_metadata_delete"`
+	AuditMetadata            types.Map    `tfsdk:"audit_metadata"`
+	DefaultCustomMetadata    types.Map    `tfsdk:"default_custom_metadata"`
+	CheckCapabilities        types.Bool   `tfsdk:"check_capabilities"`
+	WaitForUnsealSeconds     types.Int64  `tfsdk:"wait_for_unseal_seconds"`
+	LoginRetries             types.Int64  `tfsdk:"login_retries"`
+	LoginRetryInterval       types.String `tfsdk:"login_retry_interval"`
+	TokenTTLWarning          types.String `tfsdk:"token_ttl_warning"`
+	PathPrefix               types.String `tfsdk:"path_prefix"`
+	TestMode                 types.String `tfsdk:"test_mode"`
+	AllowHTTP                types.Bool   `tfsdk:"allow_http"`
+	TransitFallbackKeys      types.List   `tfsdk:"transit_fallback_keys"`
+	TransitRoutes            types.List   `tfsdk:"transit_routes"`
+	RefreshMode              types.String `tfsdk:"refresh_mode"`
+	TransitRequestCoalescing types.Bool   `tfsdk:"transit_request_coalescing"`
+	TransitBatchSize         types.Int64  `tfsdk:"transit_batch_size"`
+	UserAgentSuffix          types.String `tfsdk:"user_agent_suffix"`
+	WriteProvenanceMetadata  types.Bool   `tfsdk:"write_provenance_metadata"`
+	AllowedPathPrefixes      types.List   `tfsdk:"allowed_path_prefixes"`
+	DeniedPathPrefixes       types.List   `tfsdk:"denied_path_prefixes"`
+	WarnOnDisallowedPaths    types.Bool   `tfsdk:"warn_on_disallowed_paths"`
+	SigningKey               types.String `tfsdk:"signing_key"`
+	VerifySignatures         types.Bool   `tfsdk:"verify_signatures"`
+	TransitKeyVersion        types.Int64  `tfsdk:"transit_key_version"`
+	MaxSecretBytes           types.Int64  `tfsdk:"max_secret_bytes"`
+	AuditLogPath             types.String `tfsdk:"audit_log_path"`
+	RequireSafeTransitKey    types.Bool   `tfsdk:"require_safe_transit_key"`
+	AgeIdentityFile          types.String `tfsdk:"age_identity_file"`
+	KeyNamePattern           types.String `tfsdk:"key_name_pattern"`
+	StrictKeyNames           types.Bool   `tfsdk:"strict_key_names"`
 }
 
 func (p *Provider) Metadata(ctx context.Context, req provider.MetadataRequest, resp *provider.MetadataResponse) {
@@ -45,11 +112,165 @@ func (p *Provider) Schema(ctx context.Context, req provider.SchemaRequest, resp
 			"transit_key": schema.StringAttribute{
 				Required: true,
 			},
+			"transit_key_version": schema.Int64Attribute{
+				Optional:    true,
+				Description: "Version of `transit_key` values are encrypted with, defaults to the latest. Pins every ciphertext of a release to the same version during staged rotations, it cannot be below the `min_encryption_version` of the key",
+				Validators:  []validator.Int64{int64AtLeastValidator{min: 1}},
+			},
+			"require_safe_transit_key": schema.BoolAttribute{
+				Optional:    true,
+				Description: "Fail instead of warning when `transit_key` has `deletion_allowed`, `exportable` or `allow_plaintext_backup` set, or when its config cannot be read to check them, defaults to false",
+			},
+			"max_secret_bytes": schema.Int64Attribute{
+				Optional:    true,
+				Description: "Largest secret written, in bytes once serialized to JSON, defaults to 1047552: the 1 MiB Vault limit minus room for the rest of the request. Larger secrets fail the plan when their ciphertexts are known, or the apply before anything is written, with the size of every key",
+				Validators:  []validator.Int64{int64AtLeastValidator{min: 1}},
+			},
+			"transit_request_coalescing": schema.BoolAttribute{
+				Optional:    true,
+				Description: "Merge the decryptions of concurrent resource operations into transit batch calls, waiting up to 20ms for up to `transit_batch_size` ciphertexts",
+			},
+			"transit_batch_size": schema.Int64Attribute{
+				Optional:    true,
+				Description: "Largest number of ciphertexts sent in one transit batch call by `transit_request_coalescing`, defaults to 128. More ciphertexts are split into several calls, each caller still gets its own result or error. Lower it when batch calls hit the request size limit of Vault",
+				Validators:  []validator.Int64{int64AtLeastValidator{min: 1}},
+			},
+			"transit_fallback_keys": schema.ListAttribute{
+				Optional:    true,
+				ElementType: types.StringType,
+				Description: "Transit keys tried in order when a ciphertext does not decrypt with `transit_key`, e.g. while migrating to a new key. Values are always encrypted with `transit_key`",
+			},
+			"transit_routes": transitRoutesSchema,
+			"key_name_pattern": schema.StringAttribute{
+				Optional:    true,
+				Description: "Regular expression every key of a secret must match in full, checked at plan time, e.g. for keys injected as environment variables. Keys are not checked by default",
+				Validators:  []validator.String{regexValidator{}},
+			},
+			"strict_key_names": schema.BoolAttribute{
+				Optional:    true,
+				Description: fmt.Sprintf("Check the keys of secrets against `key_name_pattern`, defaulting to `%s`: no spaces, dots or leading digits", defaultKeyNamePattern),
+			},
+			"age_identity_file": schema.StringAttribute{
+				Optional:    true,
+				Description: fmt.Sprintf("Path of an age identity file, one `AGE-SECRET-KEY-1...` X25519 identity per line, decrypting `age_encrypted_secrets` locally. Defaults to the identities in the `%s` environment variable", ageIdentityEnv),
+				Validators:  []validator.String{notEmptyValidator{}},
+			},
+			"signing_key": schema.StringAttribute{
+				Optional:    true,
+				Description: "Transit key (e.g. ed25519) signing the content of every secret written, the signature is stored in the `vsac_signature` custom metadata. Also the default key of the `sign` and `verify` functions",
+				Validators:  []validator.String{notEmptyValidator{}},
+			},
+			"verify_signatures": schema.BoolAttribute{
+				Optional:    true,
+				Description: "Verify the signature of every secret on refresh, a secret modified outside of Terraform fails. Secrets without a signature only warn. Requires `signing_key`",
+			},
 			"kv_path": schema.StringAttribute{
 				Required: true,
 			},
 			"managed_by": schema.StringAttribute{
-				Required: true,
+				Optional: true,
+				Description: "Value of the ownership marker written on every secret. Defaults to `<managed_by_prefix>-<workspace>` (`<workspace>` without a prefix), the workspace being read from `TF_WORKSPACE` (`default` when unset). Conflicts with `managed_by_prefix`. " +
+					"It must start with a letter or a digit, only contain letters, digits and `. _ : / @ -` and be at most 128 characters long. A secret written with another marker fails the plan, unless `force_takeover_from` moves it",
+				Validators: []validator.String{managedByValidator{}},
+			},
+			"managed_by_prefix": schema.StringAttribute{
+				Optional:    true,
+				Description: "Prefix of the ownership marker derived from the workspace when `managed_by` is not set",
+			},
+			"path_prefix": schema.StringAttribute{
+				Optional:    true,
+				Description: "Prefix prepended to the `path` of every secret, e.g. `apps/production/`. Changing it replaces the secrets, or moves those with `allow_rename`",
+			},
+			"allowed_path_prefixes": schema.ListAttribute{
+				Optional:    true,
+				ElementType: types.StringType,
+				Description: "Prefixes, including `path_prefix`, every secret path must start with, e.g. `team-a/`. Resources, imports and data sources outside of them fail",
+			},
+			"denied_path_prefixes": schema.ListAttribute{
+				Optional:    true,
+				ElementType: types.StringType,
+				Description: "Prefixes, including `path_prefix`, no secret path can start with, e.g. `infra/root/`. It wins over `allowed_path_prefixes` and also applies to imports and destroys",
+			},
+			"warn_on_disallowed_paths": schema.BoolAttribute{
+				Optional:    true,
+				Description: "Only warn about paths outside of `allowed_path_prefixes`, e.g. while migrating secrets",
+			},
+			"ownership_metadata_key": schema.StringAttribute{
+				Optional:    true,
+				Description: "Custom metadata key holding the ownership marker, defaults to `managed_by`. Secrets still carrying `managed_by` are migrated on their next write",
+			},
+			"audit_metadata": schema.MapAttribute{
+				Optional:    true,
+				ElementType: types.StringType,
+				Description: "Custom metadata merged into every secret on write, e.g. the CI run URL or commit SHA. It is not subject to drift detection and keeps describing the run that wrote the latest version",
+			},
+			"default_custom_metadata": schema.MapAttribute{
+				Optional:    true,
+				ElementType: types.StringType,
+				Description: "Custom metadata written on every secret, e.g. `owner` or `cost_center`. Values set by the resource win",
+			},
+			"forbid_metadata_delete": schema.BoolAttribute{
+				Optional:    true,
+				Description: "Only soft-delete the versions of destroyed secrets, never deleting their metadata nor destroying their data. `shred_on_destroy` cannot be set",
+			},
+			"read_only": schema.BoolAttribute{
+				Optional:    true,
+				Description: "Refuse any write to Vault, plans and drift detection keep working",
+			},
+			"audit_log_path": schema.StringAttribute{
+				Optional: true,
+				Description: "Path, relative to `kv_path` and not to `path_prefix`, of a log recording every create, update and delete: each one creates `<audit_log_path>/<YYYY-MM-DD>/<hhmmss.nnnnnnnnn>-<n>` with the operation, the path, the names of the keys changed, the resulting version, a timestamp and the ownership marker, never values. " +
+					"Entries are written whatever their ownership marker, so workspaces can share the log, and with check-and-set so none is ever overwritten. Failing to write an entry only warns, `read_only` included",
+				Validators: []validator.String{notEmptyValidator{}},
+			},
+			"user_agent_suffix": schema.StringAttribute{
+				Optional:    true,
+				Description: "Appended to the User-Agent of every Vault request, e.g. the name of the pipeline, to attribute requests in the audit logs",
+			},
+			"write_provenance_metadata": schema.BoolAttribute{
+				Optional:    true,
+				Description: "Record the provider and Terraform versions in the `vsac_provider_version` and `vsac_terraform_version` custom metadata of every secret written, defaults to true. Like `audit_metadata`, they are not subject to drift detection",
+			},
+			"wait_for_unseal_seconds": schema.Int64Attribute{
+				Optional:    true,
+				Description: "How long to wait, in seconds, for sealed or initializing Vault servers before failing, defaults to 0 (fail fast)",
+				Validators:  []validator.Int64{int64AtLeastValidator{min: 0}},
+			},
+			"login_retries": schema.Int64Attribute{
+				Optional:    true,
+				Description: fmt.Sprintf("How many times to retry logging in with `auth_login_cert` when Vault cannot be reached, times out or answers with a 5xx, e.g. while its load balancer converges, defaults to %d. Invalid or denied credentials fail at once", defaultLoginRetries),
+				Validators:  []validator.Int64{int64AtLeastValidator{min: 0}},
+			},
+			"login_retry_interval": schema.StringAttribute{
+				Optional:    true,
+				Description: fmt.Sprintf("Delay before the first login retry, doubling with every retry up to 30s, defaults to %q", defaultLoginRetryInterval.String()),
+				Validators:  []validator.String{durationValidator{}},
+			},
+			"token_ttl_warning": schema.StringAttribute{
+				Optional:    true,
+				Description: fmt.Sprintf("Warn when a token has less TTL left than this when the provider starts, defaults to %q, \"0s\" disables it. Tokens the provider renews, from `auth_login_cert` or `token_file`, are not checked. Orphan batch tokens, which cannot be renewed, and tokens with only the default policy are always reported", defaultTokenTTLWarning.String()),
+				Validators:  []validator.String{durationValidator{}},
+			},
+			"allow_http": schema.BoolAttribute{
+				Optional:    true,
+				Description: "Allow `http://` endpoints, e.g. for a local dev server. Tokens and secrets then travel in plaintext, every plan warns about it",
+			},
+			"test_mode": schema.StringAttribute{
+				Optional:    true,
+				Description: "Set to `inmemory` to replace both Vault servers with a deterministic in-memory fake, for `terraform test` runs without Vault. Its transit \"encryption\" is reversible by anyone, never use it with real secrets",
+				Validators:  []validator.String{oneOfValidator{values: []string{"inmemory"}}},
+			},
+			"refresh_mode": schema.StringAttribute{
+				Optional: true,
+				Description: "How secrets are refreshed: `full` (the default) decrypts and compares every value, `version_only` skips that when the current version of the secret is still the one Terraform wrote. " +
+					"KVv2 gives every write a new version, so an unchanged version means unchanged data; secrets without a recorded version, e.g. imported by an older release, are always refreshed fully. " +
+					"`existence_only` only checks that every secret still exists and removes the missing ones from the state, without decrypting anything: it is meant for `terraform destroy`, which refreshes every secret it is about to delete but does not tell providers so. " +
+					"Changes made outside of Terraform then go unnoticed, a plan with it can show no changes while the secrets differ from the configuration: every run warns about it",
+				Validators: []validator.String{oneOfValidator{values: []string{"full", "version_only", "existence_only"}}},
+			},
+			"check_capabilities": schema.BoolAttribute{
+				Optional:    true,
+				Description: "Check the capabilities of the tokens with `sys/capabilities-self` while planning every secret, and warn about the missing ones before anything is written",
 			},
 		},
 	}
@@ -58,9 +279,42 @@ func (p *Provider) Schema(ctx context.Context, req provider.SchemaRequest, resp
 type ProviderData struct {
 	transit vaultTransit
 	kv      vaultKV
+	// checkCapabilities enables the capabilities preflight check at plan
+	// time.
+	checkCapabilities bool
+	// refreshVersionOnly skips the reconciliation of secrets whose version
+	// did not change since our latest write.
+	refreshVersionOnly bool
+	// refreshExistenceOnly only checks that secrets still exist on refresh,
+	// for destroy runs.
+	refreshExistenceOnly bool
+	// verifySignatures checks the signature of secrets on refresh.
+	verifySignatures bool
+	// stats counts the Vault calls, for the stats data source.
+	stats *operationStats
+	// ageIdentities decrypt age_encrypted_secrets, there may be none.
+	ageIdentities []age.Identity
+	// keyNamePattern is matched by the keys of secrets, nil when they are
+	// not checked.
+	keyNamePattern *regexp.Regexp
 }
 
 func (p *Provider) Configure(ctx context.Context, req provider.ConfigureRequest, resp *provider.ConfigureResponse) {
+	// Settings coming from resources that do not exist yet, e.g. when Vault
+	// is bootstrapped in the same apply, leave the provider unconfigured
+	// until they are known. Terraform then defers every resource using it.
+	if !req.Config.Raw.IsFullyKnown() {
+		if req.ClientCapabilities.DeferralAllowed {
+			resp.Deferred = &provider.Deferred{Reason: provider.DeferredReasonProviderConfigUnknown}
+			return
+		}
+		resp.Diagnostics.AddError(
+			"unknown provider configuration",
+			"some provider settings are only known after apply. Deferring the resources until then requires a Terraform version supporting deferred actions, otherwise apply the resources these settings come from first, e.g. with -target",
+		)
+		return
+	}
+
 	var data ProviderModel
 
 	resp.Diagnostics.Append(req.Config.Get(ctx, &data)...)
@@ -70,52 +324,399 @@ func (p *Provider) Configure(ctx context.Context, req provider.ConfigureRequest,
 
 	transitVaultConfig := VaultConfigModel{}
 	KVVaultConfig := VaultConfigModel{}
-	resp.Diagnostics.Append(data.TransitVaultConfig.As(ctx, &transitVaultConfig, basetypes.ObjectAsOptions{})...) // TODO: extra fields don't yield errors
+	// Extra fields never get here: Terraform rejects the attributes the
+	// nested vault config schema does not define.
+	resp.Diagnostics.Append(data.TransitVaultConfig.As(ctx, &transitVaultConfig, basetypes.ObjectAsOptions{})...)
 	resp.Diagnostics.Append(data.KVVaultConfig.As(ctx, &KVVaultConfig, basetypes.ObjectAsOptions{})...)
 	if resp.Diagnostics.HasError() {
 		return
 	}
 
-	transitVaultClient, err := newClient(ctx, transitVaultConfig)
+	userAgent := fmt.Sprintf("terraform-provider-vault-secrets-as-code/%s (terraform/%s)", p.version, req.TerraformVersion)
+	if suffix := data.UserAgentSuffix.ValueString(); suffix != "" {
+		userAgent += " " + suffix
+	}
+	transitVaultConfig.userAgent = userAgent
+	KVVaultConfig.userAgent = userAgent
+
+	if data.TestMode.IsNull() {
+		resp.Diagnostics.Append(validateEndpoint("transit_vault_config", transitVaultConfig.Endpoint, data.AllowHTTP.ValueBool())...)
+		resp.Diagnostics.Append(validateEndpoint("kv_vault_config", KVVaultConfig.Endpoint, data.AllowHTTP.ValueBool())...)
+		if resp.Diagnostics.HasError() {
+			return
+		}
+	}
+
+	var routeModels []TransitRouteModel
+	resp.Diagnostics.Append(data.TransitRoutes.ElementsAs(ctx, &routeModels, false)...)
+	routes, diags := newTransitRoutes(routeModels)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	transitPaths := []string{data.TransitPath.ValueString()}
+	for _, r := range routes {
+		transitPaths = append(transitPaths, r.path)
+	}
+	p.stats = newOperationStats(data.KVPath.ValueString(), transitPaths)
+	transitVaultConfig.stats = p.stats
+	KVVaultConfig.stats = p.stats
+
+	transitVaultClient, targetVaultClient, err := newClients(ctx, data, transitVaultConfig, KVVaultConfig)
 	if err != nil {
-		resp.Diagnostics.AddError("failed to setup transit vault client", err.Error())
+		resp.Diagnostics.AddError("failed to setup vault clients", errorDetail(err))
 		return
 	}
 
-	targetVaultClient, err := newClient(ctx, KVVaultConfig)
+	managedBy, diags := resolveManagedBy(data.ManagedBy, data.ManagedByPrefix)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	tflog.Info(ctx, "resolved the ownership marker", map[string]any{"managed_by": managedBy})
+
+	ownershipKey := defaultOwnershipKey
+	if !data.OwnershipMetadataKey.IsNull() {
+		ownershipKey = data.OwnershipMetadataKey.ValueString()
+	}
+
+	auditMetadata := make(map[string]string)
+	resp.Diagnostics.Append(data.AuditMetadata.ElementsAs(ctx, &auditMetadata, false)...)
+	if _, ok := auditMetadata[ownershipKey]; ok {
+		resp.Diagnostics.AddAttributeError(
+			path.Root("audit_metadata"),
+			"invalid audit metadata",
+			fmt.Sprintf("%q is the ownership metadata key and cannot be set through audit_metadata", ownershipKey),
+		)
+	}
+
+	defaultCustomMetadata := make(map[string]string)
+	resp.Diagnostics.Append(data.DefaultCustomMetadata.ElementsAs(ctx, &defaultCustomMetadata, false)...)
+	for _, key := range []string{ownershipKey, deletionProtectedKey, signatureKey} {
+		if _, ok := defaultCustomMetadata[key]; ok {
+			resp.Diagnostics.AddAttributeError(
+				path.Root("default_custom_metadata"),
+				"invalid default custom metadata",
+				fmt.Sprintf("%q is managed by the provider and cannot be set through default_custom_metadata", key),
+			)
+		}
+	}
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if data.VerifySignatures.ValueBool() && data.SigningKey.ValueString() == "" {
+		resp.Diagnostics.AddAttributeError(
+			path.Root("verify_signatures"),
+			"missing signing key",
+			"verify_signatures requires signing_key",
+		)
+	}
+
+	if data.RefreshMode.ValueString() == "existence_only" {
+		resp.Diagnostics.AddAttributeWarning(
+			path.Root("refresh_mode"),
+			"drift detection disabled",
+			"refresh_mode = \"existence_only\" does not read the values of the secrets back: changes made outside of Terraform are not detected and the plan does not restore them. Only set it for terraform destroy",
+		)
+	}
+
+	var fallbackKeys, allowedPathPrefixes, deniedPathPrefixes []string
+	resp.Diagnostics.Append(data.TransitFallbackKeys.ElementsAs(ctx, &fallbackKeys, false)...)
+	resp.Diagnostics.Append(data.AllowedPathPrefixes.ElementsAs(ctx, &allowedPathPrefixes, false)...)
+	resp.Diagnostics.Append(data.DeniedPathPrefixes.ElementsAs(ctx, &deniedPathPrefixes, false)...)
+	resp.Diagnostics.Append(validatePathPrefixes("allowed_path_prefixes", allowedPathPrefixes)...)
+	resp.Diagnostics.Append(validatePathPrefixes("denied_path_prefixes", deniedPathPrefixes)...)
+
+	ageIdentities, err := loadAgeIdentities(data.AgeIdentityFile.ValueString())
 	if err != nil {
-		resp.Diagnostics.AddError("failed to setup KV vault client", err.Error())
+		resp.Diagnostics.AddAttributeError(path.Root("age_identity_file"), "invalid age identities", err.Error())
+	}
+
+	keyNamePattern, err := newKeyNamePattern(data.KeyNamePattern, data.StrictKeyNames)
+	if err != nil {
+		resp.Diagnostics.AddAttributeError(path.Root("key_name_pattern"), "invalid key name pattern", err.Error())
+	}
+
+	if resp.Diagnostics.HasError() {
 		return
 	}
 
-	resp.ResourceData = ProviderData{
+	providerData := ProviderData{
 		transit: vaultTransit{
-			client: transitVaultClient,
-			path:   data.TransitPath.ValueString(),
-			key:    data.TransitKey.ValueString(),
+			client:                transitVaultClient,
+			path:                  data.TransitPath.ValueString(),
+			key:                   data.TransitKey.ValueString(),
+			fallbackKeys:          fallbackKeys,
+			decryptedWith:         &sync.Map{},
+			minDecryptionVersions: &sync.Map{},
+			signingKey:            data.SigningKey.ValueString(),
+			keyVersion:            data.TransitKeyVersion.ValueInt64(),
+			routes:                routes,
+			stats:                 p.stats,
 		},
 		kv: vaultKV{
-			client:    targetVaultClient,
-			path:      data.KVPath.ValueString(),
-			managedBy: data.ManagedBy.ValueString(),
+			client:                targetVaultClient,
+			path:                  data.KVPath.ValueString(),
+			managedBy:             managedBy,
+			ownershipKey:          ownershipKey,
+			readOnly:              data.ReadOnly.ValueBool(),
+			forbidMetadataDelete:  data.ForbidMetadataDelete.ValueBool(),
+			auditMetadata:         auditMetadata,
+			defaultCustomMetadata: defaultCustomMetadata,
+			pathPrefix:            normalizePathPrefix(data.PathPrefix.ValueString()),
+			allowedPathPrefixes:   allowedPathPrefixes,
+			warnOnDisallowedPaths: data.WarnOnDisallowedPaths.ValueBool(),
+			deniedPathPrefixes:    deniedPathPrefixes,
+			maxSecretBytes:        defaultMaxSecretBytes,
 		},
+		checkCapabilities:    data.CheckCapabilities.ValueBool(),
+		refreshVersionOnly:   data.RefreshMode.ValueString() == "version_only",
+		refreshExistenceOnly: data.RefreshMode.ValueString() == "existence_only",
+		verifySignatures:     data.VerifySignatures.ValueBool(),
+		stats:                p.stats,
+		ageIdentities:        ageIdentities,
+		keyNamePattern:       keyNamePattern,
+	}
+	if data.WriteProvenanceMetadata.IsNull() || data.WriteProvenanceMetadata.ValueBool() {
+		providerData.kv.provenanceMetadata = provenanceMetadata(p.version, req.TerraformVersion)
+	}
+	if !data.MaxSecretBytes.IsNull() {
+		providerData.kv.maxSecretBytes = int(data.MaxSecretBytes.ValueInt64())
+	}
+	if auditLogPath := strings.Trim(data.AuditLogPath.ValueString(), "/"); auditLogPath != "" {
+		if err := providerData.kv.checkSecretPath(auditLogPath); err != nil {
+			resp.Diagnostics.AddAttributeError(path.Root("audit_log_path"), "invalid audit log path", errorDetail(err))
+			return
+		}
+		providerData.kv.auditLogPath = auditLogPath
+	}
+
+	// The custom metadata of every secret starts with the provider's, it
+	// must fit the limits of Vault before anything is written.
+	if err := validateCustomMetadata(providerData.kv.customMetadata(map[string]any{deletionProtectedKey: "true"})); err != nil {
+		resp.Diagnostics.AddError("invalid custom metadata", fmt.Sprintf("the custom metadata written by the provider does not fit in Vault: %s", err))
+		return
+	}
+
+	if data.TestMode.IsNull() {
+		threshold := defaultTokenTTLWarning
+		if !data.TokenTTLWarning.IsNull() {
+			// The validator already checked it parses.
+			threshold, _ = time.ParseDuration(data.TokenTTLWarning.ValueString())
+		}
+		checks := []tokenCheck{{name: "transit", client: transitVaultClient, renewed: transitVaultConfig.renewsToken(), mounts: transitPaths}}
+		if targetVaultClient == transitVaultClient {
+			checks[0].name = "transit and KV"
+			checks[0].mounts = append(checks[0].mounts, data.KVPath.ValueString())
+		} else {
+			checks = append(checks, tokenCheck{name: "KV", client: targetVaultClient, renewed: KVVaultConfig.renewsToken(), mounts: []string{data.KVPath.ValueString()}})
+		}
+		for _, c := range checks {
+			resp.Diagnostics.Append(checkToken(ctx, c, threshold)...)
+		}
+
+		resp.Diagnostics.Append(providerData.transit.checkKeySafety(ctx, data.RequireSafeTransitKey.ValueBool())...)
+		if resp.Diagnostics.HasError() {
+			return
+		}
 	}
+
+	if data.TransitRequestCoalescing.ValueBool() {
+		batchSize := defaultCoalescingMaxItems
+		if !data.TransitBatchSize.IsNull() {
+			batchSize = int(data.TransitBatchSize.ValueInt64())
+		}
+		providerData.transit.coalescer = newDecryptCoalescer(providerData.transit, batchSize)
+	}
+	resp.ResourceData = providerData
+	resp.DataSourceData = providerData
+	resp.EphemeralResourceData = providerData
+	resp.ActionData = providerData
+	p.transit.Store(&providerData.transit)
+}
+
+// newClients returns the transit and KV clients, which are the same client
+// when both configurations are identical.
+func newClients(ctx context.Context, data ProviderModel, transitVaultConfig, KVVaultConfig VaultConfigModel) (*vault.Client, *vault.Client, error) {
+	if data.TestMode.ValueString() == "inmemory" {
+		client, err := newInMemoryClient(data.TransitPath.ValueString(), data.KVPath.ValueString(), transitVaultConfig.stats)
+		return client, client, err
+	}
+
+	waitForUnseal := time.Duration(data.WaitForUnsealSeconds.ValueInt64()) * time.Second
+	transitVaultConfig.waitForUnseal = waitForUnseal
+	KVVaultConfig.waitForUnseal = waitForUnseal
+
+	loginRetries := defaultLoginRetries
+	if !data.LoginRetries.IsNull() {
+		loginRetries = int(data.LoginRetries.ValueInt64())
+	}
+	loginRetryInterval := defaultLoginRetryInterval
+	if !data.LoginRetryInterval.IsNull() {
+		// The validator already checked it parses.
+		loginRetryInterval, _ = time.ParseDuration(data.LoginRetryInterval.ValueString())
+	}
+	transitVaultConfig.loginRetries, KVVaultConfig.loginRetries = loginRetries, loginRetries
+	transitVaultConfig.loginRetryInterval, KVVaultConfig.loginRetryInterval = loginRetryInterval, loginRetryInterval
+
+	transitVaultClient, err := newClient(ctx, transitVaultConfig)
+	if err != nil {
+		return nil, nil, fmt.Errorf("transit: %w", err)
+	}
+
+	// Reuse the transit client when both configurations are the same, it
+	// saves a login and a token.
+	if reflect.DeepEqual(transitVaultConfig, KVVaultConfig) {
+		return transitVaultClient, transitVaultClient, nil
+	}
+
+	KVVaultClient, err := newClient(ctx, KVVaultConfig)
+	if err != nil {
+		return nil, nil, fmt.Errorf("KV: %w", err)
+	}
+	return transitVaultClient, KVVaultClient, nil
+}
+
+// validatePathPrefixes checks the prefixes of attr are written the way paths
+// are compared against them: relative to the mount, with single slashes.
+func validatePathPrefixes(attr string, prefixes []string) diag.Diagnostics {
+	var diags diag.Diagnostics
+	for i, prefix := range prefixes {
+		var problem string
+		switch {
+		case prefix == "":
+			problem = "is empty, it would match every path"
+		case strings.HasPrefix(prefix, "/"):
+			problem = "starts with a slash, paths are relative to kv_path"
+		case strings.Contains(prefix, "//"):
+			problem = "contains consecutive slashes, which never appear in paths"
+		default:
+			continue
+		}
+		diags.AddAttributeError(path.Root(attr).AtListIndex(i), "invalid path prefix", fmt.Sprintf("%q %s", prefix, problem))
+	}
+	return diags
+}
+
+// validateEndpoint checks the endpoint of attr is a URL the Vault client can
+// use, and only uses plaintext HTTP when allowHTTP is set.
+func validateEndpoint(attr, endpoint string, allowHTTP bool) diag.Diagnostics {
+	var diags diag.Diagnostics
+	p := path.Root(attr).AtName("endpoint")
+
+	u, err := url.Parse(endpoint)
+	scheme := ""
+	if err == nil {
+		scheme = u.Scheme
+	}
+	switch {
+	case scheme != "http" && scheme != "https" && scheme != "unix":
+		// "vault.internal:8200" parses with the host as its scheme.
+		suggestion := "https://" + endpoint
+		if _, rest, ok := strings.Cut(endpoint, "://"); ok {
+			suggestion = "https://" + rest
+		}
+		diags.AddAttributeError(p, "invalid endpoint", fmt.Sprintf("%q is not an http, https or unix URL, did you mean %q?", endpoint, suggestion))
+	case scheme != "unix" && u.Host == "":
+		diags.AddAttributeError(p, "invalid endpoint", fmt.Sprintf("%q has no host, e.g. %q", endpoint, "https://vault.example.com:8200"))
+	case scheme == "http" && !allowHTTP:
+		diags.AddAttributeError(
+			p,
+			"plaintext endpoint",
+			fmt.Sprintf("%q sends tokens and secrets in plaintext, use %q or set allow_http = true", endpoint, "https://"+strings.TrimPrefix(endpoint, "http://")),
+		)
+	case scheme == "http":
+		diags.AddAttributeWarning(p, "plaintext endpoint", fmt.Sprintf("%q sends tokens and secrets in plaintext, allowed by allow_http", endpoint))
+	}
+	return diags
+}
+
+// resolveManagedBy returns managed_by, or derives it from managed_by_prefix
+// and the workspace when it is not set.
+func resolveManagedBy(managedBy, prefix types.String) (string, diag.Diagnostics) {
+	var diags diag.Diagnostics
+
+	if !managedBy.IsNull() {
+		if !prefix.IsNull() {
+			diags.AddAttributeError(
+				path.Root("managed_by_prefix"),
+				"conflicting attributes",
+				"managed_by_prefix is only used when managed_by is not set",
+			)
+		}
+		return managedBy.ValueString(), diags
+	}
+
+	// Terraform does not tell providers about the workspace, TF_WORKSPACE is
+	// how it is selected in automation.
+	workspace := os.Getenv("TF_WORKSPACE")
+	if workspace == "" {
+		workspace = "default"
+	}
+
+	resolved := workspace
+	if prefix.ValueString() != "" {
+		resolved = prefix.ValueString() + "-" + workspace
+	}
+	if err := checkManagedBy(resolved); err != nil {
+		diags.AddAttributeError(path.Root("managed_by_prefix"), "invalid managed_by", fmt.Sprintf("the ownership marker resolved from managed_by_prefix and TF_WORKSPACE is invalid: %s", err))
+	}
+
+	return resolved, diags
 }
 
 func (p *Provider) Resources(ctx context.Context) []func() resource.Resource {
 	return []func() resource.Resource{
 		NewSecretResource,
+		NewKVConfigResource,
+		NewSecretMetadataResource,
+		NewSecretCopyResource,
+		NewWrappedShareResource,
 	}
 }
 
 func (p *Provider) DataSources(ctx context.Context) []func() datasource.DataSource {
-	return []func() datasource.DataSource{}
+	return []func() datasource.DataSource{
+		NewManagedSecretsDataSource,
+		NewOrphansDataSource,
+		NewSecretVersionDataSource,
+		NewSecretVersionsDataSource,
+		NewOwnershipDataSource,
+		NewDriftDataSource,
+		NewInventoryDataSource,
+		NewStatsDataSource,
+		NewSopsFileDataSource,
+		NewCapabilitiesDataSource,
+	}
+}
+
+func (p *Provider) EphemeralResources(ctx context.Context) []func() ephemeral.EphemeralResource {
+	return []func() ephemeral.EphemeralResource{
+		NewEncryptedValueEphemeralResource,
+	}
+}
+
+func (p *Provider) Actions(ctx context.Context) []func() action.Action {
+	return []func() action.Action{
+		NewRewrapAction,
+	}
+}
+
+func (p *Provider) Functions(ctx context.Context) []func() function.Function {
+	return []func() function.Function{
+		func() function.Function { return &HMACFunction{provider: p} },
+		func() function.Function { return &SignFunction{provider: p} },
+		func() function.Function { return &VerifyFunction{provider: p} },
+	}
 }
 
 func New(version string) func() provider.Provider {
 	return func() provider.Provider {
 		return &Provider{
-			version: version,
+			version:    version,
+			envTransit: sync.OnceValues(transitFromEnv),
 		}
 	}
 }
@@ -0,0 +1,907 @@
+package provider
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/providerserver"
+	"github.com/hashicorp/terraform-plugin-go/tfprotov6"
+	"github.com/hashicorp/terraform-plugin-go/tftypes"
+	vault "github.com/hashicorp/vault/api"
+)
+
+// The tests drive the provider over the plugin protocol, the way Terraform
+// does, with test_mode = "inmemory": they need neither Terraform nor Vault.
+
+// unknown stands for a value only known after apply in test configurations.
+var unknown = &struct{ name string }{"unknown"}
+
+// testProvider is a configured provider served like main serves it.
+type testProvider struct {
+	t testing.TB
+	// ctx is passed to every call of the server, it carries the loggers.
+	ctx      context.Context
+	provider *Provider
+	server   tfprotov6.ProviderServer
+	schemas  *tfprotov6.GetProviderSchemaResponse
+}
+
+// testState is the state of a resource instance.
+type testState struct {
+	typeName string
+	value    tftypes.Value
+	private  []byte
+}
+
+// testProviderConfig returns the provider configuration of the tests, with
+// overrides. A nil override removes the attribute.
+func testProviderConfig(overrides map[string]any) map[string]any {
+	config := map[string]any{
+		"transit_vault_config": map[string]any{"endpoint": "http://inmemory.invalid"},
+		"kv_vault_config":      map[string]any{"endpoint": "http://inmemory.invalid"},
+		"transit_path":         "transit/",
+		"transit_key":          "vsac",
+		"kv_path":              "secret",
+		"managed_by":           "test",
+		"test_mode":            "inmemory",
+	}
+	for k, v := range overrides {
+		config[k] = v
+	}
+	return config
+}
+
+// newTestProvider returns a provider configured with
+// testProviderConfig(overrides), failing the test on error diagnostics.
+func newTestProvider(t testing.TB, overrides map[string]any) *testProvider {
+	t.Helper()
+
+	p, diags := tryNewTestProvider(t, testProviderConfig(overrides))
+	requireNoErrors(t, diags)
+	return p
+}
+
+// tryNewTestProvider returns a provider configured with config and the
+// diagnostics of its configuration.
+func tryNewTestProvider(t testing.TB, config map[string]any) (*testProvider, []*tfprotov6.Diagnostic) {
+	t.Helper()
+	return tryNewTestProviderContext(context.Background(), t, config)
+}
+
+// tryNewTestProviderContext is tryNewTestProvider serving every call with
+// ctx, e.g. to capture the logs.
+func tryNewTestProviderContext(ctx context.Context, t testing.TB, config map[string]any) (*testProvider, []*tfprotov6.Diagnostic) {
+	t.Helper()
+
+	p := &testProvider{t: t, ctx: ctx, provider: New("test")().(*Provider)}
+	p.server = Sanitized(providerserver.NewProtocol6(p.provider)())
+
+	schemas, err := p.server.GetProviderSchema(ctx, &tfprotov6.GetProviderSchemaRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	requireNoErrors(t, schemas.Diagnostics)
+	p.schemas = schemas
+
+	cfg := p.dynamicValue(schemas.Provider.ValueType(), toValue(t, schemas.Provider.ValueType(), config))
+	validated, err := p.server.ValidateProviderConfig(ctx, &tfprotov6.ValidateProviderConfigRequest{Config: cfg})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hasErrors(validated.Diagnostics) {
+		return p, validated.Diagnostics
+	}
+
+	configured, err := p.server.ConfigureProvider(ctx, &tfprotov6.ConfigureProviderRequest{
+		TerraformVersion: "1.11.0",
+		Config:           cfg,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p, append(validated.Diagnostics, configured.Diagnostics...)
+}
+
+// vault returns the client of the in-memory fake, to set it up or inspect it
+// behind the back of the provider.
+func (p *testProvider) vault() *vault.Client {
+	p.t.Helper()
+
+	transit := p.provider.transit.Load()
+	if transit == nil {
+		p.t.Fatal("the provider is not configured")
+	}
+	return transit.client
+}
+
+// failVault makes the in-memory fake fail the requests fail matches, given
+// their method and path without /v1/, with a server error. A nil fail stops
+// injecting faults.
+func (p *testProvider) failVault(fail func(method, path string) bool) {
+	p.t.Helper()
+
+	transport := p.vault().CloneConfig().HttpClient.Transport
+	if stats, ok := transport.(*statsTransport); ok {
+		transport = stats.base
+	}
+	backend, ok := transport.(*inMemoryVault)
+	if !ok {
+		p.t.Fatalf("the client is not served by the in-memory fake: %T", transport)
+	}
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+	backend.fail = fail
+}
+
+// encrypt returns the ciphertext of plaintext under the transit key of the
+// tests.
+func (p *testProvider) encrypt(plaintext string) string {
+	p.t.Helper()
+	return p.encryptDerived(plaintext, "")
+}
+
+// encryptDerived returns the ciphertext of plaintext under the transit key of
+// the tests, with the key derivation context keyContext unless empty.
+func (p *testProvider) encryptDerived(plaintext, keyContext string) string {
+	p.t.Helper()
+
+	data := map[string]any{"plaintext": base64.StdEncoding.EncodeToString([]byte(plaintext))}
+	if keyContext != "" {
+		data["context"] = base64.StdEncoding.EncodeToString([]byte(keyContext))
+	}
+	s, err := p.vault().Logical().Write("transit/encrypt/vsac", data)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	return s.Data["ciphertext"].(string)
+}
+
+// kvData returns the data of the latest version of the secret at k, nil when
+// there is none.
+func (p *testProvider) kvData(k string) map[string]any {
+	p.t.Helper()
+
+	s, err := p.vault().KVv2("secret").Get(context.Background(), k)
+	if err != nil {
+		if strings.Contains(err.Error(), vault.ErrSecretNotFound.Error()) {
+			return nil
+		}
+		p.t.Fatal(err)
+	}
+	return s.Data
+}
+
+// copySecret writes the latest data and the custom metadata of the secret at
+// k of from to the in-memory fake of p, for the tests reconfiguring the
+// provider: every configuration gets its own fake.
+func (p *testProvider) copySecret(from *testProvider, k string) {
+	p.t.Helper()
+	ctx := context.Background()
+
+	meta, err := from.vault().KVv2("secret").GetMetadata(ctx, k)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	if _, err := p.vault().KVv2("secret").Put(ctx, k, from.kvData(k)); err != nil {
+		p.t.Fatal(err)
+	}
+	if err := p.vault().KVv2("secret").PutMetadata(ctx, k, vault.KVMetadataPutInput{CustomMetadata: meta.CustomMetadata}); err != nil {
+		p.t.Fatal(err)
+	}
+}
+
+func (p *testProvider) dynamicValue(typ tftypes.Type, v tftypes.Value) *tfprotov6.DynamicValue {
+	p.t.Helper()
+
+	dv, err := tfprotov6.NewDynamicValue(typ, v)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	return &dv
+}
+
+func (p *testProvider) fromDynamicValue(typ tftypes.Type, dv *tfprotov6.DynamicValue) tftypes.Value {
+	p.t.Helper()
+
+	if dv == nil {
+		return tftypes.NewValue(typ, nil)
+	}
+	v, err := dv.Unmarshal(typ)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	return v
+}
+
+func (p *testProvider) resourceSchema(typeName string) *tfprotov6.Schema {
+	p.t.Helper()
+
+	s, ok := p.schemas.ResourceSchemas["vault-secrets-as-code_"+typeName]
+	if !ok {
+		p.t.Fatalf("no resource %q", typeName)
+	}
+	return s
+}
+
+// apply plans and applies config on the resource instance of prior, nil to
+// create it, failing the test on error diagnostics.
+func (p *testProvider) apply(typeName string, prior *testState, config map[string]any) *testState {
+	p.t.Helper()
+
+	s, diags := p.tryApply(typeName, prior, config)
+	requireNoErrors(p.t, diags)
+	return s
+}
+
+// tryApply plans and applies config on the resource instance of prior, nil
+// to create it. The instance is replaced when the plan requires it, and kept
+// as is when nothing changes. It returns prior on error diagnostics.
+func (p *testProvider) tryApply(typeName string, prior *testState, config map[string]any) (*testState, []*tfprotov6.Diagnostic) {
+	p.t.Helper()
+	ctx := p.ctx
+
+	planned, diags := p.plan(typeName, prior, config)
+	if hasErrors(diags) {
+		return prior, diags
+	}
+
+	typ := p.resourceSchema(typeName).ValueType()
+	priorValue := tftypes.NewValue(typ, nil)
+	var priorPrivate []byte
+	if prior != nil {
+		priorValue, priorPrivate = prior.value, prior.private
+		if p.requiresReplace(typ, prior.value, planned) {
+			destroyDiags := p.tryDestroy(prior)
+			if hasErrors(destroyDiags) {
+				return prior, append(diags, destroyDiags...)
+			}
+			s, createDiags := p.tryApply(typeName, nil, config)
+			return s, append(append(diags, destroyDiags...), createDiags...)
+		}
+		if p.fromDynamicValue(typ, planned.PlannedState).Equal(prior.value) {
+			return prior, diags
+		}
+	}
+
+	applied, err := p.server.ApplyResourceChange(ctx, &tfprotov6.ApplyResourceChangeRequest{
+		TypeName:       "vault-secrets-as-code_" + typeName,
+		PriorState:     p.dynamicValue(typ, priorValue),
+		PlannedState:   planned.PlannedState,
+		Config:         p.dynamicValue(typ, toValue(p.t, typ, config)),
+		PlannedPrivate: planned.PlannedPrivate,
+	})
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	diags = append(diags, applied.Diagnostics...)
+
+	newValue := p.fromDynamicValue(typ, applied.NewState)
+	if hasErrors(applied.Diagnostics) && newValue.IsNull() {
+		if prior == nil {
+			return nil, diags
+		}
+		return &testState{typeName: typeName, value: priorValue, private: priorPrivate}, diags
+	}
+	if !newValue.IsFullyKnown() && !hasErrors(applied.Diagnostics) {
+		p.t.Fatalf("%s: unknown values in the state after apply: %s", typeName, newValue)
+	}
+	return &testState{typeName: typeName, value: newValue, private: applied.Private}, diags
+}
+
+// plan plans config on the resource instance of prior, nil to create it.
+func (p *testProvider) plan(typeName string, prior *testState, config map[string]any) (*tfprotov6.PlanResourceChangeResponse, []*tfprotov6.Diagnostic) {
+	p.t.Helper()
+	ctx := p.ctx
+
+	schema := p.resourceSchema(typeName)
+	typ := schema.ValueType()
+	cfg := toValue(p.t, typ, config)
+
+	validated, err := p.server.ValidateResourceConfig(ctx, &tfprotov6.ValidateResourceConfigRequest{
+		TypeName: "vault-secrets-as-code_" + typeName,
+		Config:   p.dynamicValue(typ, cfg),
+		ClientCapabilities: &tfprotov6.ValidateResourceConfigClientCapabilities{
+			WriteOnlyAttributesAllowed: true,
+		},
+	})
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	if hasErrors(validated.Diagnostics) {
+		return nil, validated.Diagnostics
+	}
+
+	priorValue := tftypes.NewValue(typ, nil)
+	var priorPrivate []byte
+	if prior != nil {
+		priorValue, priorPrivate = prior.value, prior.private
+	}
+
+	planned, err := p.server.PlanResourceChange(ctx, &tfprotov6.PlanResourceChangeRequest{
+		TypeName:         "vault-secrets-as-code_" + typeName,
+		PriorState:       p.dynamicValue(typ, priorValue),
+		ProposedNewState: p.dynamicValue(typ, proposedNew(p.t, schema.Block, priorValue, cfg)),
+		Config:           p.dynamicValue(typ, cfg),
+		PriorPrivate:     priorPrivate,
+	})
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	return planned, append(validated.Diagnostics, planned.Diagnostics...)
+}
+
+// planChanges reports whether planning config on s would change it.
+func (p *testProvider) planChanges(s *testState, config map[string]any) bool {
+	p.t.Helper()
+
+	planned, diags := p.plan(s.typeName, s, config)
+	requireNoErrors(p.t, diags)
+	typ := p.resourceSchema(s.typeName).ValueType()
+	return p.requiresReplace(typ, s.value, planned) || !p.fromDynamicValue(typ, planned.PlannedState).Equal(s.value)
+}
+
+// requiresReplace reports whether planned replaces the instance of prior:
+// like Terraform, only when one of the attributes requiring it changes.
+func (p *testProvider) requiresReplace(typ tftypes.Type, prior tftypes.Value, planned *tfprotov6.PlanResourceChangeResponse) bool {
+	p.t.Helper()
+
+	plannedValue := p.fromDynamicValue(typ, planned.PlannedState)
+	for _, attr := range planned.RequiresReplace {
+		before, _, err := tftypes.WalkAttributePath(prior, attr)
+		if err != nil {
+			p.t.Fatal(err)
+		}
+		after, _, err := tftypes.WalkAttributePath(plannedValue, attr)
+		if err != nil {
+			p.t.Fatal(err)
+		}
+		if !before.(tftypes.Value).Equal(after.(tftypes.Value)) {
+			return true
+		}
+	}
+	return false
+}
+
+// refresh reads the resource instance of s, failing the test on error
+// diagnostics. It returns nil when the instance is gone.
+func (p *testProvider) refresh(s *testState) *testState {
+	p.t.Helper()
+
+	refreshed, diags := p.tryRefresh(s)
+	requireNoErrors(p.t, diags)
+	return refreshed
+}
+
+func (p *testProvider) tryRefresh(s *testState) (*testState, []*tfprotov6.Diagnostic) {
+	p.t.Helper()
+
+	typ := p.resourceSchema(s.typeName).ValueType()
+	read, err := p.server.ReadResource(p.ctx, &tfprotov6.ReadResourceRequest{
+		TypeName:     "vault-secrets-as-code_" + s.typeName,
+		CurrentState: p.dynamicValue(typ, s.value),
+		Private:      s.private,
+	})
+	if err != nil {
+		p.t.Fatal(err)
+	}
+
+	value := p.fromDynamicValue(typ, read.NewState)
+	if value.IsNull() {
+		return nil, read.Diagnostics
+	}
+	return &testState{typeName: s.typeName, value: value, private: read.Private}, read.Diagnostics
+}
+
+// destroy destroys the resource instance of s, failing the test on error
+// diagnostics.
+func (p *testProvider) destroy(s *testState) {
+	p.t.Helper()
+	requireNoErrors(p.t, p.tryDestroy(s))
+}
+
+func (p *testProvider) tryDestroy(s *testState) []*tfprotov6.Diagnostic {
+	p.t.Helper()
+	ctx := p.ctx
+
+	typ := p.resourceSchema(s.typeName).ValueType()
+	null := p.dynamicValue(typ, tftypes.NewValue(typ, nil))
+	planned, err := p.server.PlanResourceChange(ctx, &tfprotov6.PlanResourceChangeRequest{
+		TypeName:         "vault-secrets-as-code_" + s.typeName,
+		PriorState:       p.dynamicValue(typ, s.value),
+		ProposedNewState: null,
+		Config:           null,
+		PriorPrivate:     s.private,
+	})
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	if hasErrors(planned.Diagnostics) {
+		return planned.Diagnostics
+	}
+
+	applied, err := p.server.ApplyResourceChange(ctx, &tfprotov6.ApplyResourceChangeRequest{
+		TypeName:       "vault-secrets-as-code_" + s.typeName,
+		PriorState:     p.dynamicValue(typ, s.value),
+		PlannedState:   planned.PlannedState,
+		Config:         null,
+		PlannedPrivate: planned.PlannedPrivate,
+	})
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	return append(planned.Diagnostics, applied.Diagnostics...)
+}
+
+// importState imports the resource instance of id and refreshes it, the way
+// terraform import does.
+func (p *testProvider) importState(typeName, id string) (*testState, []*tfprotov6.Diagnostic) {
+	p.t.Helper()
+
+	imported, err := p.server.ImportResourceState(p.ctx, &tfprotov6.ImportResourceStateRequest{
+		TypeName: "vault-secrets-as-code_" + typeName,
+		ID:       id,
+	})
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	if hasErrors(imported.Diagnostics) {
+		return nil, imported.Diagnostics
+	}
+	if len(imported.ImportedResources) != 1 {
+		p.t.Fatalf("imported %d resources, expected 1", len(imported.ImportedResources))
+	}
+
+	r := imported.ImportedResources[0]
+	typ := p.resourceSchema(typeName).ValueType()
+	s := &testState{typeName: typeName, value: p.fromDynamicValue(typ, r.State), private: r.Private}
+	refreshed, diags := p.tryRefresh(s)
+	return refreshed, append(imported.Diagnostics, diags...)
+}
+
+// readData reads the data source with config, failing the test on error
+// diagnostics.
+func (p *testProvider) readData(typeName string, config map[string]any) map[string]any {
+	p.t.Helper()
+
+	data, diags := p.tryReadData(typeName, config)
+	requireNoErrors(p.t, diags)
+	return data
+}
+
+func (p *testProvider) tryReadData(typeName string, config map[string]any) (map[string]any, []*tfprotov6.Diagnostic) {
+	p.t.Helper()
+	ctx := p.ctx
+
+	schema, ok := p.schemas.DataSourceSchemas["vault-secrets-as-code_"+typeName]
+	if !ok {
+		p.t.Fatalf("no data source %q", typeName)
+	}
+	typ := schema.ValueType()
+	cfg := p.dynamicValue(typ, toValue(p.t, typ, config))
+
+	validated, err := p.server.ValidateDataResourceConfig(ctx, &tfprotov6.ValidateDataResourceConfigRequest{
+		TypeName: "vault-secrets-as-code_" + typeName,
+		Config:   cfg,
+	})
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	if hasErrors(validated.Diagnostics) {
+		return nil, validated.Diagnostics
+	}
+
+	read, err := p.server.ReadDataSource(ctx, &tfprotov6.ReadDataSourceRequest{
+		TypeName: "vault-secrets-as-code_" + typeName,
+		Config:   cfg,
+	})
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	diags := append(validated.Diagnostics, read.Diagnostics...)
+	if hasErrors(read.Diagnostics) {
+		return nil, diags
+	}
+	data, _ := fromValue(p.fromDynamicValue(typ, read.State)).(map[string]any)
+	return data, diags
+}
+
+// openEphemeral opens the ephemeral resource typeName configured with config
+// and returns its result.
+func (p *testProvider) openEphemeral(typeName string, config map[string]any) (map[string]any, []*tfprotov6.Diagnostic) {
+	p.t.Helper()
+	ctx := p.ctx
+
+	schema, ok := p.schemas.EphemeralResourceSchemas["vault-secrets-as-code_"+typeName]
+	if !ok {
+		p.t.Fatalf("no ephemeral resource %q", typeName)
+	}
+	typ := schema.ValueType()
+	cfg := p.dynamicValue(typ, toValue(p.t, typ, config))
+
+	validated, err := p.server.ValidateEphemeralResourceConfig(ctx, &tfprotov6.ValidateEphemeralResourceConfigRequest{
+		TypeName: "vault-secrets-as-code_" + typeName,
+		Config:   cfg,
+	})
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	if hasErrors(validated.Diagnostics) {
+		return nil, validated.Diagnostics
+	}
+
+	opened, err := p.server.OpenEphemeralResource(ctx, &tfprotov6.OpenEphemeralResourceRequest{
+		TypeName: "vault-secrets-as-code_" + typeName,
+		Config:   cfg,
+	})
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	diags := append(validated.Diagnostics, opened.Diagnostics...)
+	if hasErrors(opened.Diagnostics) {
+		return nil, diags
+	}
+	data, _ := fromValue(p.fromDynamicValue(typ, opened.Result)).(map[string]any)
+	return data, diags
+}
+
+// invokeAction validates, plans and invokes the action typeName configured
+// with config, and returns its progress messages.
+func (p *testProvider) invokeAction(typeName string, config map[string]any) ([]string, []*tfprotov6.Diagnostic) {
+	p.t.Helper()
+	ctx := p.ctx
+
+	server, ok := p.server.(tfprotov6.ProviderServerWithActions)
+	if !ok {
+		p.t.Fatal("the server does not serve actions")
+	}
+	schema, ok := p.schemas.ActionSchemas["vault-secrets-as-code_"+typeName]
+	if !ok {
+		p.t.Fatalf("no action %q", typeName)
+	}
+	typ := schema.Schema.ValueType()
+	cfg := p.dynamicValue(typ, toValue(p.t, typ, config))
+
+	validated, err := server.ValidateActionConfig(ctx, &tfprotov6.ValidateActionConfigRequest{
+		ActionType: "vault-secrets-as-code_" + typeName,
+		Config:     cfg,
+	})
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	if hasErrors(validated.Diagnostics) {
+		return nil, validated.Diagnostics
+	}
+
+	planned, err := server.PlanAction(ctx, &tfprotov6.PlanActionRequest{
+		ActionType: "vault-secrets-as-code_" + typeName,
+		Config:     cfg,
+	})
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	diags := append(validated.Diagnostics, planned.Diagnostics...)
+	if hasErrors(planned.Diagnostics) {
+		return nil, diags
+	}
+
+	invoked, err := server.InvokeAction(ctx, &tfprotov6.InvokeActionRequest{
+		ActionType: "vault-secrets-as-code_" + typeName,
+		Config:     cfg,
+	})
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	var messages []string
+	for event := range invoked.Events {
+		switch e := event.Type.(type) {
+		case tfprotov6.ProgressInvokeActionEventType:
+			messages = append(messages, e.Message)
+		case tfprotov6.CompletedInvokeActionEventType:
+			diags = append(diags, e.Diagnostics...)
+		}
+	}
+	return messages, diags
+}
+
+// callFunction calls the provider function name with args.
+func (p *testProvider) callFunction(name string, args ...any) (any, *tfprotov6.FunctionError) {
+	p.t.Helper()
+
+	f, ok := p.schemas.Functions[name]
+	if !ok {
+		p.t.Fatalf("no function %q", name)
+	}
+
+	arguments := make([]*tfprotov6.DynamicValue, 0, len(args))
+	for i, arg := range args {
+		var typ tftypes.Type
+		if i < len(f.Parameters) {
+			typ = f.Parameters[i].Type
+		} else if f.VariadicParameter != nil {
+			typ = f.VariadicParameter.Type
+		} else {
+			p.t.Fatalf("too many arguments for %s", name)
+		}
+		arguments = append(arguments, p.dynamicValue(typ, toValue(p.t, typ, arg)))
+	}
+
+	called, err := p.server.CallFunction(p.ctx, &tfprotov6.CallFunctionRequest{
+		Name:      name,
+		Arguments: arguments,
+	})
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	if called.Error != nil {
+		return nil, called.Error
+	}
+	return fromValue(p.fromDynamicValue(f.Return.Type, called.Result)), nil
+}
+
+// attrs returns the attributes of s as Go values, see fromValue.
+func (s *testState) attrs() map[string]any {
+	attrs, _ := fromValue(s.value).(map[string]any)
+	return attrs
+}
+
+// proposedNew merges config into prior the way Terraform proposes a new
+// state: configured values win, computed ones keep their prior value.
+func proposedNew(t testing.TB, block *tfprotov6.SchemaBlock, prior, config tftypes.Value) tftypes.Value {
+	t.Helper()
+
+	if prior.IsNull() || !prior.IsKnown() || config.IsNull() {
+		return config
+	}
+
+	var priorAttrs, configAttrs map[string]tftypes.Value
+	if err := prior.As(&priorAttrs); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.As(&configAttrs); err != nil {
+		t.Fatal(err)
+	}
+
+	proposed := make(map[string]tftypes.Value, len(configAttrs))
+	for k, v := range configAttrs {
+		proposed[k] = v
+	}
+	for _, a := range block.Attributes {
+		proposed[a.Name] = proposedAttribute(t, a.Computed, a.NestedType, priorAttrs[a.Name], configAttrs[a.Name])
+	}
+	return tftypes.NewValue(config.Type(), proposed)
+}
+
+func proposedAttribute(t testing.TB, computed bool, nested *tfprotov6.SchemaObject, prior, config tftypes.Value) tftypes.Value {
+	t.Helper()
+
+	if config.IsNull() {
+		if computed {
+			return prior
+		}
+		return config
+	}
+	if nested == nil || prior.IsNull() || !prior.IsKnown() || !config.IsKnown() {
+		return config
+	}
+
+	object := func(prior, config tftypes.Value) tftypes.Value {
+		var priorAttrs, configAttrs map[string]tftypes.Value
+		if err := prior.As(&priorAttrs); err != nil {
+			t.Fatal(err)
+		}
+		if err := config.As(&configAttrs); err != nil {
+			t.Fatal(err)
+		}
+		proposed := make(map[string]tftypes.Value, len(configAttrs))
+		for _, a := range nested.Attributes {
+			proposed[a.Name] = proposedAttribute(t, a.Computed, a.NestedType, priorAttrs[a.Name], configAttrs[a.Name])
+		}
+		return tftypes.NewValue(config.Type(), proposed)
+	}
+
+	switch nested.Nesting {
+	case tfprotov6.SchemaObjectNestingModeSingle:
+		return object(prior, config)
+	case tfprotov6.SchemaObjectNestingModeMap:
+		var priorElems, configElems map[string]tftypes.Value
+		if err := prior.As(&priorElems); err != nil {
+			t.Fatal(err)
+		}
+		if err := config.As(&configElems); err != nil {
+			t.Fatal(err)
+		}
+		proposed := make(map[string]tftypes.Value, len(configElems))
+		for k, v := range configElems {
+			if p, ok := priorElems[k]; ok && !p.IsNull() && !v.IsNull() {
+				v = object(p, v)
+			}
+			proposed[k] = v
+		}
+		return tftypes.NewValue(config.Type(), proposed)
+	default:
+		return config
+	}
+}
+
+// toValue converts v to a value of typ: nil is null, unknown is unknown,
+// objects and maps are map[string]any (or of a more specific element type),
+// lists and sets are slices. Object attributes missing from v are null.
+func toValue(t testing.TB, typ tftypes.Type, v any) tftypes.Value {
+	t.Helper()
+
+	if v == nil {
+		return tftypes.NewValue(typ, nil)
+	}
+	if v == any(unknown) {
+		return tftypes.NewValue(typ, tftypes.UnknownValue)
+	}
+
+	switch {
+	case typ.Is(tftypes.String), typ.Is(tftypes.Bool):
+		return tftypes.NewValue(typ, v)
+	case typ.Is(tftypes.Number):
+		n, ok := new(big.Float).SetString(fmt.Sprint(v))
+		if !ok {
+			t.Fatalf("%v is not a number", v)
+		}
+		return tftypes.NewValue(typ, n)
+	case typ.Is(tftypes.DynamicPseudoType):
+		t.Fatal("dynamic values are not supported")
+	}
+
+	rv := reflect.ValueOf(v)
+	switch typ := typ.(type) {
+	case tftypes.List, tftypes.Set:
+		var elemType tftypes.Type
+		if l, ok := typ.(tftypes.List); ok {
+			elemType = l.ElementType
+		} else {
+			elemType = typ.(tftypes.Set).ElementType
+		}
+		if rv.Kind() != reflect.Slice {
+			t.Fatalf("%T is not a slice", v)
+		}
+		elems := make([]tftypes.Value, 0, rv.Len())
+		for i := range rv.Len() {
+			elems = append(elems, toValue(t, elemType, rv.Index(i).Interface()))
+		}
+		return tftypes.NewValue(typ, elems)
+	case tftypes.Map:
+		if rv.Kind() != reflect.Map {
+			t.Fatalf("%T is not a map", v)
+		}
+		elems := make(map[string]tftypes.Value, rv.Len())
+		for _, k := range rv.MapKeys() {
+			elems[k.String()] = toValue(t, typ.ElementType, rv.MapIndex(k).Interface())
+		}
+		return tftypes.NewValue(typ, elems)
+	case tftypes.Object:
+		m, ok := v.(map[string]any)
+		if !ok {
+			t.Fatalf("%T is not a map[string]any", v)
+		}
+		for k := range m {
+			if _, ok := typ.AttributeTypes[k]; !ok {
+				t.Fatalf("no attribute %q", k)
+			}
+		}
+		attrs := make(map[string]tftypes.Value, len(typ.AttributeTypes))
+		for k, attrType := range typ.AttributeTypes {
+			attrs[k] = toValue(t, attrType, m[k])
+		}
+		return tftypes.NewValue(typ, attrs)
+	}
+
+	t.Fatalf("unsupported type %s", typ)
+	return tftypes.Value{}
+}
+
+// fromValue converts v to Go values: nil for null, unknown, string, bool,
+// int64 or float64, []any and map[string]any.
+func fromValue(v tftypes.Value) any {
+	if !v.IsKnown() {
+		return unknown
+	}
+	if v.IsNull() {
+		return nil
+	}
+
+	typ := v.Type()
+	switch {
+	case typ.Is(tftypes.String):
+		var s string
+		_ = v.As(&s)
+		return s
+	case typ.Is(tftypes.Bool):
+		var b bool
+		_ = v.As(&b)
+		return b
+	case typ.Is(tftypes.Number):
+		var n big.Float
+		_ = v.As(&n)
+		if n.IsInt() {
+			i, _ := n.Int64()
+			return i
+		}
+		f, _ := n.Float64()
+		return f
+	}
+
+	switch typ.(type) {
+	case tftypes.List, tftypes.Set, tftypes.Tuple:
+		var elems []tftypes.Value
+		_ = v.As(&elems)
+		out := make([]any, 0, len(elems))
+		for _, e := range elems {
+			out = append(out, fromValue(e))
+		}
+		return out
+	default:
+		var elems map[string]tftypes.Value
+		_ = v.As(&elems)
+		out := make(map[string]any, len(elems))
+		for k, e := range elems {
+			out[k] = fromValue(e)
+		}
+		return out
+	}
+}
+
+func hasErrors(diags []*tfprotov6.Diagnostic) bool {
+	for _, d := range diags {
+		if d.Severity == tfprotov6.DiagnosticSeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// diagnosticsString formats diags, one per line, for failure messages.
+func diagnosticsString(diags []*tfprotov6.Diagnostic) string {
+	lines := make([]string, 0, len(diags))
+	for _, d := range diags {
+		lines = append(lines, fmt.Sprintf("%s: %s: %s", d.Severity, d.Summary, d.Detail))
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n")
+}
+
+// requireNoErrors fails the test when diags hold an error.
+func requireNoErrors(t testing.TB, diags []*tfprotov6.Diagnostic) {
+	t.Helper()
+
+	if hasErrors(diags) {
+		t.Fatalf("unexpected error diagnostics:\n%s", diagnosticsString(diags))
+	}
+}
+
+// requireError fails the test unless diags hold an error mentioning substr.
+func requireError(t testing.TB, diags []*tfprotov6.Diagnostic, substr string) {
+	t.Helper()
+
+	for _, d := range diags {
+		if d.Severity == tfprotov6.DiagnosticSeverityError && strings.Contains(d.Summary+": "+d.Detail, substr) {
+			return
+		}
+	}
+	t.Fatalf("no error diagnostic mentioning %q in:\n%s", substr, diagnosticsString(diags))
+}
+
+// requireWarning fails the test unless diags hold a warning mentioning
+// substr.
+func requireWarning(t testing.TB, diags []*tfprotov6.Diagnostic, substr string) {
+	t.Helper()
+
+	for _, d := range diags {
+		if d.Severity == tfprotov6.DiagnosticSeverityWarning && strings.Contains(d.Summary+": "+d.Detail, substr) {
+			return
+		}
+	}
+	t.Fatalf("no warning diagnostic mentioning %q in:\n%s", substr, diagnosticsString(diags))
+}
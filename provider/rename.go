@@ -0,0 +1,107 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/vault/api"
+)
+
+// renameRequiresReplace replaces the secret on a path change unless
+// allow_rename is set.
+func renameRequiresReplace(ctx context.Context, req planmodifier.StringRequest, resp *stringplanmodifier.RequiresReplaceIfFuncResponse) {
+	var allowRename types.Bool
+	resp.Diagnostics.Append(req.Plan.GetAttribute(ctx, path.Root("allow_rename"), &allowRename)...)
+	resp.RequiresReplace = !allowRename.ValueBool()
+}
+
+// rename writes decrypted to target along with the custom metadata of source,
+// then deletes source the way a destroy would. A version along with an error
+// means target was written but source could not be deleted. Without a
+// version, neither path was changed.
+func (r *SecretResource) rename(ctx context.Context, source, target string, plan SecretModel, decrypted map[string]any, opts ...api.KVOption) (int, error) {
+	kv := r.kv.client.KVv2(r.kv.path)
+
+	current, err := kv.Get(ctx, source)
+	if err != nil {
+		return 0, err
+	}
+	if err := r.kv.checkOwnership(source, current.CustomMetadata); err != nil {
+		return 0, err
+	}
+	if current.CustomMetadata[deletionProtectedKey] == "true" {
+		return 0, fmt.Errorf("%q is protected against deletion, set protected = false and apply before renaming it", source)
+	}
+	if err := checkCAS(source, current.VersionMetadata.Version, opts); err != nil {
+		return 0, err
+	}
+
+	// Never take over a secret, even one of ours, by renaming.
+	_, err = kv.GetMetadata(ctx, target)
+	if err == nil {
+		return 0, fmt.Errorf("%s already exists, refusing to rename %s over it", r.kv.fullPath(target), r.kv.fullPath(source))
+	} else if !errors.Is(err, api.ErrSecretNotFound) {
+		return 0, err
+	}
+
+	metadata, err := r.signedMetadata(ctx, plan, decrypted)
+	if err != nil {
+		return 0, err
+	}
+	for k, v := range r.kv.carriedMetadata(current.CustomMetadata) {
+		if _, ok := metadata[k]; !ok {
+			metadata[k] = v
+		}
+	}
+
+	version, err := r.kv.Put(ctx, target, decrypted, metadata)
+	if err != nil {
+		if cleanupErr := r.removeEmptyTarget(ctx, target); cleanupErr != nil {
+			err = errors.Join(err, fmt.Errorf("%s is left behind, delete it by hand: %w", r.kv.fullPath(target), cleanupErr))
+		}
+		return 0, err
+	}
+
+	return version, r.kv.Destroy(ctx, source, plan.ShredOnDestroy.ValueBool())
+}
+
+// removeEmptyTarget deletes the metadata a failed rename wrote to target
+// before its data, so it is not left behind carrying the ownership marker.
+// A target with a version, or owned by someone else, is not touched.
+func (r *SecretResource) removeEmptyTarget(ctx context.Context, target string) error {
+	kv := r.kv.client.KVv2(r.kv.path)
+
+	meta, err := kv.GetMetadata(ctx, target)
+	if errors.Is(err, api.ErrSecretNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if meta.CurrentVersion != 0 || r.kv.checkOwnership(target, meta.CustomMetadata) != nil {
+		return nil
+	}
+	return kv.DeleteMetadata(ctx, target)
+}
+
+// carriedMetadata returns the custom metadata of a renamed secret that moves
+// to its new path. What the provider writes itself is written afresh, and
+// the marker of a secret_metadata resource stays with the old path.
+func (v vaultKV) carriedMetadata(customMetadata map[string]any) map[string]any {
+	carried := make(map[string]any)
+	for k, value := range customMetadata {
+		_, audit := v.auditMetadata[k]
+		_, provenance := v.provenanceMetadata[k]
+		switch {
+		case audit, provenance:
+		case k == v.ownershipKey, k == defaultOwnershipKey, k == deletionProtectedKey, k == signatureKey, k == metadataManagedByKey:
+		default:
+			carried[k] = value
+		}
+	}
+	return carried
+}
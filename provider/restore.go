@@ -0,0 +1,38 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// restoredVersionKey is the private state key holding the version written by
+// the latest restore_from_version change, 0 once the configuration is written
+// again.
+const restoredVersionKey = "restored_version"
+
+// readRestoredVersion returns the data of version of the secret at k, to
+// write it again as a new version.
+func (r *SecretResource) readRestoredVersion(ctx context.Context, k string, version int) (map[string]any, error) {
+	secret, err := r.kv.client.KVv2(r.kv.path).GetVersion(ctx, k, version)
+	if errors.Is(err, api.ErrSecretNotFound) {
+		return nil, fmt.Errorf("version %d of %s never existed, or is older than the versions kept by max_versions", version, r.kv.fullPath(k))
+	} else if err != nil {
+		return nil, err
+	}
+	if err := r.kv.checkOwnership(k, secret.CustomMetadata); err != nil {
+		return nil, err
+	}
+
+	meta := secret.VersionMetadata
+	switch {
+	case meta.Destroyed:
+		return nil, fmt.Errorf("version %d of %s was destroyed, its data is gone for good and cannot be restored", version, r.kv.fullPath(k))
+	case !meta.DeletionTime.IsZero() && !meta.DeletionTime.After(time.Now()):
+		return nil, fmt.Errorf("version %d of %s was deleted at %s, undelete it to restore it", version, r.kv.fullPath(k), meta.DeletionTime.Format(time.RFC3339))
+	}
+	return secret.Data, nil
+}
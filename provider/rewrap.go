@@ -0,0 +1,198 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+
+	"github.com/hashicorp/terraform-plugin-framework/action"
+	"github.com/hashicorp/terraform-plugin-framework/action/schema"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	"github.com/hashicorp/vault/api"
+)
+
+// Ensure provider defined types fully satisfy framework interfaces.
+var _ action.ActionWithConfigure = &RewrapAction{}
+
+func NewRewrapAction() action.Action {
+	return &RewrapAction{}
+}
+
+// RewrapAction brings what the managed secrets store bound to a transit key
+// version up to the latest version of the key, after a rotation. Secrets
+// hold plaintexts, the only such thing is their signature: it is checked and
+// computed again with the latest version of signing_key.
+type RewrapAction struct {
+	ProviderData
+}
+
+// RewrapActionModel describes the action data model.
+type RewrapActionModel struct {
+	Prefix types.String `tfsdk:"prefix"`
+	DryRun types.Bool   `tfsdk:"dry_run"`
+}
+
+func (a *RewrapAction) Metadata(ctx context.Context, req action.MetadataRequest, resp *action.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_rewrap"
+}
+
+func (a *RewrapAction) Schema(ctx context.Context, req action.SchemaRequest, resp *action.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		MarkdownDescription: "Signs again, with the latest version of `signing_key`, the secrets carrying our ownership marker whose `vsac_signature` was computed with an older version, e.g. after rotating the key. The current signature is verified first: a secret whose content does not match it is reported and left as is. Actions return no values: every path touched is reported as a progress message, and the counts in a final one.",
+		Attributes: map[string]schema.Attribute{
+			"prefix": schema.StringAttribute{
+				Optional:    true,
+				Description: "Only go through the secrets under this folder, relative to `path_prefix`",
+			},
+			"dry_run": schema.BoolAttribute{
+				Optional:    true,
+				Description: "Only report the secrets that would be signed again, defaults to false",
+			},
+		},
+	}
+}
+
+func (a *RewrapAction) Configure(ctx context.Context, req action.ConfigureRequest, resp *action.ConfigureResponse) {
+	// Prevent panic if the provider has not been configured.
+	if req.ProviderData == nil {
+		return
+	}
+
+	providerData, ok := req.ProviderData.(ProviderData)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Action Configure Type",
+			fmt.Sprintf("Expected ProviderData, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+		)
+		return
+	}
+
+	a.ProviderData = providerData
+}
+
+func (a *RewrapAction) Invoke(ctx context.Context, req action.InvokeRequest, resp *action.InvokeResponse) {
+	var data RewrapActionModel
+	resp.Diagnostics.Append(req.Config.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	dryRun := data.DryRun.ValueBool()
+
+	if a.transit.signingKey == "" {
+		resp.Diagnostics.AddError("nothing to rewrap", "signing_key is not set: the secrets carry no signature bound to a transit key version")
+		return
+	}
+	if !dryRun {
+		if err := a.kv.checkWritable(); err != nil {
+			resp.Diagnostics.AddError("failed to rewrap", errorDetail(err))
+			return
+		}
+	}
+
+	latest, err := a.transit.latestKeyVersion(ctx, a.transit.signingKey)
+	if err != nil {
+		resp.Diagnostics.AddError("failed to read the signing key", errorDetail(err))
+		return
+	}
+
+	owned, err := a.kv.listOwned(ctx, data.Prefix, types.Int64Null(), types.Int64Null())
+	if err != nil {
+		resp.Diagnostics.AddError("failed to list the managed secrets", errorDetail(err))
+		return
+	}
+
+	var touched, current, unsigned, failed int
+	for _, s := range owned {
+		k := a.kv.secretPath(s.path)
+		signature, _ := s.metadata.CustomMetadata[signatureKey].(string)
+		if signature == "" {
+			unsigned++
+			continue
+		}
+		var version int64
+		if _, err := fmt.Sscanf(signature, "vault:v%d:", &version); err == nil && version >= latest {
+			current++
+			continue
+		}
+
+		if dryRun {
+			touched++
+			resp.SendProgress(action.InvokeProgressEvent{Message: fmt.Sprintf("%s would be signed again with version %d of %s", s.path, latest, a.transit.signingKey)})
+			continue
+		}
+		if err := a.resign(ctx, k, s.metadata, signature); err != nil {
+			failed++
+			resp.Diagnostics.AddError("failed to rewrap "+s.path, errorDetail(err))
+			continue
+		}
+		touched++
+		a.kv.audit(ctx, "rewrap", a.kv.fullPath(k), nil, s.metadata.CurrentVersion, &resp.Diagnostics)
+		resp.SendProgress(action.InvokeProgressEvent{Message: fmt.Sprintf("%s signed again with version %d of %s", s.path, latest, a.transit.signingKey)})
+	}
+
+	verb := "signed again"
+	if dryRun {
+		verb = "to sign again"
+	}
+	summary := fmt.Sprintf("%d of %d managed secrets %s, %d already signed with version %d, %d unsigned, %d failed", touched, len(owned), verb, current, latest, unsigned, failed)
+	tflog.Info(ctx, summary)
+	resp.SendProgress(action.InvokeProgressEvent{Message: summary})
+}
+
+// resign verifies signature against the current version of the secret at k,
+// then replaces it with one computed with the latest version of the signing
+// key, keeping the rest of the custom metadata.
+func (a *RewrapAction) resign(ctx context.Context, k string, meta *api.KVMetadata, signature string) error {
+	if err := a.kv.checkNotDenied(k); err != nil {
+		return err
+	}
+
+	secret, err := a.kv.client.KVv2(a.kv.path).GetVersion(ctx, k, meta.CurrentVersion)
+	if err != nil {
+		return err
+	}
+	if secret.Data == nil {
+		return fmt.Errorf("the current version of %s is deleted, its signature can only be verified once restored", a.kv.fullPath(k))
+	}
+
+	input, err := canonicalContent(secret.Data)
+	if err != nil {
+		return err
+	}
+	valid, err := a.transit.Verify(ctx, input, signature)
+	if err != nil {
+		return err
+	}
+	if !valid {
+		return fmt.Errorf("the content of %s does not match its signature, it was modified outside of Terraform: inspect its versions and apply its configuration to sign it again", a.kv.fullPath(k))
+	}
+
+	customMetadata := maps.Clone(meta.CustomMetadata)
+	customMetadata[signatureKey], err = a.transit.Sign(ctx, input)
+	if err != nil {
+		return fmt.Errorf("failed to sign the secret: %w", err)
+	}
+	return a.kv.putCustomMetadata(ctx, k, customMetadata)
+}
+
+// latestKeyVersion returns the latest version of a transit key of the mount.
+func (v vaultTransit) latestKeyVersion(ctx context.Context, key string) (_ int64, err error) {
+	ctx, wrap := traceCall(ctx, v.client, "transit key read", v.path)
+	defer func() { err = wrap(err) }()
+
+	p := v.path + "keys/" + key
+	s, err := v.client.Logical().ReadWithContext(ctx, p)
+	if err == nil && s == nil {
+		err = fmt.Errorf("%w: transit key %q not found", errTransitKeyMissing, key)
+	}
+	if err != nil {
+		return 0, v.explainTransitError(p, "read", key, err)
+	}
+	n, ok := s.Data["latest_version"].(json.Number)
+	if !ok {
+		return 0, fmt.Errorf("the latest_version of transit key %q is not a number", key)
+	}
+	return n.Int64()
+}
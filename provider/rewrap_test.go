@@ -0,0 +1,108 @@
+package provider
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRewrapAction(t *testing.T) {
+	ctx := context.Background()
+	p := newTestProvider(t, map[string]any{"signing_key": "vsac-signing", "verify_signatures": true})
+	kv := p.vault().KVv2("secret")
+
+	states := map[string]*testState{}
+	for _, k := range []string{"app/a", "app/b", "app/tampered", "other/c"} {
+		states[k] = p.apply("secret", nil, map[string]any{
+			"path":              k,
+			"encrypted_secrets": map[string]any{"password": p.encrypt(k)},
+			"values_are_base64": false,
+		})
+	}
+	if _, err := kv.Patch(ctx, "app/tampered", map[string]any{"password": "tampered"}); err != nil {
+		t.Fatal(err)
+	}
+
+	signature := func(k string) string {
+		t.Helper()
+		meta, err := kv.GetMetadata(ctx, k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, _ := meta.CustomMetadata[signatureKey].(string)
+		return s
+	}
+	before := map[string]string{}
+	for k := range states {
+		if before[k] = signature(k); !strings.HasPrefix(before[k], "vault:v1:") {
+			t.Fatalf("%s signature %q, expected one by version 1", k, before[k])
+		}
+	}
+
+	// Nothing is signed with an older version before the rotation.
+	messages, diags := p.invokeAction("rewrap", map[string]any{"prefix": "app"})
+	requireNoErrors(t, diags)
+	if summary := messages[len(messages)-1]; summary != "0 of 3 managed secrets signed again, 3 already signed with version 1, 0 unsigned, 0 failed" {
+		t.Fatalf("summary %q", summary)
+	}
+
+	if _, err := p.vault().Logical().Write("transit/keys/vsac-signing/rotate", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	messages, diags = p.invokeAction("rewrap", map[string]any{"prefix": "app", "dry_run": true})
+	requireNoErrors(t, diags)
+	if want := []string{
+		"app/a would be signed again with version 2 of vsac-signing",
+		"app/b would be signed again with version 2 of vsac-signing",
+		"app/tampered would be signed again with version 2 of vsac-signing",
+		"3 of 3 managed secrets to sign again, 0 already signed with version 2, 0 unsigned, 0 failed",
+	}; !slices.Equal(messages, want) {
+		t.Fatalf("dry run messages %q, expected %q", messages, want)
+	}
+	for k := range states {
+		if s := signature(k); s != before[k] {
+			t.Fatalf("the dry run signed %s again: %q", k, s)
+		}
+	}
+
+	messages, diags = p.invokeAction("rewrap", map[string]any{"prefix": "app"})
+	requireError(t, diags, "app/tampered does not match its signature")
+	if want := []string{
+		"app/a signed again with version 2 of vsac-signing",
+		"app/b signed again with version 2 of vsac-signing",
+		"2 of 3 managed secrets signed again, 0 already signed with version 2, 0 unsigned, 1 failed",
+	}; !slices.Equal(messages, want) {
+		t.Fatalf("messages %q, expected %q", messages, want)
+	}
+	for k, prefix := range map[string]string{"app/a": "vault:v2:", "app/b": "vault:v2:", "app/tampered": "vault:v1:", "other/c": "vault:v1:"} {
+		if s := signature(k); !strings.HasPrefix(s, prefix) {
+			t.Errorf("%s signature %q, expected one starting with %s", k, s, prefix)
+		}
+	}
+
+	// The new signatures verify, and the rest of the metadata is kept.
+	for _, k := range []string{"app/a", "app/b"} {
+		p.refresh(states[k])
+		meta, err := kv.GetMetadata(ctx, k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if meta.CustomMetadata["managed_by"] != "test" {
+			t.Errorf("%s custom metadata %v lost the ownership marker", k, meta.CustomMetadata)
+		}
+	}
+
+	messages, diags = p.invokeAction("rewrap", map[string]any{})
+	requireError(t, diags, "app/tampered does not match its signature")
+	if summary := messages[len(messages)-1]; summary != "1 of 4 managed secrets signed again, 2 already signed with version 2, 0 unsigned, 1 failed" {
+		t.Fatalf("summary %q", summary)
+	}
+}
+
+func TestRewrapActionRequiresSigningKey(t *testing.T) {
+	p := newTestProvider(t, nil)
+	_, diags := p.invokeAction("rewrap", map[string]any{})
+	requireError(t, diags, "signing_key is not set")
+}
@@ -0,0 +1,123 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/provider/schema"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+)
+
+// transitRoute sends the ciphertexts written as <prefix>:vault:v1:... to the
+// key of another transit mount.
+type transitRoute struct {
+	prefix string
+	path   string
+	key    string
+}
+
+// TransitRouteModel describes an element of transit_routes.
+type TransitRouteModel struct {
+	CiphertextPrefix string `tfsdk:"ciphertext_prefix"`
+	Mount            string `tfsdk:"mount"`
+	Key              string `tfsdk:"key"`
+}
+
+var transitRoutesSchema = schema.ListNestedAttribute{
+	Optional: true,
+	Description: "Other transit mounts and keys, e.g. of a federated team, selected by a prefix on the ciphertext: `<ciphertext_prefix>:vault:v1:...` is decrypted with `key` of `mount`, without the prefix. " +
+		"Values read back from Vault are encrypted again through the route of the ciphertext they replace, and rewraps keep their route. A ciphertext with an unknown prefix fails",
+	NestedObject: schema.NestedAttributeObject{
+		Attributes: map[string]schema.Attribute{
+			"ciphertext_prefix": schema.StringAttribute{
+				Required:    true,
+				Description: "Prefix of the ciphertexts of the route, without the colon separating it from the ciphertext",
+				Validators:  []validator.String{notEmptyValidator{}},
+			},
+			"mount": schema.StringAttribute{
+				Required:    true,
+				Description: "Path of the transit mount, on the transit Vault server",
+				Validators:  []validator.String{notEmptyValidator{}},
+			},
+			"key": schema.StringAttribute{
+				Required:    true,
+				Description: "Name of the transit key",
+				Validators:  []validator.String{notEmptyValidator{}},
+			},
+		},
+	},
+}
+
+// newTransitRoutes checks the routes of transit_routes and converts them.
+func newTransitRoutes(models []TransitRouteModel) ([]transitRoute, diag.Diagnostics) {
+	var diags diag.Diagnostics
+	routes := make([]transitRoute, 0, len(models))
+	seen := make(map[string]bool)
+	for i, m := range models {
+		attr := path.Root("transit_routes").AtListIndex(i).AtName("ciphertext_prefix")
+		switch {
+		case m.CiphertextPrefix == "vault":
+			diags.AddAttributeError(attr, "invalid ciphertext prefix", `"vault" starts every transit ciphertext, it cannot be a route prefix`)
+		case strings.Contains(m.CiphertextPrefix, ":"):
+			diags.AddAttributeError(attr, "invalid ciphertext prefix", fmt.Sprintf("%q contains a colon, which separates the prefix from the ciphertext", m.CiphertextPrefix))
+		case seen[m.CiphertextPrefix]:
+			diags.AddAttributeError(attr, "duplicate ciphertext prefix", fmt.Sprintf("%q is already routed", m.CiphertextPrefix))
+		}
+		seen[m.CiphertextPrefix] = true
+
+		routes = append(routes, transitRoute{
+			prefix: m.CiphertextPrefix,
+			path:   strings.Trim(m.Mount, "/") + "/",
+			key:    m.Key,
+		})
+	}
+	return routes, diags
+}
+
+// splitRoutePrefix returns the route prefix of ciphertext, if any, and the
+// ciphertext without it.
+func splitRoutePrefix(ciphertext string) (string, string) {
+	prefix, rest, ok := strings.Cut(ciphertext, ":")
+	if !ok || prefix == "vault" {
+		return "", ciphertext
+	}
+	return prefix, rest
+}
+
+// route returns the transit ciphertext belongs to, and ciphertext the way
+// that transit knows it. Ciphertexts without a prefix belong to v.
+func (v vaultTransit) route(ciphertext string) (vaultTransit, string, error) {
+	prefix, rest := splitRoutePrefix(ciphertext)
+	if prefix == "" || len(v.routes) == 0 {
+		return v, ciphertext, nil
+	}
+
+	for _, r := range v.routes {
+		if r.prefix == prefix {
+			return vaultTransit{
+				client:      v.client,
+				path:        r.path,
+				key:         r.key,
+				routePrefix: r.prefix,
+				// The cache is keyed by mount, it can be shared.
+				minDecryptionVersions: v.minDecryptionVersions,
+				stats:                 v.stats,
+			}, rest, nil
+		}
+	}
+	return v, "", fmt.Errorf("no transit route for the ciphertext prefix %q, add it to transit_routes", prefix)
+}
+
+// EncryptDerivedLike encrypts plaintext through the route of previous, the
+// ciphertext of the value it replaces, so values stay with their transit.
+// An empty previous encrypts with the transit key.
+func (v vaultTransit) EncryptDerivedLike(ctx context.Context, previous, plaintext, keyContext string) (string, error) {
+	routed, _, err := v.route(previous)
+	if err != nil {
+		return "", err
+	}
+	return routed.EncryptDerived(ctx, plaintext, keyContext)
+}
@@ -0,0 +1,305 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-go/tfprotov6"
+)
+
+var (
+	// ciphertextPattern matches transit ciphertexts, HMACs and signatures.
+	ciphertextPattern = regexp.MustCompile(`vault:v\d+:[A-Za-z0-9+/=]+`)
+	// base64Pattern matches the runs of base64 characters that may be
+	// encoded secrets, e.g. a plaintext echoed back by a failed encrypt.
+	// Paths and URLs match too, looksEncoded tells them apart.
+	base64Pattern = regexp.MustCompile(`[A-Za-z0-9+/]{32,}={0,2}`)
+)
+
+const redacted = "[REDACTED]"
+
+// minEncodedLength is the length from which a run of base64 characters
+// without a slash is taken for an encoded value.
+const minEncodedLength = 32
+
+// looksEncoded reports whether m, matched by base64Pattern, is an encoded
+// value rather than a path or a URL. These split into short words on their
+// slashes, unlike encoded values, and rarely mix upper and lower case with
+// digits, unlike the encoded values a slash does split.
+func looksEncoded(m string) bool {
+	for _, segment := range strings.Split(strings.TrimRight(m, "="), "/") {
+		if len(segment) >= minEncodedLength {
+			return true
+		}
+	}
+	return len(m)%4 == 0 &&
+		strings.ContainsAny(m, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") &&
+		strings.ContainsAny(m, "abcdefghijklmnopqrstuvwxyz") &&
+		strings.ContainsAny(m, "0123456789")
+}
+
+// sanitize strips anything looking like a ciphertext or an encoded plaintext
+// from s. Vault error responses may echo back what was submitted, and
+// diagnostics end up in CI logs.
+func sanitize(s string) string {
+	return sanitizeWith(s, redacted)
+}
+
+// sanitizeWith is sanitize replacing what it strips with marker.
+func sanitizeWith(s, marker string) string {
+	s = ciphertextPattern.ReplaceAllLiteralString(s, marker)
+	return base64Pattern.ReplaceAllStringFunc(s, func(m string) string {
+		if looksEncoded(m) {
+			return marker
+		}
+		return m
+	})
+}
+
+// errorDetail returns the sanitized message of err, for diagnostics. Errors
+// of Vault calls end with the context of the call, to find it in the Vault
+// audit log, and what is stripped from them is marked with the request ID
+// when Vault sent one.
+func errorDetail(err error) string {
+	vaultErr, ok := asVaultError(err)
+	if !ok {
+		return sanitize(err.Error())
+	}
+
+	marker := redacted
+	if vaultErr.requestID != "" {
+		marker = "[REDACTED request_id=" + vaultErr.requestID + "]"
+	}
+	return sanitizeWith(err.Error(), marker) + "\n\n" + sanitizeWith(vaultErr.context(), marker)
+}
+
+// sensitive is a decrypted plaintext. It prints and marshals as redacted
+// whatever the verb, so one passed to a log field or an error by mistake
+// never shows; reveal returns the value where it is written to Vault or
+// compared.
+type sensitive string
+
+func (s sensitive) reveal() string {
+	return string(s)
+}
+
+func (s sensitive) String() string {
+	return redacted
+}
+
+func (s sensitive) GoString() string {
+	return redacted
+}
+
+func (s sensitive) Format(f fmt.State, verb rune) {
+	_, _ = io.WriteString(f, redacted)
+}
+
+func (s sensitive) MarshalJSON() ([]byte, error) {
+	return json.Marshal(redacted)
+}
+
+// Sanitized wraps server so the diagnostics and function errors of every
+// response go through sanitize, including those added without errorDetail,
+// e.g. by the framework itself. The wrapper serves actions, which server must
+// then serve too.
+func Sanitized(server tfprotov6.ProviderServer) tfprotov6.ProviderServer {
+	return sanitizedServer{server}
+}
+
+var _ tfprotov6.ProviderServerWithActions = sanitizedServer{}
+
+type sanitizedServer struct {
+	tfprotov6.ProviderServer
+}
+
+func sanitizeDiagnostics(diags []*tfprotov6.Diagnostic) {
+	for _, d := range diags {
+		if d != nil {
+			d.Summary = sanitize(d.Summary)
+			d.Detail = sanitize(d.Detail)
+		}
+	}
+}
+
+func (s sanitizedServer) ValidateProviderConfig(ctx context.Context, req *tfprotov6.ValidateProviderConfigRequest) (*tfprotov6.ValidateProviderConfigResponse, error) {
+	resp, err := s.ProviderServer.ValidateProviderConfig(ctx, req)
+	if resp != nil {
+		sanitizeDiagnostics(resp.Diagnostics)
+	}
+	return resp, err
+}
+
+func (s sanitizedServer) ConfigureProvider(ctx context.Context, req *tfprotov6.ConfigureProviderRequest) (*tfprotov6.ConfigureProviderResponse, error) {
+	resp, err := s.ProviderServer.ConfigureProvider(ctx, req)
+	if resp != nil {
+		sanitizeDiagnostics(resp.Diagnostics)
+	}
+	return resp, err
+}
+
+func (s sanitizedServer) ValidateResourceConfig(ctx context.Context, req *tfprotov6.ValidateResourceConfigRequest) (*tfprotov6.ValidateResourceConfigResponse, error) {
+	resp, err := s.ProviderServer.ValidateResourceConfig(ctx, req)
+	if resp != nil {
+		sanitizeDiagnostics(resp.Diagnostics)
+	}
+	return resp, err
+}
+
+func (s sanitizedServer) UpgradeResourceState(ctx context.Context, req *tfprotov6.UpgradeResourceStateRequest) (*tfprotov6.UpgradeResourceStateResponse, error) {
+	resp, err := s.ProviderServer.UpgradeResourceState(ctx, req)
+	if resp != nil {
+		sanitizeDiagnostics(resp.Diagnostics)
+	}
+	return resp, err
+}
+
+func (s sanitizedServer) ReadResource(ctx context.Context, req *tfprotov6.ReadResourceRequest) (*tfprotov6.ReadResourceResponse, error) {
+	resp, err := s.ProviderServer.ReadResource(ctx, req)
+	if resp != nil {
+		sanitizeDiagnostics(resp.Diagnostics)
+	}
+	return resp, err
+}
+
+func (s sanitizedServer) PlanResourceChange(ctx context.Context, req *tfprotov6.PlanResourceChangeRequest) (*tfprotov6.PlanResourceChangeResponse, error) {
+	resp, err := s.ProviderServer.PlanResourceChange(ctx, req)
+	if resp != nil {
+		sanitizeDiagnostics(resp.Diagnostics)
+	}
+	return resp, err
+}
+
+func (s sanitizedServer) ApplyResourceChange(ctx context.Context, req *tfprotov6.ApplyResourceChangeRequest) (*tfprotov6.ApplyResourceChangeResponse, error) {
+	resp, err := s.ProviderServer.ApplyResourceChange(ctx, req)
+	if resp != nil {
+		sanitizeDiagnostics(resp.Diagnostics)
+	}
+	return resp, err
+}
+
+func (s sanitizedServer) ImportResourceState(ctx context.Context, req *tfprotov6.ImportResourceStateRequest) (*tfprotov6.ImportResourceStateResponse, error) {
+	resp, err := s.ProviderServer.ImportResourceState(ctx, req)
+	if resp != nil {
+		sanitizeDiagnostics(resp.Diagnostics)
+	}
+	return resp, err
+}
+
+func (s sanitizedServer) UpgradeResourceIdentity(ctx context.Context, req *tfprotov6.UpgradeResourceIdentityRequest) (*tfprotov6.UpgradeResourceIdentityResponse, error) {
+	resp, err := s.ProviderServer.UpgradeResourceIdentity(ctx, req)
+	if resp != nil {
+		sanitizeDiagnostics(resp.Diagnostics)
+	}
+	return resp, err
+}
+
+func (s sanitizedServer) MoveResourceState(ctx context.Context, req *tfprotov6.MoveResourceStateRequest) (*tfprotov6.MoveResourceStateResponse, error) {
+	resp, err := s.ProviderServer.MoveResourceState(ctx, req)
+	if resp != nil {
+		sanitizeDiagnostics(resp.Diagnostics)
+	}
+	return resp, err
+}
+
+func (s sanitizedServer) ValidateDataResourceConfig(ctx context.Context, req *tfprotov6.ValidateDataResourceConfigRequest) (*tfprotov6.ValidateDataResourceConfigResponse, error) {
+	resp, err := s.ProviderServer.ValidateDataResourceConfig(ctx, req)
+	if resp != nil {
+		sanitizeDiagnostics(resp.Diagnostics)
+	}
+	return resp, err
+}
+
+func (s sanitizedServer) ReadDataSource(ctx context.Context, req *tfprotov6.ReadDataSourceRequest) (*tfprotov6.ReadDataSourceResponse, error) {
+	resp, err := s.ProviderServer.ReadDataSource(ctx, req)
+	if resp != nil {
+		sanitizeDiagnostics(resp.Diagnostics)
+	}
+	return resp, err
+}
+
+func (s sanitizedServer) ValidateEphemeralResourceConfig(ctx context.Context, req *tfprotov6.ValidateEphemeralResourceConfigRequest) (*tfprotov6.ValidateEphemeralResourceConfigResponse, error) {
+	resp, err := s.ProviderServer.ValidateEphemeralResourceConfig(ctx, req)
+	if resp != nil {
+		sanitizeDiagnostics(resp.Diagnostics)
+	}
+	return resp, err
+}
+
+func (s sanitizedServer) OpenEphemeralResource(ctx context.Context, req *tfprotov6.OpenEphemeralResourceRequest) (*tfprotov6.OpenEphemeralResourceResponse, error) {
+	resp, err := s.ProviderServer.OpenEphemeralResource(ctx, req)
+	if resp != nil {
+		sanitizeDiagnostics(resp.Diagnostics)
+	}
+	return resp, err
+}
+
+func (s sanitizedServer) RenewEphemeralResource(ctx context.Context, req *tfprotov6.RenewEphemeralResourceRequest) (*tfprotov6.RenewEphemeralResourceResponse, error) {
+	resp, err := s.ProviderServer.RenewEphemeralResource(ctx, req)
+	if resp != nil {
+		sanitizeDiagnostics(resp.Diagnostics)
+	}
+	return resp, err
+}
+
+func (s sanitizedServer) CloseEphemeralResource(ctx context.Context, req *tfprotov6.CloseEphemeralResourceRequest) (*tfprotov6.CloseEphemeralResourceResponse, error) {
+	resp, err := s.ProviderServer.CloseEphemeralResource(ctx, req)
+	if resp != nil {
+		sanitizeDiagnostics(resp.Diagnostics)
+	}
+	return resp, err
+}
+
+func (s sanitizedServer) CallFunction(ctx context.Context, req *tfprotov6.CallFunctionRequest) (*tfprotov6.CallFunctionResponse, error) {
+	resp, err := s.ProviderServer.CallFunction(ctx, req)
+	if resp != nil && resp.Error != nil {
+		resp.Error.Text = sanitize(resp.Error.Text)
+	}
+	return resp, err
+}
+
+func (s sanitizedServer) ValidateActionConfig(ctx context.Context, req *tfprotov6.ValidateActionConfigRequest) (*tfprotov6.ValidateActionConfigResponse, error) {
+	resp, err := s.ProviderServer.(tfprotov6.ActionServer).ValidateActionConfig(ctx, req)
+	if resp != nil {
+		sanitizeDiagnostics(resp.Diagnostics)
+	}
+	return resp, err
+}
+
+func (s sanitizedServer) PlanAction(ctx context.Context, req *tfprotov6.PlanActionRequest) (*tfprotov6.PlanActionResponse, error) {
+	resp, err := s.ProviderServer.(tfprotov6.ActionServer).PlanAction(ctx, req)
+	if resp != nil {
+		sanitizeDiagnostics(resp.Diagnostics)
+	}
+	return resp, err
+}
+
+// InvokeAction sanitizes the progress messages along with the diagnostics,
+// they report on the secrets an action goes through.
+func (s sanitizedServer) InvokeAction(ctx context.Context, req *tfprotov6.InvokeActionRequest) (*tfprotov6.InvokeActionServerStream, error) {
+	stream, err := s.ProviderServer.(tfprotov6.ActionServer).InvokeAction(ctx, req)
+	if stream == nil || stream.Events == nil {
+		return stream, err
+	}
+
+	events := stream.Events
+	return &tfprotov6.InvokeActionServerStream{
+		Events: func(yield func(tfprotov6.InvokeActionEvent) bool) {
+			for event := range events {
+				switch e := event.Type.(type) {
+				case tfprotov6.ProgressInvokeActionEventType:
+					event.Type = tfprotov6.ProgressInvokeActionEventType{Message: sanitize(e.Message)}
+				case tfprotov6.CompletedInvokeActionEventType:
+					sanitizeDiagnostics(e.Diagnostics)
+				}
+				if !yield(event) {
+					return
+				}
+			}
+		},
+	}, err
+}
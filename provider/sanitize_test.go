@@ -0,0 +1,298 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-go/tfprotov6"
+	"github.com/hashicorp/terraform-plugin-log/tflogtest"
+	"github.com/hashicorp/terraform-plugin-log/tfsdklogtest"
+)
+
+func TestSanitize(t *testing.T) {
+	for _, tc := range []struct {
+		name, in, want string
+	}{
+		{
+			name: "ciphertext",
+			in:   "invalid ciphertext vault:v3:c2VjcmV0 given",
+			want: "invalid ciphertext [REDACTED] given",
+		},
+		{
+			name: "encoded plaintext",
+			in:   "cannot encrypt " + base64.StdEncoding.EncodeToString([]byte("correct horse battery staple")),
+			want: "cannot encrypt [REDACTED]",
+		},
+		{
+			name: "encoded plaintext with slashes",
+			in:   "cannot encrypt " + base64.StdEncoding.EncodeToString([]byte{0xff, 0xfe, 0x7d, 0x01, 0x3f, 0xfc, 0x2f, 0x80, 0x11, 0x3f, 0xf8, 0x42, 0x07, 0xaf, 0xff, 0x00, 0x9e, 0x21, 0x47, 0xbf, 0xff, 0x0c, 0x5a, 0x6b}),
+			want: "cannot encrypt [REDACTED]",
+		},
+		{
+			name: "URL",
+			in:   "URL: PUT https://vault.example.com:8200/v1/secret/data/apps/production/database/credentials",
+			want: "URL: PUT https://vault.example.com:8200/v1/secret/data/apps/production/database/credentials",
+		},
+		{
+			name: "path",
+			in:   `"apps/production/payments/stripe/webhook" is protected against deletion`,
+			want: `"apps/production/payments/stripe/webhook" is protected against deletion`,
+		},
+		{
+			name: "short values",
+			in:   "key_version 2 is below min_decryption_version 3",
+			want: "key_version 2 is below min_decryption_version 3",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := sanitize(tc.in); got != tc.want {
+				t.Fatalf("sanitize(%q) = %q, expected %q", tc.in, got, tc.want)
+			}
+		})
+	}
+}
+
+// hostileVaultRequestID is the request ID of every response of
+// newHostileVaultServer.
+const hostileVaultRequestID = "5f0c2a1e-hostile"
+
+// newHostileVaultServer returns a server failing every request with an error
+// echoing the values of the request body, the way some Vault errors echo the
+// submitted ciphertext or plaintext.
+func newHostileVaultServer(t testing.TB) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var body map[string]any
+		_ = json.NewDecoder(req.Body).Decode(&body)
+
+		var echoed []string
+		var echo func(v any)
+		echo = func(v any) {
+			switch v := v.(type) {
+			case string:
+				echoed = append(echoed, v)
+			case map[string]any:
+				for _, e := range v {
+					echo(e)
+				}
+			case []any:
+				for _, e := range v {
+					echo(e)
+				}
+			}
+		}
+		echo(body)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"errors":     []string{"invalid request: " + strings.Join(echoed, ", ")},
+			"request_id": hostileVaultRequestID,
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// TestHostileErrorDiagnostics feeds error responses echoing the submitted
+// ciphertext and plaintext through the provider, and checks the diagnostics
+// carry neither.
+func TestHostileErrorDiagnostics(t *testing.T) {
+	server := newHostileVaultServer(t)
+	vaultConfig := map[string]any{"endpoint": server.URL, "token": "hostile"}
+	p := newTestProvider(t, map[string]any{
+		"test_mode":            nil,
+		"allow_http":           true,
+		"transit_vault_config": vaultConfig,
+		"kv_vault_config":      vaultConfig,
+	})
+
+	plaintext := base64.StdEncoding.EncodeToString([]byte("canary-plaintext-0123456789"))
+	ciphertext := "vault:v1:" + base64.StdEncoding.EncodeToString([]byte("canary-ciphertext-0123456789"))
+
+	_, applyDiags := p.tryApply("secret", nil, map[string]any{
+		"path":              "app/db",
+		"encrypted_secrets": map[string]any{"password": ciphertext},
+	})
+	requireError(t, applyDiags, "[REDACTED request_id="+hostileVaultRequestID+"]")
+
+	_, readDiags := p.tryReadData("capabilities", map[string]any{"paths": []string{plaintext}})
+	requireError(t, readDiags, "invalid request")
+
+	for _, d := range append(applyDiags, readDiags...) {
+		for _, canary := range []string{plaintext, ciphertext, strings.TrimPrefix(ciphertext, "vault:v1:")} {
+			if strings.Contains(d.Summary, canary) || strings.Contains(d.Detail, canary) {
+				t.Errorf("diagnostic %q leaks %q:\n%s", d.Summary, canary, d.Detail)
+			}
+		}
+	}
+}
+
+// recordingServer records the raw states and private states of the managed
+// resources the server returns.
+type recordingServer struct {
+	tfprotov6.ProviderServerWithActions
+	raw [][]byte
+}
+
+func (s *recordingServer) record(state *tfprotov6.DynamicValue, private []byte) {
+	if state != nil {
+		s.raw = append(s.raw, state.MsgPack, state.JSON)
+	}
+	s.raw = append(s.raw, private)
+}
+
+func (s *recordingServer) PlanResourceChange(ctx context.Context, req *tfprotov6.PlanResourceChangeRequest) (*tfprotov6.PlanResourceChangeResponse, error) {
+	resp, err := s.ProviderServerWithActions.PlanResourceChange(ctx, req)
+	if resp != nil {
+		s.record(resp.PlannedState, resp.PlannedPrivate)
+	}
+	return resp, err
+}
+
+func (s *recordingServer) ApplyResourceChange(ctx context.Context, req *tfprotov6.ApplyResourceChangeRequest) (*tfprotov6.ApplyResourceChangeResponse, error) {
+	resp, err := s.ProviderServerWithActions.ApplyResourceChange(ctx, req)
+	if resp != nil {
+		s.record(resp.NewState, resp.Private)
+	}
+	return resp, err
+}
+
+func (s *recordingServer) ReadResource(ctx context.Context, req *tfprotov6.ReadResourceRequest) (*tfprotov6.ReadResourceResponse, error) {
+	resp, err := s.ProviderServerWithActions.ReadResource(ctx, req)
+	if resp != nil {
+		s.record(resp.NewState, resp.Private)
+	}
+	return resp, err
+}
+
+func (s *recordingServer) ImportResourceState(ctx context.Context, req *tfprotov6.ImportResourceStateRequest) (*tfprotov6.ImportResourceStateResponse, error) {
+	resp, err := s.ProviderServerWithActions.ImportResourceState(ctx, req)
+	if resp != nil {
+		for _, r := range resp.ImportedResources {
+			s.record(r.State, r.Private)
+		}
+	}
+	return resp, err
+}
+
+// newRecordedTestProvider returns a provider configured with
+// testProviderConfig(overrides), whose provider and SDK logs go to logs and
+// whose raw states are recorded.
+func newRecordedTestProvider(t *testing.T, overrides map[string]any, logs io.Writer) (*testProvider, *recordingServer) {
+	t.Helper()
+
+	ctx := tfsdklogtest.RootLogger(tflogtest.RootLogger(context.Background(), logs), logs)
+	p, diags := tryNewTestProviderContext(ctx, t, testProviderConfig(overrides))
+	requireNoErrors(t, diags)
+	recorder := &recordingServer{ProviderServerWithActions: p.server.(tfprotov6.ProviderServerWithActions)}
+	p.server = recorder
+	return p, recorder
+}
+
+// TestSanitizedServerLeaks plants canaries in every request that reaches
+// Vault, through resources, data sources, ephemeral resources and functions,
+// against a server echoing them in its errors: neither the diagnostics, the
+// function errors nor the logs may carry them. The plaintext may not reach
+// the raw states and private states either, against Vault answering or not.
+func TestSanitizedServerLeaks(t *testing.T) {
+	const secret = "canary-plaintext-0123456789"
+	encoded := base64.StdEncoding.EncodeToString([]byte(secret))
+	var logs bytes.Buffer
+
+	// The state of a secret written while Vault still answered.
+	healthy, healthyRecorder := newRecordedTestProvider(t, nil, &logs)
+	ciphertext := healthy.encrypt(secret)
+	config := map[string]any{
+		"path":              "app/db",
+		"encrypted_secrets": map[string]any{"password": ciphertext},
+		"values_are_base64": false,
+	}
+	s := healthy.apply("secret", nil, config)
+	healthy.refresh(s)
+	if _, err := healthy.vault().KVv2("secret").Patch(context.Background(), "app/db", map[string]any{"password": secret + "-drift"}); err != nil {
+		t.Fatal(err)
+	}
+	healthy.apply("secret", healthy.refresh(s), config)
+	canaries := []string{secret, encoded, ciphertext, strings.TrimPrefix(ciphertext, "vault:v1:")}
+
+	server := newHostileVaultServer(t)
+	vaultConfig := map[string]any{"endpoint": server.URL, "token": "hostile"}
+	p, recorder := newRecordedTestProvider(t, map[string]any{
+		"test_mode":            nil,
+		"allow_http":           true,
+		"transit_vault_config": vaultConfig,
+		"kv_vault_config":      vaultConfig,
+	}, &logs)
+
+	var diagnostics []*tfprotov6.Diagnostic
+	collect := func(step string, d []*tfprotov6.Diagnostic) {
+		t.Helper()
+		if !hasErrors(d) {
+			t.Errorf("%s: no error against the hostile server", step)
+		}
+		diagnostics = append(diagnostics, d...)
+	}
+
+	_, d := p.tryApply("secret", nil, config)
+	collect("create", d)
+	_, d = p.tryRefresh(s)
+	collect("read", d)
+	config["encrypted_secrets"] = map[string]any{"password": ciphertext, "user": ciphertext}
+	_, d = p.tryApply("secret", s, config)
+	collect("update", d)
+	collect("delete", p.tryDestroy(s))
+	_, d = p.importState("secret", "app/db")
+	collect("import", d)
+	_, d = p.tryReadData("capabilities", map[string]any{"paths": []string{encoded}})
+	collect("data source", d)
+	_, d = p.openEphemeral("encrypted_value", map[string]any{"plaintext": secret})
+	collect("ephemeral resource", d)
+
+	for _, d := range diagnostics {
+		for _, canary := range canaries {
+			if strings.Contains(d.Summary, canary) || strings.Contains(d.Detail, canary) {
+				t.Errorf("diagnostic %q leaks %q:\n%s", d.Summary, canary, d.Detail)
+			}
+		}
+	}
+
+	for _, call := range [][]any{{"hmac", secret}, {"sign", secret}, {"verify", secret, ciphertext}} {
+		_, funcErr := p.callFunction(call[0].(string), call[1:]...)
+		if funcErr == nil {
+			t.Errorf("%s: no error against the hostile server", call[0])
+			continue
+		}
+		for _, canary := range canaries {
+			if strings.Contains(funcErr.Text, canary) {
+				t.Errorf("%s error leaks %q: %s", call[0], canary, funcErr.Text)
+			}
+		}
+	}
+
+	if logs.Len() == 0 {
+		t.Fatal("nothing was logged")
+	}
+	for _, canary := range canaries {
+		if strings.Contains(logs.String(), canary) {
+			t.Errorf("the logs leak %q", canary)
+		}
+	}
+
+	// The ciphertext is the configuration, the states carry it.
+	for _, raw := range append(healthyRecorder.raw, recorder.raw...) {
+		for _, canary := range []string{secret, encoded} {
+			if bytes.Contains(raw, []byte(canary)) {
+				t.Errorf("a state leaks %q: %q", canary, raw)
+			}
+		}
+	}
+}
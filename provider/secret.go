@@ -2,21 +2,64 @@ package provider
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
 
+	"github.com/hashicorp/terraform-plugin-framework-timeouts/resource/timeouts"
+	"github.com/hashicorp/terraform-plugin-framework/attr"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
 	"github.com/hashicorp/terraform-plugin-framework/resource"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/booldefault"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/listplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/mapplanmodifier"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringdefault"
 	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/tfsdk"
 	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	"github.com/hashicorp/vault/api"
 )
 
 // Ensure provider defined types fully satisfy framework interfaces.
 var (
-	_ resource.Resource                = &SecretResource{}
-	_ resource.ResourceWithImportState = &SecretResource{}
+	_ resource.Resource                   = &SecretResource{}
+	_ resource.ResourceWithImportState    = &SecretResource{}
+	_ resource.ResourceWithValidateConfig = &SecretResource{}
+	_ resource.ResourceWithModifyPlan     = &SecretResource{}
 )
 
+// pathPrefixKey is the private state key holding the path_prefix the secret
+// was written with.
+const pathPrefixKey = "path_prefix"
+
+// writtenVersionKey is the private state key holding the version of the
+// secret after our latest write.
+const writtenVersionKey = "written_version"
+
+// managedByKey is the private state key holding the ownership marker the
+// secret was written with.
+const managedByKey = "managed_by"
+
+// ageHMACsKey is the private state key holding the transit HMACs of the
+// values of age_encrypted_secrets written, by key.
+const ageHMACsKey = "age_secrets_hmacs"
+
+// writeOnlyHMACsKey is the private state key holding the transit HMACs of
+// the values of encrypted_secrets_wo written, by key.
+const writeOnlyHMACsKey = "write_only_hmacs"
+
 func NewSecretResource() resource.Resource {
 	return &SecretResource{}
 }
@@ -28,8 +71,282 @@ type SecretResource struct {
 
 // SecretModel describes the resource data model.
 type SecretModel struct {
-	Path             string            `tfsdk:"path"`
-	EncryptedSecrets map[string]string `tfsdk:"encrypted_secrets"`
+	Path                      string                          `tfsdk:"path"`
+	EncryptedSecrets          map[string]*string              `tfsdk:"encrypted_secrets"`
+	GeneratedSecrets          map[string]GeneratedSecretModel `tfsdk:"generated_secrets"`
+	Protected                 types.Bool                      `tfsdk:"protected"`
+	AlwaysWrite               types.Bool                      `tfsdk:"always_write"`
+	UpdateStrategy            types.String                    `tfsdk:"update_strategy"`
+	EncryptedValues           map[string]string               `tfsdk:"encrypted_values"`
+	EncryptedSecretObjects    map[string]EncryptedSecretModel `tfsdk:"encrypted_secret_objects"`
+	AgeEncryptedSecrets       map[string]string               `tfsdk:"age_encrypted_secrets"`
+	NonSensitiveData          map[string]string               `tfsdk:"non_sensitive_data"`
+	BinaryKeys                []string                        `tfsdk:"binary_keys"`
+	PreserveUnmanagedKeys     types.Bool                      `tfsdk:"preserve_unmanaged_keys"`
+	ExpectNoExternalWrites    types.Bool                      `tfsdk:"expect_no_external_writes"`
+	ShredOnDestroy            types.Bool                      `tfsdk:"shred_on_destroy"`
+	DestroyVersionsOlderThan  types.Int64                     `tfsdk:"destroy_versions_older_than"`
+	OnExternalChange          types.String                    `tfsdk:"on_external_change"`
+	ExternalKeys              types.List                      `tfsdk:"external_keys"`
+	UIURL                     types.String                    `tfsdk:"ui_url"`
+	ValuesAreBase64           types.Bool                      `tfsdk:"values_are_base64"`
+	RewrapTrigger             types.String                    `tfsdk:"rewrap_trigger"`
+	Keepers                   map[string]string               `tfsdk:"keepers"`
+	AllowRename               types.Bool                      `tfsdk:"allow_rename"`
+	RewrappedCiphertexts      types.Map                       `tfsdk:"rewrapped_ciphertexts"`
+	RestoreFromVersion        types.Int64                     `tfsdk:"restore_from_version"`
+	RestoredFromVersion       types.Int64                     `tfsdk:"restored_from_version"`
+	AdditionalPaths           []string                        `tfsdk:"additional_paths"`
+	ExposePlaintext           types.Bool                      `tfsdk:"expose_plaintext"`
+	AdoptExisting             types.Bool                      `tfsdk:"adopt_existing"`
+	ForceTakeoverFrom         types.String                    `tfsdk:"force_takeover_from"`
+	NormalizeJSONValues       types.Bool                      `tfsdk:"normalize_json_values"`
+	Plaintext                 types.Map                       `tfsdk:"plaintext"`
+	Timeouts                  timeouts.Value                  `tfsdk:"timeouts"`
+	EncryptedSecretsWO        map[string]string               `tfsdk:"encrypted_secrets_wo"`
+	EncryptedSecretsWOVersion types.Int64                     `tfsdk:"encrypted_secrets_wo_version"`
+
+	// writeOnly holds the HMACs of the values of encrypted_secrets_wo, by
+	// key: Terraform keeps them neither in the plan nor in the state.
+	writeOnly map[string]string
+}
+
+// ciphertext is a string secret encrypted with transit.
+type ciphertext struct {
+	ciphertext string
+	keyContext string
+}
+
+// ciphertexts returns the string secrets of m, from both their flat and
+// object forms.
+func (m SecretModel) ciphertexts() map[string]ciphertext {
+	ciphertexts := make(map[string]ciphertext)
+	for k, v := range m.EncryptedSecrets {
+		if v != nil {
+			ciphertexts[k] = ciphertext{ciphertext: *v}
+		}
+	}
+	for k, v := range m.EncryptedSecretObjects {
+		ciphertexts[k] = ciphertext{ciphertext: v.Ciphertext, keyContext: v.Context.ValueString()}
+	}
+	return ciphertexts
+}
+
+// absentKeys returns the keys of encrypted_secrets set to null, which must not
+// exist in the secret, sorted.
+func (m SecretModel) absentKeys() []string {
+	var keys []string
+	for k, v := range m.EncryptedSecrets {
+		if v == nil {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// decodesValue reports whether the base64 transit plaintext of k is decoded
+// before being written, rather than written verbatim. States from before
+// values_are_base64 existed were written verbatim.
+func (m SecretModel) decodesValue(k string) bool {
+	return slices.Contains(m.BinaryKeys, k) || (!m.ValuesAreBase64.IsNull() && !m.ValuesAreBase64.ValueBool())
+}
+
+// normalize returns value, the string value of k, as written to Vault: in its
+// canonical JSON encoding with normalize_json_values. Binary values are left
+// alone.
+func (m SecretModel) normalize(k, value string) string {
+	if !m.NormalizeJSONValues.ValueBool() || slices.Contains(m.BinaryKeys, k) {
+		return value
+	}
+	return normalizeJSONString(value)
+}
+
+// sameValue reports whether live, the value of k read from Vault, is written,
+// the value we write. With normalize_json_values, JSON documents differing only
+// by key order or whitespace are the same.
+func (m SecretModel) sameValue(k string, written, live any) bool {
+	if s, ok := live.(string); ok {
+		live = m.normalize(k, s)
+	}
+	return written == live
+}
+
+// setKeyVersions records the transit key version of every encrypted secret
+// object.
+func (m SecretModel) setKeyVersions() {
+	for k, v := range m.EncryptedSecretObjects {
+		v.KeyVersion = ciphertextKeyVersion(v.Ciphertext)
+		m.EncryptedSecretObjects[k] = v
+	}
+}
+
+// managedKeys returns the keys set by the resource.
+func (m SecretModel) managedKeys() []string {
+	var keys []string
+	for k := range m.EncryptedSecrets {
+		keys = append(keys, k)
+	}
+	for k := range m.EncryptedValues {
+		keys = append(keys, k)
+	}
+	for k := range m.EncryptedSecretObjects {
+		keys = append(keys, k)
+	}
+	for k := range m.AgeEncryptedSecrets {
+		keys = append(keys, k)
+	}
+	for k := range m.GeneratedSecrets {
+		keys = append(keys, k)
+	}
+	for k := range m.NonSensitiveData {
+		keys = append(keys, k)
+	}
+	for k := range m.writeOnly {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// manages reports whether k is one of the keys set by the resource, or kept
+// out of the secret by it.
+func (m SecretModel) manages(k string) bool {
+	_, encrypted := m.EncryptedSecrets[k]
+	_, values := m.EncryptedValues[k]
+	_, objects := m.EncryptedSecretObjects[k]
+	_, age := m.AgeEncryptedSecrets[k]
+	_, generated := m.GeneratedSecrets[k]
+	_, plaintext := m.NonSensitiveData[k]
+	_, writeOnly := m.writeOnly[k]
+	return encrypted || values || objects || age || generated || plaintext || writeOnly
+}
+
+// configValue returns the configured value of the non generated key k, in
+// the form it is stored in the state, to tell whether its configuration
+// changed.
+func (m SecretModel) configValue(k string) (string, bool) {
+	if v, ok := m.EncryptedSecrets[k]; ok {
+		if v == nil {
+			return "", true
+		}
+		return *v, true
+	}
+	if v, ok := m.EncryptedValues[k]; ok {
+		return v, true
+	}
+	if v, ok := m.EncryptedSecretObjects[k]; ok {
+		return v.Context.ValueString() + ":" + v.Ciphertext, true
+	}
+	if v, ok := m.AgeEncryptedSecrets[k]; ok {
+		return v, true
+	}
+	if v, ok := m.NonSensitiveData[k]; ok {
+		return v, true
+	}
+	if v, ok := m.writeOnly[k]; ok {
+		return v, true
+	}
+	return "", false
+}
+
+// changedKeys returns the keys whose value differs between before and after,
+// sorted.
+func changedKeys(before, after SecretModel) []string {
+	keys := append(before.managedKeys(), after.managedKeys()...)
+	slices.Sort(keys)
+	keys = slices.Compact(keys)
+
+	var changed []string
+	for _, k := range keys {
+		_, generatedBefore := before.GeneratedSecrets[k]
+		_, generatedAfter := after.GeneratedSecrets[k]
+		valueBefore, _ := before.configValue(k)
+		valueAfter, _ := after.configValue(k)
+		if generatedBefore != generatedAfter || valueBefore != valueAfter || before.manages(k) != after.manages(k) {
+			changed = append(changed, k)
+		}
+	}
+	return changed
+}
+
+// externalKeys returns the keys of data the resource does not manage,
+// sorted. It is an empty list rather than null when there are none.
+func (m SecretModel) externalKeys(data map[string]any) types.List {
+	var keys []string
+	for k := range data {
+		if !m.manages(k) {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+
+	values := make([]attr.Value, 0, len(keys))
+	for _, k := range keys {
+		values = append(values, types.StringValue(k))
+	}
+	return types.ListValueMust(types.StringType, values)
+}
+
+// plaintext returns the values of data for the plaintext attribute, null
+// unless expose_plaintext is set. Values that are not strings are JSON
+// encoded.
+func (m SecretModel) plaintext(data map[string]any) (types.Map, error) {
+	if !m.ExposePlaintext.ValueBool() {
+		return types.MapNull(types.StringType), nil
+	}
+
+	values := make(map[string]attr.Value, len(data))
+	for k, v := range data {
+		vstr, ok := v.(string)
+		if !ok {
+			b, err := json.Marshal(v)
+			if err != nil {
+				return types.MapNull(types.StringType), fmt.Errorf("failed to encode the value of %q: %w", k, err)
+			}
+			vstr = string(b)
+		}
+		values[k] = types.StringValue(vstr)
+	}
+	return types.MapValueMust(types.StringType, values), nil
+}
+
+// ignoresUnmanagedKeys reports whether keys written by other tools are left
+// alone rather than reconciled.
+func (m SecretModel) ignoresUnmanagedKeys() bool {
+	return m.UpdateStrategy.ValueString() == "patch" || m.PreserveUnmanagedKeys.ValueBool()
+}
+
+// EncryptedSecretModel describes a secret in its object form.
+type EncryptedSecretModel struct {
+	Ciphertext string       `tfsdk:"ciphertext"`
+	Context    types.String `tfsdk:"context"`
+	KeyVersion types.Int64  `tfsdk:"key_version"`
+}
+
+// ciphertextKeyVersion returns the transit key version from the vault:vN:
+// prefix of ciphertext, after its route prefix.
+func ciphertextKeyVersion(ciphertext string) types.Int64 {
+	_, ciphertext = splitRoutePrefix(ciphertext)
+	parts := strings.SplitN(ciphertext, ":", 3)
+	if len(parts) != 3 || parts[0] != "vault" || !strings.HasPrefix(parts[1], "v") {
+		return types.Int64Null()
+	}
+
+	version, err := strconv.ParseInt(strings.TrimPrefix(parts[1], "v"), 10, 64)
+	if err != nil {
+		return types.Int64Null()
+	}
+	return types.Int64Value(version)
+}
+
+// customMetadata returns the custom metadata written alongside the secret,
+// on top of the ownership marker.
+func (m SecretModel) customMetadata() map[string]any {
+	metadata := make(map[string]any)
+	if m.Protected.ValueBool() {
+		metadata[deletionProtectedKey] = "true"
+	}
+	return metadata
 }
 
 func (r *SecretResource) Metadata(ctx context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
@@ -41,152 +358,1735 @@ func (r *SecretResource) Schema(ctx context.Context, req resource.SchemaRequest,
 		MarkdownDescription: "Secret",
 		Attributes: map[string]schema.Attribute{
 			"path": schema.StringAttribute{
-				Required:      true,
-				PlanModifiers: []planmodifier.String{stringplanmodifier.RequiresReplace()},
+				Required: true,
+				PlanModifiers: []planmodifier.String{stringplanmodifier.RequiresReplaceIf(
+					renameRequiresReplace,
+					"Changing the path replaces the secret unless allow_rename is set",
+					"Changing the path replaces the secret unless `allow_rename` is set",
+				)},
+			},
+			"encrypted_secrets": schema.MapAttribute{
+				Optional:    true,
+				ElementType: types.StringType,
+				Description: "Transit ciphertexts of the values of the secret, by key. A null value removes the key from the secret and keeps it out: refreshing reports it when it reappears. Null values need `update_strategy = \"patch\"` or `preserve_unmanaged_keys`, a replace already removes every key it does not write",
+			},
+			"encrypted_secrets_wo": schema.MapAttribute{
+				Optional:    true,
+				Sensitive:   true,
+				WriteOnly:   true,
+				ElementType: types.StringType,
+				Description: "Transit ciphertexts of values of the secret, by key, kept in neither the plan nor the state, e.g. the `ciphertext` of an `encrypted_value` ephemeral resource. They are written on every create and update, which a change of `encrypted_secrets_wo_version` triggers. The keys cannot be set in another attribute, and the ciphertexts cannot carry a key derivation context. Requires Terraform 1.11 or later",
+			},
+			"encrypted_secrets_wo_version": schema.Int64Attribute{
+				Optional:    true,
+				Description: "Version of `encrypted_secrets_wo`: Terraform cannot tell when write-only values change, change it to write them again. A value changed outside of Terraform removes it from the state, so the next apply writes them again",
+			},
+			"encrypted_values": schema.MapAttribute{
+				Optional:    true,
+				ElementType: types.StringType,
+				Description: "Alternative to `encrypted_secrets` whose plaintexts are JSON documents, written to Vault with their native JSON types (numbers, booleans, lists, objects). Conflicts with `encrypted_secrets`",
+			},
+			"age_encrypted_secrets": schema.MapAttribute{
+				Optional:    true,
+				ElementType: types.StringType,
+				Description: "Alternative to `encrypted_secrets` whose values are encrypted with age (`age --armor`, or the base64 encoding of a binary age file) to one of the identities of the provider, which decrypts them locally instead of calling transit. " +
+					"They cannot be encrypted again when refreshing: the HMACs of the values written, kept in the private state, tell when they changed, and a changed value is written again on the next apply. Conflicts with the transit attributes",
+			},
+			"encrypted_secret_objects": schema.MapNestedAttribute{
+				Optional:    true,
+				Description: "Alternative to `encrypted_secrets` where every secret carries its own encryption context. Conflicts with `encrypted_secrets`, `encrypted_values` and `age_encrypted_secrets`",
+				NestedObject: schema.NestedAttributeObject{
+					Attributes: map[string]schema.Attribute{
+						"ciphertext": schema.StringAttribute{Required: true},
+						"context": schema.StringAttribute{
+							Optional:    true,
+							Description: "Key derivation context the secret was encrypted with, for derived transit keys",
+						},
+						"key_version": schema.Int64Attribute{
+							Computed:    true,
+							Description: "Version of the transit key the ciphertext decrypts under",
+						},
+					},
+				},
+			},
+			"generated_secrets": generatedSecretsAttribute,
+			"non_sensitive_data": schema.MapAttribute{
+				Optional:    true,
+				ElementType: types.StringType,
+				Description: "Values written in plaintext alongside the encrypted secrets, for harmless settings such as hostnames or ports. Keys cannot be set in another attribute",
+			},
+			"binary_keys": schema.SetAttribute{
+				Optional:    true,
+				ElementType: types.StringType,
+				Description: "Keys of `encrypted_secrets` whose plaintext is the base64 encoding of binary content. It is validated and written to Vault as is",
+			},
+			"adopt_existing": schema.BoolAttribute{
+				Optional:    true,
+				Computed:    true,
+				Default:     booldefault.StaticBool(false),
+				Description: "Take over a secret that already exists without any ownership marker when creating the resource: its custom metadata is kept, then the configured data is written over it. A warning lists the keys overwritten. Secrets owned by another configuration are still refused",
+			},
+			"force_takeover_from": schema.StringAttribute{
+				Optional: true,
+				Description: "Ownership marker of another configuration to take the secret over from, e.g. when it moves between workspaces. The write proceeds only when the current marker is exactly this value, the marker is then replaced with ours and a warning records both. " +
+					"Secrets with any other owner, or with no marker at all, are still refused",
+				Validators: []validator.String{notEmptyValidator{}},
+			},
+			"additional_paths": schema.ListAttribute{
+				Optional:    true,
+				ElementType: types.StringType,
+				Description: "Other paths, relative to `path_prefix`, written with the same content and custom metadata as `path` and deleted along with it. " +
+					"A path that fails to be written, drifts or is deleted outside of Terraform is written again on the next apply",
+			},
+			"allow_rename": schema.BoolAttribute{
+				Optional: true,
+				Computed: true,
+				Default:  booldefault.StaticBool(false),
+				Description: "Move the secret when its path (or `path_prefix`) changes instead of replacing it: its latest version and custom metadata are written to the new path, then the old path is deleted the way a destroy would. " +
+					"Version history stays with the old path. If writing the new path fails the secret stays at the old one; if deleting the old path fails the state follows the new path, and the old one keeps its ownership marker so the `orphans` data source lists it",
+			},
+			"rewrap_trigger": schema.StringAttribute{
+				Optional:    true,
+				Description: "Any change of this value writes a new version of the secret, even if its data is unchanged, and rewraps its ciphertexts to the latest version of the transit key (or `transit_key_version`) into `rewrapped_ciphertexts`. It is otherwise ignored",
+			},
+			"keepers": schema.MapAttribute{
+				Optional:    true,
+				ElementType: types.StringType,
+				Description: "Arbitrary values, any change of which writes a new version of the secret and regenerates every value of `generated_secrets`, like the `keepers` of the random provider. They are otherwise ignored, drift detection included",
+			},
+			"restore_from_version": schema.Int64Attribute{
+				Optional: true,
+				Description: "Any change of this value to a version of the secret writes the data of that version again as a new version, e.g. to roll back during an incident; the `secret_version` data source gives its ciphertexts. " +
+					"Refreshes keep the restored data, with a warning, until the configuration of the secret changes or this attribute is removed: the configured values are then written again. It is otherwise ignored, including on create",
+				Validators: []validator.Int64{int64AtLeastValidator{min: 1}},
+			},
+			"restored_from_version": schema.Int64Attribute{
+				Computed:    true,
+				Description: "Version the secret was restored from by the latest apply, null when it wrote the configured values",
 			},
-			"encrypted_secrets": schema.MapAttribute{Required: true, ElementType: types.StringType},
+			"expose_plaintext": schema.BoolAttribute{
+				Optional:    true,
+				Computed:    true,
+				Default:     booldefault.StaticBool(false),
+				Description: "Fill `plaintext` with the values of the secret, e.g. to pass a password to another provider. The values then enter the state in plaintext, protect the state accordingly",
+			},
+			"plaintext": schema.MapAttribute{
+				Computed:    true,
+				Sensitive:   true,
+				ElementType: types.StringType,
+				Description: "Values of the secret as written in Vault when `expose_plaintext` is set, values that are not strings are JSON encoded. Null otherwise, no plaintext enters the state",
+			},
+			"rewrapped_ciphertexts": schema.MapAttribute{
+				Computed:      true,
+				ElementType:   types.StringType,
+				Description:   "Ciphertexts of the secret rewrapped by the latest `rewrap_trigger` change, keyed by secret key, to copy back into the configuration. Terraform does not let the provider change the configured ciphertexts itself",
+				PlanModifiers: []planmodifier.Map{mapplanmodifier.UseStateForUnknown()},
+			},
+			"values_are_base64": schema.BoolAttribute{
+				Optional:    true,
+				Computed:    true,
+				Default:     booldefault.StaticBool(true),
+				Description: "Whether the values of `encrypted_secrets`, `encrypted_secret_objects` and `encrypted_secrets_wo` are written to Vault as the base64 plaintext transit decrypts to (the default), or decoded first. Set it to false for ciphertexts of plain values, e.g. from the `encrypted_value` ephemeral resource or a moved secret. Keys in `binary_keys` are always decoded",
+			},
+			"normalize_json_values": schema.BoolAttribute{
+				Optional:    true,
+				Description: "Write the string values holding a JSON object or array in their canonical encoding, sorted keys and no insignificant whitespace, and compare them that way on refresh, so key order or formatting changes made outside of Terraform are not drift. Other values, and keys in `binary_keys`, are written byte for byte",
+			},
+			"protected": schema.BoolAttribute{
+				Optional:    true,
+				Computed:    true,
+				Default:     booldefault.StaticBool(false),
+				Description: "Refuse to delete the secret while set. It must be set to false and applied before the secret can be destroyed",
+			},
+			"always_write": schema.BoolAttribute{
+				Optional:    true,
+				Computed:    true,
+				Default:     booldefault.StaticBool(false),
+				Description: "Write a new version of the secret on every update, even when its data is unchanged",
+			},
+			"update_strategy": schema.StringAttribute{
+				Optional:    true,
+				Computed:    true,
+				Default:     stringdefault.StaticString("replace"),
+				Description: "How updates are written: `replace` writes the whole secret, `patch` only sends the changed keys and deletes the keys removed from the configuration, leaving keys written by other tools untouched",
+				Validators:  []validator.String{oneOfValidator{values: []string{"replace", "patch"}}},
+			},
+			"expect_no_external_writes": schema.BoolAttribute{
+				Optional:    true,
+				Computed:    true,
+				Default:     booldefault.StaticBool(false),
+				Description: "Fail instead of reconciling when a version was written outside of Terraform since the latest apply. Updates use check-and-set so the protection holds until the write",
+			},
+			"shred_on_destroy": schema.BoolAttribute{
+				Optional:    true,
+				Computed:    true,
+				Default:     booldefault.StaticBool(false),
+				Description: "Destroy the data of every version, and check it is gone, before deleting the metadata on destroy",
+			},
+			"destroy_versions_older_than": schema.Int64Attribute{
+				Optional:    true,
+				Description: "Destroy the data of the versions older than the newest ones, this many, after every write, where `delete_version_after` only soft deletes them. Failing to destroy them, e.g. without the update capability on the destroy endpoint, only warns",
+				Validators:  []validator.Int64{int64AtLeastValidator{min: 1}},
+			},
+			"external_keys": schema.ListAttribute{
+				Computed:      true,
+				ElementType:   types.StringType,
+				Description:   "Names of the keys of the live secret the resource does not manage, refreshed by Read. Values are never exposed",
+				PlanModifiers: []planmodifier.List{listplanmodifier.UseStateForUnknown()},
+			},
+			"ui_url": schema.StringAttribute{
+				Computed:    true,
+				Description: "Address of the secret in the Vault UI, from the KV Vault endpoint, namespace, mount and path",
+			},
+			"on_external_change": schema.StringAttribute{
+				Optional:    true,
+				Computed:    true,
+				Default:     stringdefault.StaticString("reconcile"),
+				Description: "What refreshing does with values changed outside of Terraform: `reconcile` records them so the next apply reverts them, `error` fails listing the changed keys, `ignore` keeps the state as is and later updates keep the live values of the keys whose configuration did not change",
+				Validators:  []validator.String{oneOfValidator{values: []string{"reconcile", "error", "ignore"}}},
+			},
+			"preserve_unmanaged_keys": schema.BoolAttribute{
+				Optional:    true,
+				Computed:    true,
+				Default:     booldefault.StaticBool(false),
+				Description: "Merge the configured keys over the live secret on write, keeping the keys written by other tools, which are also ignored by drift detection",
+			},
+		},
+		Blocks: map[string]schema.Block{
+			"timeouts": timeouts.Block(ctx, timeouts.Opts{Create: true, Read: true, Update: true, Delete: true}),
 		},
 	}
 }
 
-func (r *SecretResource) Configure(ctx context.Context, req resource.ConfigureRequest, resp *resource.ConfigureResponse) {
-	// Prevent panic if the provider has not been configured.
-	if req.ProviderData == nil {
+func (r *SecretResource) ValidateConfig(ctx context.Context, req resource.ValidateConfigRequest, resp *resource.ValidateConfigResponse) {
+	var generated, nonSensitive, writeOnly types.Map
+	resp.Diagnostics.Append(req.Config.GetAttribute(ctx, path.Root("generated_secrets"), &generated)...)
+	resp.Diagnostics.Append(req.Config.GetAttribute(ctx, path.Root("non_sensitive_data"), &nonSensitive)...)
+	resp.Diagnostics.Append(req.Config.GetAttribute(ctx, path.Root("encrypted_secrets_wo"), &writeOnly)...)
+
+	// The encrypted attributes are alternatives to one another.
+	encrypted := make(map[string]types.Map)
+	for _, name := range []string{"encrypted_secrets", "encrypted_values", "encrypted_secret_objects", "age_encrypted_secrets"} {
+		var m types.Map
+		resp.Diagnostics.Append(req.Config.GetAttribute(ctx, path.Root(name), &m)...)
+		if !m.IsNull() {
+			encrypted[name] = m
+		}
+	}
+	if resp.Diagnostics.HasError() {
 		return
 	}
 
-	providerData, ok := req.ProviderData.(ProviderData)
-	if !ok {
+	if len(encrypted) > 1 {
 		resp.Diagnostics.AddError(
-			"Unexpected Resource Configure Type",
-			fmt.Sprintf("Expected ProviderData, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+			"conflicting attributes",
+			"only one of encrypted_secrets, encrypted_values, encrypted_secret_objects and age_encrypted_secrets can be used on a resource",
+		)
+	}
+	if len(encrypted) == 0 && generated.IsNull() && writeOnly.IsNull() {
+		resp.Diagnostics.AddError(
+			"missing attribute",
+			"one of encrypted_secrets, encrypted_values, encrypted_secret_objects, age_encrypted_secrets, generated_secrets and encrypted_secrets_wo must be set",
 		)
-		return
 	}
 
-	r.ProviderData = providerData
-}
+	// A null value removes its key, which only a patch or a merge with the
+	// live keys needs: a replace removes every key it does not write.
+	if m, ok := encrypted["encrypted_secrets"]; ok && !m.IsUnknown() {
+		var strategy types.String
+		var preserve types.Bool
+		resp.Diagnostics.Append(req.Config.GetAttribute(ctx, path.Root("update_strategy"), &strategy)...)
+		resp.Diagnostics.Append(req.Config.GetAttribute(ctx, path.Root("preserve_unmanaged_keys"), &preserve)...)
+		replaces := !strategy.IsUnknown() && strategy.ValueString() != "patch" && !preserve.IsUnknown() && !preserve.ValueBool()
+		for k, v := range m.Elements() {
+			if v.IsNull() && replaces {
+				resp.Diagnostics.AddAttributeError(
+					path.Root("encrypted_secrets").AtMapKey(k),
+					"null value without effect",
+					fmt.Sprintf("%q is null to remove it from the secret, which only means something with update_strategy = \"patch\" or preserve_unmanaged_keys = true: replacing the secret already removes the keys it does not write. Leave %q out of encrypted_secrets instead", k, k),
+				)
+			}
+		}
+	}
+	for _, name := range []string{"encrypted_values", "encrypted_secret_objects", "age_encrypted_secrets", "non_sensitive_data", "encrypted_secrets_wo"} {
+		m := encrypted[name]
+		switch name {
+		case "non_sensitive_data":
+			m = nonSensitive
+		case "encrypted_secrets_wo":
+			m = writeOnly
+		}
+		for k, v := range m.Elements() {
+			if v.IsNull() {
+				resp.Diagnostics.AddAttributeError(path.Root(name).AtMapKey(k), "null value", fmt.Sprintf("%q is null, only encrypted_secrets accepts null values to remove a key", k))
+			}
+		}
+	}
 
-func (r *SecretResource) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
-	var data SecretModel
-	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+	// Plaintext keys cannot also be encrypted or generated.
+	if !nonSensitive.IsUnknown() {
+		others := maps.Clone(encrypted)
+		others["generated_secrets"] = generated
+		for name, m := range others {
+			if m.IsUnknown() {
+				continue
+			}
+			for k := range nonSensitive.Elements() {
+				if _, ok := m.Elements()[k]; ok {
+					resp.Diagnostics.AddAttributeError(
+						path.Root("non_sensitive_data").AtMapKey(k),
+						"conflicting secret key",
+						fmt.Sprintf("%q is set in both non_sensitive_data and %s", k, name),
+					)
+				}
+			}
+		}
+	}
 
-	decrypted := make(map[string]any)
-	for k, v := range data.EncryptedSecrets {
-		res, err := r.transit.Decrypt(ctx, v)
-		if err != nil {
-			resp.Diagnostics.AddError("failed to decrypt secret", err.Error())
-			return
+	// Write-only keys are not in the state, they cannot be anywhere else.
+	if !writeOnly.IsUnknown() {
+		others := maps.Clone(encrypted)
+		others["generated_secrets"] = generated
+		others["non_sensitive_data"] = nonSensitive
+		for name, m := range others {
+			if m.IsUnknown() {
+				continue
+			}
+			for k := range writeOnly.Elements() {
+				if _, ok := m.Elements()[k]; ok {
+					resp.Diagnostics.AddAttributeError(
+						path.Root("encrypted_secrets_wo").AtMapKey(k),
+						"conflicting secret key",
+						fmt.Sprintf("%q is set in both encrypted_secrets_wo and %s", k, name),
+					)
+				}
+			}
 		}
-		decrypted[k] = res
 	}
 
-	err := r.kv.Put(ctx, data.Path, decrypted)
-	if err != nil {
-		resp.Diagnostics.AddError("failed to decrypt secret", err.Error())
+	if generated.IsUnknown() {
 		return
 	}
 
-	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+	for name, m := range encrypted {
+		if m.IsUnknown() {
+			continue
+		}
+		for k := range generated.Elements() {
+			if _, ok := m.Elements()[k]; ok {
+				resp.Diagnostics.AddAttributeError(
+					path.Root("generated_secrets").AtMapKey(k),
+					"conflicting secret key",
+					fmt.Sprintf("%q is set in both generated_secrets and %s", k, name),
+				)
+			}
+		}
+	}
+
+	resp.Diagnostics.Append(validateGeneratedSecrets(generated)...)
 }
 
-func (r *SecretResource) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
-	var data SecretModel
+// checkManagedByStable fails when the secret was written with another
+// ownership marker than the current one, unless force_takeover_from moves it
+// from that marker. Secrets written before the marker was recorded are not
+// checked.
+func (r *SecretResource) checkManagedByStable(ctx context.Context, req resource.ModifyPlanRequest) diag.Diagnostics {
+	var written string
+	diags := getPrivateValue(ctx, req.Private, managedByKey, &written)
+	if diags.HasError() || written == "" || written == r.kv.managedBy {
+		return diags
+	}
 
-	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
-	if resp.Diagnostics.HasError() {
+	if !req.Plan.Raw.IsNull() {
+		var from types.String
+		diags.Append(req.Plan.GetAttribute(ctx, path.Root("force_takeover_from"), &from)...)
+		if from.ValueString() == written {
+			return diags
+		}
+	}
+
+	var secretPath string
+	diags.Append(req.State.GetAttribute(ctx, path.Root("path"), &secretPath)...)
+	detail := fmt.Sprintf("%q was written with managed_by %q but it now resolves to %q, e.g. because of a typo or another TF_WORKSPACE, and every write or delete of the secret would fail its ownership check. "+
+		"Restore the previous value, or set force_takeover_from = %q to move the secret to the new one", secretPath, written, r.kv.managedBy, written)
+	if markerTypo(written, r.kv.managedBy) {
+		detail += ". The values only differ by case or whitespace, which is almost always a typo"
+	}
+	diags.AddAttributeError(path.Root("path"), "ownership marker changed", detail)
+	return diags
+}
+
+// warnAbsentKeys spells out the keys a null value in encrypted_secrets newly
+// removes from the secret at p, a null map element is easy to miss in a plan.
+func (r *SecretResource) warnAbsentKeys(ctx context.Context, req resource.ModifyPlanRequest, p string, diags *diag.Diagnostics) {
+	var planned, prior types.Map
+	diags.Append(req.Plan.GetAttribute(ctx, path.Root("encrypted_secrets"), &planned)...)
+	if !req.State.Raw.IsNull() {
+		diags.Append(req.State.GetAttribute(ctx, path.Root("encrypted_secrets"), &prior)...)
+	}
+
+	var removed []string
+	for k, v := range planned.Elements() {
+		// A null in state is a key already kept out of the secret.
+		if before, ok := prior.Elements()[k]; v.IsNull() && (!ok || !before.IsNull()) {
+			removed = append(removed, strconv.Quote(k))
+		}
+	}
+	if len(removed) == 0 {
 		return
 	}
-	decrypted := make(map[string]string)
-	for k, v := range data.EncryptedSecrets {
-		res, err := r.transit.Decrypt(ctx, v)
-		if err != nil {
-			resp.Diagnostics.AddError("failed to decrypt secret ", err.Error())
+	slices.Sort(removed)
+	diags.AddAttributeWarning(
+		path.Root("encrypted_secrets"),
+		"keys removed from the secret",
+		fmt.Sprintf("%s will be removed from %s if present, and kept out of it", strings.Join(removed, ", "), r.kv.fullPath(r.kv.secretPath(p))),
+	)
+}
+
+// getPrivateValue decodes the JSON value of key from the private state into
+// v, v is left untouched when key is not set.
+func getPrivateValue(ctx context.Context, private privateState, key string, v any) diag.Diagnostics {
+	b, diags := private.GetKey(ctx, key)
+	if diags.HasError() || b == nil {
+		return diags
+	}
+
+	if err := json.Unmarshal(b, v); err != nil {
+		diags.AddError("failed to decode "+key+" private state", err.Error())
+	}
+
+	return diags
+}
+
+func setPrivateValue(ctx context.Context, private privateState, key string, v any) diag.Diagnostics {
+	b, err := json.Marshal(v)
+	if err != nil {
+		var diags diag.Diagnostics
+		diags.AddError("failed to encode "+key+" private state", err.Error())
+		return diags
+	}
+
+	return private.SetKey(ctx, key, b)
+}
+
+// getPathPrefix returns the path_prefix the secret was written with, secrets
+// written before path_prefix existed have none.
+func getPathPrefix(ctx context.Context, private privateState) (string, diag.Diagnostics) {
+	var prefix string
+	diags := getPrivateValue(ctx, private, pathPrefixKey, &prefix)
+	return prefix, diags
+}
+
+func setPathPrefix(ctx context.Context, private privateState, prefix string) diag.Diagnostics {
+	return setPrivateValue(ctx, private, pathPrefixKey, prefix)
+}
+
+// getWrittenVersion returns the version of the secret after our latest write,
+// or 0 when it was not recorded.
+func getWrittenVersion(ctx context.Context, private privateState) (int, diag.Diagnostics) {
+	var version int
+	diags := getPrivateValue(ctx, private, writtenVersionKey, &version)
+	return version, diags
+}
+
+func setWrittenVersion(ctx context.Context, private privateState, version int) diag.Diagnostics {
+	return setPrivateValue(ctx, private, writtenVersionKey, version)
+}
+
+func (r *SecretResource) ModifyPlan(ctx context.Context, req resource.ModifyPlanRequest, resp *resource.ModifyPlanResponse) {
+	// A secret written with another ownership marker fails its next write
+	// or delete, destroy included.
+	if !req.State.Raw.IsNull() && r.kv.client != nil {
+		resp.Diagnostics.Append(r.checkManagedByStable(ctx, req)...)
+		if resp.Diagnostics.HasError() {
 			return
 		}
-		decrypted[k] = res
 	}
 
-	kv, err := r.kv.client.KVv2(r.kv.path).Get(ctx, data.Path)
-	if err != nil {
-		resp.Diagnostics.AddError("failed to get secret", err.Error())
+	// Nothing else to check on destroy, or before the provider is configured.
+	if req.Plan.Raw.IsNull() || r.kv.client == nil {
 		return
 	}
 
-	dataout := make(map[string]string)
-	for k, v := range kv.Data {
-		if value, ok := decrypted[k]; ok && value == v {
-			dataout[k] = data.EncryptedSecrets[k]
-		} else {
-			vstr, ok := v.(string)
-			if !ok {
-				resp.Diagnostics.AddError("Values must be strings",
-					fmt.Sprintf("the value of %q in secrert %q is not a string", k, data.Path))
-				return
-			}
-			dataout[k], err = r.transit.Encrypt(ctx, vstr)
-			if err != nil {
-				resp.Diagnostics.AddError("failed encrypt secret", err.Error())
-				return
-			}
+	// Changing path_prefix moves the secret like changing its path does.
+	// The path itself is unchanged, Terraform would neither update nor
+	// replace the secret: ui_url, which holds the prefix, changes instead.
+	var moved bool
+	if !req.State.Raw.IsNull() {
+		prefix, diags := getPathPrefix(ctx, req.Private)
+		resp.Diagnostics.Append(diags...)
+		moved = prefix != r.kv.pathPrefix
+		var allowRename types.Bool
+		resp.Diagnostics.Append(req.Plan.GetAttribute(ctx, path.Root("allow_rename"), &allowRename)...)
+		if moved && !allowRename.ValueBool() {
+			resp.RequiresReplace = append(resp.RequiresReplace, path.Root("ui_url"))
+		}
+	}
 
+	// Only a rewrap_trigger change rewraps the ciphertexts.
+	if !req.State.Raw.IsNull() {
+		var planned, prior types.String
+		resp.Diagnostics.Append(req.Plan.GetAttribute(ctx, path.Root("rewrap_trigger"), &planned)...)
+		resp.Diagnostics.Append(req.State.GetAttribute(ctx, path.Root("rewrap_trigger"), &prior)...)
+		if !planned.Equal(prior) {
+			resp.Diagnostics.Append(resp.Plan.SetAttribute(ctx, path.Root("rewrapped_ciphertexts"), types.MapUnknown(types.StringType))...)
 		}
 	}
 
-	data.EncryptedSecrets = dataout
+	if r.kv.forbidMetadataDelete {
+		var shred types.Bool
+		resp.Diagnostics.Append(req.Plan.GetAttribute(ctx, path.Root("shred_on_destroy"), &shred)...)
+		if shred.ValueBool() {
+			resp.Diagnostics.AddAttributeError(
+				path.Root("shred_on_destroy"),
+				"conflicting provider setting",
+				"shred_on_destroy destroys the data of the secret, which forbid_metadata_delete does not allow",
+			)
+		}
+	}
 
-	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
-}
+	// age values are decrypted by the provider when the secret is written.
+	if len(r.ageIdentities) == 0 && (req.State.Raw.IsNull() || !req.State.Raw.Equal(req.Plan.Raw)) {
+		var age types.Map
+		resp.Diagnostics.Append(req.Plan.GetAttribute(ctx, path.Root("age_encrypted_secrets"), &age)...)
+		if len(age.Elements()) > 0 {
+			resp.Diagnostics.AddAttributeError(
+				path.Root("age_encrypted_secrets"),
+				"missing age identity",
+				fmt.Sprintf("the provider has no age identity to decrypt age_encrypted_secrets with, set age_identity_file or %s", ageIdentityEnv),
+			)
+		}
+	}
 
-func (r *SecretResource) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
-	var plan SecretModel
-	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	if r.keyNamePattern != nil {
+		r.checkKeyNames(ctx, req.Plan, &resp.Diagnostics)
+	}
 
-	decrypted := make(map[string]any)
-	for k, v := range plan.EncryptedSecrets {
-		res, err := r.transit.Decrypt(ctx, v)
-		if err != nil {
-			resp.Diagnostics.AddError("failed to decrypt secret", err.Error())
-			return
+	var p types.String
+	resp.Diagnostics.Append(req.Plan.GetAttribute(ctx, path.Root("path"), &p)...)
+	if !resp.Diagnostics.HasError() && !p.IsUnknown() {
+		r.kv.checkPathAllowed(r.kv.secretPath(p.ValueString()), path.Root("path"), &resp.Diagnostics)
+		if err := r.kv.checkSecretPath(r.kv.secretPath(p.ValueString())); err != nil {
+			resp.Diagnostics.AddAttributeError(path.Root("path"), "invalid secret path", fmt.Sprintf("path = %q: %s", p.ValueString(), err))
+		}
+		if moved {
+			resp.Diagnostics.Append(resp.Plan.SetAttribute(ctx, path.Root("ui_url"), types.StringUnknown())...)
+		} else {
+			resp.Diagnostics.Append(resp.Plan.SetAttribute(ctx, path.Root("ui_url"), r.kv.uiURL(r.kv.secretPath(p.ValueString())))...)
+		}
+		r.checkAdditionalPaths(ctx, req.Plan, p.ValueString(), &resp.Diagnostics)
+		r.warnAbsentKeys(ctx, req, p.ValueString(), &resp.Diagnostics)
+		if req.State.Raw.IsNull() || !req.State.Raw.Equal(req.Plan.Raw) {
+			r.checkPlannedSize(ctx, req.Plan, &resp.Diagnostics)
+		}
+		if r.checkCapabilities {
+			r.preflightCapabilities(ctx, r.kv.secretPath(p.ValueString()), &resp.Diagnostics)
 		}
-		decrypted[k] = res
 	}
 
-	err := r.kv.Put(ctx, plan.Path, decrypted)
-	if err != nil {
-		resp.Diagnostics.AddError("failed to decrypt secret", err.Error())
+	var generatedMap types.Map
+	resp.Diagnostics.Append(req.Plan.GetAttribute(ctx, path.Root("generated_secrets"), &generatedMap)...)
+	if resp.Diagnostics.HasError() || generatedMap.IsUnknown() {
 		return
 	}
 
-	resp.Diagnostics.Append(resp.State.Set(ctx, &plan)...)
-}
-
-func (r *SecretResource) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
-	var data SecretModel
-	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	var generated map[string]GeneratedSecretModel
+	resp.Diagnostics.Append(generatedMap.ElementsAs(ctx, &generated, false)...)
 	if resp.Diagnostics.HasError() {
 		return
 	}
 
-	if err := r.kv.Destroy(ctx, data.Path); err != nil {
-		resp.Diagnostics.AddError("failed to delete secret: ", err.Error())
+	for k, spec := range generated {
+		if spec.PasswordPolicy.IsNull() || spec.PasswordPolicy.IsUnknown() {
+			continue
+		}
+
+		policy := spec.PasswordPolicy.ValueString()
+		exists, err := r.kv.PasswordPolicyExists(ctx, policy)
+		if err != nil {
+			resp.Diagnostics.AddAttributeError(
+				path.Root("generated_secrets").AtMapKey(k).AtName("password_policy"),
+				"failed to read password policy",
+				errorDetail(err),
+			)
+		} else if !exists {
+			resp.Diagnostics.AddAttributeError(
+				path.Root("generated_secrets").AtMapKey(k).AtName("password_policy"),
+				"password policy not found",
+				fmt.Sprintf("password policy %q does not exist on the KV Vault server", policy),
+			)
+		}
 	}
+}
 
-	if resp.Diagnostics.HasError() {
-		return
+// checkKeyNames reports every key of plan not matching key_name_pattern. A
+// null encrypted_secrets value removes its key, whatever its name.
+func (r *SecretResource) checkKeyNames(ctx context.Context, plan tfsdk.Plan, diags *diag.Diagnostics) {
+	for _, name := range []string{"encrypted_secrets", "encrypted_values", "encrypted_secret_objects", "age_encrypted_secrets", "generated_secrets", "non_sensitive_data"} {
+		var m types.Map
+		diags.Append(plan.GetAttribute(ctx, path.Root(name), &m)...)
+		for k, v := range m.Elements() {
+			if v.IsNull() || r.keyNamePattern.MatchString(k) {
+				continue
+			}
+			diags.AddAttributeError(
+				path.Root(name).AtMapKey(k),
+				"invalid key name",
+				fmt.Sprintf("%q does not match key_name_pattern %s, consumers such as environment variables or Kubernetes secrets may not handle it", k, r.keyNamePattern),
+			)
+		}
 	}
 }
 
-func (r *SecretResource) ImportState(ctx context.Context, req resource.ImportStateRequest, resp *resource.ImportStateResponse) {
-	data := SecretModel{
-		Path: req.ID,
+func (r *SecretResource) Configure(ctx context.Context, req resource.ConfigureRequest, resp *resource.ConfigureResponse) {
+	// Prevent panic if the provider has not been configured.
+	if req.ProviderData == nil {
+		return
+	}
+
+	providerData, ok := req.ProviderData.(ProviderData)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Resource Configure Type",
+			fmt.Sprintf("Expected ProviderData, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+		)
+		return
+	}
+
+	r.ProviderData = providerData
+}
+
+// decryptSecrets returns the values written to Vault for the encrypted
+// secrets of data.
+func (r *SecretResource) decryptSecrets(ctx context.Context, data SecretModel) (map[string]any, error) {
+	decrypted := make(map[string]any)
+	for k, v := range data.ciphertexts() {
+		decryptedValue, err := r.transit.DecryptDerived(ctx, v.ciphertext, v.keyContext)
+		if err != nil {
+			return nil, err
+		}
+		decrypted[k], err = data.writtenValue(k, decryptedValue.reveal())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for k, v := range data.EncryptedValues {
+		res, err := r.transit.Decrypt(ctx, v)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := decodeJSONPlaintext(res.reveal())
+		if err != nil {
+			return nil, fmt.Errorf("the plaintext of %q is not a valid JSON document: %w", k, err)
+		}
+		decrypted[k] = value
+	}
+
+	for k, v := range data.NonSensitiveData {
+		decrypted[k] = data.normalize(k, v)
+	}
+
+	return decrypted, nil
+}
+
+// writtenValue returns the value of k written to Vault, from its transit
+// plaintext.
+func (m SecretModel) writtenValue(k, plaintext string) (string, error) {
+	// Binary values are written as the base64 text that was encrypted, byte
+	// for byte.
+	if m.decodesValue(k) {
+		decoded, err := base64.StdEncoding.DecodeString(plaintext)
+		if err != nil {
+			return "", fmt.Errorf("failed to decode the plaintext of %q: %w", k, err)
+		}
+		plaintext = string(decoded)
+	}
+	if slices.Contains(m.BinaryKeys, k) {
+		if _, err := base64.StdEncoding.DecodeString(plaintext); err != nil {
+			return "", fmt.Errorf("%q is listed in binary_keys but its value is not valid base64", k)
+		}
+	}
+	return m.normalize(k, plaintext), nil
+}
+
+// decryptWriteOnlySecrets sets in decrypted the values of the write-only
+// secrets of data, read from the configuration, and returns their HMACs for
+// Read to detect drift with.
+func (r *SecretResource) decryptWriteOnlySecrets(ctx context.Context, data SecretModel, decrypted map[string]any) (map[string]string, error) {
+	hmacs := make(map[string]string)
+	for k, v := range data.EncryptedSecretsWO {
+		plaintext, err := r.transit.Decrypt(ctx, v)
+		if err != nil {
+			return nil, err
+		}
+		value, err := data.writtenValue(k, plaintext.reveal())
+		if err != nil {
+			return nil, err
+		}
+		hmacs[k], err = r.transit.HMAC(ctx, value)
+		if err != nil {
+			return nil, err
+		}
+		decrypted[k] = value
+	}
+	return hmacs, nil
+}
+
+// decryptAgeSecrets sets in decrypted the values of the age encrypted secrets
+// of data, decrypted locally, and returns their HMACs for Read to detect
+// drift with.
+func (r *SecretResource) decryptAgeSecrets(ctx context.Context, data SecretModel, decrypted map[string]any) (map[string]string, error) {
+	hmacs := make(map[string]string)
+	for k, v := range data.AgeEncryptedSecrets {
+		plaintext, err := ageDecrypt(r.ageIdentities, v)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt the age value of %q: %w", k, err)
+		}
+		if !utf8.Valid(plaintext) {
+			return nil, fmt.Errorf("the age plaintext of %q is not valid UTF-8, encrypt the base64 encoding of binary values", k)
+		}
+
+		value := data.normalize(k, string(plaintext))
+		hmacs[k], err = r.transit.HMAC(ctx, value)
+		if err != nil {
+			return nil, err
+		}
+		decrypted[k] = value
+	}
+	return hmacs, nil
+}
+
+func (r *SecretResource) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
+	var data SecretModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := withTimeout(ctx, data.Timeouts, "create", &resp.Diagnostics)
+	defer cancel()
+
+	decrypted, err := r.decryptSecrets(ctx, data)
+	if err != nil {
+		addOperationError(ctx, &resp.Diagnostics, "create", data.Path, "failed to decrypt secret", err)
+		return
+	}
+	ageHMACs, err := r.decryptAgeSecrets(ctx, data, decrypted)
+	if err != nil {
+		addOperationError(ctx, &resp.Diagnostics, "create", data.Path, "failed to decrypt secret", err)
+		return
+	}
+	resp.Diagnostics.Append(req.Config.GetAttribute(ctx, path.Root("encrypted_secrets_wo"), &data.EncryptedSecretsWO)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	data.writeOnly, err = r.decryptWriteOnlySecrets(ctx, data, decrypted)
+	if err != nil {
+		addOperationError(ctx, &resp.Diagnostics, "create", data.Path, "failed to decrypt secret", err)
+		return
+	}
+
+	generated, hmacs, err := r.generateSecrets(ctx, data.GeneratedSecrets, nil, nil, nil)
+	if err != nil {
+		addOperationError(ctx, &resp.Diagnostics, "create", data.Path, "failed to generate secret", err)
+		return
+	}
+	for k, v := range generated {
+		decrypted[k] = v
+	}
+
+	if data.PreserveUnmanagedKeys.ValueBool() {
+		if err := r.mergeUnmanagedKeys(ctx, r.kv.secretPath(data.Path), nil, data, decrypted, &resp.Diagnostics); err != nil {
+			addOperationError(ctx, &resp.Diagnostics, "create", data.Path, "failed to get secret", err)
+			return
+		}
+	}
+
+	metadata, err := r.signedMetadata(ctx, data, decrypted)
+	if err != nil {
+		addOperationError(ctx, &resp.Diagnostics, "create", data.Path, "failed to sign secret", err)
+		return
+	}
+
+	var adopted bool
+	var overwritten []string
+	if data.AdoptExisting.ValueBool() {
+		adopted, overwritten, err = r.adopt(ctx, r.kv.secretPath(data.Path), metadata, decrypted)
+		if err != nil {
+			addOperationError(ctx, &resp.Diagnostics, "create", data.Path, "failed to adopt secret", err)
+			return
+		}
+	}
+
+	var takenOver bool
+	if from := data.ForceTakeoverFrom.ValueString(); from != "" {
+		takenOver, err = r.takeOver(ctx, r.kv.secretPath(data.Path), from, metadata)
+		if err != nil {
+			addOperationError(ctx, &resp.Diagnostics, "create", data.Path, "failed to take secret over", err)
+			return
+		}
+	}
+
+	version, err := r.kv.Put(ctx, r.kv.secretPath(data.Path), decrypted, metadata)
+	if err != nil && r.kv.mountMissing(ctx, err) {
+		resp.Diagnostics.AddError("KV mount missing", fmt.Sprintf("mount %s does not exist, enable it or fix kv_path", strings.Trim(r.kv.path, "/")))
+		return
+	} else if err != nil {
+		addOperationError(ctx, &resp.Diagnostics, "create", data.Path, "failed to decrypt secret", err)
+		return
+	}
+	r.kv.audit(ctx, "create", r.kv.fullPath(r.kv.secretPath(data.Path)), data.managedKeys(), version, &resp.Diagnostics)
+	r.destroyOldVersions(ctx, data, r.kv.secretPath(data.Path), &resp.Diagnostics)
+
+	if takenOver {
+		r.warnTakenOver(r.kv.secretPath(data.Path), data.ForceTakeoverFrom.ValueString(), &resp.Diagnostics)
+	}
+	if adopted {
+		detail := "no key was overwritten"
+		if len(overwritten) > 0 {
+			detail = "keys overwritten or removed: " + strings.Join(overwritten, ", ")
+		}
+		resp.Diagnostics.AddWarning(
+			"existing secret adopted",
+			fmt.Sprintf("%s had no ownership marker, it is now managed by this Terraform configuration and %s", r.kv.fullPath(r.kv.secretPath(data.Path)), detail),
+		)
+	}
+
+	// The state only lists the additional paths written, the others are
+	// written again on the next apply.
+	if written := r.writeMirrors(ctx, resp.Private, "create", data, data.managedKeys(), decrypted, metadata, true, &resp.Diagnostics); len(written) < len(data.AdditionalPaths) {
+		data.AdditionalPaths = written
+	}
+
+	data.setKeyVersions()
+	data.ExternalKeys = data.externalKeys(decrypted)
+	data.RewrappedCiphertexts = types.MapNull(types.StringType)
+	data.RestoredFromVersion = types.Int64Null()
+	data.Plaintext, err = data.plaintext(decrypted)
+	if err != nil {
+		addOperationError(ctx, &resp.Diagnostics, "create", data.Path, "failed to expose secret", err)
+		return
+	}
+	data.UIURL = types.StringValue(r.kv.uiURL(r.kv.secretPath(data.Path)))
+	resp.Diagnostics.Append(setWrittenVersion(ctx, resp.Private, version)...)
+	resp.Diagnostics.Append(setPathPrefix(ctx, resp.Private, r.kv.pathPrefix)...)
+	resp.Diagnostics.Append(setPrivateValue(ctx, resp.Private, managedByKey, r.kv.managedBy)...)
+	resp.Diagnostics.Append(setGeneratedHMACs(ctx, resp.Private, hmacs)...)
+	resp.Diagnostics.Append(setPrivateValue(ctx, resp.Private, ageHMACsKey, ageHMACs)...)
+	resp.Diagnostics.Append(setPrivateValue(ctx, resp.Private, writeOnlyHMACsKey, data.writeOnly)...)
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *SecretResource) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
+	var data, prior SecretModel
+
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	resp.Diagnostics.Append(req.State.Get(ctx, &prior)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := withTimeout(ctx, data.Timeouts, "read", &resp.Diagnostics)
+	defer cancel()
+
+	// The secret stays where it was written until a path_prefix change
+	// replaces or moves it: its ui_url keeps the old prefix, so the plan
+	// sees the change.
+	prefix, diags := getPathPrefix(ctx, req.Private)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	data.UIURL = types.StringValue(r.kv.uiURL(prefix + data.Path))
+
+	// A secret about to be destroyed only needs to exist, a gone one makes
+	// the destroy a no-op.
+	if r.refreshExistenceOnly {
+		_, err := r.kv.client.KVv2(r.kv.path).GetMetadata(ctx, prefix+data.Path)
+		if errors.Is(err, api.ErrSecretNotFound) {
+			resp.State.RemoveResource(ctx)
+			return
+		} else if err != nil {
+			addOperationError(ctx, &resp.Diagnostics, "read", data.Path, "failed to read secret metadata", err)
+			return
+		}
+		resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+		return
+	}
+
+	if r.refreshVersionOnly {
+		unchanged, err := r.refreshMetadata(ctx, req.Private, prefix, &data)
+		if err != nil {
+			addOperationError(ctx, &resp.Diagnostics, "read", data.Path, "failed to read secret metadata", err)
+			return
+		}
+		if unchanged {
+			resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+			return
+		}
+	}
+
+	decrypted, err := r.decryptSecrets(ctx, data)
+	if err != nil {
+		addOperationError(ctx, &resp.Diagnostics, "read", data.Path, "failed to decrypt secret ", err)
+		return
+	}
+
+	kv, err := r.kv.client.KVv2(r.kv.path).Get(ctx, prefix+data.Path)
+	if err != nil && r.kv.mountMissing(ctx, err) {
+		resp.Diagnostics.AddWarning(
+			"KV mount missing",
+			fmt.Sprintf("mount %s does not exist anymore, %s is removed from the state", strings.Trim(r.kv.path, "/"), r.kv.fullPath(prefix+data.Path)),
+		)
+		resp.State.RemoveResource(ctx)
+		return
+	} else if err != nil {
+		addOperationError(ctx, &resp.Diagnostics, "read", data.Path, "failed to get secret", err)
+		return
+	}
+
+	if data.ExpectNoExternalWrites.ValueBool() {
+		written, diags := getWrittenVersion(ctx, req.Private)
+		resp.Diagnostics.Append(diags...)
+		if written != 0 && kv.VersionMetadata != nil && kv.VersionMetadata.Version != written {
+			resp.Diagnostics.AddError(
+				"unexpected external write",
+				fmt.Sprintf("%s is at version %d but Terraform last wrote version %d, inspect the new versions before applying again", r.kv.fullPath(prefix+data.Path), kv.VersionMetadata.Version, written),
+			)
+		}
+		if resp.Diagnostics.HasError() {
+			return
+		}
+	}
+
+	if r.verifySignatures {
+		if err := r.verifySignature(ctx, prefix+data.Path, kv.Data, kv.CustomMetadata, &resp.Diagnostics); err != nil {
+			addOperationError(ctx, &resp.Diagnostics, "read", data.Path, "failed to verify signature", err)
+			return
+		}
+		if resp.Diagnostics.HasError() {
+			return
+		}
+	}
+
+	// A restored version stands until the configuration is written again.
+	var restored int
+	resp.Diagnostics.Append(getPrivateValue(ctx, req.Private, restoredVersionKey, &restored)...)
+	if restored != 0 && kv.VersionMetadata != nil && kv.VersionMetadata.Version == restored {
+		resp.Diagnostics.AddWarning(
+			"secret restored",
+			fmt.Sprintf("%s holds version %d, restored from version %d, instead of the configured values. They are written again once the configuration of the secret changes or restore_from_version is removed", r.kv.fullPath(prefix+data.Path), restored, data.RestoredFromVersion.ValueInt64()),
+		)
+		resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+		return
+	}
+
+	// Generated values are checked against the HMACs recorded when they were
+	// generated, a mismatch drops the key from the state so it gets
+	// regenerated.
+	hmacs, diags := getGeneratedHMACs(ctx, req.Private)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	generated := maps.Clone(data.GeneratedSecrets)
+	for k := range generated {
+		value, ok := kv.Data[k].(string)
+		if !ok || hmacs[k] == "" {
+			delete(data.GeneratedSecrets, k)
+			continue
+		}
+
+		valid, err := r.transit.VerifyHMAC(ctx, value, hmacs[k])
+		if err != nil {
+			addOperationError(ctx, &resp.Diagnostics, "read", data.Path, "failed to verify HMAC", err)
+			return
+		}
+		if !valid {
+			delete(data.GeneratedSecrets, k)
+		}
+	}
+
+	// age values cannot be encrypted again, they are checked against the
+	// HMACs recorded when they were written like generated values, and a
+	// mismatch drops the key so the next apply writes it again.
+	var ageHMACs map[string]string
+	resp.Diagnostics.Append(getPrivateValue(ctx, req.Private, ageHMACsKey, &ageHMACs)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	age := maps.Clone(data.AgeEncryptedSecrets)
+	for k := range age {
+		value, ok := kv.Data[k].(string)
+		if !ok || ageHMACs[k] == "" {
+			delete(data.AgeEncryptedSecrets, k)
+			continue
+		}
+
+		valid, err := r.transit.VerifyHMAC(ctx, data.normalize(k, value), ageHMACs[k])
+		if err != nil {
+			addOperationError(ctx, &resp.Diagnostics, "read", data.Path, "failed to verify HMAC", err)
+			return
+		}
+		if !valid {
+			delete(data.AgeEncryptedSecrets, k)
+		}
+	}
+
+	// Write-only values are checked the same way, a mismatch drops the key
+	// and encrypted_secrets_wo_version so the next apply writes them again.
+	resp.Diagnostics.Append(getPrivateValue(ctx, req.Private, writeOnlyHMACsKey, &data.writeOnly)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	prior.writeOnly = maps.Clone(data.writeOnly)
+	writeOnly := maps.Clone(data.writeOnly)
+	for k, hmac := range writeOnly {
+		value, ok := kv.Data[k].(string)
+		valid := false
+		if ok {
+			valid, err = r.transit.VerifyHMAC(ctx, data.normalize(k, value), hmac)
+			if err != nil {
+				addOperationError(ctx, &resp.Diagnostics, "read", data.Path, "failed to verify HMAC", err)
+				return
+			}
+		}
+		if !valid {
+			delete(data.writeOnly, k)
+			data.EncryptedSecretsWOVersion = types.Int64Null()
+		}
+	}
+
+	// Keys found in Vault but not in the state are reported in the attribute
+	// the resource uses.
+	usesValues := data.EncryptedValues != nil && data.EncryptedSecrets == nil && data.EncryptedSecretObjects == nil
+	usesObjects := data.EncryptedSecretObjects != nil && data.EncryptedSecrets == nil && data.EncryptedValues == nil
+
+	dataout := make(map[string]*string)
+	valuesout := make(map[string]string)
+	objectsout := make(map[string]EncryptedSecretModel)
+	plaintextout := make(map[string]string)
+	for k, v := range kv.Data {
+		if _, ok := generated[k]; ok {
+			continue
+		}
+		if _, ok := age[k]; ok {
+			continue
+		}
+		if _, ok := writeOnly[k]; ok {
+			continue
+		}
+
+		// Plaintext keys stay plaintext, keys unknown to the state are
+		// encrypted below as they may well be sensitive.
+		if configured, ok := data.NonSensitiveData[k]; ok {
+			vstr, ok := v.(string)
+			if !ok {
+				b, err := json.Marshal(v)
+				if err != nil {
+					resp.Diagnostics.AddError("failed to encode secret value", err.Error())
+					return
+				}
+				vstr = string(b)
+			}
+			// The configuration is kept while it is written as is.
+			if data.normalize(k, vstr) == data.normalize(k, configured) {
+				vstr = configured
+			}
+			plaintextout[k] = vstr
+			continue
+		}
+
+		// Keys written by other tools may not be ours to track.
+		if !data.manages(k) && data.ignoresUnmanagedKeys() {
+			continue
+		}
+
+		if _, ok := data.EncryptedValues[k]; ok || (usesValues && !data.manages(k)) {
+			if value, ok := decrypted[k]; ok && jsonEqual(value, v) {
+				valuesout[k] = data.EncryptedValues[k]
+				continue
+			}
+
+			b, err := json.Marshal(v)
+			if err != nil {
+				resp.Diagnostics.AddError("failed to encode secret value", err.Error())
+				return
+			}
+			valuesout[k], err = r.transit.EncryptDerivedLike(ctx, data.EncryptedValues[k], string(b), "")
+			if err != nil {
+				addOperationError(ctx, &resp.Diagnostics, "read", data.Path, "failed encrypt secret", err)
+				return
+			}
+			continue
+		}
+
+		if object, ok := data.EncryptedSecretObjects[k]; ok || (usesObjects && !data.manages(k)) {
+			if value, ok := decrypted[k]; !ok || !data.sameValue(k, value, v) {
+				vstr, ok := v.(string)
+				if !ok {
+					resp.Diagnostics.AddError("Values must be strings",
+						fmt.Sprintf("the value of %q in secrert %q is not a string", k, data.Path))
+					return
+				}
+				object.Ciphertext, err = r.encryptLive(ctx, data, k, vstr, object.Ciphertext, object.Context.ValueString())
+				if err != nil {
+					addOperationError(ctx, &resp.Diagnostics, "read", data.Path, "failed encrypt secret", err)
+					return
+				}
+			}
+			object.KeyVersion = ciphertextKeyVersion(object.Ciphertext)
+			objectsout[k] = object
+			continue
+		}
+
+		if value, ok := decrypted[k]; ok && data.sameValue(k, value, v) {
+			dataout[k] = data.EncryptedSecrets[k]
+		} else {
+			vstr, ok := v.(string)
+			if !ok {
+				resp.Diagnostics.AddError("Values must be strings",
+					fmt.Sprintf("the value of %q in secrert %q is not a string", k, data.Path))
+				return
+			}
+			// A key that must be absent but came back is drift like any
+			// other value, the next apply removes it.
+			var previous string
+			if c := data.EncryptedSecrets[k]; c != nil {
+				previous = *c
+			}
+			encrypted, err := r.encryptLive(ctx, data, k, vstr, previous, "")
+			if err != nil {
+				addOperationError(ctx, &resp.Diagnostics, "read", data.Path, "failed encrypt secret", err)
+				return
+			}
+			dataout[k] = &encrypted
+		}
+	}
+	for _, k := range data.absentKeys() {
+		if _, ok := kv.Data[k]; !ok {
+			dataout[k] = nil
+		}
+	}
+
+	if data.EncryptedSecrets != nil || len(dataout) > 0 {
+		data.EncryptedSecrets = dataout
+	}
+	if data.EncryptedValues != nil || len(valuesout) > 0 {
+		data.EncryptedValues = valuesout
+	}
+	if data.EncryptedSecretObjects != nil || len(objectsout) > 0 {
+		data.EncryptedSecretObjects = objectsout
+	}
+	if data.NonSensitiveData != nil {
+		data.NonSensitiveData = plaintextout
+	}
+
+	if err := r.verifyMirrors(ctx, req.Private, prefix, &data); err != nil {
+		addOperationError(ctx, &resp.Diagnostics, "read", data.Path, "failed to verify additional paths", err)
+		return
+	}
+
+	if changed := changedKeys(prior, data); len(changed) > 0 {
+		switch data.OnExternalChange.ValueString() {
+		case "error":
+			resp.Diagnostics.AddError(
+				"secret changed outside of Terraform",
+				fmt.Sprintf("%s was changed outside of Terraform, keys: %s. Reconcile it by hand, or set on_external_change = \"reconcile\" to revert it on the next apply", r.kv.fullPath(prefix+data.Path), strings.Join(changed, ", ")),
+			)
+			return
+		case "ignore":
+			prior.Protected = data.Protected
+			prior.UIURL = data.UIURL
+			data = prior
+		}
+	}
+	data.ExternalKeys = data.externalKeys(kv.Data)
+	data.Protected = types.BoolValue(kv.CustomMetadata[deletionProtectedKey] == "true")
+	data.Plaintext, err = data.plaintext(kv.Data)
+	if err != nil {
+		addOperationError(ctx, &resp.Diagnostics, "read", data.Path, "failed to expose secret", err)
+		return
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+// destroyOldVersions destroys the versions of the secret at k older than the
+// newest destroy_versions_older_than. The write already succeeded, failures
+// only warn.
+func (r *SecretResource) destroyOldVersions(ctx context.Context, data SecretModel, k string, diags *diag.Diagnostics) {
+	if data.DestroyVersionsOlderThan.IsNull() {
+		return
+	}
+
+	keep := int(data.DestroyVersionsOlderThan.ValueInt64())
+	destroyed, err := r.kv.DestroyOldVersions(ctx, k, keep)
+	if err != nil {
+		diags.AddWarning(
+			"failed to destroy old versions",
+			fmt.Sprintf("the versions of %s older than the newest %d are kept: %s", r.kv.fullPath(k), keep, errorDetail(err)),
+		)
+		return
+	}
+	if len(destroyed) > 0 {
+		tflog.Info(ctx, "destroyed old versions", map[string]any{"path": r.kv.fullPath(k), "versions": destroyed})
+	}
+}
+
+// encryptLive encrypts the live value v of k so the resource writes it back
+// unchanged: values written verbatim are the base64 transit plaintext. It
+// goes through the transit route of previous, the ciphertext it replaces.
+func (r *SecretResource) encryptLive(ctx context.Context, data SecretModel, k, v, previous, keyContext string) (string, error) {
+	if !data.decodesValue(k) {
+		plaintext, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			return "", fmt.Errorf("the value of %q is not base64, set values_are_base64 = false to manage plain values: %w", k, err)
+		}
+		v = string(plaintext)
+	}
+	return r.transit.EncryptDerivedLike(ctx, previous, v, keyContext)
+}
+
+// refreshMetadata only refreshes the metadata of data when the current
+// version of the secret is the one we wrote, it reports whether it did. A
+// new version is the only way the data of a KVv2 secret changes.
+func (r *SecretResource) refreshMetadata(ctx context.Context, private privateState, prefix string, data *SecretModel) (bool, error) {
+	written, diags := getWrittenVersion(ctx, private)
+	if diags.HasError() || written == 0 {
+		return false, nil
+	}
+
+	meta, err := r.kv.client.KVv2(r.kv.path).GetMetadata(ctx, prefix+data.Path)
+	if errors.Is(err, api.ErrSecretNotFound) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	// Deleting or destroying the version does not create a new one.
+	latest, ok := meta.Versions[strconv.Itoa(meta.CurrentVersion)]
+	if meta.CurrentVersion != written || !ok || latest.Destroyed || !latest.DeletionTime.IsZero() {
+		return false, nil
+	}
+
+	data.Protected = types.BoolValue(meta.CustomMetadata[deletionProtectedKey] == "true")
+	return true, nil
+}
+
+func (r *SecretResource) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
+	var plan, state SecretModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := withTimeout(ctx, plan.Timeouts, "update", &resp.Diagnostics)
+	defer cancel()
+
+	decrypted, err := r.decryptSecrets(ctx, plan)
+	if err != nil {
+		addOperationError(ctx, &resp.Diagnostics, "update", plan.Path, "failed to decrypt secret", err)
+		return
+	}
+	ageHMACs, err := r.decryptAgeSecrets(ctx, plan, decrypted)
+	if err != nil {
+		addOperationError(ctx, &resp.Diagnostics, "update", plan.Path, "failed to decrypt secret", err)
+		return
+	}
+	resp.Diagnostics.Append(setPrivateValue(ctx, resp.Private, ageHMACsKey, ageHMACs)...)
+	resp.Diagnostics.Append(req.Config.GetAttribute(ctx, path.Root("encrypted_secrets_wo"), &plan.EncryptedSecretsWO)...)
+	resp.Diagnostics.Append(getPrivateValue(ctx, req.Private, writeOnlyHMACsKey, &state.writeOnly)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	plan.writeOnly, err = r.decryptWriteOnlySecrets(ctx, plan, decrypted)
+	if err != nil {
+		addOperationError(ctx, &resp.Diagnostics, "update", plan.Path, "failed to decrypt secret", err)
+		return
+	}
+	resp.Diagnostics.Append(setPrivateValue(ctx, resp.Private, writeOnlyHMACsKey, plan.writeOnly)...)
+
+	// With allow_rename, a path or path_prefix change moves the secret from
+	// source to target, the live values are read from source.
+	prefix, diags := getPathPrefix(ctx, req.Private)
+	resp.Diagnostics.Append(diags...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+	source, target := prefix+state.Path, r.kv.secretPath(plan.Path)
+
+	// A keepers change writes the secret again and regenerates its
+	// generated values.
+	rekeep := !maps.Equal(plan.Keepers, state.Keepers)
+
+	// A restore writes the data of the version as is, whatever the
+	// configuration says.
+	restore := !plan.RestoreFromVersion.IsNull() && !plan.RestoreFromVersion.Equal(state.RestoreFromVersion)
+	if restore {
+		if source != target {
+			resp.Diagnostics.AddAttributeError(
+				path.Root("restore_from_version"),
+				"conflicting changes",
+				fmt.Sprintf("%s cannot be restored while it moves to %s, apply one change at a time", r.kv.fullPath(source), r.kv.fullPath(target)),
+			)
+			return
+		}
+		decrypted, err = r.readRestoredVersion(ctx, source, int(plan.RestoreFromVersion.ValueInt64()))
+		if err != nil {
+			addOperationError(ctx, &resp.Diagnostics, "update", plan.Path, "failed to restore secret", err)
+			return
+		}
+	} else if len(plan.GeneratedSecrets) > 0 {
+		hmacs, diags := getGeneratedHMACs(ctx, req.Private)
+		resp.Diagnostics.Append(diags...)
+		if resp.Diagnostics.HasError() {
+			return
+		}
+
+		var currentData map[string]any
+		current, err := r.kv.client.KVv2(r.kv.path).Get(ctx, source)
+		if err == nil {
+			currentData = current.Data
+		} else if !errors.Is(err, api.ErrSecretNotFound) {
+			addOperationError(ctx, &resp.Diagnostics, "update", plan.Path, "failed to get secret", err)
+			return
+		}
+
+		prior := state.GeneratedSecrets
+		if rekeep {
+			prior = nil
+		}
+		generated, hmacs, err := r.generateSecrets(ctx, plan.GeneratedSecrets, prior, currentData, hmacs)
+		if err != nil {
+			addOperationError(ctx, &resp.Diagnostics, "update", plan.Path, "failed to generate secret", err)
+			return
+		}
+		for k, v := range generated {
+			decrypted[k] = v
+		}
+		resp.Diagnostics.Append(setGeneratedHMACs(ctx, resp.Private, hmacs)...)
+	} else {
+		resp.Diagnostics.Append(setGeneratedHMACs(ctx, resp.Private, nil)...)
+	}
+
+	// Patches leave the keys written by other tools alone, a renamed secret
+	// must carry them over.
+	keepUnmanaged := plan.PreserveUnmanagedKeys.ValueBool() && plan.UpdateStrategy.ValueString() != "patch"
+	if source != target {
+		keepUnmanaged = plan.PreserveUnmanagedKeys.ValueBool() || plan.UpdateStrategy.ValueString() == "patch"
+	}
+	if keepUnmanaged && !restore {
+		if err := r.mergeUnmanagedKeys(ctx, source, &state, plan, decrypted, &resp.Diagnostics); err != nil {
+			addOperationError(ctx, &resp.Diagnostics, "update", plan.Path, "failed to get secret", err)
+			return
+		}
+	}
+
+	if plan.OnExternalChange.ValueString() == "ignore" && !restore {
+		if err := r.keepExternalChanges(ctx, source, state, plan, decrypted); err != nil {
+			addOperationError(ctx, &resp.Diagnostics, "update", plan.Path, "failed to get secret", err)
+			return
+		}
+	}
+
+	// Refuse to write over a version written since the latest apply.
+	var opts []api.KVOption
+	if plan.ExpectNoExternalWrites.ValueBool() {
+		written, diags := getWrittenVersion(ctx, req.Private)
+		resp.Diagnostics.Append(diags...)
+		if resp.Diagnostics.HasError() {
+			return
+		}
+		if written != 0 {
+			opts = append(opts, api.WithCheckAndSet(written))
+		}
+	}
+
+	rewrap := !plan.RewrapTrigger.Equal(state.RewrapTrigger)
+	if rewrap {
+		rewrapped, err := r.rewrapCiphertexts(ctx, plan)
+		if err != nil {
+			addOperationError(ctx, &resp.Diagnostics, "update", plan.Path, "failed to rewrap secret", err)
+			return
+		}
+		var diags diag.Diagnostics
+		plan.RewrappedCiphertexts, diags = types.MapValueFrom(ctx, types.StringType, rewrapped)
+		resp.Diagnostics.Append(diags...)
+		if resp.Diagnostics.HasError() {
+			return
+		}
+	} else if plan.RewrappedCiphertexts.IsUnknown() {
+		plan.RewrappedCiphertexts = types.MapNull(types.StringType)
+	}
+
+	// A renamed secret is never written over an existing one.
+	var takenOver bool
+	if from := plan.ForceTakeoverFrom.ValueString(); from != "" && source == target {
+		metadata, err := r.signedMetadata(ctx, plan, decrypted)
+		if err != nil {
+			addOperationError(ctx, &resp.Diagnostics, "update", plan.Path, "failed to sign secret", err)
+			return
+		}
+		takenOver, err = r.takeOver(ctx, target, from, metadata)
+		if err != nil {
+			addOperationError(ctx, &resp.Diagnostics, "update", plan.Path, "failed to take secret over", err)
+			return
+		}
+	}
+
+	var version int
+	if source != target {
+		version, err = r.rename(ctx, source, target, plan, decrypted, opts...)
+		if err != nil && version != 0 {
+			// The secret is managed at target now, the state must follow it
+			// even though source is left behind.
+			resp.Diagnostics.AddError(
+				"failed to delete the old path of the renamed secret",
+				fmt.Sprintf("%s was renamed to %s but it could not be deleted, it still carries the ownership marker and is listed by the orphans data source. Delete it by hand: %s", r.kv.fullPath(source), r.kv.fullPath(target), errorDetail(err)),
+			)
+			err = nil
+		}
+	} else if plan.UpdateStrategy.ValueString() == "patch" && !restore {
+		version, err = r.patch(ctx, state, plan, decrypted, rewrap || rekeep, opts...)
+	} else {
+		var metadata map[string]any
+		metadata, err = r.signedMetadata(ctx, plan, decrypted)
+		if err != nil {
+			addOperationError(ctx, &resp.Diagnostics, "update", plan.Path, "failed to sign secret", err)
+			return
+		}
+		if plan.AlwaysWrite.ValueBool() || rewrap || rekeep || restore {
+			version, err = r.kv.Put(ctx, r.kv.secretPath(plan.Path), decrypted, metadata, opts...)
+		} else {
+			version, err = r.kv.PutIfChanged(ctx, r.kv.secretPath(plan.Path), decrypted, metadata, opts...)
+		}
+	}
+	if err != nil {
+		addOperationError(ctx, &resp.Diagnostics, "update", plan.Path, "failed to decrypt secret", err)
+		return
+	}
+	resp.Diagnostics.Append(setPathPrefix(ctx, resp.Private, r.kv.pathPrefix)...)
+	changed := changedKeys(state, plan)
+	if restore {
+		changed = slices.Collect(maps.Keys(decrypted))
+	} else if rekeep {
+		for k := range plan.GeneratedSecrets {
+			if !slices.Contains(changed, k) {
+				changed = append(changed, k)
+			}
+		}
+	}
+	r.kv.audit(ctx, "update", r.kv.fullPath(target), changed, version, &resp.Diagnostics)
+	r.destroyOldVersions(ctx, plan, target, &resp.Diagnostics)
+
+	if takenOver {
+		r.warnTakenOver(target, plan.ForceTakeoverFrom.ValueString(), &resp.Diagnostics)
+	}
+
+	// The state only lists the additional paths written, and the removed
+	// ones left behind, so the next apply tries them again.
+	if len(plan.AdditionalPaths) > 0 {
+		metadata, err := r.signedMetadata(ctx, plan, decrypted)
+		if err != nil {
+			addOperationError(ctx, &resp.Diagnostics, "update", plan.Path, "failed to sign secret", err)
+			return
+		}
+		written := r.writeMirrors(ctx, resp.Private, "update", plan, changed, decrypted, metadata, plan.AlwaysWrite.ValueBool() || rewrap || rekeep || restore, &resp.Diagnostics)
+		if len(written) < len(plan.AdditionalPaths) {
+			plan.AdditionalPaths = written
+		}
+	}
+	for _, p := range r.deleteMirrors(ctx, prefix, state, plan, &resp.Diagnostics) {
+		if !slices.Contains(plan.AdditionalPaths, p) {
+			plan.AdditionalPaths = append(plan.AdditionalPaths, p)
+		}
+	}
+
+	plan.setKeyVersions()
+	if plan.ExternalKeys.IsUnknown() {
+		live := decrypted
+		// A patch leaves the other keys in the secret, only their names are
+		// needed.
+		if plan.UpdateStrategy.ValueString() == "patch" && !restore {
+			live, err = r.kv.GetSubkeys(ctx, target, 1)
+			if err != nil {
+				addOperationError(ctx, &resp.Diagnostics, "update", plan.Path, "failed to get secret keys", err)
+				return
+			}
+		}
+		plan.ExternalKeys = plan.externalKeys(live)
+	}
+	plan.UIURL = types.StringValue(r.kv.uiURL(r.kv.secretPath(plan.Path)))
+	// A patch leaves other keys in the secret, exposed like Read does.
+	exposed := decrypted
+	if plan.ExposePlaintext.ValueBool() && plan.UpdateStrategy.ValueString() == "patch" {
+		current, err := r.kv.client.KVv2(r.kv.path).Get(ctx, target)
+		if err != nil {
+			addOperationError(ctx, &resp.Diagnostics, "update", plan.Path, "failed to get secret", err)
+			return
+		}
+		exposed = current.Data
+	}
+	plan.Plaintext, err = plan.plaintext(exposed)
+	if err != nil {
+		addOperationError(ctx, &resp.Diagnostics, "update", plan.Path, "failed to expose secret", err)
+		return
+	}
+	plan.RestoredFromVersion = types.Int64Null()
+	restored := 0
+	if restore {
+		plan.RestoredFromVersion = plan.RestoreFromVersion
+		restored = version
+	}
+	resp.Diagnostics.Append(setPrivateValue(ctx, resp.Private, restoredVersionKey, restored)...)
+	resp.Diagnostics.Append(setWrittenVersion(ctx, resp.Private, version)...)
+	resp.Diagnostics.Append(setPrivateValue(ctx, resp.Private, managedByKey, r.kv.managedBy)...)
+	resp.Diagnostics.Append(resp.State.Set(ctx, &plan)...)
+}
+
+// rewrapCiphertexts returns the ciphertexts of data rebound to the latest
+// version of the transit key, by secret key.
+func (r *SecretResource) rewrapCiphertexts(ctx context.Context, data SecretModel) (map[string]string, error) {
+	rewrapped := make(map[string]string)
+	for k, v := range data.ciphertexts() {
+		ciphertext, err := r.transit.Rewrap(ctx, v.ciphertext, v.keyContext)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", k, err)
+		}
+		rewrapped[k] = ciphertext
+	}
+	for k, v := range data.EncryptedValues {
+		ciphertext, err := r.transit.Rewrap(ctx, v, "")
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", k, err)
+		}
+		rewrapped[k] = ciphertext
+	}
+	return rewrapped, nil
+}
+
+// mergeUnmanagedKeys adds to decrypted the keys of the live secret at k that
+// plan does not manage, so writing decrypted leaves them intact. Keys managed in
+// state but removed from plan are dropped.
+func (r *SecretResource) mergeUnmanagedKeys(ctx context.Context, k string, state *SecretModel, plan SecretModel, decrypted map[string]any, diags *diag.Diagnostics) error {
+	current, err := r.kv.client.KVv2(r.kv.path).Get(ctx, k)
+	if errors.Is(err, api.ErrSecretNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	for key, v := range current.Data {
+		if _, ok := decrypted[key]; ok {
+			if state == nil || !state.manages(key) {
+				diags.AddWarning(
+					"unmanaged key overwritten",
+					fmt.Sprintf("%q in %s was written outside of Terraform and is now overwritten by the configuration", key, r.kv.fullPath(k)),
+				)
+			}
+			continue
+		}
+
+		if (state != nil && state.manages(key)) || slices.Contains(plan.absentKeys(), key) {
+			continue
+		}
+		decrypted[key] = v
+	}
+
+	return nil
+}
+
+// keepExternalChanges sets in decrypted the live value, at k, of the keys whose
+// configuration did not change since state, and keeps the live keys neither
+// of them manages, so updates do not revert what on_external_change =
+// "ignore" ignored.
+func (r *SecretResource) keepExternalChanges(ctx context.Context, k string, state, plan SecretModel, decrypted map[string]any) error {
+	current, err := r.kv.client.KVv2(r.kv.path).Get(ctx, k)
+	if errors.Is(err, api.ErrSecretNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	for _, key := range state.managedKeys() {
+		before, ok := state.configValue(key)
+		if !ok {
+			continue
+		}
+		if after, ok := plan.configValue(key); !ok || after != before {
+			continue
+		}
+
+		if v, ok := current.Data[key]; ok {
+			decrypted[key] = v
+		} else {
+			delete(decrypted, key)
+		}
+	}
+
+	for key, v := range current.Data {
+		if !state.manages(key) && !plan.manages(key) {
+			decrypted[key] = v
+		}
+	}
+
+	return nil
+}
+
+// patch only sends the keys of decrypted that differ from the live secret, and
+// deletes the keys that were managed in state but are no longer in plan.
+// Keys written by other tools are left alone. With force, every key of
+// decrypted is sent.
+func (r *SecretResource) patch(ctx context.Context, state, plan SecretModel, decrypted map[string]any, force bool, opts ...api.KVOption) (int, error) {
+	current, err := r.kv.client.KVv2(r.kv.path).Get(ctx, r.kv.secretPath(plan.Path))
+	if err != nil {
+		return 0, err
+	}
+
+	patch := make(map[string]any)
+	for k, v := range decrypted {
+		if plan.AlwaysWrite.ValueBool() || force || !reflect.DeepEqual(current.Data[k], v) {
+			patch[k] = v
+		}
+	}
+
+	for _, k := range state.managedKeys() {
+		if _, ok := decrypted[k]; !ok {
+			patch[k] = nil
+		}
+	}
+	for _, k := range plan.absentKeys() {
+		if _, ok := current.Data[k]; ok {
+			patch[k] = nil
+		}
+	}
+
+	// The signature covers the secret as it will be once patched.
+	patched := maps.Clone(current.Data)
+	for k, v := range patch {
+		if v == nil {
+			delete(patched, k)
+		} else {
+			patched[k] = v
+		}
+	}
+	metadata, err := r.signedMetadata(ctx, plan, patched)
+	if err != nil {
+		return 0, err
+	}
+
+	return r.kv.Patch(ctx, r.kv.secretPath(plan.Path), patch, metadata, opts...)
+}
+
+func (r *SecretResource) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
+	var data SecretModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	ctx, cancel := withTimeout(ctx, data.Timeouts, "delete", &resp.Diagnostics)
+	defer cancel()
+
+	// Delete the secret where it was written, path_prefix may have changed
+	// since.
+	prefix, diags := getPathPrefix(ctx, req.Private)
+	resp.Diagnostics.Append(diags...)
+	resp.Diagnostics.Append(getPrivateValue(ctx, req.Private, writeOnlyHMACsKey, &data.writeOnly)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	// The secret stays in the state until its additional paths are gone.
+	if kept := r.deleteMirrors(ctx, prefix, data, SecretModel{}, &resp.Diagnostics); len(kept) > 0 {
+		return
+	}
+
+	// Nothing is left to delete once the mount is gone.
+	err := r.kv.Destroy(ctx, prefix+data.Path, data.ShredOnDestroy.ValueBool())
+	if err != nil && r.kv.mountMissing(ctx, err) {
+		resp.Diagnostics.AddWarning("KV mount missing", fmt.Sprintf("mount %s does not exist anymore, there is nothing to delete", strings.Trim(r.kv.path, "/")))
+	} else if err != nil {
+		addOperationError(ctx, &resp.Diagnostics, "delete", data.Path, "failed to delete secret", err)
+	} else {
+		r.kv.audit(ctx, "delete", r.kv.fullPath(prefix+data.Path), data.managedKeys(), 0, &resp.Diagnostics)
+	}
+
+	if resp.Diagnostics.HasError() {
+		return
+	}
+}
+
+func (r *SecretResource) ImportState(ctx context.Context, req resource.ImportStateRequest, resp *resource.ImportStateResponse) {
+	data := SecretModel{
+		Path:                 req.ID,
+		ExternalKeys:         types.ListNull(types.StringType),
+		RewrappedCiphertexts: types.MapNull(types.StringType),
+		Plaintext:            types.MapNull(types.StringType),
+		Timeouts:             nullTimeouts(),
+	}
+
+	// Make sure there is something to import before stamping ownership,
+	// otherwise a typo would create metadata for a secret with no data.
+	secretPath := r.kv.secretPath(data.Path)
+	r.kv.checkPathAllowed(secretPath, path.Root("path"), &resp.Diagnostics)
+	if err := r.kv.checkSecretPath(secretPath); err != nil {
+		resp.Diagnostics.AddError("invalid import ID", fmt.Sprintf("%q: %s", req.ID, err))
+	}
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	meta, err := r.kv.client.KVv2(r.kv.path).GetMetadata(ctx, secretPath)
+	if errors.Is(err, api.ErrSecretNotFound) {
+		resp.Diagnostics.AddError("secret not found", fmt.Sprintf("no secret found at %s", r.kv.fullPath(secretPath)))
+		return
+	} else if err != nil {
+		resp.Diagnostics.AddError("failed to read secret metadata", errorDetail(err))
+		return
+	}
+
+	// Soft-deleted secrets are not imported, there would be no data to
+	// reconcile the state with.
+	if latest, ok := meta.Versions[strconv.Itoa(meta.CurrentVersion)]; !ok || latest.Destroyed || !latest.DeletionTime.IsZero() {
+		resp.Diagnostics.AddError(
+			"secret deleted",
+			fmt.Sprintf("the latest version of %s is deleted or destroyed, undelete it or write a new version before importing it", r.kv.fullPath(secretPath)),
+		)
+		return
+	}
+
+	// A secret of another configuration is not imported, the way Create and
+	// adopt_existing leave it alone.
+	if managedBy, ok := r.kv.ownershipMarker(meta.CustomMetadata); ok && managedBy != "" {
+		if err := r.kv.checkOwnership(secretPath, meta.CustomMetadata); err != nil {
+			resp.Diagnostics.AddError("secret managed by another configuration", errorDetail(err)+", remove it from that configuration before importing it")
+			return
+		}
+	}
+
+	// Keep the custom metadata of the secret, an existing deletion lock and
+	// the marker of a secret_metadata resource included: importing must not
+	// unprotect a secret nor drop what others wrote on it.
+	metadata := r.kv.carriedMetadata(meta.CustomMetadata)
+	for _, key := range []string{deletionProtectedKey, metadataManagedByKey} {
+		if v, ok := meta.CustomMetadata[key]; ok {
+			metadata[key] = v
+		}
 	}
 
-	err := r.kv.OverwriteManagedbyMeta(ctx, data.Path)
+	err = r.kv.OverwriteManagedbyMeta(ctx, secretPath, metadata)
 	if err != nil {
-		resp.Diagnostics.AddError("failed to mark secret as managed by Terraform", err.Error())
+		resp.Diagnostics.AddError("failed to mark secret as managed by Terraform", errorDetail(err))
 		return
 	}
 
+	resp.Diagnostics.Append(setPathPrefix(ctx, resp.Private, r.kv.pathPrefix)...)
+	resp.Diagnostics.Append(setWrittenVersion(ctx, resp.Private, meta.CurrentVersion)...)
+	resp.Diagnostics.Append(setPrivateValue(ctx, resp.Private, managedByKey, r.kv.managedBy)...)
 	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
 }
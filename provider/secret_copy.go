@@ -0,0 +1,312 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/booldefault"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/int64planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/vault/api"
+)
+
+// Ensure provider defined types fully satisfy framework interfaces.
+var (
+	_ resource.Resource               = &SecretCopyResource{}
+	_ resource.ResourceWithModifyPlan = &SecretCopyResource{}
+)
+
+// copiedHMACKey is the private state key holding the HMAC of the data
+// written to the destination, to detect its drift without keeping it.
+const copiedHMACKey = "copied_hmac"
+
+func NewSecretCopyResource() resource.Resource {
+	return &SecretCopyResource{}
+}
+
+// SecretCopyResource copies a secret to another path, possibly in another
+// mount. Only the destination is owned.
+type SecretCopyResource struct {
+	ProviderData
+}
+
+// SecretCopyModel describes the resource data model.
+type SecretCopyModel struct {
+	SourceMount      types.String `tfsdk:"source_mount"`
+	SourcePath       types.String `tfsdk:"source_path"`
+	DestinationMount types.String `tfsdk:"destination_mount"`
+	DestinationPath  types.String `tfsdk:"destination_path"`
+	Trigger          types.Map    `tfsdk:"trigger"`
+	TrackSource      types.Bool   `tfsdk:"track_source"`
+	CopiedVersion    types.Int64  `tfsdk:"copied_version"`
+}
+
+func (r *SecretCopyResource) Metadata(ctx context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_secret_copy"
+}
+
+func (r *SecretCopyResource) Schema(ctx context.Context, req resource.SchemaRequest, resp *resource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		MarkdownDescription: "Copy of a secret to another path, e.g. to promote it from staging to production. " +
+			"The destination is marked as managed by Terraform, the source is only read. " +
+			"The copy is made again when `trigger` changes or the destination drifts, and when the source changes only with `track_source`. Destroying the resource deletes the destination.",
+		Attributes: map[string]schema.Attribute{
+			"source_mount": schema.StringAttribute{
+				Optional:    true,
+				Description: "KVv2 mount of the source, defaults to `kv_path`",
+			},
+			"source_path": schema.StringAttribute{
+				Required:    true,
+				Description: "Path of the source secret, relative to `path_prefix`",
+			},
+			"destination_mount": schema.StringAttribute{
+				Optional:      true,
+				Description:   "KVv2 mount of the destination, defaults to `kv_path`",
+				PlanModifiers: []planmodifier.String{stringplanmodifier.RequiresReplace()},
+			},
+			"destination_path": schema.StringAttribute{
+				Required:      true,
+				Description:   "Path of the destination secret, relative to `path_prefix`",
+				PlanModifiers: []planmodifier.String{stringplanmodifier.RequiresReplace()},
+			},
+			"trigger": schema.MapAttribute{
+				Optional:    true,
+				ElementType: types.StringType,
+				Description: "Arbitrary values whose change copies the source again, e.g. the release being promoted",
+			},
+			"track_source": schema.BoolAttribute{
+				Optional:    true,
+				Computed:    true,
+				Default:     booldefault.StaticBool(false),
+				Description: "Copy the source again whenever it has a new version",
+			},
+			"copied_version": schema.Int64Attribute{
+				Computed:      true,
+				Description:   "Version of the source that was copied",
+				PlanModifiers: []planmodifier.Int64{int64planmodifier.UseStateForUnknown()},
+			},
+		},
+	}
+}
+
+func (r *SecretCopyResource) Configure(ctx context.Context, req resource.ConfigureRequest, resp *resource.ConfigureResponse) {
+	// Prevent panic if the provider has not been configured.
+	if req.ProviderData == nil {
+		return
+	}
+
+	providerData, ok := req.ProviderData.(ProviderData)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Resource Configure Type",
+			fmt.Sprintf("Expected ProviderData, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+		)
+		return
+	}
+
+	r.ProviderData = providerData
+}
+
+// withMount returns v operating on mount, or on its own mount when mount is
+// null.
+func (v vaultKV) withMount(mount types.String) vaultKV {
+	if !mount.IsNull() && !mount.IsUnknown() {
+		v.path = mount.ValueString()
+	}
+	return v
+}
+
+// copySecret writes the latest version of the source to the destination and
+// records the copied version. The write is audited as operation.
+func (r *SecretCopyResource) copySecret(ctx context.Context, operation string, data *SecretCopyModel, private privateState, diags *diag.Diagnostics) error {
+	source := r.kv.withMount(data.SourceMount)
+	destination := r.kv.withMount(data.DestinationMount)
+
+	secret, err := source.client.KVv2(source.path).Get(ctx, source.secretPath(data.SourcePath.ValueString()))
+	if errors.Is(err, api.ErrSecretNotFound) {
+		return fmt.Errorf("the source %s does not exist or its latest version is deleted", source.fullPath(source.secretPath(data.SourcePath.ValueString())))
+	} else if err != nil {
+		return err
+	}
+
+	k := destination.secretPath(data.DestinationPath.ValueString())
+	version, err := destination.Put(ctx, k, secret.Data, nil)
+	if err != nil {
+		return err
+	}
+	r.kv.audit(ctx, operation, destination.fullPath(k), slices.Collect(maps.Keys(secret.Data)), version, diags)
+
+	hmac, err := r.contentHMAC(ctx, secret.Data)
+	if err != nil {
+		return err
+	}
+	if diags := setPrivateValue(ctx, private, copiedHMACKey, hmac); diags.HasError() {
+		return errors.New("failed to record the HMAC of the copy")
+	}
+
+	data.CopiedVersion = types.Int64Value(int64(secret.VersionMetadata.Version))
+	return nil
+}
+
+// contentHMAC returns the HMAC of the canonical form of data.
+func (r *SecretCopyResource) contentHMAC(ctx context.Context, data map[string]any) (string, error) {
+	input, err := canonicalContent(data)
+	if err != nil {
+		return "", err
+	}
+	return r.transit.HMAC(ctx, input)
+}
+
+func (r *SecretCopyResource) ModifyPlan(ctx context.Context, req resource.ModifyPlanRequest, resp *resource.ModifyPlanResponse) {
+	// Nothing to check on destroy, or before the provider is configured.
+	if req.Plan.Raw.IsNull() || r.kv.client == nil {
+		return
+	}
+
+	var plan SecretCopyModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if !plan.DestinationMount.IsUnknown() && !plan.DestinationPath.IsUnknown() {
+		destination := r.kv.withMount(plan.DestinationMount)
+		destination.checkPathAllowed(destination.secretPath(plan.DestinationPath.ValueString()), path.Root("destination_path"), &resp.Diagnostics)
+		if err := destination.checkSecretPath(destination.secretPath(plan.DestinationPath.ValueString())); err != nil {
+			resp.Diagnostics.AddAttributeError(path.Root("destination_path"), "invalid secret path", fmt.Sprintf("destination_path = %q: %s", plan.DestinationPath.ValueString(), err))
+		}
+	}
+
+	if req.State.Raw.IsNull() {
+		return
+	}
+
+	var state SecretCopyModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	// A drifted destination has no copied version, see Read.
+	recopy := state.CopiedVersion.IsNull() ||
+		!plan.Trigger.Equal(state.Trigger) ||
+		!plan.SourcePath.Equal(state.SourcePath) ||
+		!plan.SourceMount.Equal(state.SourceMount)
+
+	if !recopy && plan.TrackSource.ValueBool() && !plan.SourcePath.IsUnknown() {
+		source := r.kv.withMount(plan.SourceMount)
+		meta, err := source.client.KVv2(source.path).GetMetadata(ctx, source.secretPath(plan.SourcePath.ValueString()))
+		if err != nil {
+			resp.Diagnostics.AddError("failed to read source metadata", errorDetail(err))
+			return
+		}
+		recopy = int64(meta.CurrentVersion) != state.CopiedVersion.ValueInt64()
+	}
+
+	if recopy {
+		resp.Diagnostics.Append(resp.Plan.SetAttribute(ctx, path.Root("copied_version"), types.Int64Unknown())...)
+	}
+}
+
+func (r *SecretCopyResource) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
+	var data SecretCopyModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if err := r.copySecret(ctx, "create", &data, resp.Private, &resp.Diagnostics); err != nil {
+		resp.Diagnostics.AddError("failed to copy secret", errorDetail(err))
+		return
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+// Read checks the destination still holds the copy. A drifted destination
+// loses its copied version, which the next plan copies again.
+func (r *SecretCopyResource) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
+	var data SecretCopyModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	destination := r.kv.withMount(data.DestinationMount)
+	secret, err := destination.client.KVv2(destination.path).Get(ctx, destination.secretPath(data.DestinationPath.ValueString()))
+	if errors.Is(err, api.ErrSecretNotFound) {
+		resp.State.RemoveResource(ctx)
+		return
+	} else if err != nil {
+		resp.Diagnostics.AddError("failed to get destination secret", errorDetail(err))
+		return
+	}
+
+	var hmac string
+	resp.Diagnostics.Append(getPrivateValue(ctx, req.Private, copiedHMACKey, &hmac)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	input, err := canonicalContent(secret.Data)
+	if err != nil {
+		resp.Diagnostics.AddError("failed to verify destination secret", err.Error())
+		return
+	}
+	valid := false
+	if hmac != "" {
+		valid, err = r.transit.VerifyHMAC(ctx, input, hmac)
+		if err != nil {
+			resp.Diagnostics.AddError("failed to verify HMAC", errorDetail(err))
+			return
+		}
+	}
+	if !valid {
+		data.CopiedVersion = types.Int64Null()
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *SecretCopyResource) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
+	var plan SecretCopyModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if plan.CopiedVersion.IsUnknown() {
+		if err := r.copySecret(ctx, "update", &plan, resp.Private, &resp.Diagnostics); err != nil {
+			resp.Diagnostics.AddError("failed to copy secret", errorDetail(err))
+			return
+		}
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &plan)...)
+}
+
+func (r *SecretCopyResource) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
+	var data SecretCopyModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	destination := r.kv.withMount(data.DestinationMount)
+	k := destination.secretPath(data.DestinationPath.ValueString())
+	err := destination.Destroy(ctx, k, false)
+	if err == nil {
+		r.kv.audit(ctx, "delete", destination.fullPath(k), nil, 0, &resp.Diagnostics)
+	} else if !errors.Is(err, api.ErrSecretNotFound) {
+		resp.Diagnostics.AddError("failed to delete destination secret", errorDetail(err))
+	}
+}
@@ -0,0 +1,335 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/vault/api"
+)
+
+// Ensure provider defined types fully satisfy framework interfaces.
+var (
+	_ resource.Resource                = &SecretMetadataResource{}
+	_ resource.ResourceWithImportState = &SecretMetadataResource{}
+	_ resource.ResourceWithModifyPlan  = &SecretMetadataResource{}
+)
+
+// metadataManagedByKey marks the metadata managed by a secret_metadata
+// resource. It is distinct from the ownership marker, which claims the data.
+const metadataManagedByKey = "metadata_managed_by"
+
+func NewSecretMetadataResource() resource.Resource {
+	return &SecretMetadataResource{}
+}
+
+// SecretMetadataResource manages the metadata of a secret whose data is
+// written by something else. It never reads nor writes the data.
+type SecretMetadataResource struct {
+	ProviderData
+}
+
+// SecretMetadataModel describes the resource data model.
+type SecretMetadataModel struct {
+	Path               string            `tfsdk:"path"`
+	MaxVersions        types.Int64       `tfsdk:"max_versions"`
+	CASRequired        types.Bool        `tfsdk:"cas_required"`
+	DeleteVersionAfter types.String      `tfsdk:"delete_version_after"`
+	CustomMetadata     map[string]string `tfsdk:"custom_metadata"`
+}
+
+func (r *SecretMetadataResource) Metadata(ctx context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_secret_metadata"
+}
+
+func (r *SecretMetadataResource) Schema(ctx context.Context, req resource.SchemaRequest, resp *resource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		MarkdownDescription: "Metadata of an existing secret whose data is managed elsewhere, e.g. by an application. " +
+			"The data is never read nor written and the ownership marker is not required, the metadata is marked with `" + metadataManagedByKey + "` instead. " +
+			"Only the attributes that are set are managed, destroying the resource resets them and leaves the rest of the metadata alone.",
+		Attributes: map[string]schema.Attribute{
+			"path": schema.StringAttribute{
+				Required:    true,
+				Description: "Path of the secret, relative to `path_prefix`",
+				PlanModifiers: []planmodifier.String{
+					stringplanmodifier.RequiresReplace(),
+				},
+			},
+			"max_versions": schema.Int64Attribute{
+				Optional:    true,
+				Description: "Number of versions kept, 0 means the mount setting",
+				Validators:  []validator.Int64{int64AtLeastValidator{min: 0}},
+			},
+			"cas_required": schema.BoolAttribute{
+				Optional:    true,
+				Description: "Require the cas parameter on every write of the secret",
+			},
+			"delete_version_after": schema.StringAttribute{
+				Optional:    true,
+				Description: "Duration after which versions are deleted, 0s means the mount setting",
+				Validators:  []validator.String{durationValidator{}},
+			},
+			"custom_metadata": schema.MapAttribute{
+				Optional:    true,
+				ElementType: types.StringType,
+				Description: "Custom metadata keys to set, other keys are left alone",
+			},
+		},
+	}
+}
+
+func (r *SecretMetadataResource) Configure(ctx context.Context, req resource.ConfigureRequest, resp *resource.ConfigureResponse) {
+	// Prevent panic if the provider has not been configured.
+	if req.ProviderData == nil {
+		return
+	}
+
+	providerData, ok := req.ProviderData.(ProviderData)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Resource Configure Type",
+			fmt.Sprintf("Expected ProviderData, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+		)
+		return
+	}
+
+	r.ProviderData = providerData
+}
+
+// patchInput returns the merge patch turning the metadata set by prior into
+// the metadata of plan. Fields and keys dropped from plan are reset.
+func (r *SecretMetadataResource) patchInput(prior, plan SecretMetadataModel) (api.KVMetadataPatchInput, error) {
+	var input api.KVMetadataPatchInput
+
+	if !plan.MaxVersions.IsNull() {
+		maxVersions := int(plan.MaxVersions.ValueInt64())
+		input.MaxVersions = &maxVersions
+	} else if !prior.MaxVersions.IsNull() {
+		input.MaxVersions = new(int)
+	}
+
+	if !plan.CASRequired.IsNull() {
+		casRequired := plan.CASRequired.ValueBool()
+		input.CASRequired = &casRequired
+	} else if !prior.CASRequired.IsNull() {
+		input.CASRequired = new(bool)
+	}
+
+	if !plan.DeleteVersionAfter.IsNull() {
+		deleteVersionAfter, err := time.ParseDuration(plan.DeleteVersionAfter.ValueString())
+		if err != nil {
+			return input, err
+		}
+		input.DeleteVersionAfter = &deleteVersionAfter
+	} else if !prior.DeleteVersionAfter.IsNull() {
+		input.DeleteVersionAfter = new(time.Duration)
+	}
+
+	customMetadata := make(map[string]any)
+	for k := range prior.CustomMetadata {
+		customMetadata[k] = nil
+	}
+	for k, v := range plan.CustomMetadata {
+		customMetadata[k] = v
+	}
+	// The marker lives as long as the resource, whatever fields it sets.
+	if plan.Path != "" {
+		customMetadata[metadataManagedByKey] = r.kv.managedBy
+	} else {
+		customMetadata[metadataManagedByKey] = nil
+	}
+	input.CustomMetadata = customMetadata
+
+	return input, nil
+}
+
+// patch applies the metadata of plan over the one set by prior, after
+// checking the secret exists and its metadata is not managed by another
+// configuration.
+func (r *SecretMetadataResource) patch(ctx context.Context, prior, plan SecretMetadataModel) error {
+	k := r.kv.secretPath(plan.Path)
+	if err := r.kv.checkWritable(); err != nil {
+		return err
+	}
+	if err := r.kv.checkNotDenied(k); err != nil {
+		return err
+	}
+
+	meta, err := r.kv.client.KVv2(r.kv.path).GetMetadata(ctx, k)
+	if errors.Is(err, api.ErrSecretNotFound) {
+		return fmt.Errorf("%s does not exist, the metadata can only be managed once the secret is written", r.kv.fullPath(k))
+	} else if err != nil {
+		return err
+	}
+
+	if managedBy, ok := meta.CustomMetadata[metadataManagedByKey]; ok && managedBy != r.kv.managedBy {
+		return fmt.Errorf("the metadata of %q is managed by another Terraform configuration (%s: %q)", k, metadataManagedByKey, managedBy)
+	}
+
+	input, err := r.patchInput(prior, plan)
+	if err != nil {
+		return err
+	}
+
+	merged := make(map[string]any)
+	for key, value := range meta.CustomMetadata {
+		merged[key] = value
+	}
+	for key, value := range input.CustomMetadata {
+		if value == nil {
+			delete(merged, key)
+		} else {
+			merged[key] = value
+		}
+	}
+	if err := validateCustomMetadata(merged); err != nil {
+		return fmt.Errorf("invalid custom metadata for %q: %w", k, err)
+	}
+
+	return r.kv.client.KVv2(r.kv.path).PatchMetadata(ctx, k, input)
+}
+
+func (r *SecretMetadataResource) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
+	var data SecretMetadataModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if err := r.patch(ctx, SecretMetadataModel{}, data); err != nil {
+		resp.Diagnostics.AddError("failed to write secret metadata", errorDetail(err))
+		return
+	}
+	r.kv.audit(ctx, "create", r.kv.fullPath(r.kv.secretPath(data.Path)), nil, 0, &resp.Diagnostics)
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+// Read only refreshes the fields and custom metadata keys in the state,
+// the rest of the metadata belongs to whoever writes the secret.
+func (r *SecretMetadataResource) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
+	var data SecretMetadataModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	meta, err := r.kv.client.KVv2(r.kv.path).GetMetadata(ctx, r.kv.secretPath(data.Path))
+	if errors.Is(err, api.ErrSecretNotFound) {
+		resp.State.RemoveResource(ctx)
+		return
+	} else if err != nil {
+		resp.Diagnostics.AddError("failed to read secret metadata", errorDetail(err))
+		return
+	}
+
+	if !data.MaxVersions.IsNull() {
+		data.MaxVersions = types.Int64Value(int64(meta.MaxVersions))
+	}
+	if !data.CASRequired.IsNull() {
+		data.CASRequired = types.BoolValue(meta.CASRequired)
+	}
+	// Vault normalizes durations (768h becomes 768h0m0s), only report drift
+	// when the actual duration changed.
+	if !data.DeleteVersionAfter.IsNull() {
+		current, err := time.ParseDuration(data.DeleteVersionAfter.ValueString())
+		if err != nil || current != meta.DeleteVersionAfter {
+			data.DeleteVersionAfter = types.StringValue(meta.DeleteVersionAfter.String())
+		}
+	}
+	for k := range data.CustomMetadata {
+		if v, ok := meta.CustomMetadata[k]; ok {
+			data.CustomMetadata[k] = fmt.Sprint(v)
+		} else {
+			delete(data.CustomMetadata, k)
+		}
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *SecretMetadataResource) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
+	var plan, state SecretMetadataModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if err := r.patch(ctx, state, plan); err != nil {
+		resp.Diagnostics.AddError("failed to write secret metadata", errorDetail(err))
+		return
+	}
+	r.kv.audit(ctx, "update", r.kv.fullPath(r.kv.secretPath(plan.Path)), nil, 0, &resp.Diagnostics)
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &plan)...)
+}
+
+// Delete resets the fields and removes the custom metadata keys the resource
+// set, the secret itself is left alone.
+func (r *SecretMetadataResource) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
+	var data SecretMetadataModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	k := r.kv.secretPath(data.Path)
+	if err := r.kv.checkWritable(); err != nil {
+		resp.Diagnostics.AddError("failed to reset secret metadata", errorDetail(err))
+		return
+	}
+	if err := r.kv.checkNotDenied(k); err != nil {
+		resp.Diagnostics.AddError("failed to reset secret metadata", errorDetail(err))
+		return
+	}
+
+	input, err := r.patchInput(data, SecretMetadataModel{})
+	if err != nil {
+		resp.Diagnostics.AddError("failed to reset secret metadata", errorDetail(err))
+		return
+	}
+
+	err = r.kv.client.KVv2(r.kv.path).PatchMetadata(ctx, k, input)
+	if err == nil {
+		r.kv.audit(ctx, "delete", r.kv.fullPath(k), nil, 0, &resp.Diagnostics)
+	} else if !isNotFound(err) {
+		resp.Diagnostics.AddError("failed to reset secret metadata", errorDetail(err))
+	}
+}
+
+func (r *SecretMetadataResource) ModifyPlan(ctx context.Context, req resource.ModifyPlanRequest, resp *resource.ModifyPlanResponse) {
+	// Nothing to check on destroy, or before the provider is configured.
+	if req.Plan.Raw.IsNull() || r.kv.client == nil {
+		return
+	}
+
+	var p types.String
+	resp.Diagnostics.Append(req.Plan.GetAttribute(ctx, path.Root("path"), &p)...)
+	if !resp.Diagnostics.HasError() && !p.IsUnknown() {
+		r.kv.checkPathAllowed(r.kv.secretPath(p.ValueString()), path.Root("path"), &resp.Diagnostics)
+		if err := r.kv.checkSecretPath(r.kv.secretPath(p.ValueString())); err != nil {
+			resp.Diagnostics.AddAttributeError(path.Root("path"), "invalid secret path", fmt.Sprintf("path = %q: %s", p.ValueString(), err))
+		}
+	}
+}
+
+func (r *SecretMetadataResource) ImportState(ctx context.Context, req resource.ImportStateRequest, resp *resource.ImportStateResponse) {
+	r.kv.checkPathAllowed(r.kv.secretPath(req.ID), path.Root("path"), &resp.Diagnostics)
+	if err := r.kv.checkSecretPath(r.kv.secretPath(req.ID)); err != nil {
+		resp.Diagnostics.AddError("invalid import ID", fmt.Sprintf("%q: %s", req.ID, err))
+	}
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	resource.ImportStatePassthroughID(ctx, path.Root("path"), req, resp)
+}
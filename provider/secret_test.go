@@ -0,0 +1,756 @@
+package provider
+
+import (
+	"context"
+	"encoding/base64"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	vault "github.com/hashicorp/vault/api"
+)
+
+func TestSecretLifecycle(t *testing.T) {
+	p := newTestProvider(t, nil)
+
+	config := map[string]any{
+		"path":              "app/db",
+		"encrypted_secrets": map[string]any{"user": p.encrypt("admin"), "password": p.encrypt("hunter2")},
+		"values_are_base64": false,
+	}
+	s := p.apply("secret", nil, config)
+	if got := p.kvData("app/db"); got["user"] != "admin" || got["password"] != "hunter2" {
+		t.Fatalf("written data: %v", got)
+	}
+
+	// Ciphertexts change on every encryption, the plaintexts do not.
+	s = p.refresh(s)
+	if p.planChanges(s, config) {
+		t.Fatal("the refreshed secret plans changes")
+	}
+
+	config["encrypted_secrets"] = map[string]any{"user": p.encrypt("admin"), "password": p.encrypt("correct horse")}
+	s = p.apply("secret", s, config)
+	if got := p.kvData("app/db"); got["password"] != "correct horse" {
+		t.Fatalf("updated data: %v", got)
+	}
+
+	// A change made outside of Terraform is drift.
+	if _, err := p.vault().Logical().Write("secret/data/app/db", map[string]any{"data": map[string]any{"user": "admin", "password": "tampered"}}); err != nil {
+		t.Fatal(err)
+	}
+	s = p.refresh(s)
+	if !p.planChanges(s, config) {
+		t.Fatal("the drifted secret plans no changes")
+	}
+	s = p.apply("secret", s, config)
+	if got := p.kvData("app/db"); got["password"] != "correct horse" {
+		t.Fatalf("reconciled data: %v", got)
+	}
+
+	p.destroy(s)
+	if got := p.kvData("app/db"); got != nil {
+		t.Fatalf("data left after destroy: %v", got)
+	}
+}
+
+func TestSecretImport(t *testing.T) {
+	p := newTestProvider(t, nil)
+
+	if _, err := p.vault().Logical().Write("secret/data/app/api", map[string]any{"data": map[string]any{"key": base64.StdEncoding.EncodeToString([]byte("abc"))}}); err != nil {
+		t.Fatal(err)
+	}
+
+	s, diags := p.importState("secret", "app/api")
+	requireNoErrors(t, diags)
+	if s.attrs()["path"] != "app/api" {
+		t.Fatalf("imported path: %v", s.attrs()["path"])
+	}
+
+	config := map[string]any{
+		"path":              "app/api",
+		"encrypted_secrets": map[string]any{"key": p.encrypt("abc")},
+	}
+	// Only the defaults of the configuration change, the data does not.
+	s = p.apply("secret", s, config)
+	if got := p.kvData("app/api"); got["key"] != base64.StdEncoding.EncodeToString([]byte("abc")) {
+		t.Fatalf("data after import: %v", got)
+	}
+	if p.planChanges(p.refresh(s), config) {
+		t.Fatal("the imported secret plans changes")
+	}
+
+	_, diags = p.importState("secret", "app/typo")
+	requireError(t, diags, "no secret found at secret/app/typo")
+}
+
+func TestSecretImportOwnership(t *testing.T) {
+	ctx := context.Background()
+	p := newTestProvider(t, nil)
+	kv := p.vault().KVv2("secret")
+	write := func(k string, customMetadata map[string]any) {
+		t.Helper()
+		if _, err := kv.Put(ctx, k, map[string]any{"key": base64.StdEncoding.EncodeToString([]byte("abc"))}); err != nil {
+			t.Fatal(err)
+		}
+		if err := kv.PutMetadata(ctx, k, vault.KVMetadataPutInput{CustomMetadata: customMetadata}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("app/theirs", map[string]any{"managed_by": "other", "owner": "team-a"})
+	_, diags := p.importState("secret", "app/theirs")
+	requireError(t, diags, `"app/theirs" is not managed by this Terraform configuration (managed_by: "other")`)
+	meta, err := kv.GetMetadata(ctx, "app/theirs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]any{"managed_by": "other", "owner": "team-a"}; !reflect.DeepEqual(meta.CustomMetadata, want) {
+		t.Fatalf("custom metadata %v after the failed import, expected %v", meta.CustomMetadata, want)
+	}
+
+	for k, customMetadata := range map[string]map[string]any{
+		"app/unowned": {"owner": "team-a", deletionProtectedKey: "true", metadataManagedByKey: "test"},
+		"app/blank":   {"managed_by": "", "owner": "team-a"},
+		"app/ours":    {"managed_by": "test", "owner": "team-a"},
+	} {
+		write(k, customMetadata)
+		_, diags := p.importState("secret", k)
+		requireNoErrors(t, diags)
+
+		meta, err := kv.GetMetadata(ctx, k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := maps.Clone(customMetadata)
+		want["managed_by"] = "test"
+		for key, v := range meta.CustomMetadata {
+			if _, ok := want[key]; !ok && strings.HasPrefix(key, "vsac_") {
+				want[key] = v // provenance
+			}
+		}
+		if !reflect.DeepEqual(meta.CustomMetadata, want) {
+			t.Errorf("%s custom metadata %v after import, expected %v", k, meta.CustomMetadata, want)
+		}
+	}
+}
+
+func TestSecretProtectedTwoStepDestroy(t *testing.T) {
+	p := newTestProvider(t, nil)
+
+	config := map[string]any{
+		"path":              "app/root",
+		"encrypted_secrets": map[string]any{"password": p.encrypt("hunter2")},
+		"values_are_base64": false,
+		"protected":         true,
+	}
+	s := p.apply("secret", nil, config)
+
+	// Removing the resource block does not delete a protected secret.
+	requireError(t, p.tryDestroy(s), "set protected = false and apply before destroying it")
+	if p.kvData("app/root") == nil {
+		t.Fatal("the protected secret was deleted")
+	}
+
+	// Unprotecting it first, in its own apply, does.
+	config["protected"] = false
+	s = p.apply("secret", s, config)
+	p.destroy(s)
+	if got := p.kvData("app/root"); got != nil {
+		t.Fatalf("data left after destroy: %v", got)
+	}
+}
+
+func TestSecretImportSoftDeleted(t *testing.T) {
+	p := newTestProvider(t, nil)
+	kv := p.vault().KVv2("secret")
+
+	if _, err := p.vault().Logical().Write("secret/data/app/old", map[string]any{"data": map[string]any{"key": "abc"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := kv.DeleteVersions(context.Background(), "app/old", []int{1}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, diags := p.importState("secret", "app/old")
+	requireError(t, diags, "the latest version of secret/app/old is deleted or destroyed")
+
+	// Nothing was stamped on the secret.
+	meta, err := kv.GetMetadata(context.Background(), "app/old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(meta.CustomMetadata) != 0 {
+		t.Fatalf("custom metadata written by a failed import: %v", meta.CustomMetadata)
+	}
+
+	// Writing a new version makes it importable again.
+	if _, err := p.vault().Logical().Write("secret/data/app/old", map[string]any{"data": map[string]any{"key": "YWJj"}}); err != nil {
+		t.Fatal(err)
+	}
+	_, diags = p.importState("secret", "app/old")
+	requireNoErrors(t, diags)
+}
+
+func TestSecretPatchUpdate(t *testing.T) {
+	p := newTestProvider(t, nil)
+
+	config := map[string]any{
+		"path":              "app/api",
+		"encrypted_secrets": map[string]any{"key": p.encrypt("v1"), "removed": p.encrypt("gone soon")},
+		"values_are_base64": false,
+		"update_strategy":   "patch",
+	}
+	s := p.apply("secret", nil, config)
+
+	// Another tool merges its own key into the secret.
+	if _, err := p.vault().KVv2("secret").Patch(context.Background(), "app/api", map[string]any{"other": "theirs"}); err != nil {
+		t.Fatal(err)
+	}
+	s = p.refresh(s)
+
+	// Removing a key from the configuration sends null for it, which
+	// deletes it; the key of the other tool is left untouched.
+	config["encrypted_secrets"] = map[string]any{"key": p.encrypt("v2")}
+	p.apply("secret", s, config)
+
+	got := p.kvData("app/api")
+	want := map[string]any{"key": "v2", "other": "theirs"}
+	if len(got) != len(want) || got["key"] != want["key"] || got["other"] != want["other"] {
+		t.Fatalf("data after the patch: %v, expected %v", got, want)
+	}
+}
+
+func TestSecretRequiresValues(t *testing.T) {
+	p := newTestProvider(t, nil)
+
+	_, diags := p.tryApply("secret", nil, map[string]any{"path": "app/empty", "non_sensitive_data": map[string]any{"user": "admin"}})
+	requireError(t, diags, "one of encrypted_secrets, encrypted_values, encrypted_secret_objects, age_encrypted_secrets, generated_secrets and encrypted_secrets_wo must be set")
+	if got := p.kvData("app/empty"); got != nil {
+		t.Fatalf("data written by an invalid configuration: %v", got)
+	}
+}
+
+func TestSecretModelCiphertexts(t *testing.T) {
+	flat := "vault:v1:ZmxhdA=="
+	m := SecretModel{
+		EncryptedSecrets: map[string]*string{"user": &flat, "removed": nil},
+		EncryptedSecretObjects: map[string]EncryptedSecretModel{
+			"password": {Ciphertext: "vault:v3:b2JqZWN0", Context: types.StringValue("app/db")},
+			"token":    {Ciphertext: "vault:v2:dG9rZW4=", Context: types.StringNull()},
+		},
+	}
+
+	want := map[string]ciphertext{
+		"user":     {ciphertext: flat},
+		"password": {ciphertext: "vault:v3:b2JqZWN0", keyContext: "app/db"},
+		"token":    {ciphertext: "vault:v2:dG9rZW4="},
+	}
+	if got := m.ciphertexts(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("ciphertexts() = %v, expected %v", got, want)
+	}
+
+	m.setKeyVersions()
+	for k, version := range map[string]int64{"password": 3, "token": 2} {
+		if got := m.EncryptedSecretObjects[k].KeyVersion; got.ValueInt64() != version {
+			t.Errorf("key_version of %q = %v, expected %d", k, got, version)
+		}
+	}
+
+	// The context is part of the configured value of an object: the same
+	// ciphertext under another context is another value.
+	for k, want := range map[string]string{"user": flat, "removed": "", "password": "app/db:vault:v3:b2JqZWN0", "token": ":vault:v2:dG9rZW4="} {
+		if got, ok := m.configValue(k); !ok || got != want {
+			t.Errorf("configValue(%q) = %q, %t, expected %q", k, got, ok, want)
+		}
+	}
+}
+
+func TestSecretEncryptedObjects(t *testing.T) {
+	p := newTestProvider(t, nil)
+
+	config := map[string]any{
+		"path": "app/db",
+		"encrypted_secret_objects": map[string]any{
+			"password": map[string]any{"ciphertext": p.encryptDerived("hunter2", "app/db"), "context": "app/db"},
+			"user":     map[string]any{"ciphertext": p.encrypt("admin")},
+		},
+		"values_are_base64": false,
+	}
+	s := p.apply("secret", nil, config)
+	if got := p.kvData("app/db"); got["user"] != "admin" || got["password"] != "hunter2" {
+		t.Fatalf("written data: %v", got)
+	}
+	objects := s.attrs()["encrypted_secret_objects"].(map[string]any)
+	if got := objects["password"].(map[string]any)["key_version"]; got != int64(1) {
+		t.Fatalf("key_version in the state: %v", got)
+	}
+	if p.planChanges(p.refresh(s), config) {
+		t.Fatal("the refreshed secret plans changes")
+	}
+
+	// Moving to the flat form, the context can no longer be given.
+	config = map[string]any{
+		"path":              "app/db",
+		"encrypted_secrets": map[string]any{"user": p.encrypt("admin"), "password": p.encrypt("hunter2")},
+		"values_are_base64": false,
+	}
+	p.apply("secret", s, config)
+	if got := p.kvData("app/db"); got["user"] != "admin" || got["password"] != "hunter2" {
+		t.Fatalf("data after moving to encrypted_secrets: %v", got)
+	}
+}
+
+func TestSecretPathPrefixChange(t *testing.T) {
+	before := newTestProvider(t, map[string]any{"path_prefix": "old"})
+	config := map[string]any{
+		"path":              "app/db",
+		"encrypted_secrets": map[string]any{"password": before.encrypt("hunter2")},
+		"values_are_base64": false,
+	}
+	s := before.apply("secret", nil, config)
+
+	t.Run("replace", func(t *testing.T) {
+		p := newTestProvider(t, map[string]any{"path_prefix": "new"})
+		p.copySecret(before, "old/app/db")
+
+		s := p.refresh(s)
+		planned, diags := p.plan("secret", s, config)
+		requireNoErrors(t, diags)
+		if !p.requiresReplace(p.resourceSchema("secret").ValueType(), s.value, planned) {
+			t.Fatal("the path_prefix change does not replace the secret")
+		}
+		p.apply("secret", s, config)
+		if got := p.kvData("new/app/db"); got["password"] != "hunter2" {
+			t.Fatalf("data at the new prefix: %v", got)
+		}
+		if got := p.kvData("old/app/db"); got != nil {
+			t.Fatalf("data left at the old prefix: %v", got)
+		}
+	})
+
+	t.Run("rename", func(t *testing.T) {
+		p := newTestProvider(t, map[string]any{"path_prefix": "new"})
+		p.copySecret(before, "old/app/db")
+
+		config := maps.Clone(config)
+		config["allow_rename"] = true
+		s := p.refresh(s)
+		planned, diags := p.plan("secret", s, config)
+		requireNoErrors(t, diags)
+		if p.requiresReplace(p.resourceSchema("secret").ValueType(), s.value, planned) {
+			t.Fatal("the path_prefix change replaces the secret despite allow_rename")
+		}
+		s = p.apply("secret", s, config)
+		if got := p.kvData("new/app/db"); got["password"] != "hunter2" {
+			t.Fatalf("data at the new prefix: %v", got)
+		}
+		if got := p.kvData("old/app/db"); got != nil {
+			t.Fatalf("data left at the old prefix: %v", got)
+		}
+
+		// The state follows the secret to its new prefix.
+		if p.planChanges(p.refresh(s), config) {
+			t.Fatal("the renamed secret plans changes")
+		}
+	})
+}
+
+func TestSecretRenameFaults(t *testing.T) {
+	orphans := func(p *testProvider, declared string) []any {
+		t.Helper()
+		found, _ := p.readData("orphans", map[string]any{"declared_paths": []any{declared}})["orphans"].([]any)
+		return found
+	}
+	setup := func(t *testing.T) (*testProvider, *testState, map[string]any) {
+		p := newTestProvider(t, nil)
+		config := map[string]any{
+			"path":              "app/old",
+			"encrypted_secrets": map[string]any{"password": p.encrypt("hunter2")},
+			"values_are_base64": false,
+			"allow_rename":      true,
+		}
+		s := p.apply("secret", nil, config)
+		config = maps.Clone(config)
+		config["path"] = "app/new"
+		return p, s, config
+	}
+
+	t.Run("target write fails", func(t *testing.T) {
+		p, s, config := setup(t)
+		p.failVault(func(method, path string) bool { return method != "GET" && path == "secret/data/app/new" })
+
+		s, diags := p.tryApply("secret", s, config)
+		requireError(t, diags, "injected fault on secret/data/app/new")
+		if got := s.attrs()["path"]; got != "app/old" {
+			t.Fatalf("state path %q, expected it to stay at app/old", got)
+		}
+		if got := p.kvData("app/old"); got["password"] != "hunter2" {
+			t.Fatalf("data at the source: %v", got)
+		}
+		if _, err := p.vault().KVv2("secret").GetMetadata(context.Background(), "app/new"); err == nil || !strings.Contains(err.Error(), vault.ErrSecretNotFound.Error()) {
+			t.Fatalf("the failed rename left app/new behind: %v", err)
+		}
+		if found := orphans(p, "app/old"); len(found) != 0 {
+			t.Fatalf("orphans %v, expected none", found)
+		}
+
+		// The rename goes through once the fault is gone.
+		p.failVault(nil)
+		s = p.apply("secret", s, config)
+		if got := p.kvData("app/new"); got["password"] != "hunter2" {
+			t.Fatalf("data at the target: %v", got)
+		}
+		if got := p.kvData("app/old"); got != nil {
+			t.Fatalf("data left at the source: %v", got)
+		}
+		if p.planChanges(p.refresh(s), config) {
+			t.Fatal("the renamed secret plans changes")
+		}
+	})
+
+	t.Run("source delete fails", func(t *testing.T) {
+		p, s, config := setup(t)
+		p.failVault(func(method, path string) bool { return method == "DELETE" && path == "secret/metadata/app/old" })
+
+		s, diags := p.tryApply("secret", s, config)
+		requireError(t, diags, "secret/app/old was renamed to secret/app/new but it could not be deleted")
+		p.failVault(nil)
+		if got := s.attrs()["path"]; got != "app/new" {
+			t.Fatalf("state path %q, expected it to follow the secret to app/new", got)
+		}
+		if got := p.kvData("app/new"); got["password"] != "hunter2" {
+			t.Fatalf("data at the target: %v", got)
+		}
+		if got := p.kvData("app/old"); got["password"] != "hunter2" {
+			t.Fatalf("data at the source: %v, expected it left behind", got)
+		}
+		if found := orphans(p, "app/new"); !slices.Equal(found, []any{"app/old"}) {
+			t.Fatalf("orphans %v, expected the source", found)
+		}
+		if p.planChanges(p.refresh(s), config) {
+			t.Fatal("the renamed secret plans changes")
+		}
+	})
+}
+
+func TestSecretRefreshExistenceOnly(t *testing.T) {
+	before := newTestProvider(t, nil)
+	config := map[string]any{
+		"path":              "app/db",
+		"encrypted_secrets": map[string]any{"password": before.encrypt("hunter2")},
+		"values_are_base64": false,
+	}
+	s := before.apply("secret", nil, config)
+
+	p, diags := tryNewTestProvider(t, testProviderConfig(map[string]any{"refresh_mode": "existence_only"}))
+	requireNoErrors(t, diags)
+	requireWarning(t, diags, "changes made outside of Terraform are not detected")
+	p.copySecret(before, "app/db")
+
+	// The trade-off: a change made outside of Terraform goes unnoticed.
+	if _, err := p.vault().KVv2("secret").Patch(context.Background(), "app/db", map[string]any{"password": "changed"}); err != nil {
+		t.Fatal(err)
+	}
+	if p.planChanges(p.refresh(s), config) {
+		t.Fatal("existence_only detected the change of the value")
+	}
+
+	if err := p.vault().KVv2("secret").DeleteMetadata(context.Background(), "app/db"); err != nil {
+		t.Fatal(err)
+	}
+	if refreshed := p.refresh(s); refreshed != nil {
+		t.Fatalf("the deleted secret is still in the state: %v", refreshed.attrs())
+	}
+}
+
+func TestSecretWriteOnly(t *testing.T) {
+	p := newTestProvider(t, nil)
+
+	encrypt := func(plaintext string) string {
+		t.Helper()
+		opened, diags := p.openEphemeral("encrypted_value", map[string]any{"plaintext": plaintext})
+		requireNoErrors(t, diags)
+		return opened["ciphertext"].(string)
+	}
+	config := map[string]any{
+		"path":                         "app/db",
+		"encrypted_secrets":            map[string]any{"user": p.encrypt("admin")},
+		"encrypted_secrets_wo":         map[string]any{"password": encrypt("hunter2")},
+		"encrypted_secrets_wo_version": 1,
+		"values_are_base64":            false,
+	}
+	_, diags := p.tryApply("secret", nil, map[string]any{
+		"path":                 "app/db",
+		"encrypted_secrets":    map[string]any{"password": p.encrypt("hunter2")},
+		"encrypted_secrets_wo": map[string]any{"password": encrypt("hunter2")},
+	})
+	requireError(t, diags, `"password" is set in both encrypted_secrets_wo and encrypted_secrets`)
+
+	s := p.apply("secret", nil, config)
+	if got := p.kvData("app/db"); got["user"] != "admin" || got["password"] != "hunter2" {
+		t.Fatalf("written data: %v", got)
+	}
+	if got := s.attrs()["encrypted_secrets_wo"]; got != nil {
+		t.Fatalf("write-only values in the state: %v", got)
+	}
+
+	// Neither the new ciphertexts of every run nor the refresh plan changes.
+	config["encrypted_secrets_wo"] = map[string]any{"password": encrypt("hunter2")}
+	s = p.refresh(s)
+	if p.planChanges(s, config) {
+		t.Fatal("the refreshed secret plans changes")
+	}
+	if got := s.attrs()["external_keys"]; len(got.([]any)) != 0 {
+		t.Fatalf("write-only keys reported as external: %v", got)
+	}
+
+	// A change made outside of Terraform is drift.
+	if _, err := p.vault().Logical().Write("secret/data/app/db", map[string]any{"data": map[string]any{"user": "admin", "password": "tampered"}}); err != nil {
+		t.Fatal(err)
+	}
+	s = p.refresh(s)
+	if !p.planChanges(s, config) {
+		t.Fatal("the drifted secret plans no changes")
+	}
+	s = p.apply("secret", s, config)
+	if got := p.kvData("app/db"); got["password"] != "hunter2" {
+		t.Fatalf("reconciled data: %v", got)
+	}
+
+	// A version change writes the new values.
+	config["encrypted_secrets_wo"] = map[string]any{"password": encrypt("correct horse")}
+	config["encrypted_secrets_wo_version"] = 2
+	s = p.apply("secret", s, config)
+	if got := p.kvData("app/db"); got["password"] != "correct horse" {
+		t.Fatalf("updated data: %v", got)
+	}
+
+	// Without the write-only values, the key is removed.
+	delete(config, "encrypted_secrets_wo")
+	delete(config, "encrypted_secrets_wo_version")
+	p.apply("secret", s, config)
+	if got := p.kvData("app/db"); len(got) != 1 || got["user"] != "admin" {
+		t.Fatalf("data after removing the write-only values: %v", got)
+	}
+}
+
+func TestSecretAuditLog(t *testing.T) {
+	p := newTestProvider(t, map[string]any{"audit_log_path": "audit"})
+
+	config := map[string]any{
+		"path":              "app/db",
+		"encrypted_secrets": map[string]any{"password": p.encrypt("hunter2")},
+		"values_are_base64": false,
+	}
+	s := p.apply("secret", nil, config)
+	config["encrypted_secrets"] = map[string]any{"password": p.encrypt("correct horse")}
+	s = p.apply("secret", s, config)
+	p.destroy(s)
+
+	// Every operation is an entry of its own, written once.
+	var operations []string
+	for _, entry := range auditEntries(t, p.vault()) {
+		operations = append(operations, entry.Data["operation"].(string))
+		if entry.VersionMetadata.Version != 1 {
+			t.Errorf("audit entry at version %d", entry.VersionMetadata.Version)
+		}
+	}
+	if !slices.Equal(operations, []string{"create", "update", "delete"}) {
+		t.Fatalf("audited operations: %v", operations)
+	}
+
+	// A read-only provider records nothing.
+	kv := vaultKV{client: p.vault(), path: "secret", auditLogPath: "audit-read-only", readOnly: true}
+	var diags diag.Diagnostics
+	kv.audit(context.Background(), "share", "secret/app/db", nil, 1, &diags)
+	if diags.WarningsCount() != 1 {
+		t.Fatalf("diagnostics of a read-only audit: %v", diags)
+	}
+	if _, err := p.vault().KVv2("secret").GetMetadata(context.Background(), "audit-read-only"); err == nil {
+		t.Fatal("a read-only provider wrote an audit entry")
+	}
+}
+
+// auditEntries returns the entries of the audit log under audit/, in the order
+// they were written.
+func auditEntries(t *testing.T, client *vault.Client) []*vault.KVSecret {
+	t.Helper()
+	ctx := context.Background()
+
+	list := func(k string) []string {
+		t.Helper()
+		s, err := client.Logical().List("secret/metadata/" + k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var keys []string
+		for _, key := range s.Data["keys"].([]any) {
+			keys = append(keys, key.(string))
+		}
+		return keys
+	}
+
+	var paths []string
+	for _, day := range list("audit") {
+		for _, entry := range list("audit/" + day) {
+			paths = append(paths, "audit/"+day+entry)
+		}
+	}
+	slices.Sort(paths)
+
+	var entries []*vault.KVSecret
+	for _, k := range paths {
+		entry, err := client.KVv2("secret").Get(ctx, k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestSecretDestroyVersionsOlderThan(t *testing.T) {
+	p := newTestProvider(t, nil)
+
+	config := map[string]any{
+		"path":                        "app/db",
+		"encrypted_secrets":           map[string]any{"password": p.encrypt("v1")},
+		"values_are_base64":           false,
+		"destroy_versions_older_than": 2,
+	}
+	s := p.apply("secret", nil, config)
+	for _, password := range []string{"v2", "v3", "v4"} {
+		config["encrypted_secrets"] = map[string]any{"password": p.encrypt(password)}
+		s = p.apply("secret", s, config)
+	}
+
+	meta, err := p.vault().KVv2("secret").GetMetadata(context.Background(), "app/db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if meta.CurrentVersion != 4 {
+		t.Fatalf("current version %d, expected 4", meta.CurrentVersion)
+	}
+	for v, version := range meta.Versions {
+		if destroyed, want := version.Destroyed, v == "1" || v == "2"; destroyed != want {
+			t.Errorf("version %s destroyed: %t, expected %t", v, destroyed, want)
+		}
+	}
+	if got := p.kvData("app/db"); got["password"] != "v4" {
+		t.Fatalf("latest data: %v", got)
+	}
+
+	// The destroyed versions stay destroyed, nothing more is destroyed
+	// without a new version.
+	s = p.refresh(s)
+	if p.planChanges(s, config) {
+		t.Fatal("the refreshed secret plans changes")
+	}
+}
+
+func TestSecretValuesAreBase64(t *testing.T) {
+	const value = "a\nb==\n"
+	encoded := base64.StdEncoding.EncodeToString([]byte(value))
+
+	for _, tc := range []struct {
+		name     string
+		base64   any
+		written  string
+		tampered string
+	}{
+		{name: "default", base64: nil, written: encoded, tampered: base64.StdEncoding.EncodeToString([]byte("a\nb=\n"))},
+		{name: "true", base64: true, written: encoded, tampered: base64.StdEncoding.EncodeToString([]byte("a\nb=\n"))},
+		{name: "false", base64: false, written: value, tampered: "a\nb=="},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			p := newTestProvider(t, nil)
+			config := map[string]any{
+				"path":              "app/cert",
+				"encrypted_secrets": map[string]any{"pem": p.encrypt(value)},
+			}
+			if tc.base64 != nil {
+				config["values_are_base64"] = tc.base64
+			}
+
+			s := p.apply("secret", nil, config)
+			got, _ := p.kvData("app/cert")["pem"].(string)
+			if got != tc.written {
+				t.Fatalf("written value %q, expected %q", got, tc.written)
+			}
+			if tc.written == encoded {
+				if decoded, err := base64.StdEncoding.DecodeString(got); err != nil || string(decoded) != value {
+					t.Fatalf("written value decodes to %q (%v), expected %q", decoded, err, value)
+				}
+			}
+
+			// Read compares the live value the way it was written.
+			s = p.refresh(s)
+			if p.planChanges(s, config) {
+				t.Fatal("the refreshed secret plans changes")
+			}
+
+			// And tells a change of the padding or the newlines apart.
+			if _, err := p.vault().KVv2("secret").Put(context.Background(), "app/cert", map[string]any{"pem": tc.tampered}); err != nil {
+				t.Fatal(err)
+			}
+			s = p.refresh(s)
+			if !p.planChanges(s, config) {
+				t.Fatal("the change made outside of Terraform plans no change")
+			}
+			p.apply("secret", s, config)
+			if got := p.kvData("app/cert")["pem"]; got != tc.written {
+				t.Fatalf("value written back %q, expected %q", got, tc.written)
+			}
+		})
+	}
+}
+
+func TestSecretPathEscaping(t *testing.T) {
+	const k = "team a/süper+secret"
+	p := newTestProvider(t, nil)
+
+	config := map[string]any{
+		"path":              k,
+		"encrypted_secrets": map[string]any{"password": p.encrypt("hunter2")},
+	}
+	s := p.apply("secret", nil, config)
+	if got := p.kvData(k); got["password"] != base64.StdEncoding.EncodeToString([]byte("hunter2")) {
+		t.Fatalf("written data: %v", got)
+	}
+	listed, err := p.vault().Logical().List("secret/metadata/team a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys := listed.Data["keys"].([]any); len(keys) != 1 || keys[0] != "süper+secret" {
+		t.Fatalf("secrets under team a/: %v, expected the one written", keys)
+	}
+	if got, want := s.attrs()["ui_url"], "http://inmemory.invalid/ui/vault/secrets/secret/kv/team%20a%2Fs%C3%BCper+secret/details"; got != want {
+		t.Fatalf("ui_url %q, expected %q", got, want)
+	}
+
+	s = p.refresh(s)
+	if p.planChanges(s, config) {
+		t.Fatal("the refreshed secret plans changes")
+	}
+
+	imported, diags := p.importState("secret", k)
+	requireNoErrors(t, diags)
+	if imported.attrs()["path"] != k {
+		t.Fatalf("imported path %q, expected %q", imported.attrs()["path"], k)
+	}
+	imported = p.apply("secret", imported, config)
+	if p.planChanges(p.refresh(imported), config) {
+		t.Fatal("the imported secret plans changes")
+	}
+
+	for _, bad := range []string{"team a//secret", "team a/./secret", "team a/../secret"} {
+		config["path"] = bad
+		_, diags := p.tryApply("secret", nil, config)
+		requireError(t, diags, "has an empty, . or .. segment")
+	}
+}
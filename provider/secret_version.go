@@ -0,0 +1,158 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/datasource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/vault/api"
+)
+
+// Ensure provider defined types fully satisfy framework interfaces.
+var _ datasource.DataSource = &SecretVersionDataSource{}
+
+func NewSecretVersionDataSource() datasource.DataSource {
+	return &SecretVersionDataSource{}
+}
+
+// SecretVersionDataSource reads a version of a secret, its values are
+// encrypted with transit before entering the state.
+type SecretVersionDataSource struct {
+	ProviderData
+}
+
+// SecretVersionModel describes the data source data model.
+type SecretVersionModel struct {
+	Path             string            `tfsdk:"path"`
+	Version          int64             `tfsdk:"version"`
+	EncryptedSecrets map[string]string `tfsdk:"encrypted_secrets"`
+	CreatedTime      types.String      `tfsdk:"created_time"`
+	DeletionTime     types.String      `tfsdk:"deletion_time"`
+}
+
+func (d *SecretVersionDataSource) Metadata(ctx context.Context, req datasource.MetadataRequest, resp *datasource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_secret_version"
+}
+
+func (d *SecretVersionDataSource) Schema(ctx context.Context, req datasource.SchemaRequest, resp *datasource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		MarkdownDescription: "A version of a secret, e.g. to find out what it held at some point. Deleted, destroyed and unknown versions are errors.",
+		Attributes: map[string]schema.Attribute{
+			"path": schema.StringAttribute{
+				Required:    true,
+				Description: "Path of the secret, relative to `path_prefix`",
+			},
+			"version": schema.Int64Attribute{
+				Required:   true,
+				Validators: []validator.Int64{int64AtLeastValidator{min: 1}},
+			},
+			"encrypted_secrets": schema.MapAttribute{
+				Computed:    true,
+				ElementType: types.StringType,
+				Description: "Values of the version encrypted with the transit key, values that are not strings are JSON encoded first",
+			},
+			"created_time": schema.StringAttribute{
+				Computed:    true,
+				Description: "Time the version was written, in RFC 3339 format",
+			},
+			"deletion_time": schema.StringAttribute{
+				Computed:    true,
+				Description: "Time the version is scheduled to be deleted at by `delete_version_after`, in RFC 3339 format, empty when it is not",
+			},
+		},
+	}
+}
+
+func (d *SecretVersionDataSource) Configure(ctx context.Context, req datasource.ConfigureRequest, resp *datasource.ConfigureResponse) {
+	// Prevent panic if the provider has not been configured.
+	if req.ProviderData == nil {
+		return
+	}
+
+	providerData, ok := req.ProviderData.(ProviderData)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Data Source Configure Type",
+			fmt.Sprintf("Expected ProviderData, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+		)
+		return
+	}
+
+	d.ProviderData = providerData
+}
+
+func (d *SecretVersionDataSource) Read(ctx context.Context, req datasource.ReadRequest, resp *datasource.ReadResponse) {
+	var data SecretVersionModel
+	resp.Diagnostics.Append(req.Config.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	secretPath := d.kv.secretPath(data.Path)
+	d.kv.checkPathAllowed(secretPath, path.Root("path"), &resp.Diagnostics)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	secret, err := d.kv.client.KVv2(d.kv.path).GetVersion(ctx, secretPath, int(data.Version))
+	if errors.Is(err, api.ErrSecretNotFound) {
+		resp.Diagnostics.AddError(
+			"version not found",
+			fmt.Sprintf("version %d of %s never existed, or is older than the versions kept by max_versions", data.Version, d.kv.fullPath(secretPath)),
+		)
+		return
+	} else if err != nil {
+		resp.Diagnostics.AddError("failed to read secret version", errorDetail(err))
+		return
+	}
+
+	meta := secret.VersionMetadata
+	switch {
+	case meta.Destroyed:
+		resp.Diagnostics.AddError(
+			"version destroyed",
+			fmt.Sprintf("version %d of %s was destroyed, its data is gone for good", data.Version, d.kv.fullPath(secretPath)),
+		)
+		return
+	case !meta.DeletionTime.IsZero() && !meta.DeletionTime.After(time.Now()):
+		resp.Diagnostics.AddError(
+			"version deleted",
+			fmt.Sprintf("version %d of %s was deleted at %s, undelete it to read it", data.Version, d.kv.fullPath(secretPath), meta.DeletionTime.Format(time.RFC3339)),
+		)
+		return
+	}
+
+	data.EncryptedSecrets = make(map[string]string)
+	for k, v := range secret.Data {
+		plaintext, ok := v.(string)
+		if !ok {
+			b, err := json.Marshal(v)
+			if err != nil {
+				resp.Diagnostics.AddError("failed to encode value", fmt.Sprintf("%q: %s", k, err))
+				return
+			}
+			plaintext = string(b)
+		}
+
+		data.EncryptedSecrets[k], err = d.transit.Encrypt(ctx, plaintext)
+		if err != nil {
+			resp.Diagnostics.AddError("failed to encrypt value", errorDetail(err))
+			return
+		}
+	}
+
+	data.CreatedTime = types.StringValue(meta.CreatedTime.Format(time.RFC3339))
+	data.DeletionTime = types.StringValue("")
+	if !meta.DeletionTime.IsZero() {
+		data.DeletionTime = types.StringValue(meta.DeletionTime.Format(time.RFC3339))
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
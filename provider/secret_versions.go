@@ -0,0 +1,191 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/datasource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/vault/api"
+)
+
+// Ensure provider defined types fully satisfy framework interfaces.
+var _ datasource.DataSource = &SecretVersionsDataSource{}
+
+func NewSecretVersionsDataSource() datasource.DataSource {
+	return &SecretVersionsDataSource{}
+}
+
+// SecretVersionsDataSource lists the versions of a secret from its metadata,
+// the data of the versions is never read.
+type SecretVersionsDataSource struct {
+	ProviderData
+}
+
+// SecretVersionsModel describes the data source data model.
+type SecretVersionsModel struct {
+	Path           string                    `tfsdk:"path"`
+	Limit          types.Int64               `tfsdk:"limit"`
+	Offset         types.Int64               `tfsdk:"offset"`
+	CurrentVersion types.Int64               `tfsdk:"current_version"`
+	OldestVersion  types.Int64               `tfsdk:"oldest_version"`
+	CustomMetadata map[string]string         `tfsdk:"custom_metadata"`
+	Versions       []SecretVersionEntryModel `tfsdk:"versions"`
+}
+
+// SecretVersionEntryModel describes a version of the list.
+type SecretVersionEntryModel struct {
+	Version      int64  `tfsdk:"version"`
+	CreatedTime  string `tfsdk:"created_time"`
+	DeletionTime string `tfsdk:"deletion_time"`
+	Deleted      bool   `tfsdk:"deleted"`
+	Destroyed    bool   `tfsdk:"destroyed"`
+}
+
+func (d *SecretVersionsDataSource) Metadata(ctx context.Context, req datasource.MetadataRequest, resp *datasource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_secret_versions"
+}
+
+func (d *SecretVersionsDataSource) Schema(ctx context.Context, req datasource.SchemaRequest, resp *datasource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		MarkdownDescription: "The versions of a secret, newest first, with their timestamps and deletion state, e.g. to review its history. Only the metadata is read, never the data of a version. " +
+			"Vault does not version custom metadata: `custom_metadata`, and the `audit_metadata` in it, describe the run that wrote the latest version.",
+		Attributes: map[string]schema.Attribute{
+			"path": schema.StringAttribute{
+				Required:    true,
+				Description: "Path of the secret, relative to `path_prefix`",
+			},
+			"limit": schema.Int64Attribute{
+				Optional:    true,
+				Description: "Largest number of versions listed, all of them by default",
+				Validators:  []validator.Int64{int64AtLeastValidator{min: 1}},
+			},
+			"offset": schema.Int64Attribute{
+				Optional:    true,
+				Description: "Number of the newest versions skipped, defaults to 0",
+				Validators:  []validator.Int64{int64AtLeastValidator{min: 0}},
+			},
+			"current_version": schema.Int64Attribute{
+				Computed: true,
+			},
+			"oldest_version": schema.Int64Attribute{
+				Computed:    true,
+				Description: "Oldest version kept, older ones were removed by `max_versions`",
+			},
+			"custom_metadata": schema.MapAttribute{
+				Computed:    true,
+				ElementType: types.StringType,
+				Description: "Custom metadata of the secret, as of the latest write",
+			},
+			"versions": schema.ListNestedAttribute{
+				Computed:    true,
+				Description: "The versions, newest first, after `offset` and `limit`",
+				NestedObject: schema.NestedAttributeObject{
+					Attributes: map[string]schema.Attribute{
+						"version": schema.Int64Attribute{
+							Computed: true,
+						},
+						"created_time": schema.StringAttribute{
+							Computed:    true,
+							Description: "Time the version was written, in RFC 3339 format",
+						},
+						"deletion_time": schema.StringAttribute{
+							Computed:    true,
+							Description: "Time the version was deleted, or is scheduled to be by `delete_version_after`, in RFC 3339 format, empty when it is not",
+						},
+						"deleted": schema.BoolAttribute{
+							Computed:    true,
+							Description: "Whether the version is deleted, it can still be undeleted unless destroyed",
+						},
+						"destroyed": schema.BoolAttribute{
+							Computed:    true,
+							Description: "Whether the data of the version is destroyed for good",
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func (d *SecretVersionsDataSource) Configure(ctx context.Context, req datasource.ConfigureRequest, resp *datasource.ConfigureResponse) {
+	// Prevent panic if the provider has not been configured.
+	if req.ProviderData == nil {
+		return
+	}
+
+	providerData, ok := req.ProviderData.(ProviderData)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Data Source Configure Type",
+			fmt.Sprintf("Expected ProviderData, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+		)
+		return
+	}
+
+	d.ProviderData = providerData
+}
+
+func (d *SecretVersionsDataSource) Read(ctx context.Context, req datasource.ReadRequest, resp *datasource.ReadResponse) {
+	var data SecretVersionsModel
+	resp.Diagnostics.Append(req.Config.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	secretPath := d.kv.secretPath(data.Path)
+	d.kv.checkPathAllowed(secretPath, path.Root("path"), &resp.Diagnostics)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	meta, err := d.kv.client.KVv2(d.kv.path).GetMetadata(ctx, secretPath)
+	if errors.Is(err, api.ErrSecretNotFound) {
+		resp.Diagnostics.AddError("secret not found", fmt.Sprintf("%s does not exist", d.kv.fullPath(secretPath)))
+		return
+	} else if err != nil {
+		resp.Diagnostics.AddError("failed to read secret metadata", errorDetail(err))
+		return
+	}
+
+	versions := make([]api.KVVersionMetadata, 0, len(meta.Versions))
+	for _, v := range meta.Versions {
+		versions = append(versions, v)
+	}
+	slices.SortFunc(versions, func(a, b api.KVVersionMetadata) int { return b.Version - a.Version })
+
+	data.CurrentVersion = types.Int64Value(int64(meta.CurrentVersion))
+	data.OldestVersion = types.Int64Value(int64(meta.OldestVersion))
+	data.CustomMetadata = make(map[string]string, len(meta.CustomMetadata))
+	for k, v := range meta.CustomMetadata {
+		data.CustomMetadata[k] = fmt.Sprint(v)
+	}
+
+	offset := min(int(data.Offset.ValueInt64()), len(versions))
+	versions = versions[offset:]
+	if !data.Limit.IsNull() {
+		versions = versions[:min(int(data.Limit.ValueInt64()), len(versions))]
+	}
+
+	data.Versions = make([]SecretVersionEntryModel, 0, len(versions))
+	for _, v := range versions {
+		entry := SecretVersionEntryModel{
+			Version:     int64(v.Version),
+			CreatedTime: v.CreatedTime.Format(time.RFC3339),
+			Deleted:     !v.DeletionTime.IsZero() && !v.DeletionTime.After(time.Now()),
+			Destroyed:   v.Destroyed,
+		}
+		if !v.DeletionTime.IsZero() {
+			entry.DeletionTime = v.DeletionTime.Format(time.RFC3339)
+		}
+		data.Versions = append(data.Versions, entry)
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
@@ -0,0 +1,215 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/function"
+)
+
+// signatureKey is the custom metadata key holding the signature of the
+// content of a secret.
+const signatureKey = "vsac_signature"
+
+// canonicalContent returns the content of a secret in the form it is signed:
+// JSON with sorted keys, so the same data always signs the same.
+func canonicalContent(data map[string]any) (string, error) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode the secret to sign it: %w", err)
+	}
+	return string(b), nil
+}
+
+// signedMetadata returns the custom metadata of m, along with the signature
+// of content when a signing key is configured.
+func (r *SecretResource) signedMetadata(ctx context.Context, m SecretModel, content map[string]any) (map[string]any, error) {
+	metadata := m.customMetadata()
+	if r.transit.signingKey == "" {
+		return metadata, nil
+	}
+
+	input, err := canonicalContent(content)
+	if err != nil {
+		return nil, err
+	}
+	metadata[signatureKey], err = r.transit.Sign(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign the secret: %w", err)
+	}
+	return metadata, nil
+}
+
+// verifySignature checks the live content of the secret at k against the
+// signature in its custom metadata. Secrets without one, e.g. written before
+// signing_key was set, are reported as unverified.
+func (r *SecretResource) verifySignature(ctx context.Context, k string, content map[string]any, customMetadata map[string]any, diags *diag.Diagnostics) error {
+	signature, _ := customMetadata[signatureKey].(string)
+	if signature == "" {
+		diags.AddWarning(
+			"unverified secret",
+			fmt.Sprintf("%s carries no signature, its content cannot be verified until Terraform writes it again", r.kv.fullPath(k)),
+		)
+		return nil
+	}
+
+	input, err := canonicalContent(content)
+	if err != nil {
+		return err
+	}
+	valid, err := r.transit.Verify(ctx, input, signature)
+	if err != nil {
+		return err
+	}
+	if !valid {
+		diags.AddError(
+			"secret signature verification failed",
+			fmt.Sprintf("the content of %s does not match its signature, it was modified outside of Terraform. Inspect its versions before applying again", r.kv.fullPath(k)),
+		)
+	}
+	return nil
+}
+
+// functionSigningOptions returns the options of the sign and verify functions
+// for the key names of their variadic argument, and the transit mount to call.
+// The algorithms are the defaults of Vault for the type of the key.
+func (p *Provider) functionSigningOptions(keys []string, position int64) (*vaultTransit, signingOptions, *function.FuncError) {
+	var opts signingOptions
+	if len(keys) > 1 {
+		return nil, opts, function.NewArgumentFuncError(position+1, "at most one key can be given")
+	}
+	if len(keys) == 1 {
+		if keys[0] == "" {
+			return nil, opts, function.NewArgumentFuncError(position, "the key cannot be empty")
+		}
+		opts.key = keys[0]
+	}
+
+	transit, err := p.functionTransit()
+	if err != nil {
+		return nil, opts, function.NewFuncError(errorDetail(err))
+	}
+	if opts.key == "" && transit.signingKey == "" {
+		return nil, opts, function.NewFuncError(fmt.Sprintf("no signing key: set signing_key, or %s, or give the key", signingKeyEnv))
+	}
+	return transit, opts, nil
+}
+
+// Ensure provider defined types fully satisfy framework interfaces.
+var (
+	_ function.Function = &SignFunction{}
+	_ function.Function = &VerifyFunction{}
+)
+
+// SignFunction signs an input with a transit key, e.g. a published
+// configuration.
+type SignFunction struct {
+	provider *Provider
+}
+
+func (f *SignFunction) Metadata(ctx context.Context, req function.MetadataRequest, resp *function.MetadataResponse) {
+	resp.Name = "sign"
+}
+
+func (f *SignFunction) Definition(ctx context.Context, req function.DefinitionRequest, resp *function.DefinitionResponse) {
+	resp.Definition = function.Definition{
+		Summary:             "Transit signature of an input",
+		MarkdownDescription: fmt.Sprintf("Signature of an input computed by Vault with a transit key, e.g. `vault:v1:...`, with the defaults of Vault for the type of the key. Terraform may call functions before configuring the provider: the transit mount is then the one of `%s`, the signing key the one of `%s`, with the Vault address and token of `VAULT_ADDR` and `VAULT_TOKEN`.", transitPathEnv, signingKeyEnv),
+		Parameters: []function.Parameter{
+			function.StringParameter{
+				Name:                "input",
+				MarkdownDescription: "Input to sign",
+			},
+		},
+		VariadicParameter: function.StringParameter{
+			Name:                "key",
+			MarkdownDescription: "Name of the transit key, defaults to `signing_key`",
+		},
+		Return: function.StringReturn{},
+	}
+}
+
+func (f *SignFunction) Run(ctx context.Context, req function.RunRequest, resp *function.RunResponse) {
+	var input string
+	var keys []string
+	resp.Error = function.ConcatFuncErrors(req.Arguments.Get(ctx, &input, &keys))
+	if resp.Error != nil {
+		return
+	}
+
+	transit, opts, funcErr := f.provider.functionSigningOptions(keys, 1)
+	if funcErr != nil {
+		resp.Error = funcErr
+		return
+	}
+
+	signature, err := transit.SignWithOptions(ctx, input, opts)
+	if err != nil {
+		resp.Error = function.NewFuncError("failed to sign: " + errorDetail(err))
+		return
+	}
+	resp.Error = function.ConcatFuncErrors(resp.Result.Set(ctx, signature))
+}
+
+// VerifyFunction checks the transit signature of an input. A signature that
+// does not match is false, not an error, to fit in conditions.
+type VerifyFunction struct {
+	provider *Provider
+}
+
+func (f *VerifyFunction) Metadata(ctx context.Context, req function.MetadataRequest, resp *function.MetadataResponse) {
+	resp.Name = "verify"
+}
+
+func (f *VerifyFunction) Definition(ctx context.Context, req function.DefinitionRequest, resp *function.DefinitionResponse) {
+	resp.Definition = function.Definition{
+		Summary:             "Check the transit signature of an input",
+		MarkdownDescription: fmt.Sprintf("Whether a signature, from `sign`, is a signature of an input by a transit key, whatever the version of the key. A signature that does not match is false rather than an error, e.g. for `precondition` blocks. Terraform may call functions before configuring the provider: the transit mount is then the one of `%s`, the signing key the one of `%s`, with the Vault address and token of `VAULT_ADDR` and `VAULT_TOKEN`.", transitPathEnv, signingKeyEnv),
+		Parameters: []function.Parameter{
+			function.StringParameter{
+				Name:                "input",
+				MarkdownDescription: "Input the signature is checked against",
+			},
+			function.StringParameter{
+				Name:                "signature",
+				MarkdownDescription: "Signature of the input, e.g. `vault:v1:...`",
+			},
+		},
+		VariadicParameter: function.StringParameter{
+			Name:                "key",
+			MarkdownDescription: "Name of the transit key, defaults to `signing_key`",
+		},
+		Return: function.BoolReturn{},
+	}
+}
+
+func (f *VerifyFunction) Run(ctx context.Context, req function.RunRequest, resp *function.RunResponse) {
+	var input, signature string
+	var keys []string
+	resp.Error = function.ConcatFuncErrors(req.Arguments.Get(ctx, &input, &signature, &keys))
+	if resp.Error != nil {
+		return
+	}
+
+	transit, opts, funcErr := f.provider.functionSigningOptions(keys, 2)
+	if funcErr != nil {
+		resp.Error = funcErr
+		return
+	}
+
+	// Vault rejects what is not a transit signature at all, it cannot match.
+	if !strings.HasPrefix(signature, "vault:v") {
+		resp.Error = function.ConcatFuncErrors(resp.Result.Set(ctx, false))
+		return
+	}
+
+	valid, err := transit.VerifyWithOptions(ctx, input, signature, opts)
+	if err != nil {
+		resp.Error = function.NewFuncError("failed to verify the signature: " + errorDetail(err))
+		return
+	}
+	resp.Error = function.ConcatFuncErrors(resp.Result.Set(ctx, valid))
+}
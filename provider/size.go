@@ -0,0 +1,122 @@
+package provider
+
+import (
+	"cmp"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-framework/attr"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/tfsdk"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+// defaultMaxSecretBytes is the 1 MiB Vault limit on the size of a request
+// and of a storage entry, minus room for the rest of the request.
+const defaultMaxSecretBytes = 1<<20 - 1<<10
+
+// transitOverhead is the nonce and tag transit adds to every plaintext with
+// its default aes256-gcm96 keys.
+const transitOverhead = 28
+
+// checkSecretSize returns an error when value, once serialized, is larger
+// than max_secret_bytes. Vault would refuse it with a bare 413.
+func (v vaultKV) checkSecretSize(k string, value map[string]any) error {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	if len(b) <= v.maxSecretBytes {
+		return nil
+	}
+
+	sizes := make(map[string]int, len(value))
+	for key, val := range value {
+		b, err := json.Marshal(map[string]any{key: val})
+		if err != nil {
+			return err
+		}
+		sizes[key] = len(b) - 2
+	}
+	return fmt.Errorf("%s is %d bytes once serialized, more than max_secret_bytes = %d. Bytes by key: %s", v.fullPath(k), len(b), v.maxSecretBytes, formatKeySizes(sizes))
+}
+
+// formatKeySizes lists the keys of sizes from the largest, without values.
+func formatKeySizes(sizes map[string]int) string {
+	keys := slices.SortedFunc(maps.Keys(sizes), func(a, b string) int {
+		return cmp.Or(cmp.Compare(sizes[b], sizes[a]), strings.Compare(a, b))
+	})
+
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%s: %d", k, sizes[k]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// checkPlannedSize fails the plan when the planned secret is surely larger
+// than max_secret_bytes. Nothing is decrypted: the size of every value is
+// estimated from its ciphertext, as a lower bound, and the exact size is
+// checked again before writing.
+func (r *SecretResource) checkPlannedSize(ctx context.Context, plan tfsdk.Plan, diags *diag.Diagnostics) {
+	sizes := make(map[string]int)
+	total := 2
+	add := func(k string, n int) {
+		// A quoted key, a colon and a comma.
+		sizes[k] = len(k) + 3 + n
+		total += len(k) + 4 + n
+	}
+
+	for _, name := range []string{"encrypted_secrets", "encrypted_values", "encrypted_secret_objects", "non_sensitive_data"} {
+		var m types.Map
+		diags.Append(plan.GetAttribute(ctx, path.Root(name), &m)...)
+		if diags.HasError() {
+			return
+		}
+
+		for k, e := range m.Elements() {
+			var value attr.Value = e
+			if o, ok := e.(types.Object); ok {
+				value = o.Attributes()["ciphertext"]
+			}
+			s, ok := value.(types.String)
+			if !ok || s.IsUnknown() || s.IsNull() {
+				continue
+			}
+
+			if name == "non_sensitive_data" {
+				b, _ := json.Marshal(s.ValueString())
+				add(k, len(b))
+			} else {
+				add(k, ciphertextSize(s.ValueString()))
+			}
+		}
+	}
+
+	if total > r.kv.maxSecretBytes {
+		diags.AddError(
+			"secret too large",
+			fmt.Sprintf("the secret is at least %d bytes once serialized, more than max_secret_bytes = %d. Bytes by key, at least: %s", total, r.kv.maxSecretBytes, formatKeySizes(sizes)),
+		)
+	}
+}
+
+// ciphertextSize returns a lower bound of the size of the value encrypted in
+// ciphertext, as written to Vault.
+func ciphertextSize(ciphertext string) int {
+	_, ciphertext = splitRoutePrefix(ciphertext)
+	parts := strings.SplitN(ciphertext, ":", 3)
+	if len(parts) != 3 {
+		return 0
+	}
+
+	// The plaintext is base64, written either as is or decoded.
+	n := base64.StdEncoding.DecodedLen(len(parts[2])) - transitOverhead
+	return max(n, 0) * 3 / 4
+}
@@ -0,0 +1,410 @@
+package provider
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/datasource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"gopkg.in/yaml.v3"
+)
+
+// Ensure provider defined types fully satisfy framework interfaces.
+var _ datasource.DataSource = &SopsFileDataSource{}
+
+func NewSopsFileDataSource() datasource.DataSource {
+	return &SopsFileDataSource{}
+}
+
+// SopsFileDataSource decrypts a SOPS file whose data key is wrapped with
+// transit, and encrypts its values with transit again one by one. Only
+// ciphertexts enter the state.
+type SopsFileDataSource struct {
+	ProviderData
+}
+
+// SopsFileModel describes the data source data model.
+type SopsFileModel struct {
+	Path                   string                              `tfsdk:"path"`
+	Separator              types.String                        `tfsdk:"separator"`
+	Convergent             types.Bool                          `tfsdk:"convergent"`
+	EncryptedSecrets       map[string]string                   `tfsdk:"encrypted_secrets"`
+	EncryptedSecretObjects map[string]SopsEncryptedSecretModel `tfsdk:"encrypted_secret_objects"`
+}
+
+// SopsEncryptedSecretModel is a value of the file encrypted with its key
+// derivation context, in the form encrypted_secret_objects takes.
+type SopsEncryptedSecretModel struct {
+	Ciphertext string `tfsdk:"ciphertext"`
+	Context    string `tfsdk:"context"`
+}
+
+// defaultSopsSeparator joins the keys of nested values.
+const defaultSopsSeparator = "."
+
+func (d *SopsFileDataSource) Metadata(ctx context.Context, req datasource.MetadataRequest, resp *datasource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_sops_file"
+}
+
+func (d *SopsFileDataSource) Schema(ctx context.Context, req datasource.SchemaRequest, resp *datasource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		MarkdownDescription: "Values of a YAML or JSON file encrypted with SOPS, whose data key is wrapped with the transit key of the provider (`sops --hc-vault-transit`), encrypted with the transit key one by one to feed `encrypted_secrets`. " +
+			"The file is decrypted in memory and its MAC verified. Nested values are flattened, list items by index, and values that are not strings are written in their YAML form. " +
+			"The ciphertexts are of plain values, set `values_are_base64 = false` on the resources using them. " +
+			"Transit encrypts a value differently every time, and a data source keeps no state to reuse the ciphertexts of the previous run: the resources using `encrypted_secrets` plan an update on every run, which writes nothing since the values are unchanged. " +
+			"With a transit key created with `derived` and `convergent_encryption`, set `convergent` and feed `encrypted_secret_objects` instead, whose ciphertexts only change with the values.",
+		Attributes: map[string]schema.Attribute{
+			"path": schema.StringAttribute{
+				Required:    true,
+				Description: "Path of the SOPS file, relative to the working directory",
+				Validators:  []validator.String{notEmptyValidator{}},
+			},
+			"separator": schema.StringAttribute{
+				Optional:    true,
+				Description: fmt.Sprintf("Separator of the keys of nested values, defaults to %q: `db: {password: ...}` is `db%spassword`", defaultSopsSeparator, defaultSopsSeparator),
+				Validators:  []validator.String{notEmptyValidator{}},
+			},
+			"convergent": schema.BoolAttribute{
+				Optional:    true,
+				Description: "Encrypt every value with its flattened key as key derivation context, into `encrypted_secret_objects` rather than `encrypted_secrets`. The transit key must have `derived` and `convergent_encryption` enabled, identical values under identical keys then yield identical ciphertexts",
+			},
+			"encrypted_secrets": schema.MapAttribute{
+				Computed:    true,
+				ElementType: types.StringType,
+				Description: "Values of the file by flattened key, encrypted with the transit key. Null with `convergent`",
+			},
+			"encrypted_secret_objects": schema.MapNestedAttribute{
+				Computed:    true,
+				Description: "Values of the file by flattened key, encrypted with the transit key and their key derivation context, for `encrypted_secret_objects`. Only set with `convergent`",
+				NestedObject: schema.NestedAttributeObject{
+					Attributes: map[string]schema.Attribute{
+						"ciphertext": schema.StringAttribute{
+							Computed:    true,
+							Description: "Ciphertext of the value",
+						},
+						"context": schema.StringAttribute{
+							Computed:    true,
+							Description: "Key derivation context of the ciphertext, the flattened key",
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func (d *SopsFileDataSource) Configure(ctx context.Context, req datasource.ConfigureRequest, resp *datasource.ConfigureResponse) {
+	// Prevent panic if the provider has not been configured.
+	if req.ProviderData == nil {
+		return
+	}
+
+	providerData, ok := req.ProviderData.(ProviderData)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Data Source Configure Type",
+			fmt.Sprintf("Expected ProviderData, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+		)
+		return
+	}
+
+	d.ProviderData = providerData
+}
+
+func (d *SopsFileDataSource) Read(ctx context.Context, req datasource.ReadRequest, resp *datasource.ReadResponse) {
+	var data SopsFileModel
+	resp.Diagnostics.Append(req.Config.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	separator := defaultSopsSeparator
+	if !data.Separator.IsNull() {
+		separator = data.Separator.ValueString()
+	}
+
+	values, err := d.decryptSopsFile(ctx, data.Path, separator)
+	if err != nil {
+		resp.Diagnostics.AddError("failed to decrypt SOPS file", fmt.Sprintf("%s: %s", data.Path, errorDetail(err)))
+		return
+	}
+
+	if data.Convergent.ValueBool() {
+		data.EncryptedSecretObjects = make(map[string]SopsEncryptedSecretModel, len(values))
+	} else {
+		data.EncryptedSecrets = make(map[string]string, len(values))
+	}
+	for k, v := range values {
+		if data.Convergent.ValueBool() {
+			var object SopsEncryptedSecretModel
+			object.Ciphertext, err = d.transit.EncryptDerived(ctx, v.reveal(), k)
+			object.Context = k
+			data.EncryptedSecretObjects[k] = object
+		} else {
+			data.EncryptedSecrets[k], err = d.transit.Encrypt(ctx, v.reveal())
+		}
+		if err != nil {
+			resp.Diagnostics.AddError("failed to encrypt value", fmt.Sprintf("%q of %s: %s", k, data.Path, errorDetail(err)))
+			return
+		}
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+// sopsMetadata is the part of the sops metadata of a file needed to decrypt
+// it.
+type sopsMetadata struct {
+	LastModified     string           `yaml:"lastmodified"`
+	MAC              string           `yaml:"mac"`
+	MACOnlyEncrypted bool             `yaml:"mac_only_encrypted"`
+	HCVault          []sopsVaultKey   `yaml:"hc_vault"`
+	KeyGroups        []map[string]any `yaml:"key_groups"`
+}
+
+// sopsVaultKey is the data key of a file wrapped with a transit key.
+type sopsVaultKey struct {
+	EnginePath string `yaml:"engine_path"`
+	KeyName    string `yaml:"key_name"`
+	Enc        string `yaml:"enc"`
+}
+
+// sopsValue is a value encrypted by SOPS.
+var sopsValue = regexp.MustCompile(`^ENC\[AES256_GCM,data:(.+),iv:(.+),tag:(.+),type:(.+)\]$`)
+
+// decryptSopsFile returns the values of the SOPS file at name, flattened with
+// separator. Errors name the keys, never the values.
+func (d *SopsFileDataSource) decryptSopsFile(ctx context.Context, name, separator string) (map[string]sensitive, error) {
+	b, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return nil, fmt.Errorf("not a YAML or JSON SOPS file: %w", err)
+	}
+	if len(doc.Content) != 1 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, errors.New("not a YAML or JSON SOPS file: the document is not a mapping")
+	}
+	root := doc.Content[0]
+
+	var meta sopsMetadata
+	var found bool
+	for i := 0; i < len(root.Content); i += 2 {
+		if root.Content[i].Value == "sops" {
+			if err := root.Content[i+1].Decode(&meta); err != nil {
+				return nil, fmt.Errorf("invalid sops metadata: %w", err)
+			}
+			found = true
+		}
+	}
+	if !found {
+		return nil, errors.New("the file has no sops metadata, it is not encrypted with SOPS")
+	}
+
+	dataKey, err := d.transit.unwrapSopsDataKey(ctx, meta)
+	if err != nil {
+		return nil, err
+	}
+
+	// The MAC covers every value in the order of the file, the decrypted
+	// ones by their plaintext.
+	values := make(map[string]sensitive)
+	hash := sha512.New()
+	var walk func(node *yaml.Node, aad []string, key string) error
+	walk = func(node *yaml.Node, aad []string, key string) error {
+		switch node.Kind {
+		case yaml.MappingNode:
+			for i := 0; i < len(node.Content); i += 2 {
+				k := node.Content[i].Value
+				if len(aad) == 0 && k == "sops" {
+					continue
+				}
+				flat := k
+				if key != "" {
+					flat = key + separator + k
+				}
+				if err := walk(node.Content[i+1], append(slices.Clone(aad), k), flat); err != nil {
+					return err
+				}
+			}
+		case yaml.SequenceNode:
+			for i, item := range node.Content {
+				if err := walk(item, aad, key+separator+strconv.Itoa(i)); err != nil {
+					return err
+				}
+			}
+		case yaml.AliasNode:
+			return walk(node.Alias, aad, key)
+		case yaml.ScalarNode:
+			value, encrypted, err := decryptSopsValue(node, dataKey, strings.Join(aad, ":")+":")
+			if err != nil {
+				return fmt.Errorf("failed to decrypt %q: %w", key, err)
+			}
+			if encrypted || !meta.MACOnlyEncrypted {
+				hash.Write([]byte(value.macForm))
+			}
+			if _, ok := values[key]; ok {
+				return fmt.Errorf("%q is set twice once flattened, use another separator", key)
+			}
+			values[key] = sensitive(value.value)
+		}
+		return nil
+	}
+	if err := walk(root, nil, ""); err != nil {
+		return nil, err
+	}
+
+	mac, err := decryptSopsString(meta.MAC, dataKey, meta.LastModified)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt the MAC of the file: %w", err)
+	}
+	if mac != fmt.Sprintf("%X", hash.Sum(nil)) {
+		return nil, errors.New("the MAC of the file does not match its values, it was modified without SOPS")
+	}
+
+	return values, nil
+}
+
+// unwrapSopsDataKey decrypts the data key of a SOPS file with the transit key
+// it was wrapped with, which must be the transit key of the provider, one of
+// its fallback keys or the key of a transit route.
+func (v vaultTransit) unwrapSopsDataKey(ctx context.Context, meta sopsMetadata) ([]byte, error) {
+	if len(meta.KeyGroups) > 0 {
+		return nil, errors.New("files with key_groups are not supported, the data key must be wrapped with transit as a whole")
+	}
+
+	var wrappedWith []string
+	for _, k := range meta.HCVault {
+		wrappedWith = append(wrappedWith, fmt.Sprintf("key %q of %s", k.KeyName, k.EnginePath))
+
+		ciphertext := ""
+		if mount := strings.Trim(k.EnginePath, "/"); mount == strings.Trim(v.path, "/") && (k.KeyName == v.key || slices.Contains(v.fallbackKeys, k.KeyName)) {
+			ciphertext = k.Enc
+		} else {
+			for _, r := range v.routes {
+				if strings.Trim(r.path, "/") == mount && r.key == k.KeyName {
+					ciphertext = r.prefix + ":" + k.Enc
+				}
+			}
+		}
+		if ciphertext == "" {
+			continue
+		}
+
+		plaintext, err := v.Decrypt(ctx, ciphertext)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unwrap the data key: %w", err)
+		}
+		dataKey, err := base64.StdEncoding.DecodeString(plaintext.reveal())
+		if err != nil {
+			return nil, errors.New("the unwrapped data key is not base64")
+		}
+		return dataKey, nil
+	}
+
+	if len(wrappedWith) == 0 {
+		return nil, errors.New("the data key is not wrapped with transit, encrypt the file with sops --hc-vault-transit")
+	}
+	return nil, fmt.Errorf("the data key is wrapped with %s, none of them is the transit key of the provider or of a transit route", strings.Join(wrappedWith, ", "))
+}
+
+// sopsPlaintext is a value of a SOPS file, in the form written to Vault and
+// the form the MAC covers.
+type sopsPlaintext struct {
+	value   string
+	macForm string
+}
+
+// decryptSopsValue returns the value of node, decrypted with dataKey and aad
+// when it is encrypted.
+func decryptSopsValue(node *yaml.Node, dataKey []byte, aad string) (sopsPlaintext, bool, error) {
+	m := sopsValue.FindStringSubmatch(node.Value)
+	if m == nil {
+		return unencryptedSopsValue(node), false, nil
+	}
+
+	plaintext, err := decryptSopsString(node.Value, dataKey, aad)
+	if err != nil {
+		return sopsPlaintext{}, true, err
+	}
+	value := plaintext
+	switch m[4] {
+	case "bool":
+		// SOPS encrypts booleans the way Python writes them.
+		value = strings.ToLower(plaintext)
+	case "str", "int", "float", "bytes":
+	default:
+		return sopsPlaintext{}, true, fmt.Errorf("unsupported SOPS value type %q", m[4])
+	}
+	return sopsPlaintext{value: value, macForm: plaintext}, true, nil
+}
+
+// unencryptedSopsValue returns the value of node, a scalar SOPS left in
+// plaintext, e.g. a key with the unencrypted suffix.
+func unencryptedSopsValue(node *yaml.Node) sopsPlaintext {
+	var v any
+	if err := node.Decode(&v); err != nil {
+		return sopsPlaintext{value: node.Value, macForm: node.Value}
+	}
+	switch v := v.(type) {
+	case nil:
+		return sopsPlaintext{}
+	case bool:
+		macForm := "False"
+		if v {
+			macForm = "True"
+		}
+		return sopsPlaintext{value: strconv.FormatBool(v), macForm: macForm}
+	case int:
+		return sopsPlaintext{value: node.Value, macForm: strconv.Itoa(v)}
+	case float64:
+		return sopsPlaintext{value: node.Value, macForm: strconv.FormatFloat(v, 'f', -1, 64)}
+	}
+	return sopsPlaintext{value: node.Value, macForm: node.Value}
+}
+
+// decryptSopsString decrypts s, an ENC[AES256_GCM,...] value, with dataKey and
+// aad.
+func decryptSopsString(s string, dataKey []byte, aad string) (string, error) {
+	m := sopsValue.FindStringSubmatch(s)
+	if m == nil {
+		return "", errors.New("not a SOPS encrypted value")
+	}
+	var parts [3][]byte
+	for i := range parts {
+		b, err := base64.StdEncoding.DecodeString(m[i+1])
+		if err != nil {
+			return "", errors.New("the encrypted value is not valid base64")
+		}
+		parts[i] = b
+	}
+	data, iv, tag := parts[0], parts[1], parts[2]
+
+	block, err := aes.NewCipher(dataKey)
+	if err != nil {
+		return "", fmt.Errorf("invalid data key: %w", err)
+	}
+	gcm, err := cipher.NewGCMWithNonceSize(block, len(iv))
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := gcm.Open(nil, iv, append(data, tag...), []byte(aad))
+	if err != nil {
+		return "", errors.New("the value does not decrypt with the data key of the file, it was modified or moved without SOPS")
+	}
+	return string(plaintext), nil
+}
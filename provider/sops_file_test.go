@@ -0,0 +1,104 @@
+package provider
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeSopsFile writes a SOPS file of the top-level string values, in the
+// order given as key, value pairs, whose data key is wrapped with the transit
+// key of the tests, and returns its path.
+func writeSopsFile(t *testing.T, p *testProvider, pairs ...string) string {
+	t.Helper()
+
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		t.Fatal(err)
+	}
+	wrapped, err := p.vault().Logical().Write("transit/encrypt/vsac", map[string]any{
+		"plaintext": base64.StdEncoding.EncodeToString(dataKey),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encrypt := func(value, aad string) string {
+		t.Helper()
+		block, err := aes.NewCipher(dataKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gcm, err := cipher.NewGCMWithNonceSize(block, 32)
+		if err != nil {
+			t.Fatal(err)
+		}
+		iv := make([]byte, 32)
+		if _, err := rand.Read(iv); err != nil {
+			t.Fatal(err)
+		}
+		sealed := gcm.Seal(nil, iv, []byte(value), []byte(aad))
+		data, tag := sealed[:len(sealed)-gcm.Overhead()], sealed[len(sealed)-gcm.Overhead():]
+		return fmt.Sprintf("ENC[AES256_GCM,data:%s,iv:%s,tag:%s,type:str]",
+			base64.StdEncoding.EncodeToString(data), base64.StdEncoding.EncodeToString(iv), base64.StdEncoding.EncodeToString(tag))
+	}
+
+	var b strings.Builder
+	hash := sha512.New()
+	for i := 0; i < len(pairs); i += 2 {
+		fmt.Fprintf(&b, "%s: %s\n", pairs[i], encrypt(pairs[i+1], pairs[i]+":"))
+		hash.Write([]byte(pairs[i+1]))
+	}
+	lastModified := "2026-10-15T10:00:00Z"
+	fmt.Fprintf(&b, "sops:\n  hc_vault:\n    - engine_path: transit\n      key_name: vsac\n      enc: %s\n", wrapped.Data["ciphertext"])
+	fmt.Fprintf(&b, "  lastmodified: %q\n  mac: %s\n", lastModified, encrypt(fmt.Sprintf("%X", hash.Sum(nil)), lastModified))
+
+	name := filepath.Join(t.TempDir(), "secrets.enc.yaml")
+	if err := os.WriteFile(name, []byte(b.String()), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+func TestSopsFile(t *testing.T) {
+	p := newTestProvider(t, nil)
+	name := writeSopsFile(t, p, "user", "admin", "password", "hunter2")
+
+	data := p.readData("sops_file", map[string]any{"path": name})
+	if data["encrypted_secret_objects"] != nil {
+		t.Fatalf("encrypted_secret_objects without convergent: %v", data["encrypted_secret_objects"])
+	}
+	p.apply("secret", nil, map[string]any{
+		"path":              "app/plain",
+		"encrypted_secrets": data["encrypted_secrets"],
+		"values_are_base64": false,
+	})
+	if got := p.kvData("app/plain"); got["user"] != "admin" || got["password"] != "hunter2" {
+		t.Fatalf("data written from encrypted_secrets: %v", got)
+	}
+
+	// Convergent ciphertexts carry their flattened key as context.
+	data = p.readData("sops_file", map[string]any{"path": name, "convergent": true})
+	if data["encrypted_secrets"] != nil {
+		t.Fatalf("encrypted_secrets with convergent: %v", data["encrypted_secrets"])
+	}
+	objects := data["encrypted_secret_objects"].(map[string]any)
+	if got := objects["password"].(map[string]any)["context"]; got != "password" {
+		t.Fatalf("context of password: %v", got)
+	}
+	p.apply("secret", nil, map[string]any{
+		"path":                     "app/convergent",
+		"encrypted_secret_objects": objects,
+		"values_are_base64":        false,
+	})
+	if got := p.kvData("app/convergent"); got["user"] != "admin" || got["password"] != "hunter2" {
+		t.Fatalf("data written from encrypted_secret_objects: %v", got)
+	}
+}
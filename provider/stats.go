@@ -0,0 +1,250 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/hashicorp/terraform-plugin-framework/datasource"
+	"github.com/hashicorp/terraform-plugin-framework/datasource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/provider"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	"github.com/hashicorp/terraform-plugin-log/tfsdklog"
+)
+
+// operationStats counts the Vault calls of a provider run. Resources run in
+// parallel, every counter is atomic.
+type operationStats struct {
+	// kvMount and transitMounts tell the calls apart, they are set before
+	// any call.
+	kvMount       string
+	transitMounts []string
+
+	requests        atomic.Int64
+	kvGets          atomic.Int64
+	kvPuts          atomic.Int64
+	kvMetadata      atomic.Int64
+	transitEncrypts atomic.Int64
+	transitDecrypts atomic.Int64
+	transitRewraps  atomic.Int64
+	retries         atomic.Int64
+	cacheHits       atomic.Int64
+}
+
+func newOperationStats(kvPath string, transitPaths []string) *operationStats {
+	s := &operationStats{kvMount: strings.Trim(kvPath, "/") + "/"}
+	for _, p := range transitPaths {
+		s.transitMounts = append(s.transitMounts, strings.Trim(p, "/")+"/")
+	}
+	return s
+}
+
+// record counts req, a call about to be sent to Vault.
+func (s *operationStats) record(req *http.Request) {
+	s.requests.Add(1)
+
+	p := strings.TrimPrefix(req.URL.Path, "/v1/")
+	if rest, ok := strings.CutPrefix(p, s.kvMount); ok {
+		switch {
+		case strings.HasPrefix(rest, "metadata/"):
+			s.kvMetadata.Add(1)
+		case strings.HasPrefix(rest, "data/") && req.Method == http.MethodGet, strings.HasPrefix(rest, "subkeys/"):
+			s.kvGets.Add(1)
+		case strings.HasPrefix(rest, "data/"), strings.HasPrefix(rest, "delete/"), strings.HasPrefix(rest, "undelete/"), strings.HasPrefix(rest, "destroy/"):
+			s.kvPuts.Add(1)
+		}
+		return
+	}
+
+	for _, mount := range s.transitMounts {
+		rest, ok := strings.CutPrefix(p, mount)
+		if !ok {
+			continue
+		}
+		switch {
+		case strings.HasPrefix(rest, "encrypt/"):
+			s.transitEncrypts.Add(1)
+		case strings.HasPrefix(rest, "decrypt/"):
+			s.transitDecrypts.Add(1)
+		case strings.HasPrefix(rest, "rewrap/"):
+			s.transitRewraps.Add(1)
+		}
+		return
+	}
+}
+
+// cacheHit counts a lookup answered without calling Vault, s may be nil.
+func (s *operationStats) cacheHit() {
+	if s != nil {
+		s.cacheHits.Add(1)
+	}
+}
+
+// fields returns the counters, as log fields.
+func (s *operationStats) fields() map[string]any {
+	return map[string]any{
+		"requests":         s.requests.Load(),
+		"kv_gets":          s.kvGets.Load(),
+		"kv_puts":          s.kvPuts.Load(),
+		"kv_metadata":      s.kvMetadata.Load(),
+		"transit_encrypts": s.transitEncrypts.Load(),
+		"transit_decrypts": s.transitDecrypts.Load(),
+		"transit_rewraps":  s.transitRewraps.Load(),
+		"retries":          s.retries.Load(),
+		"cache_hits":       s.cacheHits.Load(),
+	}
+}
+
+// checkRetry wraps the retry policy of a Vault client to count the retries.
+func (s *operationStats) checkRetry(base func(context.Context, *http.Response, error) (bool, error)) func(context.Context, *http.Response, error) (bool, error) {
+	return func(ctx context.Context, resp *http.Response, err error) (bool, error) {
+		retry, err := base(ctx, resp, err)
+		if retry {
+			s.retries.Add(1)
+		}
+		return retry, err
+	}
+}
+
+// statsTransport counts every call sent through base, retries included.
+type statsTransport struct {
+	base  http.RoundTripper
+	stats *operationStats
+}
+
+func (t *statsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.stats.record(req)
+	return t.base.RoundTrip(req)
+}
+
+func (t *statsTransport) under() http.RoundTripper { return t.base }
+
+func (t *statsTransport) over(base http.RoundTripper) http.RoundTripper {
+	return &statsTransport{base: base, stats: t.stats}
+}
+
+// LogStats logs the totals of the Vault calls of p at the INFO level, once
+// Terraform is done with it. No request is left to log through, it uses a
+// root logger of its own.
+func LogStats(p provider.Provider) {
+	vp, ok := p.(*Provider)
+	if !ok || vp.stats == nil {
+		return
+	}
+
+	ctx := tfsdklog.NewRootProviderLogger(
+		context.Background(),
+		tfsdklog.WithStderrFromInit(),
+		tfsdklog.WithLogName("vault_secrets_as_code"),
+		tflog.WithLevelFromEnv("TF_LOG_PROVIDER", "vault_secrets_as_code"),
+	)
+	tflog.Info(ctx, "vault calls of the run", vp.stats.fields())
+}
+
+// Ensure provider defined types fully satisfy framework interfaces.
+var _ datasource.DataSource = &StatsDataSource{}
+
+func NewStatsDataSource() datasource.DataSource {
+	return &StatsDataSource{}
+}
+
+// StatsDataSource exposes the Vault calls made so far by the provider.
+type StatsDataSource struct {
+	ProviderData
+}
+
+// StatsModel describes the data source data model.
+type StatsModel struct {
+	Requests        int64 `tfsdk:"requests"`
+	KVGets          int64 `tfsdk:"kv_gets"`
+	KVPuts          int64 `tfsdk:"kv_puts"`
+	KVMetadata      int64 `tfsdk:"kv_metadata"`
+	TransitEncrypts int64 `tfsdk:"transit_encrypts"`
+	TransitDecrypts int64 `tfsdk:"transit_decrypts"`
+	TransitRewraps  int64 `tfsdk:"transit_rewraps"`
+	Retries         int64 `tfsdk:"retries"`
+	CacheHits       int64 `tfsdk:"cache_hits"`
+}
+
+func (d *StatsDataSource) Metadata(ctx context.Context, req datasource.MetadataRequest, resp *datasource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_stats"
+}
+
+func (d *StatsDataSource) Schema(ctx context.Context, req datasource.SchemaRequest, resp *datasource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		MarkdownDescription: "Vault calls made by the provider so far in the current operation, when the data source is read, e.g. to assert the cost of a plan in `terraform test`. " +
+			"Every operation (plan, apply) starts a new provider process and counts from zero, the totals of an operation are logged at the INFO level when it ends.",
+		Attributes: map[string]schema.Attribute{
+			"requests": schema.Int64Attribute{
+				Computed:    true,
+				Description: "Every call to either Vault server, retries included",
+			},
+			"kv_gets": schema.Int64Attribute{
+				Computed:    true,
+				Description: "Reads of secret data or subkeys",
+			},
+			"kv_puts": schema.Int64Attribute{
+				Computed:    true,
+				Description: "Writes, patches, deletions, undeletions and destructions of secret versions",
+			},
+			"kv_metadata": schema.Int64Attribute{
+				Computed:    true,
+				Description: "Reads, writes, deletions and listings of secret metadata",
+			},
+			"transit_encrypts": schema.Int64Attribute{
+				Computed: true,
+			},
+			"transit_decrypts": schema.Int64Attribute{
+				Computed:    true,
+				Description: "Decrypt calls, a batch of coalesced decryptions counting once",
+			},
+			"transit_rewraps": schema.Int64Attribute{
+				Computed: true,
+			},
+			"retries": schema.Int64Attribute{
+				Computed:    true,
+				Description: "Calls failing in a way Vault clients retry, e.g. a 5xx or a 412 from a performance standby",
+			},
+			"cache_hits": schema.Int64Attribute{
+				Computed:    true,
+				Description: "Lookups answered by the caches of the provider instead of Vault, e.g. the transit key a ciphertext decrypts with",
+			},
+		},
+	}
+}
+
+func (d *StatsDataSource) Configure(ctx context.Context, req datasource.ConfigureRequest, resp *datasource.ConfigureResponse) {
+	// Prevent panic if the provider has not been configured.
+	if req.ProviderData == nil {
+		return
+	}
+
+	providerData, ok := req.ProviderData.(ProviderData)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Data Source Configure Type",
+			fmt.Sprintf("Expected ProviderData, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+		)
+		return
+	}
+
+	d.ProviderData = providerData
+}
+
+func (d *StatsDataSource) Read(ctx context.Context, req datasource.ReadRequest, resp *datasource.ReadResponse) {
+	s := d.stats
+	data := StatsModel{
+		Requests:        s.requests.Load(),
+		KVGets:          s.kvGets.Load(),
+		KVPuts:          s.kvPuts.Load(),
+		KVMetadata:      s.kvMetadata.Load(),
+		TransitEncrypts: s.transitEncrypts.Load(),
+		TransitDecrypts: s.transitDecrypts.Load(),
+		TransitRewraps:  s.transitRewraps.Load(),
+		Retries:         s.retries.Load(),
+		CacheHits:       s.cacheHits.Load(),
+	}
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
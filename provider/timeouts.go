@@ -0,0 +1,61 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-framework-timeouts/resource/timeouts"
+	"github.com/hashicorp/terraform-plugin-framework/attr"
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+// defaultTimeout is used for every operation that has no configured timeout.
+const defaultTimeout = 20 * time.Minute
+
+// nullTimeouts is the timeouts block of a state no configuration wrote yet,
+// e.g. an imported one.
+func nullTimeouts() timeouts.Value {
+	return timeouts.Value{Object: types.ObjectNull(map[string]attr.Type{
+		"create": types.StringType,
+		"read":   types.StringType,
+		"update": types.StringType,
+		"delete": types.StringType,
+	})}
+}
+
+// withTimeout derives the context of op, "create", "read", "update" or
+// "delete", from the timeouts block t.
+func withTimeout(ctx context.Context, t timeouts.Value, op string, diags *diag.Diagnostics) (context.Context, context.CancelFunc) {
+	timeout := defaultTimeout
+	var d diag.Diagnostics
+	switch op {
+	case "create":
+		timeout, d = t.Create(ctx, defaultTimeout)
+	case "read":
+		timeout, d = t.Read(ctx, defaultTimeout)
+	case "update":
+		timeout, d = t.Update(ctx, defaultTimeout)
+	case "delete":
+		timeout, d = t.Delete(ctx, defaultTimeout)
+	}
+	diags.Append(d...)
+
+	return context.WithTimeout(ctx, timeout)
+}
+
+// addOperationError adds err to diags, reporting a timeout instead when the
+// operation context expired so the user knows which call hung.
+func addOperationError(ctx context.Context, diags *diag.Diagnostics, op, path, summary string, err error) {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		diags.AddError(
+			"operation timed out",
+			fmt.Sprintf("%s of secret %q did not complete before the configured timeout: %s", op, path, errorDetail(err)),
+		)
+		return
+	}
+
+	diags.AddError(summary, errorDetail(err))
+}
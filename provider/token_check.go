@@ -0,0 +1,88 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
+	"github.com/hashicorp/vault/api"
+)
+
+// defaultTokenTTLWarning is the TTL left under which a token is reported,
+// longer than most applies.
+const defaultTokenTTLWarning = 30 * time.Minute
+
+// tokenCheck describes the token of a Vault client to look up.
+type tokenCheck struct {
+	// name tells the clients apart in the diagnostics, e.g. "transit".
+	name   string
+	client *api.Client
+	// renewed is set when the provider renews the token or reads it again
+	// as it rotates, its TTL then does not matter.
+	renewed bool
+	// mounts are the mounts the token must reach.
+	mounts []string
+}
+
+// renewsToken reports whether the provider keeps the token of config alive:
+// it logs in again, or reads the token file again as it rotates.
+func (config VaultConfigModel) renewsToken() bool {
+	return config.AuthLoginCert != nil || config.TokenFile != nil
+}
+
+// checkToken warns when the token of c is about to expire, cannot be renewed,
+// or obviously has no access to the mounts. Tokens denied their own lookup
+// are not checked. The accessor identifies the token, never the token itself.
+func checkToken(ctx context.Context, c tokenCheck, threshold time.Duration) diag.Diagnostics {
+	var diags diag.Diagnostics
+
+	s, err := c.client.Auth().Token().LookupSelfWithContext(ctx)
+	if err != nil || s == nil {
+		tflog.Debug(ctx, "cannot look the token up, it is not checked", map[string]any{"client": c.name, "error": errorDetail(err)})
+		return diags
+	}
+
+	accessor, _ := s.TokenAccessor()
+	token := fmt.Sprintf("the %s token (accessor %s)", c.name, accessor)
+	if accessor == "" {
+		token = fmt.Sprintf("the %s token (no accessor)", c.name)
+	}
+	ttl, _ := s.TokenTTL()
+	tokenType, _ := s.Data["type"].(string)
+	orphan, _ := s.Data["orphan"].(bool)
+
+	// A TTL of 0 never expires, e.g. a root token.
+	if !c.renewed && ttl > 0 && ttl < threshold {
+		diags.AddWarning(
+			"token about to expire",
+			fmt.Sprintf("%s expires in %s, less than token_ttl_warning = %s: an apply running longer fails halfway with permission denied errors. Use a fresh token, or let the provider log in with auth_login_cert", token, ttl, threshold),
+		)
+	}
+	if tokenType == "batch" && orphan && ttl > 0 {
+		diags.AddWarning(
+			"token cannot be renewed",
+			fmt.Sprintf("%s is an orphan batch token: it cannot be renewed and dies in %s whatever the provider does", token, ttl),
+		)
+	}
+
+	// The default policy grants nothing on secret mounts, a token without
+	// any other policy is denied everything the provider does.
+	policies, _ := s.TokenPolicies()
+	if identityPolicies, ok := s.Data["identity_policies"].([]any); ok {
+		for _, p := range identityPolicies {
+			policies = append(policies, fmt.Sprint(p))
+		}
+	}
+	if !slices.ContainsFunc(policies, func(p string) bool { return p != "default" }) {
+		diags.AddWarning(
+			"token without access to the mounts",
+			fmt.Sprintf("%s only has the default policy, which grants nothing on %s", token, strings.Join(c.mounts, ", ")),
+		)
+	}
+
+	return diags
+}
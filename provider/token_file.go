@@ -0,0 +1,114 @@
+package provider
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// tokenFile is a token sink, e.g. written by Vault Agent auto-auth, which
+// rotates the token it holds.
+type tokenFile struct {
+	path string
+
+	mu      sync.Mutex
+	token   string
+	modTime time.Time
+}
+
+// read returns the token of the file, reading it again when it was modified
+// since the last read.
+func (f *tokenFile) read() (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read the token file: %w", err)
+	}
+	if f.token != "" && info.ModTime().Equal(f.modTime) {
+		return f.token, nil
+	}
+
+	b, err := os.ReadFile(f.path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read the token file: %w", err)
+	}
+	token := strings.TrimSpace(string(b))
+	if token == "" {
+		return "", fmt.Errorf("the token file %s is empty", f.path)
+	}
+
+	f.token = token
+	f.modTime = info.ModTime()
+	return token, nil
+}
+
+// tokenFileTransport sends every request with the current token of the
+// file. A request denied with a token the file no longer holds is retried
+// once with the new one, as the token may rotate between the check of the
+// file and the request.
+type tokenFileTransport struct {
+	base http.RoundTripper
+	file *tokenFile
+}
+
+func (t *tokenFileTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := t.file.read()
+	if err != nil {
+		return nil, err
+	}
+
+	// The body is needed again for the retry.
+	var body []byte
+	if req.Body != nil {
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	resp, err := t.base.RoundTrip(t.withToken(req, token, body))
+	if err != nil || resp.StatusCode != http.StatusForbidden {
+		return resp, err
+	}
+
+	// Concurrent requests may have read the new token already, compare with
+	// the token this request was sent with.
+	t.file.mu.Lock()
+	t.file.modTime = time.Time{}
+	t.file.mu.Unlock()
+	current, err := t.file.read()
+	if err != nil || current == token {
+		return resp, nil
+	}
+
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return t.base.RoundTrip(t.withToken(req, current, body))
+}
+
+// withToken returns a copy of req sent with token and body, req itself must
+// not be modified by a RoundTripper.
+func (t *tokenFileTransport) under() http.RoundTripper { return t.base }
+
+func (t *tokenFileTransport) over(base http.RoundTripper) http.RoundTripper {
+	return &tokenFileTransport{base: base, file: t.file}
+}
+
+func (t *tokenFileTransport) withToken(req *http.Request, token string, body []byte) *http.Request {
+	req = req.Clone(req.Context())
+	req.Header.Set(api.AuthHeaderName, token)
+	if body != nil {
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	return req
+}
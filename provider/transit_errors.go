@@ -0,0 +1,41 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+)
+
+var (
+	// errTransitMountMissing and errTransitKeyMissing are the errors of the
+	// calls to a transit mount, or key, that does not exist.
+	errTransitMountMissing = errors.New("transit mount missing")
+	errTransitKeyMissing   = errors.New("transit key missing")
+)
+
+// explainTransitError tells apart the reasons the call to p, using key and
+// requiring capability, may have been refused: a missing mount, a missing
+// key, or a denied token. Vault answers them with generic errors that look
+// like corrupt ciphertexts. Any other error is returned as is.
+func (v vaultTransit) explainTransitError(p, capability, key string, err error) error {
+	var respErr *api.ResponseError
+	if !errors.As(err, &respErr) {
+		return err
+	}
+	mount := strings.TrimSuffix(v.path, "/")
+	messages := strings.Join(respErr.Errors, "; ")
+
+	switch {
+	case respErr.StatusCode == http.StatusNotFound && (strings.Contains(messages, "no handler for route") || strings.Contains(messages, "unsupported path")):
+		return fmt.Errorf("%w: nothing is mounted at %s (queried %s). It was disabled or never enabled, and the ciphertexts of its keys cannot be decrypted until it is restored from a Vault backup: %w", errTransitMountMissing, mount, p, err)
+	case respErr.StatusCode == http.StatusBadRequest && strings.Contains(messages, "key not found"),
+		respErr.StatusCode == http.StatusNotFound && len(respErr.Errors) == 0:
+		return fmt.Errorf("%w: transit key %q does not exist on %s (queried %s). It was deleted or never created, and its ciphertexts cannot be decrypted until it is restored from a backup of the key: %w", errTransitKeyMissing, key, mount, p, err)
+	case respErr.StatusCode == http.StatusForbidden:
+		return fmt.Errorf("permission denied on %s: the token of the transit Vault lacks the %s capability there, the key and its ciphertexts are not at fault: %w", p, capability, err)
+	}
+	return err
+}
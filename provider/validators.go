@@ -0,0 +1,180 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+)
+
+// durationValidator ensures a string parses with time.ParseDuration.
+type durationValidator struct{}
+
+func (v durationValidator) Description(ctx context.Context) string {
+	return "value must be a valid duration, e.g. 30s or 2m"
+}
+
+func (v durationValidator) MarkdownDescription(ctx context.Context) string {
+	return v.Description(ctx)
+}
+
+func (v durationValidator) ValidateString(ctx context.Context, req validator.StringRequest, resp *validator.StringResponse) {
+	if req.ConfigValue.IsNull() || req.ConfigValue.IsUnknown() {
+		return
+	}
+
+	if _, err := time.ParseDuration(req.ConfigValue.ValueString()); err != nil {
+		resp.Diagnostics.AddAttributeError(req.Path, "invalid duration", err.Error())
+	}
+}
+
+// oneOfValidator ensures a string is one of the given values.
+type oneOfValidator struct {
+	values []string
+}
+
+func (v oneOfValidator) Description(ctx context.Context) string {
+	return fmt.Sprintf("value must be one of: %s", strings.Join(v.values, ", "))
+}
+
+func (v oneOfValidator) MarkdownDescription(ctx context.Context) string {
+	return v.Description(ctx)
+}
+
+func (v oneOfValidator) ValidateString(ctx context.Context, req validator.StringRequest, resp *validator.StringResponse) {
+	if req.ConfigValue.IsNull() || req.ConfigValue.IsUnknown() {
+		return
+	}
+
+	if !slices.Contains(v.values, req.ConfigValue.ValueString()) {
+		resp.Diagnostics.AddAttributeError(req.Path, "invalid value", v.Description(ctx))
+	}
+}
+
+// regexValidator ensures a string is a valid regular expression.
+type regexValidator struct{}
+
+func (v regexValidator) Description(ctx context.Context) string {
+	return "value must be a valid regular expression"
+}
+
+func (v regexValidator) MarkdownDescription(ctx context.Context) string {
+	return v.Description(ctx)
+}
+
+func (v regexValidator) ValidateString(ctx context.Context, req validator.StringRequest, resp *validator.StringResponse) {
+	if req.ConfigValue.IsNull() || req.ConfigValue.IsUnknown() {
+		return
+	}
+
+	if _, err := regexp.Compile(req.ConfigValue.ValueString()); err != nil {
+		resp.Diagnostics.AddAttributeError(req.Path, "invalid regular expression", err.Error())
+	}
+}
+
+// int64AtLeastValidator ensures an integer is at least min.
+type int64AtLeastValidator struct {
+	min int64
+}
+
+func (v int64AtLeastValidator) Description(ctx context.Context) string {
+	return fmt.Sprintf("value must be at least %d", v.min)
+}
+
+func (v int64AtLeastValidator) MarkdownDescription(ctx context.Context) string {
+	return v.Description(ctx)
+}
+
+func (v int64AtLeastValidator) ValidateInt64(ctx context.Context, req validator.Int64Request, resp *validator.Int64Response) {
+	if req.ConfigValue.IsNull() || req.ConfigValue.IsUnknown() {
+		return
+	}
+
+	if req.ConfigValue.ValueInt64() < v.min {
+		resp.Diagnostics.AddAttributeError(req.Path, "invalid value", v.Description(ctx))
+	}
+}
+
+// notEmptyValidator ensures a string is not empty.
+type notEmptyValidator struct{}
+
+func (v notEmptyValidator) Description(ctx context.Context) string {
+	return "value must not be empty"
+}
+
+func (v notEmptyValidator) MarkdownDescription(ctx context.Context) string {
+	return v.Description(ctx)
+}
+
+func (v notEmptyValidator) ValidateString(ctx context.Context, req validator.StringRequest, resp *validator.StringResponse) {
+	if req.ConfigValue.IsNull() || req.ConfigValue.IsUnknown() {
+		return
+	}
+
+	if req.ConfigValue.ValueString() == "" {
+		resp.Diagnostics.AddAttributeError(req.Path, "invalid value", v.Description(ctx))
+	}
+}
+
+// maxManagedByLength caps the length of the ownership marker.
+const maxManagedByLength = 128
+
+// managedByPattern is the charset of the ownership marker. Whitespace is left
+// out: a trailing space makes a marker that looks like ours but is not.
+var managedByPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._:/@-]*$`)
+
+// checkManagedBy returns an error unless managedBy is a valid ownership
+// marker.
+func checkManagedBy(managedBy string) error {
+	switch {
+	case len(managedBy) > maxManagedByLength:
+		return fmt.Errorf("%q is longer than %d characters", managedBy, maxManagedByLength)
+	case !managedByPattern.MatchString(managedBy):
+		return fmt.Errorf("%q must start with a letter or a digit and only contain letters, digits and . _ : / @ -", managedBy)
+	}
+	return nil
+}
+
+// managedByValidator ensures a string is a valid ownership marker.
+type managedByValidator struct{}
+
+func (v managedByValidator) Description(ctx context.Context) string {
+	return fmt.Sprintf("value must start with a letter or a digit, only contain letters, digits and . _ : / @ - and be at most %d characters long", maxManagedByLength)
+}
+
+func (v managedByValidator) MarkdownDescription(ctx context.Context) string {
+	return v.Description(ctx)
+}
+
+func (v managedByValidator) ValidateString(ctx context.Context, req validator.StringRequest, resp *validator.StringResponse) {
+	if req.ConfigValue.IsNull() || req.ConfigValue.IsUnknown() {
+		return
+	}
+
+	if err := checkManagedBy(req.ConfigValue.ValueString()); err != nil {
+		resp.Diagnostics.AddAttributeError(req.Path, "invalid managed_by", err.Error())
+	}
+}
+
+// defaultKeyNamePattern is the key name pattern of strict_key_names, names
+// that work as environment variables and Kubernetes secret keys.
+const defaultKeyNamePattern = `[A-Za-z_][A-Za-z0-9_]*`
+
+// newKeyNamePattern returns the regular expression matching the whole of the
+// valid key names, from key_name_pattern and strict_key_names. Keys are not
+// checked, nil, unless either is set.
+func newKeyNamePattern(pattern types.String, strict types.Bool) (*regexp.Regexp, error) {
+	if pattern.IsNull() && !strict.ValueBool() {
+		return nil, nil
+	}
+	expr := defaultKeyNamePattern
+	if !pattern.IsNull() {
+		expr = pattern.ValueString()
+	}
+	return regexp.Compile(`^(?:` + expr + `)$`)
+}
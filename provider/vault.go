@@ -3,126 +3,1340 @@ package provider
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
 	"github.com/hashicorp/terraform-plugin-framework/provider/schema"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-log/tflog"
 	"github.com/hashicorp/vault/api"
 	vault "github.com/hashicorp/vault/api"
 )
 
+// defaultOwnershipKey is the custom metadata key holding the ownership marker
+// unless ownership_metadata_key says otherwise.
+const defaultOwnershipKey = "managed_by"
+
+// deletionProtectedKey is the custom metadata key locking a secret against
+// deletion.
+const deletionProtectedKey = "deletion_protected"
+
 type vaultKV struct {
-	client    *vault.Client
-	path      string
-	managedBy string
+	// client is shared by every concurrent operation, it is not modified
+	// once configured: per-operation variations must use a copy, e.g. from
+	// client.WithNamespace or client.Clone. Only the token changes, when
+	// cert auth logs in again.
+	client       *vault.Client
+	path         string
+	managedBy    string
+	ownershipKey string
+	readOnly     bool
+	// forbidMetadataDelete turns destroys into soft deletes.
+	forbidMetadataDelete bool
+	// auditMetadata is merged into the custom metadata on every write.
+	auditMetadata map[string]string
+	// provenanceMetadata records the provider and Terraform versions on
+	// every write, like auditMetadata.
+	provenanceMetadata map[string]string
+	// defaultCustomMetadata is merged into the custom metadata on every
+	// write, below the metadata set by the resource.
+	defaultCustomMetadata map[string]string
+	// pathPrefix is prepended to the path of every secret, it is either
+	// empty or ends with a slash.
+	pathPrefix string
+	// allowedPathPrefixes restricts the paths of the secrets, including
+	// pathPrefix, when set.
+	allowedPathPrefixes []string
+	// warnOnDisallowedPaths downgrades allowedPathPrefixes violations to
+	// warnings.
+	warnOnDisallowedPaths bool
+	// deniedPathPrefixes are never written nor deleted under, whatever
+	// allowedPathPrefixes says.
+	deniedPathPrefixes []string
+	// maxSecretBytes is the largest serialized secret written.
+	maxSecretBytes int
+	// auditLogPath is where every mutation is recorded, relative to the
+	// mount, when set.
+	auditLogPath string
 	// TODO(antoine): look into adding the resource ID in the meta so  we cannot
 	// overwrite the value within TF
 }
 
-func (v vaultKV) Destroy(ctx context.Context, k string) error {
-	kv := v.client.KVv2(v.path)
+// Destroy deletes k along with all its versions. When shred is set, the data
+// of every version is destroyed first and checked to be gone before the
+// metadata is deleted.
+func (v vaultKV) Destroy(ctx context.Context, k string, shred bool) (err error) {
+	ctx, wrap := traceCall(ctx, v.client, "kv destroy", v.path)
+	defer func() { err = wrap(err) }()
+
+	if err := v.checkWritable(); err != nil {
+		return err
+	}
+	if err := v.checkNotDenied(k); err != nil {
+		return err
+	}
+
+	kv := v.client.KVv2(v.path)
+
+	meta, err := kv.GetMetadata(ctx, k)
+	if err != nil {
+		return err
+	}
+
+	if meta.CustomMetadata[deletionProtectedKey] == "true" {
+		return fmt.Errorf("%q is protected against deletion, set protected = false and apply before destroying it", k)
+	}
+
+	if err := v.checkOwnership(k, meta.CustomMetadata); err != nil {
+		return err
+	}
+
+	if v.forbidMetadataDelete {
+		if shred {
+			return fmt.Errorf("refusing to shred %q, forbid_metadata_delete is set", k)
+		}
+		return v.softDelete(ctx, k, meta)
+	}
+
+	if shred {
+		if err := v.shred(ctx, k, meta); err != nil {
+			return err
+		}
+	}
+
+	if err := kv.DeleteMetadata(ctx, k); err != nil {
+		if isPermissionDenied(err) {
+			return fmt.Errorf("permission denied deleting the metadata of %q, the token needs the delete capability on %s/metadata/%s: %w", k, strings.TrimSuffix(v.path, "/"), k, err)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// softDelete deletes every live version of k, keeping its data and metadata
+// so the versions can be undeleted.
+func (v vaultKV) softDelete(ctx context.Context, k string, meta *api.KVMetadata) error {
+	versions := make([]int, 0, len(meta.Versions))
+	for _, version := range meta.Versions {
+		if !version.Destroyed && version.DeletionTime.IsZero() {
+			versions = append(versions, version.Version)
+		}
+	}
+
+	return v.client.KVv2(v.path).DeleteVersions(ctx, k, versions)
+}
+
+// shred destroys the data of every version of k and checks they are all
+// marked destroyed.
+func (v vaultKV) shred(ctx context.Context, k string, meta *api.KVMetadata) error {
+	kv := v.client.KVv2(v.path)
+
+	versions := make([]int, 0, len(meta.Versions))
+	for _, version := range meta.Versions {
+		if !version.Destroyed {
+			versions = append(versions, version.Version)
+		}
+	}
+	if len(versions) == 0 {
+		return nil
+	}
+
+	if err := kv.Destroy(ctx, k, versions); err != nil {
+		if isPermissionDenied(err) {
+			return fmt.Errorf("permission denied destroying the versions of %q, the token needs the update capability on %s/destroy/%s: %w", k, strings.TrimSuffix(v.path, "/"), k, err)
+		}
+		return err
+	}
+
+	meta, err := kv.GetMetadata(ctx, k)
+	if err != nil {
+		return err
+	}
+	for _, version := range meta.Versions {
+		if !version.Destroyed {
+			return fmt.Errorf("version %d of %q is not marked destroyed after destroying it, refusing to delete its metadata", version.Version, k)
+		}
+	}
+
+	return nil
+}
+
+// DestroyOldVersions destroys the data of the versions of k older than its
+// newest keep versions, and returns the versions it destroyed.
+func (v vaultKV) DestroyOldVersions(ctx context.Context, k string, keep int) (_ []int, err error) {
+	ctx, wrap := traceCall(ctx, v.client, "kv destroy versions", v.path)
+	defer func() { err = wrap(err) }()
+
+	if err := v.checkWritable(); err != nil {
+		return nil, err
+	}
+	if err := v.checkNotDenied(k); err != nil {
+		return nil, err
+	}
+
+	kv := v.client.KVv2(v.path)
+
+	meta, err := kv.GetMetadata(ctx, k)
+	if err != nil {
+		return nil, err
+	}
+	if err := v.checkOwnership(k, meta.CustomMetadata); err != nil {
+		return nil, err
+	}
+
+	var versions []int
+	for _, version := range meta.Versions {
+		if !version.Destroyed && version.Version <= meta.CurrentVersion-keep {
+			versions = append(versions, version.Version)
+		}
+	}
+	if len(versions) == 0 {
+		return nil, nil
+	}
+	slices.Sort(versions)
+
+	if err := kv.Destroy(ctx, k, versions); err != nil {
+		if isPermissionDenied(err) {
+			return nil, fmt.Errorf("permission denied destroying the old versions of %q, the token needs the update capability on %s/destroy/%s: %w", k, strings.TrimSuffix(v.path, "/"), k, err)
+		}
+		return nil, err
+	}
+	return versions, nil
+}
+
+// isPermissionDenied reports whether err is a 403 from Vault.
+func isPermissionDenied(err error) bool {
+	var respErr *api.ResponseError
+	return errors.As(err, &respErr) && respErr.StatusCode == http.StatusForbidden
+}
+
+// isBadRequest reports whether err is a 400 from Vault, which transit
+// returns for ciphertexts the key cannot decrypt.
+func isBadRequest(err error) bool {
+	var respErr *api.ResponseError
+	return errors.As(err, &respErr) && respErr.StatusCode == http.StatusBadRequest
+}
+
+// isNotFound reports whether err is a 404 from Vault.
+func isNotFound(err error) bool {
+	var respErr *api.ResponseError
+	return errors.As(err, &respErr) && respErr.StatusCode == http.StatusNotFound
+}
+
+// mountMissing reports whether err comes from the KV mount no longer
+// existing, e.g. disabled by a teardown. Reads hide a missing mount behind a
+// 404 or a 403, the config endpoint of the mount tells them apart. A token
+// denied that endpoint cannot tell, the mount is then assumed to exist.
+func (v vaultKV) mountMissing(ctx context.Context, err error) bool {
+	if !errors.Is(err, api.ErrSecretNotFound) && !isNotFound(err) && !isPermissionDenied(err) {
+		return false
+	}
+
+	resp, err := v.client.Logical().ReadRawWithContext(ctx, strings.TrimSuffix(v.path, "/")+"/config")
+	if resp != nil {
+		resp.Body.Close()
+	}
+
+	var respErr *api.ResponseError
+	if !errors.As(err, &respErr) || respErr.StatusCode != http.StatusNotFound {
+		return false
+	}
+	for _, e := range respErr.Errors {
+		if strings.Contains(e, "no handler for route") {
+			return true
+		}
+	}
+	return false
+}
+
+// errReadOnly is returned by every mutating call in read-only mode.
+var errReadOnly = errors.New("the provider is in read-only mode (read_only = true), refusing to write to Vault")
+
+// checkWritable returns errReadOnly in read-only mode.
+func (v vaultKV) checkWritable() error {
+	if v.readOnly {
+		return errReadOnly
+	}
+	return nil
+}
+
+// normalizePathPrefix returns prefix without leading slashes and with a
+// single trailing one, or an empty prefix.
+func normalizePathPrefix(prefix string) string {
+	prefix = strings.Trim(prefix, "/")
+	if prefix == "" {
+		return ""
+	}
+	return prefix + "/"
+}
+
+// secretPath returns the path of the secret at p relative to pathPrefix.
+func (v vaultKV) secretPath(p string) string {
+	return v.pathPrefix + p
+}
+
+// pathAllowed reports whether k is under one of allowedPathPrefixes, every
+// path is allowed when there are none.
+func (v vaultKV) pathAllowed(k string) bool {
+	if _, denied := v.deniedPrefix(k); denied {
+		return false
+	}
+	if len(v.allowedPathPrefixes) == 0 {
+		return true
+	}
+	for _, prefix := range v.allowedPathPrefixes {
+		if strings.HasPrefix(k, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPathAllowed adds an error on attr, or a warning with
+// warn_on_disallowed_paths, when k is outside of allowedPathPrefixes.
+func (v vaultKV) checkPathAllowed(k string, attr path.Path, diags *diag.Diagnostics) {
+	if err := v.checkNotDenied(k); err != nil {
+		diags.AddAttributeError(attr, "path denied", err.Error())
+		return
+	}
+	if v.pathAllowed(k) {
+		return
+	}
+
+	summary := "path not allowed"
+	detail := fmt.Sprintf("%s is outside of allowed_path_prefixes (%s)", v.fullPath(k), strings.Join(v.allowedPathPrefixes, ", "))
+	if v.warnOnDisallowedPaths {
+		diags.AddAttributeWarning(attr, summary, detail)
+	} else {
+		diags.AddAttributeError(attr, summary, detail)
+	}
+}
+
+// deniedPrefix returns the prefix of deniedPathPrefixes k is under.
+func (v vaultKV) deniedPrefix(k string) (string, bool) {
+	for _, prefix := range v.deniedPathPrefixes {
+		if strings.HasPrefix(k, prefix) {
+			return prefix, true
+		}
+	}
+	return "", false
+}
+
+// checkNotDenied returns an error when k is under one of
+// deniedPathPrefixes. It guards every write and delete, on top of the plan
+// time checks.
+func (v vaultKV) checkNotDenied(k string) error {
+	if prefix, denied := v.deniedPrefix(k); denied {
+		return fmt.Errorf("%s is under the denied path prefix %q (denied_path_prefixes)", v.fullPath(k), prefix)
+	}
+	return nil
+}
+
+// checkSecretPath returns an error when k is empty or repeats the mount, a
+// common mistake when paths are copied from the Vault CLI, or when the Vault
+// client would clean it into another path. The error shows where the secret
+// would have been written.
+func (v vaultKV) checkSecretPath(k string) error {
+	mount := strings.Trim(v.path, "/")
+	normalized := strings.Trim(k, "/")
+	sent := mount + "/data/" + k
+
+	switch {
+	case normalized == "":
+		return fmt.Errorf("the secret path is empty, it would be sent to Vault as %s", sent)
+	case normalized == mount:
+		return fmt.Errorf("the secret path %q is the name of the mount, it would be sent to Vault as %s", k, sent)
+	case strings.HasPrefix(normalized, mount+"/"):
+		return fmt.Errorf("the secret path %q includes the mount, it would be sent to Vault as %s. Paths are relative to kv_path", k, sent)
+	case slices.ContainsFunc(strings.Split(normalized, "/"), func(segment string) bool { return segment == "" || segment == "." || segment == ".." }):
+		// Other characters, e.g. spaces, + or non ASCII, are escaped by the
+		// client and reach Vault unchanged.
+		return fmt.Errorf("the secret path %q has an empty, . or .. segment, the Vault client would clean it into another path than %s", k, sent)
+	}
+	return nil
+}
+
+// fullPath returns the path of k including the mount, for messages.
+func (v vaultKV) fullPath(k string) string {
+	return strings.TrimSuffix(v.path, "/") + "/" + k
+}
+
+// uiURL returns the address of the page of k in the Vault UI.
+func (v vaultKV) uiURL(k string) string {
+	u := strings.TrimSuffix(v.client.Address(), "/") +
+		"/ui/vault/secrets/" + url.PathEscape(strings.Trim(v.path, "/")) +
+		"/kv/" + url.PathEscape(k) + "/details"
+	if ns := strings.Trim(v.client.Namespace(), "/"); ns != "" {
+		u += "?namespace=" + url.QueryEscape(ns)
+	}
+	return u
+}
+
+// checkOwnership returns an error unless the custom metadata carries our
+// ownership marker.
+func (v vaultKV) checkOwnership(k string, customMetadata map[string]any) error {
+	managedBy, ok := v.ownershipMarker(customMetadata)
+	if !ok {
+		return fmt.Errorf("%q is not managed by this Terraform configuration", k)
+	} else if managedBy != v.managedBy {
+		if s, ok := managedBy.(string); ok && markerTypo(s, v.managedBy) {
+			return fmt.Errorf("%q is not managed by this Terraform configuration (%s: %q), the marker only differs from managed_by %q by case or whitespace, which is almost always a typo", k, v.ownershipKey, managedBy, v.managedBy)
+		}
+		return fmt.Errorf("%q is not managed by this Terraform configuration (%s: %q)", k, v.ownershipKey, managedBy)
+	}
+
+	return nil
+}
+
+// markerTypo reports whether the ownership markers a and b differ only by
+// case or surrounding whitespace.
+func markerTypo(a, b string) bool {
+	return a != b && strings.EqualFold(strings.TrimSpace(a), strings.TrimSpace(b))
+}
+
+// ownershipMarker returns the ownership marker of the custom metadata, if
+// any.
+func (v vaultKV) ownershipMarker(customMetadata map[string]any) (any, bool) {
+	managedBy, ok := customMetadata[v.ownershipKey]
+	if !ok && v.ownershipKey != defaultOwnershipKey {
+		// Secrets written before ownership_metadata_key was changed still
+		// carry the default key, they get migrated on the next write.
+		managedBy, ok = customMetadata[defaultOwnershipKey]
+	}
+	return managedBy, ok
+}
+
+// OverwriteManagedbyMeta replaces the custom metadata of k with our ownership
+// marker, the audit metadata and the given extra metadata.
+func (v vaultKV) OverwriteManagedbyMeta(ctx context.Context, k string, metadata map[string]any) (err error) {
+	ctx, wrap := traceCall(ctx, v.client, "kv metadata write", v.path)
+	defer func() { err = wrap(err) }()
+
+	if err := v.checkWritable(); err != nil {
+		return err
+	}
+	if err := v.checkNotDenied(k); err != nil {
+		return err
+	}
+
+	return v.putCustomMetadata(ctx, k, v.customMetadata(metadata))
+}
+
+func (v vaultKV) putCustomMetadata(ctx context.Context, k string, customMetadata map[string]any) error {
+	if err := validateCustomMetadata(customMetadata); err != nil {
+		return fmt.Errorf("invalid custom metadata for %q: %w", k, err)
+	}
+
+	kv := v.client.KVv2(v.path)
+	return kv.PutMetadata(ctx, k, api.KVMetadataPutInput{
+		CustomMetadata: customMetadata,
+	})
+}
+
+func (v vaultKV) customMetadata(metadata map[string]any) map[string]any {
+	customMetadata := make(map[string]any)
+	for key, value := range v.defaultCustomMetadata {
+		customMetadata[key] = value
+	}
+	for key, value := range v.auditMetadata {
+		customMetadata[key] = value
+	}
+	for key, value := range v.provenanceMetadata {
+		customMetadata[key] = value
+	}
+	for key, value := range metadata {
+		customMetadata[key] = value
+	}
+	customMetadata[v.ownershipKey] = v.managedBy
+	return customMetadata
+}
+
+// updateMetadata updates the custom metadata of k when no new version of its
+// data is written. The audit and provenance metadata keep describing the run
+// that wrote the latest version.
+func (v vaultKV) updateMetadata(ctx context.Context, k string, current map[string]any, metadata map[string]any) error {
+	customMetadata := v.customMetadata(metadata)
+	for _, run := range []map[string]string{v.auditMetadata, v.provenanceMetadata} {
+		for key := range run {
+			if value, ok := current[key]; ok {
+				customMetadata[key] = value
+			} else {
+				delete(customMetadata, key)
+			}
+		}
+	}
+
+	if reflect.DeepEqual(current, customMetadata) {
+		return nil
+	}
+
+	return v.putCustomMetadata(ctx, k, customMetadata)
+}
+
+// Custom metadata keys of the provenance metadata.
+const (
+	provenanceProviderVersionKey  = "vsac_provider_version"
+	provenanceTerraformVersionKey = "vsac_terraform_version"
+	// maxProvenanceValueLength keeps odd version strings from eating the
+	// custom metadata budget.
+	maxProvenanceValueLength = 64
+)
+
+// provenanceMetadata returns the provenance metadata of the given versions.
+func provenanceMetadata(providerVersion, terraformVersion string) map[string]string {
+	truncate := func(s string) string {
+		if len(s) > maxProvenanceValueLength {
+			return s[:maxProvenanceValueLength]
+		}
+		return s
+	}
+	return map[string]string{
+		provenanceProviderVersionKey:  truncate(providerVersion),
+		provenanceTerraformVersionKey: truncate(terraformVersion),
+	}
+}
+
+// Limits enforced by Vault on custom metadata.
+const (
+	maxCustomMetadataKeys        = 64
+	maxCustomMetadataKeyLength   = 128
+	maxCustomMetadataValueLength = 512
+	maxCustomMetadataBytes       = 4096
+)
+
+func validateCustomMetadata(customMetadata map[string]any) error {
+	if len(customMetadata) > maxCustomMetadataKeys {
+		return fmt.Errorf("%d keys, at most %d are allowed", len(customMetadata), maxCustomMetadataKeys)
+	}
+
+	size := 0
+	for key, value := range customMetadata {
+		s := fmt.Sprint(value)
+		if len(key) > maxCustomMetadataKeyLength {
+			return fmt.Errorf("key %q is %d bytes long, at most %d are allowed", key, len(key), maxCustomMetadataKeyLength)
+		}
+		if len(s) > maxCustomMetadataValueLength {
+			return fmt.Errorf("the value of %q is %d bytes long, at most %d are allowed", key, len(s), maxCustomMetadataValueLength)
+		}
+		size += len(key) + len(s)
+	}
+
+	if size > maxCustomMetadataBytes {
+		return fmt.Errorf("%d bytes, at most %d are allowed", size, maxCustomMetadataBytes)
+	}
+
+	return nil
+}
+
+// PutIfChanged is like Put but only writes a new version of k when value
+// differs from its latest version, otherwise only the metadata is updated.
+func (v vaultKV) PutIfChanged(ctx context.Context, k string, value map[string]any, metadata map[string]any, opts ...api.KVOption) (_ int, err error) {
+	ctx, wrap := traceCall(ctx, v.client, "kv put", v.path)
+	defer func() { err = wrap(err) }()
+
+	if err := v.checkWritable(); err != nil {
+		return 0, err
+	}
+	if err := v.checkNotDenied(k); err != nil {
+		return 0, err
+	}
+	if err := v.checkSecretPath(k); err != nil {
+		return 0, err
+	}
+	if err := v.checkSecretSize(k, value); err != nil {
+		return 0, err
+	}
+
+	kv := v.client.KVv2(v.path)
+
+	current, err := kv.Get(ctx, k)
+	if errors.Is(err, api.ErrSecretNotFound) || (err == nil && !reflect.DeepEqual(current.Data, value)) {
+		return v.Put(ctx, k, value, metadata, opts...)
+	} else if err != nil {
+		return 0, err
+	}
+
+	if err := v.checkOwnership(k, current.CustomMetadata); err != nil {
+		return 0, err
+	}
+	if err := checkCAS(k, current.VersionMetadata.Version, opts); err != nil {
+		return 0, err
+	}
+
+	return current.VersionMetadata.Version, v.updateMetadata(ctx, k, current.CustomMetadata, metadata)
+}
+
+// checkCAS returns an error when opts carry a check-and-set version other
+// than current, before anything is written.
+func checkCAS(k string, current int, opts []api.KVOption) error {
+	for _, opt := range opts {
+		if key, value := opt(); key == "cas" && value != current {
+			return fmt.Errorf("%q is at version %d but version %v was expected, it was written outside of Terraform", k, current, value)
+		}
+	}
+	return nil
+}
+
+// Put writes value as a new version of k and returns the version number.
+func (v vaultKV) Put(ctx context.Context, k string, value map[string]any, metadata map[string]any, opts ...api.KVOption) (_ int, err error) {
+	ctx, wrap := traceCall(ctx, v.client, "kv put", v.path)
+	defer func() { err = wrap(err) }()
+
+	if err := v.checkWritable(); err != nil {
+		return 0, err
+	}
+	if err := v.checkNotDenied(k); err != nil {
+		return 0, err
+	}
+	if err := v.checkSecretPath(k); err != nil {
+		return 0, err
+	}
+	if err := v.checkSecretSize(k, value); err != nil {
+		return 0, err
+	}
+
+	kv := v.client.KVv2(v.path)
+
+	meta, err := kv.GetMetadata(ctx, k)
+	if err == nil {
+		if err := v.checkOwnership(k, meta.CustomMetadata); err != nil {
+			return 0, err
+		}
+		if err := checkCAS(k, meta.CurrentVersion, opts); err != nil {
+			return 0, err
+		}
+	} else if !errors.Is(err, api.ErrSecretNotFound) {
+		return 0, err
+	}
+
+	err = v.OverwriteManagedbyMeta(ctx, k, metadata)
+	if err != nil {
+		return 0, err
+	}
+
+	secret, err := kv.Put(ctx, k, value, opts...)
+	if err != nil {
+		return 0, err
+	}
+
+	return secret.VersionMetadata.Version, nil
+}
+
+// GeneratePassword returns a password generated from the named password
+// policy.
+func (v vaultKV) GeneratePassword(ctx context.Context, policy string) (_ string, err error) {
+	ctx, wrap := traceCall(ctx, v.client, "password generation", "")
+	defer func() { err = wrap(err) }()
+
+	s, err := v.client.Logical().ReadWithContext(ctx, "sys/policies/password/"+policy+"/generate")
+	if err != nil {
+		return "", err
+	}
+	if s == nil {
+		return "", fmt.Errorf("password policy %q not found", policy)
+	}
+	password, ok := s.Data["password"].(string)
+	if !ok {
+		return "", fmt.Errorf("the value of the generated password is not a string")
+	}
+	return password, nil
+}
+
+// PasswordPolicyExists reports whether the named password policy exists.
+func (v vaultKV) PasswordPolicyExists(ctx context.Context, policy string) (_ bool, err error) {
+	ctx, wrap := traceCall(ctx, v.client, "password policy read", "")
+	defer func() { err = wrap(err) }()
+
+	s, err := v.client.Logical().ReadWithContext(ctx, "sys/policies/password/"+policy)
+	if err != nil {
+		return false, err
+	}
+	return s != nil, nil
+}
+
+// Patch applies a JSON merge patch to the latest version of k, nil values
+// delete their key. Only secrets we own can be patched. It returns the
+// version number of k afterwards.
+func (v vaultKV) Patch(ctx context.Context, k string, patch map[string]any, metadata map[string]any, opts ...api.KVOption) (_ int, err error) {
+	ctx, wrap := traceCall(ctx, v.client, "kv patch", v.path)
+	defer func() { err = wrap(err) }()
+
+	if err := v.checkWritable(); err != nil {
+		return 0, err
+	}
+	if err := v.checkNotDenied(k); err != nil {
+		return 0, err
+	}
+	if err := v.checkSecretPath(k); err != nil {
+		return 0, err
+	}
+	if err := v.checkSecretSize(k, patch); err != nil {
+		return 0, err
+	}
+
+	kv := v.client.KVv2(v.path)
+
+	meta, err := kv.GetMetadata(ctx, k)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := v.checkOwnership(k, meta.CustomMetadata); err != nil {
+		return 0, err
+	}
+	if err := checkCAS(k, meta.CurrentVersion, opts); err != nil {
+		return 0, err
+	}
+
+	if len(patch) == 0 {
+		return meta.CurrentVersion, v.updateMetadata(ctx, k, meta.CustomMetadata, metadata)
+	}
+
+	err = v.OverwriteManagedbyMeta(ctx, k, metadata)
+	if err != nil {
+		return 0, err
+	}
+
+	secret, err := kv.Patch(ctx, k, patch, opts...)
+	if err != nil {
+		return 0, err
+	}
+
+	return secret.VersionMetadata.Version, nil
+}
+
+// List returns the path of every secret under prefix, descending at most
+// maxDepth folders below it.
+func (v vaultKV) List(ctx context.Context, prefix string, maxDepth int) (_ []string, err error) {
+	ctx, wrap := traceCall(ctx, v.client, "kv list", v.path)
+	defer func() { err = wrap(err) }()
+
+	s, err := v.client.Logical().ListWithContext(ctx, strings.TrimSuffix(v.path, "/")+"/metadata/"+prefix)
+	if err != nil {
+		return nil, err
+	}
+	if s == nil {
+		return nil, nil
+	}
+
+	keys, _ := s.Data["keys"].([]any)
+	paths := make([]string, 0, len(keys))
+	for _, key := range keys {
+		key, ok := key.(string)
+		if !ok {
+			continue
+		}
+
+		if !strings.HasSuffix(key, "/") {
+			paths = append(paths, prefix+key)
+			continue
+		}
+		if maxDepth <= 0 {
+			continue
+		}
+
+		sub, err := v.List(ctx, prefix+key, maxDepth-1)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, sub...)
+	}
+
+	return paths, nil
+}
+
+// GetSubkeys returns the key structure of the latest version of the secret at
+// k, every value replaced by nil, down to depth levels (all of them when 0).
+// The values never leave Vault, unless the subkeys endpoint is missing (Vault
+// before 1.10) or denied, the secret is then read and reduced here. A missing
+// secret, or a deleted latest version, is api.ErrSecretNotFound.
+func (v vaultKV) GetSubkeys(ctx context.Context, k string, depth int) (_ map[string]any, err error) {
+	ctx, wrap := traceCall(ctx, v.client, "kv subkeys read", v.path)
+	defer func() { err = wrap(err) }()
+
+	p := strings.TrimSuffix(v.path, "/") + "/subkeys/" + k
+	resp, err := v.client.Logical().ReadRawWithDataWithContext(ctx, p, url.Values{"depth": {strconv.Itoa(depth)}})
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+
+	var respErr *api.ResponseError
+	if errors.As(err, &respErr) && subkeysUnavailable(respErr) {
+		secret, err := v.client.KVv2(v.path).Get(ctx, k)
+		if err != nil {
+			return nil, err
+		}
+		return subkeysOf(secret.Data, depth), nil
+	}
+	if isNotFound(err) {
+		return nil, fmt.Errorf("%w: %s", api.ErrSecretNotFound, v.fullPath(k))
+	} else if err != nil {
+		return nil, err
+	}
+
+	secret, err := api.ParseSecret(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	subkeys, ok := secret.Data["subkeys"].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", api.ErrSecretNotFound, v.fullPath(k))
+	}
+	return subkeys, nil
+}
+
+// subkeysUnavailable reports whether err means the subkeys endpoint cannot be
+// used, rather than the secret missing.
+func subkeysUnavailable(err *api.ResponseError) bool {
+	switch err.StatusCode {
+	case http.StatusForbidden, http.StatusMethodNotAllowed:
+		return true
+	case http.StatusNotFound:
+		return slices.ContainsFunc(err.Errors, func(e string) bool { return strings.Contains(e, "unsupported path") })
+	}
+	return false
+}
+
+// subkeysOf returns the key structure of data the way the subkeys endpoint
+// does.
+func subkeysOf(data map[string]any, depth int) map[string]any {
+	subkeys := make(map[string]any, len(data))
+	for k, v := range data {
+		nested, ok := v.(map[string]any)
+		if ok && depth != 1 {
+			subkeys[k] = subkeysOf(nested, max(depth-1, 0))
+		} else {
+			subkeys[k] = nil
+		}
+	}
+	return subkeys
+}
+
+// ownedSecret is a secret carrying our ownership marker.
+type ownedSecret struct {
+	path     string
+	metadata *api.KVMetadata
+}
+
+// ListOwned returns the secrets under prefix carrying our ownership marker,
+// sorted by path. At most concurrency metadata reads run at once.
+func (v vaultKV) ListOwned(ctx context.Context, prefix string, maxDepth, concurrency int) ([]ownedSecret, error) {
+	paths, err := v.List(ctx, prefix, maxDepth)
+	if err != nil {
+		return nil, err
+	}
+
+	kv := v.client.KVv2(v.path)
+	metadata := make([]*api.KVMetadata, len(paths))
+	errs := make([]error, len(paths))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	for i, p := range paths {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			meta, err := kv.GetMetadata(ctx, p)
+			if errors.Is(err, api.ErrSecretNotFound) {
+				// Deleted since it was listed.
+				return
+			}
+			metadata[i], errs[i] = meta, err
+		}()
+	}
+	wg.Wait()
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	owned := make([]ownedSecret, 0)
+	for i, p := range paths {
+		if metadata[i] == nil {
+			continue
+		}
+		if err := v.checkOwnership(p, metadata[i].CustomMetadata); err != nil {
+			if marker, _ := v.ownershipMarker(metadata[i].CustomMetadata); marker != nil && markerTypo(fmt.Sprint(marker), v.managedBy) {
+				tflog.Warn(ctx, "skipped a secret whose ownership marker only differs from managed_by by case or whitespace", map[string]any{"path": v.fullPath(p), "marker": marker})
+			}
+			continue
+		}
+		owned = append(owned, ownedSecret{path: p, metadata: metadata[i]})
+	}
+	slices.SortFunc(owned, func(a, b ownedSecret) int { return strings.Compare(a.path, b.path) })
+
+	return owned, nil
+}
+
+type vaultTransit struct {
+	// client is shared like the client of vaultKV, and must not be
+	// modified either.
+	client *vault.Client
+	path   string
+	key    string
+	// fallbackKeys are tried in order when a ciphertext does not decrypt
+	// with key.
+	fallbackKeys []string
+	// decryptedWith remembers the key each ciphertext decrypted with, so
+	// the fallback keys are only searched once per ciphertext.
+	decryptedWith *sync.Map
+	// minDecryptionVersions caches the min_decryption_version of the keys
+	// that refused a ciphertext as too old, by mount and key.
+	minDecryptionVersions *sync.Map
+	// coalescer merges concurrent decryptions, when enabled.
+	coalescer *decryptCoalescer
+	// signingKey signs the content of the secrets written, when set.
+	signingKey string
+	// keyVersion is the version of key values are encrypted with, the
+	// latest one when 0.
+	keyVersion int64
+	// routes send prefixed ciphertexts to other transit mounts.
+	routes []transitRoute
+	// routePrefix is prepended to the ciphertexts of a routed transit.
+	routePrefix string
+	// stats counts the cache hits, when set.
+	stats *operationStats
+}
+
+func (v vaultTransit) Decrypt(ctx context.Context, ciphertext string) (sensitive, error) {
+	return v.DecryptDerived(ctx, ciphertext, "")
+}
+
+// DecryptDerived decrypts ciphertext with the given key derivation context,
+// an empty context is not sent. Ciphertexts that do not decrypt with the
+// primary key are tried against the fallback keys.
+func (v vaultTransit) DecryptDerived(ctx context.Context, ciphertext, keyContext string) (sensitive, error) {
+	routed, ciphertext, err := v.route(ciphertext)
+	if err != nil {
+		return "", err
+	}
+	if routed.routePrefix != "" {
+		return routed.decrypt(ctx, routed.key, ciphertext, keyContext)
+	}
+
+	keys := append([]string{v.key}, v.fallbackKeys...)
+	if v.decryptedWith != nil {
+		if key, ok := v.decryptedWith.Load(ciphertext); ok {
+			keys = []string{key.(string)}
+			if len(v.fallbackKeys) > 0 {
+				v.stats.cacheHit()
+			}
+		}
+	}
+
+	var errs []error
+	for _, key := range keys {
+		plaintext, err := v.decrypt(ctx, key, ciphertext, keyContext)
+		if err == nil {
+			if v.decryptedWith != nil {
+				v.decryptedWith.Store(ciphertext, key)
+			}
+			if key != v.key {
+				tflog.Debug(ctx, "decrypted with a fallback transit key", map[string]any{"key": key})
+			}
+			return plaintext, nil
+		}
+
+		// Only a ciphertext rejected by the key is worth another key,
+		// anything else (e.g. permission denied) is reported as is.
+		if !isBadRequest(err) {
+			return "", err
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", key, err))
+	}
+
+	if len(errs) == 1 {
+		return "", errors.Unwrap(errs[0])
+	}
+	return "", fmt.Errorf("no transit key decrypts the ciphertext: %w", errors.Join(errs...))
+}
+
+// decrypt decrypts ciphertext with key, along with other decryptions when
+// coalescing is enabled.
+func (v vaultTransit) decrypt(ctx context.Context, key, ciphertext, keyContext string) (_ sensitive, err error) {
+	ctx, wrap := traceCall(ctx, v.client, "transit decrypt", v.path)
+	defer func() { err = wrap(err) }()
+
+	var plaintext sensitive
+	if v.coalescer != nil {
+		plaintext, err = v.coalescer.decrypt(ctx, key, ciphertext, keyContext)
+	} else {
+		plaintext, err = v.decryptWith(ctx, key, ciphertext, keyContext)
+	}
+	if isBadRequest(err) && strings.Contains(err.Error(), transitTooOld) {
+		return "", v.tooOldError(ctx, key, ciphertext, err)
+	} else if err != nil {
+		return "", v.explainTransitError(v.path+"decrypt/"+key, "update", key, err)
+	}
+	return plaintext, nil
+}
+
+// transitTooOld is in the error of transit for ciphertexts of a key version
+// below the min_decryption_version of the key.
+const transitTooOld = "disallowed by policy (too old)"
+
+// tooOldError explains err, the refusal of key to decrypt ciphertext because
+// of its min_decryption_version, and how to fix it.
+func (v vaultTransit) tooOldError(ctx context.Context, key, ciphertext string, err error) error {
+	version := "an unknown version"
+	if n := ciphertextKeyVersion(ciphertext); !n.IsNull() {
+		version = fmt.Sprintf("version %d", n.ValueInt64())
+	}
+
+	floor := "min_decryption_version"
+	minVersion, minErr := v.minDecryptionVersion(ctx, key)
+	if minErr != nil {
+		tflog.Debug(ctx, "failed to read the min_decryption_version of the transit key", map[string]any{"key": key, "error": errorDetail(minErr)})
+	} else {
+		floor = fmt.Sprintf("min_decryption_version %d", minVersion)
+	}
+
+	return fmt.Errorf("the ciphertext is encrypted with %s of transit key %q of %s, below its %s. "+
+		"Lower min_decryption_version to that version, change rewrap_trigger to rewrap the ciphertexts with the latest version and copy rewrapped_ciphertexts into the configuration, then raise it again: %w",
+		version, key, strings.TrimSuffix(v.path, "/"), floor, err)
+}
+
+// minDecryptionVersion returns the min_decryption_version of key, read once
+// per provider run.
+func (v vaultTransit) minDecryptionVersion(ctx context.Context, key string) (int64, error) {
+	if v.minDecryptionVersions != nil {
+		if n, ok := v.minDecryptionVersions.Load(v.path + key); ok {
+			v.stats.cacheHit()
+			return n.(int64), nil
+		}
+	}
 
-	meta, err := kv.GetMetadata(ctx, k)
+	s, err := v.client.Logical().ReadWithContext(ctx, v.path+"keys/"+key)
 	if err != nil {
-		return err
+		return 0, err
+	}
+	if s == nil {
+		return 0, fmt.Errorf("transit key %q not found", key)
+	}
+	n, ok := s.Data["min_decryption_version"].(json.Number)
+	if !ok {
+		return 0, fmt.Errorf("the min_decryption_version of transit key %q is not a number", key)
+	}
+	minVersion, err := n.Int64()
+	if err != nil {
+		return 0, err
 	}
 
-	if managedBy, ok := meta.CustomMetadata["managed_by"]; !ok {
-		return fmt.Errorf("%q is not managed by this Terraform configuration", k)
-	} else if managedBy != v.managedBy {
-		return fmt.Errorf("%q is not managed by this Terraform configuration (managedBy: %q)", k, managedBy)
+	if v.minDecryptionVersions != nil {
+		v.minDecryptionVersions.Store(v.path+key, minVersion)
 	}
+	return minVersion, nil
+}
 
-	if err := kv.DeleteMetadata(ctx, k); err != nil {
-		return err
+func (v vaultTransit) decryptWith(ctx context.Context, key, ciphertext, keyContext string) (sensitive, error) {
+	data := map[string]any{"ciphertext": ciphertext}
+	if keyContext != "" {
+		data["context"] = base64.StdEncoding.EncodeToString([]byte(keyContext))
 	}
 
-	return nil
+	s, err := v.client.Logical().
+		WriteWithContext(
+			ctx,
+			v.path+"decrypt/"+key,
+			data,
+		)
+	if err != nil {
+		return "", err
+	}
+	plaintext, ok := s.Data["plaintext"].(string)
+	if !ok {
+		return "", fmt.Errorf("the value of the decrypted secret is not a string")
+	}
+
+	return sensitive(plaintext), nil
 }
 
-func (v vaultKV) OverwriteManagedbyMeta(ctx context.Context, k string) error {
-	kv := v.client.KVv2(v.path)
-	return kv.PutMetadata(ctx, k, api.KVMetadataPutInput{
-		CustomMetadata: map[string]any{"managed_by": v.managedBy},
-	})
+func (v vaultTransit) Encrypt(ctx context.Context, plaintext string) (string, error) {
+	return v.EncryptDerived(ctx, plaintext, "")
 }
 
-func (v vaultKV) Put(ctx context.Context, k string, value map[string]any) error {
-	kv := v.client.KVv2(v.path)
+// EncryptDerived encrypts plaintext with the given key derivation context, an
+// empty context is not sent.
+func (v vaultTransit) EncryptDerived(ctx context.Context, plaintext, keyContext string) (string, error) {
+	return v.encrypt(ctx, base64.StdEncoding.EncodeToString([]byte(plaintext)), keyContext)
+}
 
-	meta, err := kv.GetMetadata(ctx, k)
-	if err == nil {
-		managedBy, ok := meta.CustomMetadata["managed_by"]
-		if !ok {
-			return fmt.Errorf("%q is not managed by this Terraform configuration", k)
-		} else if managedBy != v.managedBy {
-			return fmt.Errorf("%q is not managed by this Terraform configuration (managedBy: %q)", k, managedBy)
-		}
-	} else if !errors.Is(err, api.ErrSecretNotFound) {
-		return err
+// encrypt encrypts the base64 encoded plaintext.
+func (v vaultTransit) encrypt(ctx context.Context, encoded, keyContext string) (_ string, err error) {
+	ctx, wrap := traceCall(ctx, v.client, "transit encrypt", v.path)
+	defer func() { err = wrap(err) }()
+
+	data := map[string]any{"plaintext": encoded}
+	if keyContext != "" {
+		data["context"] = base64.StdEncoding.EncodeToString([]byte(keyContext))
+	}
+	if v.keyVersion != 0 {
+		data["key_version"] = v.keyVersion
 	}
 
-	err = v.OverwriteManagedbyMeta(ctx, k)
+	s, err := v.client.Logical().
+		WriteWithContext(
+			ctx,
+			v.path+"encrypt/"+v.key,
+			data,
+		)
+	if isBadRequest(err) && v.keyVersion != 0 && strings.Contains(err.Error(), "minimum encryption key version") {
+		return "", fmt.Errorf("transit_key_version %d is below the min_encryption_version of transit key %q, raise it or lower min_encryption_version: %w", v.keyVersion, v.key, err)
+	}
 	if err != nil {
-		return err
+		return "", v.explainTransitError(v.path+"encrypt/"+v.key, "update", v.key, err)
+	}
+	ciphertext, ok := s.Data["ciphertext"].(string)
+	if !ok {
+		return "", fmt.Errorf("the value of the encrypted secret is not a string")
+	}
+	return v.withRoutePrefix(ciphertext), nil
+}
+
+// withRoutePrefix prepends the route prefix of v to ciphertext, if any.
+func (v vaultTransit) withRoutePrefix(ciphertext string) string {
+	if v.routePrefix == "" {
+		return ciphertext
 	}
+	return v.routePrefix + ":" + ciphertext
+}
 
-	_, err = kv.Put(ctx, k, value)
+// Rewrap rebinds ciphertext to the latest version of the key, or to
+// keyVersion, without exposing the plaintext. Ciphertexts of a fallback key
+// are decrypted and encrypted again with the key, routed ciphertexts are
+// rewrapped by their route.
+func (v vaultTransit) Rewrap(ctx context.Context, ciphertext, keyContext string) (string, error) {
+	routed, ciphertext, err := v.route(ciphertext)
 	if err != nil {
-		return err
+		return "", err
+	}
+	return routed.rewrap(ctx, ciphertext, keyContext)
+}
+
+func (v vaultTransit) rewrap(ctx context.Context, ciphertext, keyContext string) (_ string, err error) {
+	ctx, wrap := traceCall(ctx, v.client, "transit rewrap", v.path)
+	defer func() { err = wrap(err) }()
+
+	data := map[string]any{"ciphertext": ciphertext}
+	if keyContext != "" {
+		data["context"] = base64.StdEncoding.EncodeToString([]byte(keyContext))
+	}
+	if v.keyVersion != 0 {
+		data["key_version"] = v.keyVersion
 	}
 
-	return nil
+	s, err := v.client.Logical().
+		WriteWithContext(
+			ctx,
+			v.path+"rewrap/"+v.key,
+			data,
+		)
+	if isBadRequest(err) && len(v.fallbackKeys) > 0 {
+		plaintext, err := v.DecryptDerived(ctx, ciphertext, keyContext)
+		if err != nil {
+			return "", err
+		}
+		return v.encrypt(ctx, plaintext.reveal(), keyContext)
+	}
+	if err != nil {
+		return "", v.explainTransitError(v.path+"rewrap/"+v.key, "update", v.key, err)
+	}
+	rewrapped, ok := s.Data["ciphertext"].(string)
+	if !ok {
+		return "", fmt.Errorf("the value of the rewrapped secret is not a string")
+	}
+	return v.withRoutePrefix(rewrapped), nil
 }
 
-type vaultTransit struct {
-	client *vault.Client
-	path   string
-	key    string
+// RandomBytes returns length random bytes generated by Vault, encoded in
+// format (base64 or hex).
+func (v vaultTransit) RandomBytes(ctx context.Context, length int64, format string) (_ string, err error) {
+	ctx, wrap := traceCall(ctx, v.client, "transit random bytes", v.path)
+	defer func() { err = wrap(err) }()
+
+	s, err := v.client.Logical().
+		WriteWithContext(
+			ctx,
+			v.path+"random/"+strconv.FormatInt(length, 10),
+			map[string]any{"format": format},
+		)
+	if err != nil {
+		return "", err
+	}
+	randomBytes, ok := s.Data["random_bytes"].(string)
+	if !ok {
+		return "", fmt.Errorf("the value of the random bytes is not a string")
+	}
+	return randomBytes, nil
+}
+
+// HMAC returns the HMAC of input computed with the transit key.
+func (v vaultTransit) HMAC(ctx context.Context, input string) (string, error) {
+	return v.HMACWithAlgorithm(ctx, input, "")
 }
 
-func (v vaultTransit) Decrypt(ctx context.Context, ciphertext string) (string, error) {
+// HMACWithAlgorithm returns the HMAC of input computed with the transit key
+// and algorithm, e.g. "sha2-512". Vault defaults to sha2-256 when algorithm is
+// empty.
+func (v vaultTransit) HMACWithAlgorithm(ctx context.Context, input, algorithm string) (_ string, err error) {
+	ctx, wrap := traceCall(ctx, v.client, "transit hmac", v.path)
+	defer func() { err = wrap(err) }()
+
+	body := map[string]any{"input": base64.StdEncoding.EncodeToString([]byte(input))}
+	if algorithm != "" {
+		body["algorithm"] = algorithm
+	}
 	s, err := v.client.Logical().
 		WriteWithContext(
 			ctx,
-			v.path+"decrypt/"+v.key,
-			map[string]any{"ciphertext": ciphertext},
+			v.path+"hmac/"+v.key,
+			body,
 		)
 	if err != nil {
 		return "", err
 	}
-	plaintext, ok := s.Data["plaintext"].(string)
+	hmac, ok := s.Data["hmac"].(string)
 	if !ok {
-		return "", fmt.Errorf("the value of the decrypted secret is not a string")
+		return "", fmt.Errorf("the value of the HMAC is not a string")
 	}
+	return hmac, nil
+}
 
-	return plaintext, nil
+// VerifyHMAC reports whether hmac is the HMAC of input, whatever the version
+// of the transit key it was computed with.
+func (v vaultTransit) VerifyHMAC(ctx context.Context, input, hmac string) (_ bool, err error) {
+	ctx, wrap := traceCall(ctx, v.client, "transit hmac verification", v.path)
+	defer func() { err = wrap(err) }()
+
+	encoded := base64.StdEncoding.EncodeToString([]byte(input))
+	s, err := v.client.Logical().
+		WriteWithContext(
+			ctx,
+			v.path+"verify/"+v.key,
+			map[string]any{"input": encoded, "hmac": hmac},
+		)
+	if err != nil {
+		return false, err
+	}
+	valid, ok := s.Data["valid"].(bool)
+	if !ok {
+		return false, fmt.Errorf("the HMAC verification result is not a boolean")
+	}
+	return valid, nil
 }
 
-func (v vaultTransit) Encrypt(ctx context.Context, plaintext string) (string, error) {
-	encoded := base64.StdEncoding.EncodeToString([]byte(plaintext))
+// signingOptions tune a transit signature, the zero value signs with the
+// signing key and the defaults of Vault for its type.
+type signingOptions struct {
+	// key replaces the signing key.
+	key string
+	// hashAlgorithm hashes the input, e.g. "sha2-512", ed25519 keys ignore it.
+	hashAlgorithm string
+	// prehashed tells the input is already hashed with hashAlgorithm.
+	prehashed bool
+}
+
+// signingRequest returns the body of a sign or verify request for input, and the key
+// it is sent to.
+func (v vaultTransit) signingRequest(input string, opts signingOptions) (string, map[string]any) {
+	key := v.signingKey
+	if opts.key != "" {
+		key = opts.key
+	}
+	body := map[string]any{"input": base64.StdEncoding.EncodeToString([]byte(input))}
+	if opts.hashAlgorithm != "" {
+		body["hash_algorithm"] = opts.hashAlgorithm
+	}
+	if opts.prehashed {
+		body["prehashed"] = true
+	}
+	return key, body
+}
+
+// Sign returns the signature of input computed with the signing key.
+func (v vaultTransit) Sign(ctx context.Context, input string) (string, error) {
+	return v.SignWithOptions(ctx, input, signingOptions{})
+}
+
+// SignWithOptions returns the signature of input computed as opts tell.
+func (v vaultTransit) SignWithOptions(ctx context.Context, input string, opts signingOptions) (_ string, err error) {
+	ctx, wrap := traceCall(ctx, v.client, "transit sign", v.path)
+	defer func() { err = wrap(err) }()
+
+	key, body := v.signingRequest(input, opts)
 	s, err := v.client.Logical().
 		WriteWithContext(
 			ctx,
-			v.path+"encrypt/"+v.key,
-			map[string]any{"plaintext": encoded},
+			v.path+"sign/"+key,
+			body,
 		)
 	if err != nil {
 		return "", err
 	}
-	ciphertext, ok := s.Data["ciphertext"].(string)
+	signature, ok := s.Data["signature"].(string)
 	if !ok {
-		return "", fmt.Errorf("the value of the encrypted secret is not a string")
+		return "", fmt.Errorf("the value of the signature is not a string")
+	}
+	return signature, nil
+}
+
+// Verify reports whether signature is a signature of input by the signing
+// key, whatever the version of the key it was computed with.
+func (v vaultTransit) Verify(ctx context.Context, input, signature string) (bool, error) {
+	return v.VerifyWithOptions(ctx, input, signature, signingOptions{})
+}
+
+// VerifyWithOptions reports whether signature is a signature of input
+// computed as opts tell.
+func (v vaultTransit) VerifyWithOptions(ctx context.Context, input, signature string, opts signingOptions) (_ bool, err error) {
+	ctx, wrap := traceCall(ctx, v.client, "transit signature verification", v.path)
+	defer func() { err = wrap(err) }()
+
+	key, body := v.signingRequest(input, opts)
+	body["signature"] = signature
+	s, err := v.client.Logical().
+		WriteWithContext(
+			ctx,
+			v.path+"verify/"+key,
+			body,
+		)
+	if err != nil {
+		return false, err
 	}
-	return ciphertext, nil
+	valid, ok := s.Data["valid"].(bool)
+	if !ok {
+		return false, fmt.Errorf("the signature verification result is not a boolean")
+	}
+	return valid, nil
 }
 
 var vaultConfigSchema = schema.SingleNestedAttribute{
 	Attributes: map[string]schema.Attribute{
-		"endpoint":     schema.StringAttribute{Required: true},
-		"ca_cert_file": schema.StringAttribute{Optional: true},
+		"endpoint": schema.StringAttribute{
+			Required:    true,
+			Description: "Address of the Vault server, an `https://`, `unix://` or, with `allow_http`, `http://` URL",
+		},
+		"ca_cert_file": schema.StringAttribute{
+			Optional:    true,
+			Description: "Path to a file on local disk that contains the PEM-encoded CA certificate used to verify the Vault server",
+		},
 		"auth_login_cert": schema.SingleNestedAttribute{
 			Attributes: map[string]schema.Attribute{
 				"mount": schema.StringAttribute{
@@ -136,30 +1350,102 @@ var vaultConfigSchema = schema.SingleNestedAttribute{
 
 				"cert_file": schema.StringAttribute{
 					Required:    true,
-					Description: "Path to a file on local disk that contains the PEM-encoded certificate to present to the server",
+					Description: "Path to a file on local disk that contains the PEM-encoded certificate to present to the server. It is read again on every login, and shortly before the certificate read last expires, so it can rotate while the provider runs",
 				},
 
 				"key_file": schema.StringAttribute{
 					Required:    true,
-					Description: "Path to a file on local disk that contains the PEM-encoded private key for which the authentication certificate was issued",
+					Description: "Path to a file on local disk that contains the PEM-encoded private key for which the authentication certificate was issued, read again along with `cert_file`",
 				},
 			},
 			Optional: true,
 		},
-		"token": schema.StringAttribute{Optional: true},
+		"namespace": schema.StringAttribute{
+			Optional:    true,
+			Description: "Namespace of every request, e.g. `admin/team-a`. Defaults to `VAULT_NAMESPACE`, then to `admin` on HCP Vault Dedicated. It is checked to exist while configuring the provider",
+		},
+		"hcp": schema.BoolAttribute{
+			Optional:    true,
+			Description: "Whether the server is an HCP Vault Dedicated cluster, whose namespace defaults to `admin`. Defaults to true for endpoints under `hashicorp.cloud`",
+		},
+		"token": schema.StringAttribute{
+			Optional:    true,
+			Description: "Vault token, ignored when `auth_login_cert` is set",
+		},
+		"token_file": schema.StringAttribute{
+			Optional:    true,
+			Description: "Path to a file holding the Vault token, e.g. a Vault Agent sink. It is read again whenever it changes, and when Vault denies a request. Conflicts with `token` and `auth_login_cert`",
+		},
+		"max_idle_connections": schema.Int64Attribute{
+			Optional:    true,
+			Description: "Idle connections kept open to the server, 0 for no limit. Defaults to the HTTP client default",
+			Validators:  []validator.Int64{int64AtLeastValidator{min: 0}},
+		},
+		"max_idle_connections_per_host": schema.Int64Attribute{
+			Optional:    true,
+			Description: "Idle connections kept open per host, e.g. below the per-client connection limit of a load balancer. Defaults to the HTTP client default",
+			Validators:  []validator.Int64{int64AtLeastValidator{min: 1}},
+		},
+		"max_connections_per_host": schema.Int64Attribute{
+			Optional:    true,
+			Description: "Connections open at once per host, active ones included, 0 for no limit: requests beyond it wait for a connection. Defaults to no limit",
+			Validators:  []validator.Int64{int64AtLeastValidator{min: 0}},
+		},
 	},
-	Required: true,
+	Required:    true,
+	Description: "The standard VAULT_* environment variables (e.g. VAULT_CLIENT_TIMEOUT, VAULT_MAX_RETRIES, VAULT_SKIP_VERIFY, VAULT_TLS_SERVER_NAME, VAULT_RATE_LIMIT) apply to both Vault clients, explicitly configured attributes take precedence over them",
 }
 
 type VaultConfigModel struct {
 	Endpoint      string         `tfsdk:"endpoint"`
 	CACertFile    *string        `tfsdk:"ca_cert_file"`
 	Token         *string        `tfsdk:"token"`
+	TokenFile     *string        `tfsdk:"token_file"`
 	AuthLoginCert *AuthLoginCert `tfsdk:"auth_login_cert"`
+	Namespace     *string        `tfsdk:"namespace"`
+	HCP           *bool          `tfsdk:"hcp"`
+
+	MaxIdleConnections        *int64 `tfsdk:"max_idle_connections"`
+	MaxIdleConnectionsPerHost *int64 `tfsdk:"max_idle_connections_per_host"`
+	MaxConnectionsPerHost     *int64 `tfsdk:"max_connections_per_host"`
+
+	// waitForUnseal is how long to wait for a sealed or uninitialized Vault
+	// before giving up, set from wait_for_unseal_seconds.
+	waitForUnseal time.Duration
+	// loginRetries and loginRetryInterval retry a login failing on a
+	// network error or a 5xx, set from login_retries and
+	// login_retry_interval.
+	loginRetries       int
+	loginRetryInterval time.Duration
+	// userAgent identifies the provider in the Vault audit logs.
+	userAgent string
+	// stats counts the calls of the client.
+	stats *operationStats
+}
+
+// limitConnections sets the connection limits of config on transport, unset
+// limits keep the defaults of transport.
+func (config VaultConfigModel) limitConnections(transport *http.Transport) {
+	if config.MaxIdleConnections != nil {
+		transport.MaxIdleConns = int(*config.MaxIdleConnections)
+	}
+	if config.MaxIdleConnectionsPerHost != nil {
+		transport.MaxIdleConnsPerHost = int(*config.MaxIdleConnectionsPerHost)
+	}
+	if config.MaxConnectionsPerHost != nil {
+		transport.MaxConnsPerHost = int(*config.MaxConnectionsPerHost)
+	}
 }
 
 func newClient(ctx context.Context, config VaultConfigModel) (*api.Client, error) {
-	cfg := &vault.Config{Address: config.Endpoint}
+	// DefaultConfig reads the VAULT_* environment variables, anything set
+	// explicitly below takes precedence.
+	cfg := vault.DefaultConfig()
+	if cfg.Error != nil {
+		return nil, fmt.Errorf("failed to read vault environment: %w", cfg.Error)
+	}
+	cfg.Address = config.Endpoint
+
 	if config.CACertFile != nil {
 		err := cfg.ConfigureTLS(&vault.TLSConfig{
 			CACert: *config.CACertFile,
@@ -169,25 +1455,189 @@ func newClient(ctx context.Context, config VaultConfigModel) (*api.Client, error
 		}
 	}
 
+	// The cert auth login client clones the transport, limits included.
+	if transport, ok := cfg.HttpClient.Transport.(*http.Transport); ok {
+		config.limitConnections(transport)
+	}
+
+	cfg.HttpClient.Transport = &traceTransport{base: cfg.HttpClient.Transport}
+	if config.stats != nil {
+		cfg.HttpClient.Transport = &statsTransport{base: cfg.HttpClient.Transport, stats: config.stats}
+		checkRetry := cfg.CheckRetry
+		if checkRetry == nil {
+			checkRetry = api.DefaultRetryPolicy
+		}
+		cfg.CheckRetry = config.stats.checkRetry(checkRetry)
+	}
+
+	var file *tokenFile
+	if config.TokenFile != nil {
+		if config.Token != nil || config.AuthLoginCert != nil {
+			return nil, errors.New("token_file conflicts with token and auth_login_cert")
+		}
+		file = &tokenFile{path: *config.TokenFile}
+		cfg.HttpClient.Transport = &tokenFileTransport{base: cfg.HttpClient.Transport, file: file}
+	}
+
 	client, err := vault.NewClient(cfg)
 	if err != nil {
 		return nil, err
 	}
+	if config.userAgent != "" {
+		client.AddHeader("User-Agent", config.userAgent)
+		client.SetCloneHeaders(true)
+	}
+
+	if config.waitForUnseal > 0 {
+		if err := waitForUnseal(ctx, client, config.waitForUnseal); err != nil {
+			return nil, err
+		}
+	}
+
+	// The namespace set by VAULT_NAMESPACE is already on the client, only
+	// namespace takes precedence over it.
+	if config.Namespace != nil {
+		client.SetNamespace(strings.Trim(*config.Namespace, "/"))
+	} else if client.Namespace() == "" && config.isHCP() {
+		client.SetNamespace(hcpNamespace)
+	}
 
 	if config.Token != nil {
 		client.SetToken(*config.Token)
 	}
 
+	if file != nil {
+		token, err := file.read()
+		if err != nil {
+			return nil, err
+		}
+		client.SetToken(token)
+	}
+
 	if config.AuthLoginCert != nil {
-		_, err := client.Auth().Login(ctx, config.AuthLoginCert)
+		login := &certLogin{AuthLoginCert: *config.AuthLoginCert}
+		secret, err := loginWithRetry(ctx, client, login, config.loginRetries, config.loginRetryInterval)
 		if err != nil {
 			return nil, fmt.Errorf("failed to login using the cert auth method: %w", err)
 		}
+
+		// The token must outlive Configure, keep the logger but not the
+		// cancellation of its context.
+		go login.keepTokenAlive(context.WithoutCancel(ctx), client, secret)
+	}
+
+	if ns := client.Namespace(); ns != "" {
+		if err := checkNamespace(ctx, client, ns); err != nil {
+			return nil, err
+		}
 	}
 
 	return client, nil
 }
 
+// hcpNamespace is the top-level namespace of HCP Vault Dedicated clusters,
+// the root namespace is not reachable there.
+const hcpNamespace = "admin"
+
+// isHCP reports whether the server is an HCP Vault Dedicated cluster, from
+// hcp or else from the endpoint.
+func (config VaultConfigModel) isHCP() bool {
+	if config.HCP != nil {
+		return *config.HCP
+	}
+	u, err := url.Parse(config.Endpoint)
+	return err == nil && strings.HasSuffix(u.Hostname(), ".hashicorp.cloud")
+}
+
+// checkNamespace probes ns by looking the token up, which every token may
+// do, so that a missing namespace fails here rather than as 404s on every
+// secret.
+func checkNamespace(ctx context.Context, client *api.Client, ns string) error {
+	_, err := client.Auth().Token().LookupSelfWithContext(ctx)
+	switch {
+	case err == nil:
+		return nil
+	case isNotFound(err):
+		return fmt.Errorf("namespace %q does not exist on %s: %w", ns, client.Address(), err)
+	case isPermissionDenied(err):
+		return fmt.Errorf("the token is denied in namespace %q on %s, it may not exist or the token may belong to another namespace (HCP Vault Dedicated tokens usually belong to %q): %w", ns, client.Address(), hcpNamespace, err)
+	}
+	return fmt.Errorf("failed to check namespace %q on %s: %w", ns, client.Address(), err)
+}
+
+// waitForUnseal polls the seal status of client until Vault is initialized
+// and unsealed, backing off between attempts, for at most budget.
+func waitForUnseal(ctx context.Context, client *api.Client, budget time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, budget)
+	defer cancel()
+
+	delay := time.Second
+	for {
+		status, err := client.Sys().SealStatusWithContext(ctx)
+		switch {
+		case err != nil:
+			tflog.Info(ctx, "waiting for Vault to answer", map[string]any{"address": client.Address(), "error": errorDetail(err)})
+		case !status.Initialized:
+			tflog.Info(ctx, "waiting for Vault to be initialized", map[string]any{"address": client.Address()})
+		case status.Sealed:
+			tflog.Info(ctx, "waiting for Vault to be unsealed", map[string]any{
+				"address":  client.Address(),
+				"progress": fmt.Sprintf("%d/%d", status.Progress, status.T),
+			})
+		default:
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			if err != nil {
+				return fmt.Errorf("vault did not become available within %s: %w", budget, err)
+			}
+			return fmt.Errorf("vault is still sealed or uninitialized after %s", budget)
+		case <-time.After(delay):
+		}
+		delay = min(2*delay, 30*time.Second)
+	}
+}
+
+// defaultLoginRetries and defaultLoginRetryInterval ride out a Vault that
+// comes up a few seconds after the runner.
+const (
+	defaultLoginRetries       = 3
+	defaultLoginRetryInterval = time.Second
+)
+
+// loginWithRetry logs client in with method, trying again up to retries times
+// when the login fails in a way a Vault still coming up explains. Denied or
+// invalid credentials fail at once. The delay between attempts starts at
+// interval and doubles, up to 30s.
+func loginWithRetry(ctx context.Context, client *api.Client, method api.AuthMethod, retries int, interval time.Duration) (*api.Secret, error) {
+	delay := interval
+	for attempt := 1; ; attempt++ {
+		secret, err := client.Auth().Login(ctx, method)
+		if err == nil || attempt > retries || classifyError(err) != errorClassTransient {
+			return secret, err
+		}
+
+		tflog.Warn(ctx, "login failed, retrying", map[string]any{
+			"address": client.Address(),
+			"attempt": fmt.Sprintf("%d/%d", attempt, retries+1),
+			"delay":   delay.String(),
+			"error":   errorDetail(err),
+		})
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%w, gave up retrying: %w", err, ctx.Err())
+		case <-time.After(delay):
+		}
+		delay = min(2*delay, 30*time.Second)
+	}
+}
+
+// certificateReloadMargin is how long before its expiry a client certificate
+// is read again from its files, which may already hold its renewal.
+const certificateReloadMargin = 5 * time.Minute
+
 type AuthLoginCert struct {
 	Mount    string `tfsdk:"mount"`
 	Name     string `tfsdk:"name"`
@@ -195,37 +1645,200 @@ type AuthLoginCert struct {
 	KeyFile  string `tfsdk:"key_file"`
 }
 
-// Login using the cert authentication engine.
-func (l *AuthLoginCert) Login(ctx context.Context, client *api.Client) (*api.Secret, error) {
-	c, err := client.Clone()
+// certLogin logs in with the cert authentication engine as configured by
+// AuthLoginCert. Its state is kept out of the model, so that configurations
+// only compare on their attributes.
+type certLogin struct {
+	AuthLoginCert
+
+	// mu guards loginClient, which presents the client certificate and is
+	// kept so logging in again reuses its transport, and certificate, the
+	// client certificate as last read from CertFile and KeyFile. The token
+	// renewal logs in again from another goroutine.
+	mu          sync.Mutex
+	loginClient *api.Client
+	certificate *tls.Certificate
+}
+
+// Login using the cert authentication engine. The certificate files are read
+// on every login: they rotate under a long-lived process, e.g. in Kubernetes.
+func (l *certLogin) Login(ctx context.Context, client *api.Client) (*api.Secret, error) {
+	if _, err := l.loadCertificate(); err != nil {
+		return nil, err
+	}
+	loginClient, err := l.client(client)
+	if err != nil {
+		return nil, err
+	}
+
+	return loginClient.Logical().WriteWithContext(
+		ctx,
+		"auth/"+l.Mount+"/login",
+		map[string]any{"name": l.Name},
+	)
+}
+
+// client returns the login client, a copy of client made on the first login.
+func (l *certLogin) client(client *api.Client) (*api.Client, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.loginClient == nil {
+		c, err := l.newLoginClient(client)
+		if err != nil {
+			return nil, err
+		}
+		l.loginClient = c
+	}
+	return l.loginClient, nil
+}
+
+// loadCertificate reads the client certificate from CertFile and KeyFile and
+// keeps it for the handshakes of the login client. An expired certificate is
+// an error, Vault would only deny it.
+func (l *certLogin) loadCertificate() (*tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(l.CertFile, l.KeyFile)
 	if err != nil {
 		return nil, err
 	}
+	if cert.Leaf == nil {
+		if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+			return nil, err
+		}
+	}
+	if time.Now().After(cert.Leaf.NotAfter) {
+		return nil, fmt.Errorf("the client certificate in %s expired at %s", l.CertFile, cert.Leaf.NotAfter.Format(time.RFC3339))
+	}
+
+	l.mu.Lock()
+	l.certificate = &cert
+	l.mu.Unlock()
+	return &cert, nil
+}
+
+// clientCertificate returns the certificate to present, read again from the
+// files when the kept one expires within certificateReloadMargin. The kept one
+// is still presented when reading them fails.
+func (l *certLogin) clientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	l.mu.Lock()
+	cert := l.certificate
+	l.mu.Unlock()
+	if cert != nil && time.Until(cert.Leaf.NotAfter) > certificateReloadMargin {
+		return cert, nil
+	}
+
+	fresh, err := l.loadCertificate()
+	if err != nil && cert == nil {
+		return nil, err
+	}
+	if err != nil {
+		return cert, nil
+	}
+	return fresh, nil
+}
 
+// newLoginClient returns a copy of client presenting the client certificate.
+func (l *certLogin) newLoginClient(client *api.Client) (*api.Client, error) {
 	config := client.CloneConfig()
 	tlsConfig := config.TLSConfig()
 	if tlsConfig == nil {
 		return nil, fmt.Errorf("clone api.Config's TLSConfig is nil")
 	}
+	tlsConfig.GetClientCertificate = l.clientCertificate
 
-	clientCert, err := tls.LoadX509KeyPair(l.CertFile, l.KeyFile)
+	// CloneConfig copies the http.Client but not its transport, which is
+	// shared with every other client built from the same config. Clone the
+	// transport so presenting the client certificate does not leak into (or
+	// race with) the shared one.
+	transport, err := loginTransport(config.HttpClient.Transport, tlsConfig)
 	if err != nil {
 		return nil, err
 	}
+	config.HttpClient.Transport = transport
 
-	tlsConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
-		return &clientCert, nil
+	c, err := api.NewClient(config)
+	if err != nil {
+		return nil, err
 	}
+	c.ClearToken()
+	// Headers are not part of the config, e.g. the User-Agent.
+	c.SetHeaders(client.Headers())
+
+	return c, nil
+}
+
+// layeredTransport is a round tripper of ours layered over another one, e.g.
+// to count or authenticate requests.
+type layeredTransport interface {
+	http.RoundTripper
+	// under returns the transport it is layered over.
+	under() http.RoundTripper
+	// over returns a copy of it layered over base.
+	over(base http.RoundTripper) http.RoundTripper
+}
 
-	switch t := config.HttpClient.Transport.(type) {
+// loginTransport returns a copy of rt, down to the *http.Transport at the
+// bottom of its layers, sending requests with tlsConfig on a new connection
+// each: the client certificate is only presented when connecting, and it may
+// have been read again since the last login. No transport stands for
+// http.DefaultTransport, as in http.Client. A transport of another type cannot
+// be copied without losing what it does, e.g. a proxy or logging, and is an
+// error.
+func loginTransport(rt http.RoundTripper, tlsConfig *tls.Config) (http.RoundTripper, error) {
+	switch t := rt.(type) {
+	case layeredTransport:
+		under, err := loginTransport(t.under(), tlsConfig)
+		if err != nil {
+			return nil, err
+		}
+		return t.over(under), nil
 	case *http.Transport:
-		t.TLSClientConfig = tlsConfig
+		transport := t.Clone()
+		transport.TLSClientConfig = tlsConfig
+		transport.DisableKeepAlives = true
+		return transport, nil
+	case nil:
+		return loginTransport(http.DefaultTransport, tlsConfig)
 	default:
-		return nil, fmt.Errorf("HTTPClient has unsupported Transport type %T", t)
+		return nil, fmt.Errorf("cert auth cannot present the client certificate through a transport of type %T, only through an *http.Transport", rt)
 	}
+}
 
-	return c.Logical().Write(
-		"auth/"+l.Mount+"/login",
-		map[string]any{"name": l.Name},
-	)
+// keepTokenAlive renews the token of client, obtained from secret, for as long
+// as Vault allows it and then logs in again, with the certificate files as
+// they are then, so the token outlives long applies. It returns when logging
+// in again fails.
+func (l *certLogin) keepTokenAlive(ctx context.Context, client *api.Client, secret *api.Secret) {
+	for secret != nil && secret.Auth != nil && secret.Auth.LeaseDuration > 0 {
+		watcher, err := client.NewLifetimeWatcher(&api.LifetimeWatcherInput{
+			Secret:        secret,
+			RenewBehavior: api.RenewBehaviorIgnoreErrors,
+		})
+		if err != nil {
+			tflog.Warn(ctx, "cannot watch the cert auth token lifetime", map[string]any{"error": errorDetail(err)})
+			return
+		}
+
+		go watcher.Start()
+	watch:
+		for {
+			select {
+			case err := <-watcher.DoneCh():
+				if err != nil {
+					tflog.Debug(ctx, "cert auth token renewal stopped", map[string]any{"error": errorDetail(err)})
+				}
+				break watch
+			case <-watcher.RenewCh():
+				tflog.Debug(ctx, "renewed the cert auth token")
+			}
+		}
+		watcher.Stop()
+
+		secret, err = client.Auth().Login(ctx, l)
+		if err != nil {
+			tflog.Error(ctx, "failed to log in again with the cert auth method", map[string]any{"error": errorDetail(err)})
+			return
+		}
+		tflog.Debug(ctx, "logged in again with the cert auth method")
+	}
 }
@@ -0,0 +1,248 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// errorClass tells what a failed Vault call means, and whether trying it
+// again may help.
+type errorClass int
+
+const (
+	errorClassUnknown errorClass = iota
+	// errorClassTransient is Vault, or its load balancer, unreachable,
+	// timing out or answering with a 5xx.
+	errorClassTransient
+	errorClassDenied
+	errorClassNotFound
+	// errorClassInvalid is any other 4xx, e.g. bad credentials or a
+	// ciphertext the key cannot decrypt.
+	errorClassInvalid
+	errorClassCanceled
+)
+
+func (c errorClass) String() string {
+	switch c {
+	case errorClassTransient:
+		return "transient"
+	case errorClassDenied:
+		return "permission denied"
+	case errorClassNotFound:
+		return "not found"
+	case errorClassInvalid:
+		return "invalid request"
+	case errorClassCanceled:
+		return "canceled"
+	}
+	return "unknown"
+}
+
+// classifyError returns the class of err, from a call to Vault.
+func classifyError(err error) errorClass {
+	var respErr *api.ResponseError
+	if errors.As(err, &respErr) {
+		switch {
+		case respErr.StatusCode >= http.StatusInternalServerError:
+			return errorClassTransient
+		case respErr.StatusCode == http.StatusForbidden:
+			return errorClassDenied
+		case respErr.StatusCode == http.StatusNotFound:
+			return errorClassNotFound
+		}
+		return errorClassInvalid
+	}
+
+	var netErr net.Error
+	var dnsErr *net.DNSError
+	switch {
+	case errors.Is(err, context.Canceled):
+		return errorClassCanceled
+	case errors.Is(err, syscall.ECONNREFUSED), errors.Is(err, syscall.ECONNRESET), errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, io.EOF):
+		return errorClassTransient
+	case errors.As(err, &dnsErr):
+		if dnsErr.IsNotFound || dnsErr.IsTemporary || dnsErr.IsTimeout {
+			return errorClassTransient
+		}
+	case errors.As(err, &netErr):
+		if netErr.Timeout() {
+			return errorClassTransient
+		}
+	}
+	return errorClassUnknown
+}
+
+// vaultError is a failed call to Vault with what is needed to find it in the
+// Vault audit log, appended to diagnostics by errorDetail.
+type vaultError struct {
+	// operation is what the provider was doing, e.g. "kv put".
+	operation string
+	mount     string
+	namespace string
+	// status is 0 when Vault did not answer.
+	status int
+	// requestID is only known when Vault sent one with the error, e.g. for
+	// a batch call failing on some of its items.
+	requestID string
+	class     errorClass
+	err       error
+}
+
+func (e *vaultError) Error() string {
+	return e.err.Error()
+}
+
+func (e *vaultError) Unwrap() error {
+	return e.err
+}
+
+// context returns the block describing the call, one "name: value" per line.
+func (e *vaultError) context() string {
+	lines := []string{"Context:", "  operation: " + e.operation}
+	if e.mount != "" {
+		lines = append(lines, "  mount: "+e.mount)
+	}
+	namespace := e.namespace
+	if namespace == "" {
+		namespace = "root"
+	}
+	lines = append(lines, "  namespace: "+namespace)
+	if e.status != 0 {
+		lines = append(lines, fmt.Sprintf("  status: %d", e.status))
+	}
+	if e.requestID != "" {
+		lines = append(lines, "  request_id: "+e.requestID)
+	}
+	lines = append(lines, "  class: "+e.class.String())
+	return strings.Join(lines, "\n")
+}
+
+// asVaultError returns the vaultError of err. A bare Vault response error is
+// described from the request it answers.
+func asVaultError(err error) (*vaultError, bool) {
+	var vaultErr *vaultError
+	if errors.As(err, &vaultErr) {
+		return vaultErr, true
+	}
+
+	var respErr *api.ResponseError
+	if !errors.As(err, &respErr) {
+		return nil, false
+	}
+	operation := respErr.HTTPMethod
+	if u, err := url.Parse(respErr.URL); err == nil {
+		operation += " " + u.Path
+	}
+	// Only the client knows its namespace, the error rarely carries it.
+	namespace := respErr.NamespacePath
+	if namespace == "" {
+		namespace = "unknown"
+	}
+	return &vaultError{
+		operation: operation,
+		namespace: namespace,
+		status:    respErr.StatusCode,
+		class:     classifyError(err),
+		err:       err,
+	}, true
+}
+
+// callTrace collects the request ID of the failed responses of a call, it
+// travels in the context of the requests.
+type callTrace struct {
+	mu        sync.Mutex
+	requestID string
+}
+
+type callTraceKey struct{}
+
+// traceCall returns ctx carrying a trace for a call to Vault, and the function
+// wrapping the error of the call in a vaultError describing operation on
+// mount. Errors that did not come from Vault, e.g. a refused ownership check,
+// and errors already wrapped are returned as is.
+func traceCall(ctx context.Context, client *api.Client, operation, mount string) (context.Context, func(error) error) {
+	trace := &callTrace{}
+	ctx = context.WithValue(ctx, callTraceKey{}, trace)
+
+	return ctx, func(err error) error {
+		var respErr *api.ResponseError
+		var urlErr *url.Error
+		var vaultErr *vaultError
+		if err == nil || errors.As(err, &vaultErr) || (!errors.As(err, &respErr) && !errors.As(err, &urlErr)) {
+			return err
+		}
+
+		e := &vaultError{
+			operation: operation,
+			mount:     strings.TrimSuffix(mount, "/"),
+			namespace: client.Namespace(),
+			class:     classifyError(err),
+			err:       err,
+		}
+		if respErr != nil {
+			e.status = respErr.StatusCode
+			if respErr.NamespacePath != "" {
+				e.namespace = respErr.NamespacePath
+			}
+		}
+		trace.mu.Lock()
+		e.requestID = trace.requestID
+		trace.mu.Unlock()
+		return e
+	}
+}
+
+// maxTracedBodyBytes bounds the error responses read for their request ID.
+const maxTracedBodyBytes = 1 << 20
+
+// traceTransport records the request ID of error responses in the trace of
+// the request, if any. Vault only sends one with some errors.
+type traceTransport struct {
+	base http.RoundTripper
+}
+
+func (t *traceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	trace, ok := req.Context().Value(callTraceKey{}).(*callTrace)
+	if err != nil || !ok || resp.StatusCode < http.StatusBadRequest || resp.Body == nil {
+		return resp, err
+	}
+
+	body, readErr := io.ReadAll(io.LimitReader(resp.Body, maxTracedBodyBytes))
+	rest := resp.Body
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), rest), rest}
+	if readErr != nil {
+		return resp, nil
+	}
+
+	var parsed struct {
+		RequestID string `json:"request_id"`
+	}
+	if json.Unmarshal(body, &parsed) == nil && parsed.RequestID != "" {
+		trace.mu.Lock()
+		trace.requestID = parsed.RequestID
+		trace.mu.Unlock()
+	}
+	return resp, nil
+}
+
+func (t *traceTransport) under() http.RoundTripper { return t.base }
+
+func (t *traceTransport) over(base http.RoundTripper) http.RoundTripper {
+	return &traceTransport{base: base}
+}
@@ -0,0 +1,631 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// testVaultServer serves the in-memory fake over TLS, with the cert auth
+// method mounted at auth/cert, as a stand-in for a real Vault server.
+type testVaultServer struct {
+	*httptest.Server
+	backend *inMemoryVault
+
+	// CACertFile verifies the server, CertFile and KeyFile hold a client
+	// certificate the cert auth method accepts.
+	CACertFile string
+	CertFile   string
+	KeyFile    string
+
+	// ca and caKey issue the client certificates.
+	ca    *x509.Certificate
+	caKey *ecdsa.PrivateKey
+
+	// logins counts the successful cert auth logins.
+	logins atomic.Int64
+	// presented is the client certificate of the latest login.
+	presented atomic.Pointer[x509.Certificate]
+	// inspect, when set, sees the path and the body of every request
+	// served by the backend.
+	inspect func(p string, body map[string]any)
+	// loginStarted, when set, receives a value when a login request
+	// arrives. The request then hangs until its client gives up.
+	loginStarted chan struct{}
+}
+
+// testVaultToken is the token of the cert auth logins.
+const testVaultToken = "cert-token"
+
+func newTestVaultServer(t testing.TB) *testVaultServer {
+	t.Helper()
+
+	dir := t.TempDir()
+	ca, caKey := newTestCertificate(t, nil, nil, func(c *x509.Certificate) {
+		c.IsCA = true
+		c.KeyUsage = x509.KeyUsageCertSign
+		c.BasicConstraintsValid = true
+	})
+	server, serverKey := newTestCertificate(t, ca, caKey, func(c *x509.Certificate) {
+		c.IPAddresses = []net.IP{net.ParseIP("127.0.0.1")}
+		c.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	})
+
+	s := &testVaultServer{
+		backend:    newInMemoryVault("transit/", "secret"),
+		CACertFile: writePEM(t, dir, "ca.pem", "CERTIFICATE", ca.Raw),
+		CertFile:   filepath.Join(dir, "client.pem"),
+		KeyFile:    filepath.Join(dir, "client-key.pem"),
+		ca:         ca,
+		caKey:      caKey,
+	}
+	s.writeClientCertificate(t)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	s.Server = httptest.NewUnstartedServer(http.HandlerFunc(s.serveHTTP))
+	// Handshakes failing on purpose are no news.
+	s.Config.ErrorLog = log.New(io.Discard, "", 0)
+	s.TLS = &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{server.Raw}, PrivateKey: serverKey, Leaf: server}},
+		ClientCAs:    pool,
+		ClientAuth:   tls.VerifyClientCertIfGiven,
+	}
+	s.StartTLS()
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *testVaultServer) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	switch p := strings.TrimPrefix(req.URL.Path, "/v1/"); {
+	case p == "auth/cert/login":
+		if s.loginStarted != nil {
+			// The server only notices the client going away once the
+			// body is read.
+			_, _ = io.Copy(io.Discard, req.Body)
+			s.loginStarted <- struct{}{}
+			<-req.Context().Done()
+			return
+		}
+		if req.TLS == nil || len(req.TLS.PeerCertificates) == 0 {
+			inMemoryError(w, http.StatusBadRequest, "client certificate must be supplied")
+			return
+		}
+		s.logins.Add(1)
+		s.presented.Store(req.TLS.PeerCertificates[0])
+		inMemoryReply(w, map[string]any{"auth": map[string]any{
+			"client_token":   testVaultToken,
+			"accessor":       "cert-accessor",
+			"policies":       []string{"default", "vsac"},
+			"lease_duration": 3600,
+			"renewable":      false,
+		}})
+	case req.Header.Get("X-Vault-Token") != testVaultToken:
+		inMemoryError(w, http.StatusForbidden, "permission denied")
+	case p == "auth/token/lookup-self":
+		inMemoryData(w, map[string]any{"accessor": "cert-accessor", "ttl": 3600, "policies": []string{"default", "vsac"}})
+	default:
+		if s.inspect != nil {
+			raw, _ := io.ReadAll(req.Body)
+			var body map[string]any
+			_ = json.Unmarshal(raw, &body)
+			s.inspect(p, body)
+			req.Body = io.NopCloser(bytes.NewReader(raw))
+		}
+		s.backend.ServeHTTP(w, req)
+	}
+}
+
+// writeClientCertificate issues a new client certificate, writes it and its
+// key over CertFile and KeyFile, and returns it.
+func (s *testVaultServer) writeClientCertificate(t testing.TB) *x509.Certificate {
+	t.Helper()
+
+	client, clientKey := newTestCertificate(t, s.ca, s.caKey, func(c *x509.Certificate) {
+		c.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	})
+	writePEM(t, filepath.Dir(s.CertFile), filepath.Base(s.CertFile), "CERTIFICATE", client.Raw)
+	writePEM(t, filepath.Dir(s.KeyFile), filepath.Base(s.KeyFile), "EC PRIVATE KEY", marshalECKey(t, clientKey))
+	return client
+}
+
+// vaultConfig returns the configuration of a client logging in to s with its
+// client certificate.
+func (s *testVaultServer) vaultConfig() VaultConfigModel {
+	return VaultConfigModel{
+		Endpoint:   s.URL,
+		CACertFile: &s.CACertFile,
+		AuthLoginCert: &AuthLoginCert{
+			Mount:    "cert",
+			Name:     "vsac",
+			CertFile: s.CertFile,
+			KeyFile:  s.KeyFile,
+		},
+	}
+}
+
+// newTestCertificate returns a certificate signed by parent, self-signed when
+// nil, after template customizes it.
+func newTestCertificate(t testing.TB, parent *x509.Certificate, parentKey *ecdsa.PrivateKey, template func(*x509.Certificate)) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: "vsac-test"},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	template(c)
+	if parent == nil {
+		parent, parentKey = c, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, c, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
+
+func marshalECKey(t testing.TB, key *ecdsa.PrivateKey) []byte {
+	t.Helper()
+
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func writePEM(t testing.TB, dir, name, blockType string, der []byte) string {
+	t.Helper()
+
+	p := filepath.Join(dir, name)
+	if err := os.WriteFile(p, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestNewClientsShareCertLogin(t *testing.T) {
+	s := newTestVaultServer(t)
+
+	data := ProviderModel{}
+	transit, kv, err := newClients(context.Background(), data, s.vaultConfig(), s.vaultConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if transit != kv {
+		t.Fatal("identical cert auth configurations do not share their client")
+	}
+	if n := s.logins.Load(); n != 1 {
+		t.Fatalf("logged in %d times, expected once", n)
+	}
+	if transit.Token() != testVaultToken {
+		t.Fatalf("token %q, expected the one of the login", transit.Token())
+	}
+}
+
+// TestCertLoginConcurrent logs in from several goroutines at once, as the
+// token renewal does alongside the provider, for the race detector.
+func TestCertLoginConcurrent(t *testing.T) {
+	s := newTestVaultServer(t)
+
+	config := s.vaultConfig()
+	config.AuthLoginCert = nil
+	client, err := newClient(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	login := &certLogin{AuthLoginCert: *s.vaultConfig().AuthLoginCert}
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := login.Login(context.Background(), client); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := s.logins.Load(); n != 8 {
+		t.Fatalf("%d logins succeeded, expected 8", n)
+	}
+}
+
+// TestCertLoginRotatedFiles replaces the certificate and key files between
+// two logins: the second one presents the new certificate.
+func TestCertLoginRotatedFiles(t *testing.T) {
+	s := newTestVaultServer(t)
+
+	config := s.vaultConfig()
+	config.AuthLoginCert = nil
+	client, err := newClient(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	login := &certLogin{AuthLoginCert: *s.vaultConfig().AuthLoginCert}
+
+	var presented []*big.Int
+	for range 2 {
+		issued := s.writeClientCertificate(t)
+		if _, err := login.Login(context.Background(), client); err != nil {
+			t.Fatal(err)
+		}
+		got := s.presented.Load()
+		if got == nil || got.SerialNumber.Cmp(issued.SerialNumber) != 0 {
+			t.Fatalf("login %d presented %v, expected the certificate in the files, serial %v", len(presented)+1, got, issued.SerialNumber)
+		}
+		presented = append(presented, got.SerialNumber)
+	}
+	if presented[0].Cmp(presented[1]) == 0 {
+		t.Fatal("both logins presented the same certificate")
+	}
+}
+
+// TestCertLoginLayeredTransport logs in through our layers over the
+// transport, which are kept: the stats still count the login.
+func TestCertLoginLayeredTransport(t *testing.T) {
+	s := newTestVaultServer(t)
+
+	config := s.vaultConfig()
+	config.AuthLoginCert = nil
+	config.stats = newOperationStats("secret", []string{"transit"})
+	client, err := newClient(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	login := &certLogin{AuthLoginCert: *s.vaultConfig().AuthLoginCert}
+	if _, err := login.Login(context.Background(), client); err != nil {
+		t.Fatal(err)
+	}
+	if s.presented.Load() == nil {
+		t.Fatal("the login presented no client certificate")
+	}
+	if n := config.stats.requests.Load(); n != 1 {
+		t.Fatalf("%d requests counted, expected the login", n)
+	}
+}
+
+// opaqueTransport is a transport of someone else's wrapping another one, it
+// cannot be looked through.
+type opaqueTransport struct {
+	base http.RoundTripper
+}
+
+func (t opaqueTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.base.RoundTrip(req)
+}
+
+// TestCertLoginUnknownTransport logs in from a client whose transport is
+// wrapped by another one: the login fails rather than dropping the wrapper.
+func TestCertLoginUnknownTransport(t *testing.T) {
+	s := newTestVaultServer(t)
+
+	cfg := api.DefaultConfig()
+	cfg.Address = s.URL
+	if err := cfg.ConfigureTLS(&api.TLSConfig{CACert: s.CACertFile}); err != nil {
+		t.Fatal(err)
+	}
+	cfg.HttpClient.Transport = opaqueTransport{base: cfg.HttpClient.Transport}
+	client, err := api.NewClient(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	login := &certLogin{AuthLoginCert: *s.vaultConfig().AuthLoginCert}
+	_, err = login.Login(context.Background(), client)
+	if err == nil || !strings.Contains(err.Error(), "transport of type provider.opaqueTransport") {
+		t.Fatalf("login error %v, expected one about the transport", err)
+	}
+	if n := s.logins.Load(); n != 0 {
+		t.Fatalf("%d logins went through", n)
+	}
+}
+
+func TestCertLoginCancel(t *testing.T) {
+	s := newTestVaultServer(t)
+	s.loginStarted = make(chan struct{}, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := newClient(ctx, s.vaultConfig())
+		done <- err
+	}()
+
+	select {
+	case <-s.loginStarted:
+	case <-time.After(10 * time.Second):
+		t.Fatal("the login request never arrived")
+	}
+	cancel()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("login failed with %v, expected the cancellation", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("the login did not return promptly once cancelled")
+	}
+}
+
+// client returns a client of s holding the token of the cert auth logins.
+func (s *testVaultServer) client(t testing.TB) *api.Client {
+	t.Helper()
+
+	config := api.DefaultConfig()
+	config.Address = s.URL
+	if err := config.ConfigureTLS(&api.TLSConfig{CACert: s.CACertFile}); err != nil {
+		t.Fatal(err)
+	}
+	client, err := api.NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SetToken(testVaultToken)
+	return client
+}
+
+// providerVaultConfig returns the provider vault config attribute logging in
+// to s with its client certificate.
+func (s *testVaultServer) providerVaultConfig() map[string]any {
+	return map[string]any{
+		"endpoint":     s.URL,
+		"ca_cert_file": s.CACertFile,
+		"auth_login_cert": map[string]any{
+			"mount":     "cert",
+			"name":      "vsac",
+			"cert_file": s.CertFile,
+			"key_file":  s.KeyFile,
+		},
+	}
+}
+
+// TestProviderCertAuth configures each vault config against its own server,
+// trusted through ca_cert_file and logged in to with auth_login_cert.
+func TestProviderCertAuth(t *testing.T) {
+	transit, kv := newTestVaultServer(t), newTestVaultServer(t)
+
+	p := newTestProvider(t, map[string]any{
+		"test_mode":            nil,
+		"transit_vault_config": transit.providerVaultConfig(),
+		"kv_vault_config":      kv.providerVaultConfig(),
+	})
+	if transit.logins.Load() != 1 || kv.logins.Load() != 1 {
+		t.Fatalf("logged in %d times to transit and %d times to KV, expected once each", transit.logins.Load(), kv.logins.Load())
+	}
+
+	p.apply("secret", nil, map[string]any{
+		"path":              "app/db",
+		"encrypted_secrets": map[string]any{"password": p.encrypt("hunter2")},
+		"values_are_base64": false,
+	})
+
+	s, err := kv.client(t).KVv2("secret").Get(context.Background(), "app/db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Data["password"] != "hunter2" {
+		t.Fatalf("data written to the KV server: %v", s.Data)
+	}
+	if _, err := transit.client(t).KVv2("secret").Get(context.Background(), "app/db"); !errors.Is(err, api.ErrSecretNotFound) {
+		t.Fatalf("the secret was written to the transit server: %v", err)
+	}
+}
+
+func TestProviderCertAuthUntrustedServer(t *testing.T) {
+	s := newTestVaultServer(t)
+
+	config := s.providerVaultConfig()
+	delete(config, "ca_cert_file")
+	_, diags := tryNewTestProvider(t, testProviderConfig(map[string]any{
+		"test_mode":            nil,
+		"transit_vault_config": config,
+		"kv_vault_config":      config,
+		"login_retries":        0,
+	}))
+	requireError(t, diags, "certificate signed by unknown authority")
+}
+
+// baseTransport returns the *http.Transport at the bottom of the layers of
+// rt.
+func baseTransport(t testing.TB, rt http.RoundTripper) *http.Transport {
+	t.Helper()
+
+	for {
+		switch l := rt.(type) {
+		case layeredTransport:
+			rt = l.under()
+		case *http.Transport:
+			return l
+		default:
+			t.Fatalf("unexpected transport %T", rt)
+			return nil
+		}
+	}
+}
+
+// TestNewClientsEnvironment pins down which VAULT_* environment variables
+// apply to each client when only the transit one is configured explicitly:
+// they apply to both, unless an attribute of the client overrides them.
+func TestNewClientsEnvironment(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		inMemoryData(w, map[string]any{})
+	}))
+	t.Cleanup(server.Close)
+
+	ca, _ := newTestCertificate(t, nil, nil, func(c *x509.Certificate) { c.IsCA = true })
+	ns, token, caCertFile := "team-a", "explicit-token", writePEM(t, t.TempDir(), "ca.pem", "CERTIFICATE", ca.Raw)
+	transitConfig := VaultConfigModel{Endpoint: server.URL, Namespace: &ns, Token: &token, CACertFile: &caCertFile}
+	kvConfig := VaultConfigModel{Endpoint: server.URL}
+
+	for _, tc := range []struct {
+		env, value string
+		// check returns the setting of client the variable drives.
+		check       func(t *testing.T, client *api.Client) any
+		transit, kv any
+	}{
+		{
+			env: "VAULT_CLIENT_TIMEOUT", value: "42",
+			check:   func(t *testing.T, c *api.Client) any { return c.ClientTimeout() },
+			transit: 42 * time.Second, kv: 42 * time.Second,
+		},
+		{
+			env: "VAULT_MAX_RETRIES", value: "7",
+			check:   func(t *testing.T, c *api.Client) any { return c.MaxRetries() },
+			transit: 7, kv: 7,
+		},
+		{
+			env: "VAULT_SKIP_VERIFY", value: "true",
+			check: func(t *testing.T, c *api.Client) any {
+				return baseTransport(t, c.CloneConfig().HttpClient.Transport).TLSClientConfig.InsecureSkipVerify
+			},
+			transit: true, kv: true,
+		},
+		{
+			env: "VAULT_TLS_SERVER_NAME", value: "vault.internal",
+			check: func(t *testing.T, c *api.Client) any {
+				return baseTransport(t, c.CloneConfig().HttpClient.Transport).TLSClientConfig.ServerName
+			},
+			transit: "vault.internal", kv: "vault.internal",
+		},
+		{
+			env: "VAULT_RATE_LIMIT", value: "5",
+			check:   func(t *testing.T, c *api.Client) any { return float64(c.CloneConfig().Limiter.Limit()) },
+			transit: 5.0, kv: 5.0,
+		},
+		{
+			env: "VAULT_NAMESPACE", value: "env-ns",
+			check:   func(t *testing.T, c *api.Client) any { return c.Namespace() },
+			transit: "team-a", kv: "env-ns",
+		},
+		{
+			env: "VAULT_TOKEN", value: "env-token",
+			check:   func(t *testing.T, c *api.Client) any { return c.Token() },
+			transit: "explicit-token", kv: "env-token",
+		},
+	} {
+		t.Run(tc.env, func(t *testing.T) {
+			t.Setenv(tc.env, tc.value)
+
+			transit, kv, err := newClients(context.Background(), ProviderModel{}, transitConfig, kvConfig)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := tc.check(t, transit); got != tc.transit {
+				t.Errorf("transit client: %v, expected %v", got, tc.transit)
+			}
+			if got := tc.check(t, kv); got != tc.kv {
+				t.Errorf("KV client: %v, expected %v", got, tc.kv)
+			}
+		})
+	}
+}
+
+// TestSharedClientsConcurrent runs KV writes and reads, encryptions and
+// decryptions from several goroutines on one shared client, alongside
+// namespaced copies of it, for the race detector: the shared client must come
+// out as it was configured.
+func TestSharedClientsConcurrent(t *testing.T) {
+	ctx := context.Background()
+	client, err := newInMemoryClient("transit/", "secret", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.SetNamespace("team-a")
+
+	kv := vaultKV{
+		client:         client,
+		path:           "secret",
+		managedBy:      "test",
+		ownershipKey:   defaultOwnershipKey,
+		maxSecretBytes: defaultMaxSecretBytes,
+	}
+	transit := vaultTransit{
+		client:                client,
+		path:                  "transit/",
+		key:                   "vsac",
+		decryptedWith:         &sync.Map{},
+		minDecryptionVersions: &sync.Map{},
+	}
+
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			k := fmt.Sprintf("app/%d", i)
+			ciphertext, err := transit.Encrypt(ctx, k)
+			if err != nil {
+				t.Errorf("%s: encrypt: %s", k, err)
+				return
+			}
+			plaintext, err := transit.Decrypt(ctx, ciphertext)
+			if err != nil {
+				t.Errorf("%s: decrypt: %s", k, err)
+				return
+			}
+			if _, err := kv.Put(ctx, k, map[string]any{"password": plaintext.reveal()}, nil); err != nil {
+				t.Errorf("%s: put: %s", k, err)
+			}
+			if _, err := kv.GetSubkeys(ctx, k, 0); err != nil {
+				t.Errorf("%s: subkeys: %s", k, err)
+			}
+
+			// What another namespace needs goes through a copy.
+			copied := client.WithNamespace(fmt.Sprintf("team-%d", i))
+			if _, err := copied.KVv2("secret").Get(ctx, k); err != nil {
+				t.Errorf("%s: namespaced copy: %s", k, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if ns := client.Namespace(); ns != "team-a" {
+		t.Fatalf("namespace of the shared client %q, expected %q", ns, "team-a")
+	}
+}
@@ -0,0 +1,253 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/hashicorp/terraform-plugin-framework/diag"
+	"github.com/hashicorp/terraform-plugin-framework/path"
+	"github.com/hashicorp/terraform-plugin-framework/resource"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/int64planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/planmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringdefault"
+	"github.com/hashicorp/terraform-plugin-framework/resource/schema/stringplanmodifier"
+	"github.com/hashicorp/terraform-plugin-framework/schema/validator"
+	"github.com/hashicorp/terraform-plugin-framework/types"
+	"github.com/hashicorp/vault/api"
+)
+
+// Ensure provider defined types fully satisfy framework interfaces.
+var (
+	_ resource.Resource               = &WrappedShareResource{}
+	_ resource.ResourceWithModifyPlan = &WrappedShareResource{}
+)
+
+// defaultWrapTTL leaves a day to hand the token over.
+const defaultWrapTTL = "24h"
+
+func NewWrappedShareResource() resource.Resource {
+	return &WrappedShareResource{}
+}
+
+// WrappedShareResource hands a managed secret over through a single-use
+// response wrapping token, instead of its values.
+type WrappedShareResource struct {
+	ProviderData
+}
+
+// WrappedShareModel describes the resource data model.
+type WrappedShareModel struct {
+	Path      types.String `tfsdk:"path"`
+	WrapTTL   types.String `tfsdk:"wrap_ttl"`
+	Trigger   types.Map    `tfsdk:"trigger"`
+	Token     types.String `tfsdk:"token"`
+	Accessor  types.String `tfsdk:"accessor"`
+	Version   types.Int64  `tfsdk:"version"`
+	ExpiresAt types.String `tfsdk:"expires_at"`
+}
+
+func (r *WrappedShareResource) Metadata(ctx context.Context, req resource.MetadataRequest, resp *resource.MetadataResponse) {
+	resp.TypeName = req.ProviderTypeName + "_wrapped_share"
+}
+
+func (r *WrappedShareResource) Schema(ctx context.Context, req resource.SchemaRequest, resp *resource.SchemaResponse) {
+	resp.Schema = schema.Schema{
+		MarkdownDescription: "Single-use response wrapping token holding the latest version of a managed secret, to hand it over to a person without pasting its values anywhere: `vault unwrap <token>` returns them once. " +
+			"The token is wrapped again only when `trigger` or `wrap_ttl` changes. Vault is not called on refresh, an expired or unwrapped token is no drift. Destroying the resource only forgets the token.",
+		Attributes: map[string]schema.Attribute{
+			"path": schema.StringAttribute{
+				Required:      true,
+				Description:   "Path of the secret, relative to `path_prefix`. It must be managed by this configuration",
+				PlanModifiers: []planmodifier.String{stringplanmodifier.RequiresReplace()},
+			},
+			"wrap_ttl": schema.StringAttribute{
+				Optional:    true,
+				Computed:    true,
+				Default:     stringdefault.StaticString(defaultWrapTTL),
+				Description: fmt.Sprintf("How long the token can be unwrapped, e.g. \"30m\", defaults to %q. Vault caps it with the max TTL of the mount of sys/wrapping", defaultWrapTTL),
+				Validators:  []validator.String{durationValidator{}},
+			},
+			"trigger": schema.MapAttribute{
+				Optional:    true,
+				ElementType: types.StringType,
+				Description: "Arbitrary values whose change wraps the secret again, e.g. the recipient or a date",
+			},
+			"token": schema.StringAttribute{
+				Computed:      true,
+				Sensitive:     true,
+				Description:   "Response wrapping token, single-use",
+				PlanModifiers: []planmodifier.String{stringplanmodifier.UseStateForUnknown()},
+			},
+			"accessor": schema.StringAttribute{
+				Computed:      true,
+				Description:   "Accessor of the token, e.g. to look it up without using it",
+				PlanModifiers: []planmodifier.String{stringplanmodifier.UseStateForUnknown()},
+			},
+			"version": schema.Int64Attribute{
+				Computed:      true,
+				Description:   "Version of the secret that was wrapped",
+				PlanModifiers: []planmodifier.Int64{int64planmodifier.UseStateForUnknown()},
+			},
+			"expires_at": schema.StringAttribute{
+				Computed:      true,
+				Description:   "When the token expires, RFC 3339",
+				PlanModifiers: []planmodifier.String{stringplanmodifier.UseStateForUnknown()},
+			},
+		},
+	}
+}
+
+func (r *WrappedShareResource) Configure(ctx context.Context, req resource.ConfigureRequest, resp *resource.ConfigureResponse) {
+	// Prevent panic if the provider has not been configured.
+	if req.ProviderData == nil {
+		return
+	}
+
+	providerData, ok := req.ProviderData.(ProviderData)
+	if !ok {
+		resp.Diagnostics.AddError(
+			"Unexpected Resource Configure Type",
+			fmt.Sprintf("Expected ProviderData, got: %T. Please report this issue to the provider developers.", req.ProviderData),
+		)
+		return
+	}
+
+	r.ProviderData = providerData
+}
+
+// Wrap returns the wrapping token of data, held by Vault in a cubbyhole for
+// ttl. The client is used through a copy, the shared one is not modified.
+func (v vaultKV) Wrap(ctx context.Context, data map[string]any, ttl string) (_ *api.SecretWrapInfo, err error) {
+	ctx, wrap := traceCall(ctx, v.client, "wrap", "sys/wrapping")
+	defer func() { err = wrap(err) }()
+
+	client := v.client.WithRequestCallbacks(func(req *api.Request) {
+		req.WrapTTL = ttl
+	})
+	s, err := client.Logical().WriteWithContext(ctx, "sys/wrapping/wrap", data)
+	if err != nil {
+		return nil, err
+	}
+	if s == nil || s.WrapInfo == nil || s.WrapInfo.Token == "" {
+		return nil, errors.New("vault did not wrap the response")
+	}
+	return s.WrapInfo, nil
+}
+
+// share wraps the latest version of the secret of data, which must be ours.
+func (r *WrappedShareResource) share(ctx context.Context, data *WrappedShareModel, diags *diag.Diagnostics) error {
+	k := r.kv.secretPath(data.Path.ValueString())
+	if err := r.kv.checkNotDenied(k); err != nil {
+		return err
+	}
+
+	secret, err := r.kv.client.KVv2(r.kv.path).Get(ctx, k)
+	if errors.Is(err, api.ErrSecretNotFound) {
+		return fmt.Errorf("%s does not exist or its latest version is deleted", r.kv.fullPath(k))
+	} else if err != nil {
+		return err
+	}
+	if err := r.kv.checkOwnership(k, secret.CustomMetadata); err != nil {
+		return err
+	}
+
+	info, err := r.kv.Wrap(ctx, secret.Data, data.WrapTTL.ValueString())
+	if err != nil {
+		return err
+	}
+	version := secret.VersionMetadata.Version
+	r.kv.audit(ctx, "share", r.kv.fullPath(k), slices.Collect(maps.Keys(secret.Data)), version, diags)
+
+	data.Token = types.StringValue(info.Token)
+	data.Accessor = types.StringValue(info.Accessor)
+	data.Version = types.Int64Value(int64(version))
+	data.ExpiresAt = types.StringValue(info.CreationTime.Add(time.Duration(info.TTL) * time.Second).UTC().Format(time.RFC3339))
+	return nil
+}
+
+func (r *WrappedShareResource) ModifyPlan(ctx context.Context, req resource.ModifyPlanRequest, resp *resource.ModifyPlanResponse) {
+	// Nothing to check on destroy, or before the provider is configured.
+	if req.Plan.Raw.IsNull() || r.kv.client == nil {
+		return
+	}
+
+	var plan WrappedShareModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if !plan.Path.IsUnknown() {
+		r.kv.checkPathAllowed(r.kv.secretPath(plan.Path.ValueString()), path.Root("path"), &resp.Diagnostics)
+	}
+
+	if req.State.Raw.IsNull() {
+		return
+	}
+
+	var state WrappedShareModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &state)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if !plan.Trigger.Equal(state.Trigger) || !plan.WrapTTL.Equal(state.WrapTTL) {
+		for _, attr := range []string{"token", "accessor", "expires_at"} {
+			resp.Diagnostics.Append(resp.Plan.SetAttribute(ctx, path.Root(attr), types.StringUnknown())...)
+		}
+		resp.Diagnostics.Append(resp.Plan.SetAttribute(ctx, path.Root("version"), types.Int64Unknown())...)
+	}
+}
+
+func (r *WrappedShareResource) Create(ctx context.Context, req resource.CreateRequest, resp *resource.CreateResponse) {
+	var data WrappedShareModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if err := r.share(ctx, &data, &resp.Diagnostics); err != nil {
+		resp.Diagnostics.AddError("failed to wrap secret", errorDetail(err))
+		return
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+// Read keeps the state as is: the token is single-use and expires, looking it
+// up would only report drift nothing can fix but a new trigger.
+func (r *WrappedShareResource) Read(ctx context.Context, req resource.ReadRequest, resp *resource.ReadResponse) {
+	var data WrappedShareModel
+	resp.Diagnostics.Append(req.State.Get(ctx, &data)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &data)...)
+}
+
+func (r *WrappedShareResource) Update(ctx context.Context, req resource.UpdateRequest, resp *resource.UpdateResponse) {
+	var plan WrappedShareModel
+	resp.Diagnostics.Append(req.Plan.Get(ctx, &plan)...)
+	if resp.Diagnostics.HasError() {
+		return
+	}
+
+	if plan.Token.IsUnknown() {
+		if err := r.share(ctx, &plan, &resp.Diagnostics); err != nil {
+			resp.Diagnostics.AddError("failed to wrap secret", errorDetail(err))
+			return
+		}
+	}
+
+	resp.Diagnostics.Append(resp.State.Set(ctx, &plan)...)
+}
+
+// Delete only forgets the token, it expires on its own.
+func (r *WrappedShareResource) Delete(ctx context.Context, req resource.DeleteRequest, resp *resource.DeleteResponse) {
+}